@@ -0,0 +1,68 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Alignment determines where thumbnails that don't fill their tile (see
+// KeepAspectRatio) are placed along one axis of the tile, leaving the bars
+// on the other side.
+type Alignment int
+
+const (
+	// AlignCenter centers the thumbnail in the tile, with bars on both
+	// sides.
+	AlignCenter Alignment = iota
+
+	// AlignStart places the thumbnail at the left (or at the top) of the
+	// tile.
+	AlignStart
+
+	// AlignEnd places the thumbnail at the right (or at the bottom) of
+	// the tile.
+	AlignEnd
+)
+
+// ErrInvalidAlignment is returned when the alignment is unknown.
+var ErrInvalidAlignment = errors.New("invalid alignment")
+
+var alignmentNames = map[Alignment]string{
+	AlignCenter: "center",
+	AlignStart:  "start",
+	AlignEnd:    "end",
+}
+
+// String returns the name of the alignment.
+func (a Alignment) String() string {
+	if name, ok := alignmentNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Alignment(%d)", int(a))
+}
+
+// valid reports whether the alignment is known.
+func (a Alignment) valid() bool {
+	_, ok := alignmentNames[a]
+	return ok
+}
+
+// offset returns the offset of a thumbnail that leaves the given free space
+// along one axis of its tile.
+func (a Alignment) offset(free int) int {
+	if free <= 0 {
+		return 0
+	}
+	switch a {
+	case AlignStart:
+		return 0
+	case AlignEnd:
+		return free
+	default:
+		return free / 2
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestAlignmentOffset(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		alignment Alignment
+		free      int
+		expected  int
+	}{
+		{AlignCenter, 110, 55},
+		{AlignStart, 110, 0},
+		{AlignEnd, 110, 110},
+		{AlignEnd, 0, 0},
+		{AlignCenter, -4, 0},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.alignment.String(), func(t *testing.T) {
+			t.Parallel()
+			if got := test.alignment.offset(test.free); got != test.expected {
+				t.Errorf("wrong offset for %d free pixels\nwant %d\ngot  %d", test.free, test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteAlignment(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name         string
+		source       image.Point
+		width        uint
+		height       uint
+		alignX       Alignment
+		alignY       Alignment
+		expectedRect image.Rectangle
+	}{
+		{
+			name:         "portrait source, left",
+			source:       image.Pt(90, 160),
+			width:        160,
+			height:       90,
+			alignX:       AlignStart,
+			expectedRect: image.Rect(0, 0, 50, 90),
+		},
+		{
+			name:         "portrait source, right",
+			source:       image.Pt(90, 160),
+			width:        160,
+			height:       90,
+			alignX:       AlignEnd,
+			expectedRect: image.Rect(110, 0, 160, 90),
+		},
+		{
+			name:         "landscape source, top",
+			source:       image.Pt(160, 90),
+			width:        90,
+			height:       160,
+			alignY:       AlignStart,
+			expectedRect: image.Rect(0, 0, 90, 50),
+		},
+		{
+			name:         "landscape source, bottom",
+			source:       image.Pt(160, 90),
+			width:        90,
+			height:       160,
+			alignY:       AlignEnd,
+			expectedRect: image.Rect(0, 110, 90, 160),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := startSourcePackager(test.source)
+			defer server.Close()
+			generator := Generator{
+				Translator: func(string) (string, error) { return server.URL, nil },
+			}
+			data, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL:        "/video.mp4",
+				Width:           test.width,
+				Height:          test.height,
+				KeepAspectRatio: true,
+				AlignX:          test.alignX,
+				AlignY:          test.alignY,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sprite, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// sample pixels a few pixels inside the thumbnail and inside
+			// the bar, avoiding JPEG artifacts.
+			r := test.expectedRect
+			if y := luminance(sprite, image.Pt(r.Min.X+2, r.Min.Y+2)); y < 100 {
+				t.Errorf("expected thumbnail at %v, got luminance %d", r.Min, y)
+			}
+			if y := luminance(sprite, image.Pt(r.Max.X-3, r.Max.Y-3)); y < 100 {
+				t.Errorf("expected thumbnail at %v, got luminance %d", r.Max, y)
+			}
+			bar := image.Pt(2, 2)
+			if r.Max.X < int(test.width) {
+				bar.X = r.Max.X + 2
+			}
+			if r.Max.Y < int(test.height) {
+				bar.Y = r.Max.Y + 2
+			}
+			if y := luminance(sprite, bar); y > 30 {
+				t.Errorf("expected bar at %v, got luminance %d", bar, y)
+			}
+		})
+	}
+}
+
+func TestGenSpriteInvalidAlignment(t *testing.T) {
+	t.Parallel()
+	var generator Generator
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		Width:           160,
+		Height:          90,
+		KeepAspectRatio: true,
+		AlignY:          Alignment(42),
+	})
+	if !errors.Is(err, ErrInvalidAlignment) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidAlignment, err)
+	}
+}
+
+func luminance(img image.Image, p image.Point) uint8 {
+	return color.GrayModel.Convert(img.At(p.X, p.Y)).(color.Gray).Y
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// ErrInvalidArrangement is returned when an Arrangement doesn't place each
+// tile in its own cell within the grid, or when it's combined with Columns
+// or Rows.
+var ErrInvalidArrangement = errors.New("invalid arrangement: tiles must be placed in distinct cells of the grid, without Columns or Rows")
+
+// Arrangement places the tiles of a sprite in a grid of cells, replacing the
+// default grid with a fixed number of columns (see
+// GenSpriteOptions.Arrangement).
+type Arrangement interface {
+	// Arrange returns the cell (column and row) of each of the n tiles,
+	// in chronological order, along with the number of columns and rows
+	// of the grid. tileWidth and tileHeight are the dimensions of the
+	// tiles, or zero when they're derived from the source, and thus
+	// unknown before the thumbnails are fetched.
+	Arrange(n, tileWidth, tileHeight int) (cells []image.Point, columns, rows int)
+}
+
+// ArrangementFunc is a function that implements Arrangement.
+type ArrangementFunc func(n, tileWidth, tileHeight int) ([]image.Point, int, int)
+
+// Arrange invokes f.
+func (f ArrangementFunc) Arrange(n, tileWidth, tileHeight int) ([]image.Point, int, int) {
+	return f(n, tileWidth, tileHeight)
+}
+
+// FixedColumns returns an Arrangement that fills a grid with the given
+// number of columns row by row, like GenSpriteOptions.Columns.
+func FixedColumns(columns uint) Arrangement {
+	if columns == 0 {
+		columns = 1
+	}
+	return ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+		return rowMajor(newGrid(n, columns), n)
+	})
+}
+
+// VerticalStrip places all tiles in a single column.
+var VerticalStrip = FixedColumns(1)
+
+// HorizontalStrip places all tiles in a single row.
+var HorizontalStrip = ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+	return rowMajor(grid{columns: n, rows: 1}, n)
+})
+
+// NearSquare fills, row by row, the grid whose canvas is the closest to a
+// square, taking the aspect ratio of the tiles into account when it's known.
+var NearSquare = ArrangementFunc(func(n, tileWidth, tileHeight int) ([]image.Point, int, int) {
+	ratio := 1.0
+	if tileWidth > 0 && tileHeight > 0 {
+		ratio = float64(tileHeight) / float64(tileWidth)
+	}
+	columns := uint(math.Ceil(math.Sqrt(float64(n) * ratio)))
+	if columns == 0 {
+		columns = 1
+	}
+	return rowMajor(newGrid(n, columns), n)
+})
+
+func rowMajor(g grid, n int) ([]image.Point, int, int) {
+	cells := make([]image.Point, n)
+	for i := range cells {
+		cells[i].X, cells[i].Y = g.position(i)
+	}
+	return cells, g.columns, g.rows
+}
+
+// grid returns the grid of a sprite with n tiles, using the Arrangement in
+// the options, when set.
+func (o *GenSpriteOptions) grid(n int) (grid, error) {
+	if o.Arrangement == nil {
+		g := newGrid(n, o.Columns)
+		g.rtl = o.rightToLeft()
+		return g, nil
+	}
+	tileWidth, tileHeight := o.tileSize()
+	cells, columns, rows := o.Arrangement.Arrange(n, tileWidth, tileHeight)
+	if len(cells) != n || (n > 0 && (columns <= 0 || rows <= 0)) {
+		return grid{}, ErrInvalidArrangement
+	}
+	seen := make(map[image.Point]bool, n)
+	for _, cell := range cells {
+		if cell.X < 0 || cell.X >= columns || cell.Y < 0 || cell.Y >= rows || seen[cell] {
+			return grid{}, ErrInvalidArrangement
+		}
+		seen[cell] = true
+	}
+	return grid{columns: columns, rows: rows, rtl: o.rightToLeft(), cells: cells}, nil
+}
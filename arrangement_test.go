@@ -0,0 +1,175 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// zigZag fills rows alternating between left to right and right to left.
+var zigZag = ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+	const columns = 3
+	cells := make([]image.Point, n)
+	for i := range cells {
+		x, y := i%columns, i/columns
+		if y%2 == 1 {
+			x = columns - 1 - x
+		}
+		cells[i] = image.Pt(x, y)
+	}
+	return cells, columns, (n + columns - 1) / columns
+})
+
+func TestArrangements(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name            string
+		arrangement     Arrangement
+		n               int
+		tileWidth       int
+		tileHeight      int
+		expectedCells   []image.Point
+		expectedColumns int
+		expectedRows    int
+	}{
+		{
+			"vertical strip",
+			VerticalStrip,
+			3, 160, 90,
+			[]image.Point{{0, 0}, {0, 1}, {0, 2}},
+			1, 3,
+		},
+		{
+			"horizontal strip",
+			HorizontalStrip,
+			3, 160, 90,
+			[]image.Point{{0, 0}, {1, 0}, {2, 0}},
+			3, 1,
+		},
+		{
+			"fixed columns",
+			FixedColumns(2),
+			5, 160, 90,
+			[]image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}},
+			2, 3,
+		},
+		{
+			"near square, unknown dimensions",
+			NearSquare,
+			9, 0, 0,
+			[]image.Point{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}, {2, 1}, {0, 2}, {1, 2}, {2, 2}},
+			3, 3,
+		},
+		{
+			"near square, wide tiles",
+			NearSquare,
+			8, 200, 100,
+			[]image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}, {1, 2}, {0, 3}, {1, 3}},
+			2, 4,
+		},
+		{
+			"zig-zag",
+			zigZag,
+			5, 160, 90,
+			[]image.Point{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {1, 1}},
+			3, 2,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			cells, columns, rows := test.arrangement.Arrange(test.n, test.tileWidth, test.tileHeight)
+			if !reflect.DeepEqual(cells, test.expectedCells) {
+				t.Errorf("wrong cells\nwant %v\ngot  %v", test.expectedCells, cells)
+			}
+			if columns != test.expectedColumns || rows != test.expectedRows {
+				t.Errorf("wrong grid\nwant %dx%d\ngot  %dx%d", test.expectedColumns, test.expectedRows, columns, rows)
+			}
+		})
+	}
+}
+
+func TestGenSpriteArrangement(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         8 * time.Second,
+		Interval:    2 * time.Second,
+		Height:      72,
+		Arrangement: zigZag,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := image.Pt(3*result.TileWidth, 2*result.TileHeight); result.Width != expected.X || result.Height != expected.Y {
+		t.Errorf("wrong sprite size\nwant %v\ngot  %dx%d", expected, result.Width, result.Height)
+	}
+	expectedCells, _, _ := zigZag(len(result.Tiles), 0, 0)
+	for i, tile := range result.Tiles {
+		cell := image.Pt(tile.X/tile.Width, tile.Y/tile.Height)
+		if cell != expectedCells[i] {
+			t.Errorf("wrong cell for tile %d\nwant %v\ngot  %v", i, expectedCells[i], cell)
+		}
+	}
+}
+
+func TestGenSpriteInvalidArrangement(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name string
+		opts GenSpriteOptions
+	}{
+		{
+			"missing cells",
+			GenSpriteOptions{Arrangement: ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+				return make([]image.Point, n-1), 1, n
+			})},
+		},
+		{
+			"overlapping cells",
+			GenSpriteOptions{Arrangement: ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+				return make([]image.Point, n), 1, n
+			})},
+		},
+		{
+			"cell out of the grid",
+			GenSpriteOptions{Arrangement: ArrangementFunc(func(n, _, _ int) ([]image.Point, int, int) {
+				cells, _, _ := VerticalStrip.Arrange(n, 0, 0)
+				return cells, 1, n - 1
+			})},
+		},
+		{
+			"with columns",
+			GenSpriteOptions{Arrangement: NearSquare, Columns: 2},
+		},
+		{
+			"with rows",
+			GenSpriteOptions{Arrangement: NearSquare, Rows: 2},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			generator := Generator{Translator: func(string) (string, error) { return "http://packager", nil }}
+			opts := test.opts
+			opts.VideoURL = "/video.mp4"
+			opts.End = 8 * time.Second
+			opts.Interval = 2 * time.Second
+			_, err := generator.GenSprite(opts)
+			if !errors.Is(err, ErrInvalidArrangement) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidArrangement, err)
+			}
+		})
+	}
+}
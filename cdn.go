@@ -0,0 +1,64 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ImageCDNRequestBuilder is a RequestBuilder for deployments where
+// thumbnails are pre-extracted stills served through an image CDN with a
+// URL-based transform API (imgix-style query string parameters), instead of
+// being captured by nginx-vod-module.
+//
+// The layout of the sprite, the metadata and the VTT are generated just like
+// with nginx-vod-module.
+type ImageCDNRequestBuilder struct {
+	// StillURL returns the URL of the still for the given timecode, where
+	// prefix is the value returned by the translator of the Generator.
+	// It's required.
+	StillURL func(prefix string, timecode time.Duration) string
+
+	// WidthParam and HeightParam are the names of the query string
+	// parameters used for resizing the stills. They default to "w" and
+	// "h".
+	WidthParam  string
+	HeightParam string
+
+	// Params are additional query string parameters sent in every
+	// request (e.g. fm=jpg to ensure the CDN responds with JPEGs).
+	Params url.Values
+}
+
+// BuildRequest builds a GET request for the still of the given thumbnail.
+func (b *ImageCDNRequestBuilder) BuildRequest(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error) {
+	u, err := url.Parse(b.StillURL(thumb.Prefix, thumb.Timecode))
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	for name, values := range b.Params {
+		query[name] = append(query[name], values...)
+	}
+	if thumb.Width > 0 {
+		query.Set(stringOrDefault(b.WidthParam, "w"), strconv.FormatUint(uint64(thumb.Width), 10))
+	}
+	if thumb.Height > 0 {
+		query.Set(stringOrDefault(b.HeightParam, "h"), strconv.FormatUint(uint64(thumb.Height), 10))
+	}
+	u.RawQuery = query.Encode()
+	return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+}
+
+func stringOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
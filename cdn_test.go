@@ -0,0 +1,162 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestImageCDNRequestBuilder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		builder  ImageCDNRequestBuilder
+		thumb    ThumbnailRequest
+		expected string
+	}{
+		{
+			"default params",
+			ImageCDNRequestBuilder{},
+			ThumbnailRequest{Prefix: "https://stills.example.com/video1", Timecode: 2 * time.Second, Width: 128, Height: 72},
+			"https://stills.example.com/video1/2000.jpg?h=72&w=128",
+		},
+		{
+			"custom params",
+			ImageCDNRequestBuilder{
+				WidthParam:  "width",
+				HeightParam: "height",
+				Params:      url.Values{"fm": {"jpg"}},
+			},
+			ThumbnailRequest{Prefix: "https://stills.example.com/video1", Timecode: 4 * time.Second, Height: 72},
+			"https://stills.example.com/video1/4000.jpg?fm=jpg&height=72",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			test.builder.StillURL = func(prefix string, timecode time.Duration) string {
+				return fmt.Sprintf("%s/%d.jpg", prefix, timecode/time.Millisecond)
+			}
+			req, err := test.builder.BuildRequest(context.Background(), test.thumb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u := req.URL.String(); u != test.expected {
+				t.Errorf("wrong URL\nwant %s\ngot  %s", test.expected, u)
+			}
+		})
+	}
+}
+
+func TestGenSpriteImageCDN(t *testing.T) {
+	t.Parallel()
+	var packager fakePackager
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timecode, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(r.URL.Path), ".jpg"), 10, 64)
+		fileName := packager.fileName(timecode)
+		if fileName == "" || r.URL.Query().Get("h") != "72" {
+			http.Error(w, "invalid still", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", fileName))
+	}))
+	defer server.Close()
+	generator := Generator{
+		Translator: func(videoURL string) (string, error) {
+			return server.URL + "/stills/" + videoURL, nil
+		},
+		RequestBuilder: &ImageCDNRequestBuilder{
+			StillURL: func(prefix string, timecode time.Duration) string {
+				return fmt.Sprintf("%s/%d.jpg", prefix, timecode/time.Millisecond)
+			},
+		},
+		MaxWorkers: 4,
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "video1",
+		End:      6 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  2,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tiles) != 4 || result.Width != 254 || result.Height != 144 {
+		t.Errorf("wrong sprite generated: %dx%d with %d tiles", result.Width, result.Height, len(result.Tiles))
+	}
+}
+
+func TestGenSpriteImageCDNScalingMode(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		opts     GenSpriteOptions
+		expected string
+	}{
+		{
+			name:     "letterbox",
+			opts:     GenSpriteOptions{Width: 160, Height: 72, KeepAspectRatio: true},
+			expected: "h=72",
+		},
+		{
+			name:     "source",
+			opts:     GenSpriteOptions{Width: 160, Height: 90, ScalingMode: ScaleSource},
+			expected: "",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			var queries []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				queries = append(queries, r.URL.RawQuery)
+				mu.Unlock()
+				img := image.NewRGBA(image.Rect(0, 0, 160, 90))
+				fill(img, color.Gray{Y: 128})
+				jpeg.Encode(w, img, nil)
+			}))
+			defer server.Close()
+			generator := Generator{
+				Translator: func(string) (string, error) { return server.URL, nil },
+				RequestBuilder: &ImageCDNRequestBuilder{
+					StillURL: func(prefix string, timecode time.Duration) string {
+						return fmt.Sprintf("%s/%d.jpg", prefix, timecode/time.Millisecond)
+					},
+				},
+			}
+			opts := test.opts
+			opts.VideoURL = "video1"
+			opts.End = 2 * time.Second
+			opts.Interval = 2 * time.Second
+			opts.Columns = 2
+			if _, err := generator.GenSpriteWithMetadata(opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, query := range queries {
+				if query != test.expected {
+					t.Errorf("wrong query string\nwant %q\ngot  %q", test.expected, query)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when the checksum of a thumbnail doesn't
+// match the one declared by the server. See Generator.ChecksumHeader.
+var ErrChecksumMismatch = errors.New("thumbnail checksum mismatch")
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// verifyChecksum verifies the given data against the checksum in the given
+// header, returning ErrChecksumMismatch when they don't match.
+//
+// Content-MD5 holds the base64-encoded MD5 of the data. Any other header is
+// expected to hold a list of algorithm=checksum pairs, as in the Digest
+// header (e.g. "sha-256=<base64>"), with checksums encoded in base64 or in
+// hex. Missing headers and unsupported algorithms are ignored.
+func verifyChecksum(header http.Header, name string, data []byte) error {
+	value := header.Get(name)
+	if value == "" {
+		return nil
+	}
+	if http.CanonicalHeaderKey(name) == "Content-Md5" {
+		return compareChecksum(md5.New, value, data)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if newHash, ok := checksumAlgorithms[strings.ToLower(parts[0])]; ok {
+			return compareChecksum(newHash, parts[1], data)
+		}
+	}
+	return nil
+}
+
+func compareChecksum(newHash func() hash.Hash, expected string, data []byte) error {
+	h := newHash()
+	h.Write(data)
+	sum := h.Sum(nil)
+	if decoded, err := base64.StdEncoding.DecodeString(expected); err == nil && bytes.Equal(decoded, sum) {
+		return nil
+	}
+	if decoded, err := hex.DecodeString(expected); err == nil && bytes.Equal(decoded, sum) {
+		return nil
+	}
+	return ErrChecksumMismatch
+}
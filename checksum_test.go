@@ -0,0 +1,72 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	t.Parallel()
+	data := []byte("hello world")
+	tests := []struct {
+		name     string
+		header   http.Header
+		hname    string
+		expected error
+	}{
+		{"missing header", http.Header{}, "Digest", nil},
+		{"content-md5", http.Header{"Content-Md5": {"XrY7u+Ae7tCTyyK7j1rNww=="}}, "content-md5", nil},
+		{"content-md5 mismatch", http.Header{"Content-Md5": {"AAY7u+Ae7tCTyyK7j1rNww=="}}, "Content-MD5", ErrChecksumMismatch},
+		{"digest sha-256", http.Header{"Digest": {"sha-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="}}, "Digest", nil},
+		{"digest sha-256 mismatch", http.Header{"Digest": {"SHA-256=AA0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="}}, "Digest", ErrChecksumMismatch},
+		{"hex md5", http.Header{"X-Checksum": {"md5=5eb63bbbe01eeed093cb22bb8f5acdc3"}}, "X-Checksum", nil},
+		{"multiple algorithms", http.Header{"Digest": {"unixsum=123, md5=XrY7u+Ae7tCTyyK7j1rNww=="}}, "Digest", nil},
+		{"unsupported algorithm", http.Header{"Digest": {"unixsum=123"}}, "Digest", nil},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			err := verifyChecksum(test.header, test.hname, data)
+			if err != test.expected {
+				t.Errorf("wrong error returned\nwant %v\ngot  %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestGenSpriteChecksum(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		digest   string
+		expected error
+	}{
+		{"valid", nil},
+		{"invalid", ErrChecksumMismatch},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.digest, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.digest = test.digest
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4, ChecksumHeader: "Digest"}
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:      4 * time.Second,
+				Interval: 2 * time.Second,
+				Height:   72,
+			})
+			if !errors.Is(err, test.expected) {
+				t.Errorf("wrong error returned\nwant %v\ngot  %v", test.expected, err)
+			}
+		})
+	}
+}
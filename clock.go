@@ -0,0 +1,23 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import "time"
+
+// Clock is the source of the current time used for time-based decisions,
+// such as the freshness of thumbnails and the expiration of cached lookups,
+// so they can be tested deterministically by simulating time.
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the current time according to the given clock, falling back to
+// the system clock when it's nil.
+func now(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
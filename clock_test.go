@@ -0,0 +1,87 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestGenSpriteClock(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.cacheControl = map[int64]string{
+		0:    "max-age=3600",
+		2000: "max-age=60",
+	}
+	clock := &fakeClock{now: time.Date(2018, 5, 26, 12, 0, 0, 0, time.UTC)}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 2, Clock: clock}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      2 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := clock.Now().Add(time.Minute)
+	if result.Expires == nil || !result.Expires.Equal(expected) {
+		t.Errorf("wrong Expires\nwant %v\ngot  %v", expected, result.Expires)
+	}
+}
+
+func TestMappingTranslatorClock(t *testing.T) {
+	t.Parallel()
+	var requests int64
+	server := startFakeMappingService(&requests)
+	defer server.Close()
+	clock := &fakeClock{now: time.Date(2018, 5, 26, 12, 0, 0, 0, time.UTC)}
+	translator := MappingTranslator{
+		MappingEndpoint: server.URL + "/",
+		ThumbEndpoint:   "http://packager/thumb/",
+		CacheTTL:        time.Minute,
+		Clock:           clock,
+	}
+	steps := []struct {
+		advance      time.Duration
+		wantRequests int64
+	}{
+		{0, 1},
+		{59 * time.Second, 1},
+		{2 * time.Second, 2},
+	}
+	for i, step := range steps {
+		clock.advance(step.advance)
+		if _, err := translator.Translate(context.Background(), "https://cdn/video.mp4"); err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt64(&requests); n != step.wantRequests {
+			t.Errorf("wrong number of requests to the mapping service after step %d\nwant %d\ngot  %d", i, step.wantRequests, n)
+		}
+	}
+}
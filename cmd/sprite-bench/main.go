@@ -0,0 +1,174 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command sprite-bench benchmarks the generation of sprites against a
+// synthetic video-packager with configurable latency, error rate and
+// thumbnail size, so settings such as the number of workers can be tuned for
+// a given deployment.
+//
+// Example:
+//
+//	% sprite-bench -workers 4,16,64 -tiles 200 -latency 80ms -dist exponential -error-rate 0.01
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sprite "github.com/fsouza/vod-module-sprite"
+)
+
+type benchConfig struct {
+	workers         []uint
+	runs            int
+	tiles           int
+	columns         uint
+	width           uint
+	height          uint
+	quality         int
+	lossless        bool
+	continueOnError bool
+}
+
+type benchResult struct {
+	workers   uint
+	durations []time.Duration
+	failures  int
+	bytes     int64
+}
+
+func main() {
+	var (
+		cfg        benchConfig
+		workers    string
+		latency    time.Duration
+		jitter     time.Duration
+		dist       string
+		errorRate  float64
+		srcWidth   int
+		srcHeight  int
+		maxDrawers uint
+	)
+	flag.StringVar(&workers, "workers", "4,8,16,32", "comma-separated list of worker counts to benchmark")
+	flag.IntVar(&cfg.runs, "runs", 3, "number of sprites generated for each worker count")
+	flag.IntVar(&cfg.tiles, "tiles", 100, "number of tiles in each sprite")
+	flag.UintVar(&cfg.columns, "columns", 10, "number of columns in each sprite")
+	flag.UintVar(&cfg.width, "width", 0, "width of each tile - 0 for keeping the aspect ratio/source")
+	flag.UintVar(&cfg.height, "height", 180, "height of each tile - 0 for keeping the aspect ratio/source")
+	flag.IntVar(&cfg.quality, "quality", 80, "JPEG quality of the sprites (1-100)")
+	flag.BoolVar(&cfg.lossless, "lossless", false, "assemble the sprites from the thumbnails without re-encoding them")
+	flag.BoolVar(&cfg.continueOnError, "continue-on-error", false, "keep generating sprites when the packager fails")
+	flag.UintVar(&maxDrawers, "max-drawers", 0, "maximum number of goroutines drawing each sprite - 0 for drawing sequentially")
+	flag.DurationVar(&latency, "latency", 50*time.Millisecond, "mean latency of the synthetic packager")
+	flag.DurationVar(&jitter, "jitter", 20*time.Millisecond, "maximum deviation from the mean latency, for the uniform distribution")
+	flag.StringVar(&dist, "dist", string(latencyUniform), "latency distribution of the synthetic packager: fixed, uniform or exponential")
+	flag.Float64Var(&errorRate, "error-rate", 0, "fraction of requests that fail with 503 (0-1)")
+	flag.IntVar(&srcWidth, "source-width", 1280, "width of the synthetic source video")
+	flag.IntVar(&srcHeight, "source-height", 720, "height of the synthetic source video")
+	flag.Parse()
+
+	var err error
+	cfg.workers, err = parseWorkers(workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	packager, err := newSyntheticPackager(latency, jitter, latencyDist(dist), errorRate, srcWidth, srcHeight)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := http.Server{Handler: packager}
+	go server.Serve(listener)
+	defer server.Close()
+
+	prefix := "http://" + listener.Addr().String() + "/video"
+	results := make([]benchResult, 0, len(cfg.workers))
+	for _, n := range cfg.workers {
+		generator := sprite.Generator{
+			Translator: func(string) (string, error) { return prefix, nil },
+			MaxWorkers: n,
+			MaxDrawers: maxDrawers,
+		}
+		results = append(results, bench(&generator, n, cfg))
+	}
+	printResults(os.Stdout, results, cfg)
+}
+
+func parseWorkers(value string) ([]uint, error) {
+	var workers []uint
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(part), 10, 0)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid worker count %q", part)
+		}
+		workers = append(workers, uint(n))
+	}
+	return workers, nil
+}
+
+func bench(generator *sprite.Generator, workers uint, cfg benchConfig) benchResult {
+	result := benchResult{workers: workers}
+	const interval = 2 * time.Second
+	for i := 0; i < cfg.runs; i++ {
+		start := time.Now()
+		generated, err := generator.GenSpriteWithMetadata(sprite.GenSpriteOptions{
+			VideoURL:        "/video.mp4",
+			End:             time.Duration(cfg.tiles-1) * interval,
+			Interval:        interval,
+			Columns:         cfg.columns,
+			Width:           cfg.width,
+			Height:          cfg.height,
+			JPEGQuality:     cfg.quality,
+			LosslessJPEG:    cfg.lossless,
+			ContinueOnError: cfg.continueOnError,
+		})
+		if err != nil {
+			result.failures++
+			continue
+		}
+		result.durations = append(result.durations, time.Since(start))
+		result.bytes += generated.BytesDownloaded
+	}
+	return result
+}
+
+func printResults(w *os.File, results []benchResult, cfg benchConfig) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "workers\truns\tfailures\tmin\tmean\tmax\ttiles/s\tMB/s")
+	for _, result := range results {
+		if len(result.durations) == 0 {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t-\t-\t-\t-\t-\n", result.workers, cfg.runs, result.failures)
+			continue
+		}
+		min, max, total := result.durations[0], result.durations[0], time.Duration(0)
+		for _, d := range result.durations {
+			if d < min {
+				min = d
+			}
+			if d > max {
+				max = d
+			}
+			total += d
+		}
+		mean := total / time.Duration(len(result.durations))
+		tilesPerSecond := float64(cfg.tiles*len(result.durations)) / total.Seconds()
+		mbPerSecond := float64(result.bytes) / (1 << 20) / total.Seconds()
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%v\t%v\t%v\t%.1f\t%.2f\n",
+			result.workers, cfg.runs, result.failures,
+			min.Round(time.Millisecond), mean.Round(time.Millisecond), max.Round(time.Millisecond),
+			tilesPerSecond, mbPerSecond)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyDist is the distribution of the latency of the synthetic packager.
+type latencyDist string
+
+const (
+	latencyFixed       latencyDist = "fixed"
+	latencyUniform     latencyDist = "uniform"
+	latencyExponential latencyDist = "exponential"
+)
+
+// syntheticPackager is an http.Handler that mimics nginx-vod-module's
+// thumbnail endpoint, generating thumbnails of the requested size with a
+// configurable latency and error rate.
+type syntheticPackager struct {
+	latency   time.Duration
+	jitter    time.Duration
+	dist      latencyDist
+	errorRate float64
+
+	// width and height are the dimensions of the source video, used
+	// when the request doesn't specify them.
+	width  int
+	height int
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	thumbs map[image.Point][]byte
+}
+
+var thumbRegexp = regexp.MustCompile(`thumb-(\d+)(?:-w(\d+))?(?:-h(\d+))?`)
+
+func newSyntheticPackager(latency, jitter time.Duration, dist latencyDist, errorRate float64, width, height int) (*syntheticPackager, error) {
+	switch dist {
+	case latencyFixed, latencyUniform, latencyExponential:
+	default:
+		return nil, fmt.Errorf("invalid latency distribution %q", dist)
+	}
+	if errorRate < 0 || errorRate > 1 {
+		return nil, fmt.Errorf("invalid error rate %v: must be between 0 and 1", errorRate)
+	}
+	return &syntheticPackager{
+		latency:   latency,
+		jitter:    jitter,
+		dist:      dist,
+		errorRate: errorRate,
+		width:     width,
+		height:    height,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		thumbs:    make(map[image.Point][]byte),
+	}, nil
+}
+
+func (p *syntheticPackager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	match := thumbRegexp.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.Error(w, "invalid thumbnail URL", http.StatusBadRequest)
+		return
+	}
+	delay, fail := p.next()
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	if fail {
+		http.Error(w, "synthetic failure", http.StatusServiceUnavailable)
+		return
+	}
+	width, _ := strconv.Atoi(match[2])
+	height, _ := strconv.Atoi(match[3])
+	data, err := p.thumb(p.size(width, height))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// next returns the latency of the next response, and whether it should
+// fail.
+func (p *syntheticPackager) next() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fail := p.rand.Float64() < p.errorRate
+	switch p.dist {
+	case latencyUniform:
+		delay := p.latency - p.jitter + time.Duration(p.rand.Int63n(int64(2*p.jitter)+1))
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, fail
+	case latencyExponential:
+		return time.Duration(p.rand.ExpFloat64() * float64(p.latency)), fail
+	default:
+		return p.latency, fail
+	}
+}
+
+// size returns the size of the thumbnail for the requested dimensions,
+// deriving missing dimensions from the aspect ratio of the source.
+func (p *syntheticPackager) size(width, height int) image.Point {
+	switch {
+	case width == 0 && height == 0:
+		return image.Pt(p.width, p.height)
+	case width == 0:
+		return image.Pt(height*p.width/p.height, height)
+	case height == 0:
+		return image.Pt(width, width*p.height/p.width)
+	default:
+		return image.Pt(width, height)
+	}
+}
+
+// thumb returns the JPEG of the given size, encoding it on first use.
+func (p *syntheticPackager) thumb(size image.Point) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if data, ok := p.thumbs[size]; ok {
+		return data, nil
+	}
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	p.thumbs[size] = buf.Bytes()
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+// coalesce removes inputs that map to the same thumbnail URL as a previous
+// input (e.g. timecodes that differ only after the millisecond truncation, or
+// duplicate entries in a list of timecodes), so each thumbnail is fetched
+// only once. It returns the inputs that must be fetched, and a handler that
+// invokes the given handler for the output of each of them and for each of
+// their duplicates, with the index of the duplicate.
+//
+// Duplicates share the decoded image, so the TileHook is invoked once for the
+// first of them.
+func coalesce(inputs []workerInput, handle func(workerOutput)) ([]workerInput, func(workerOutput)) {
+	first := make(map[string]int, len(inputs))
+	duplicates := make(map[int][]int)
+	unique := make([]workerInput, 0, len(inputs))
+	for _, input := range inputs {
+		url := input.url()
+		if index, ok := first[url]; ok {
+			duplicates[index] = append(duplicates[index], input.index)
+			continue
+		}
+		first[url] = input.index
+		unique = append(unique, input)
+	}
+	if len(duplicates) == 0 {
+		return inputs, handle
+	}
+	return unique, func(output workerOutput) {
+		handle(output)
+		for _, index := range duplicates[output.input.index] {
+			duplicate := output
+			duplicate.input.index = index
+			handle(duplicate)
+		}
+	}
+}
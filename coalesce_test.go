@@ -0,0 +1,73 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteCoalescesDuplicateURLs(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	for _, prime := range []bool{false, true} {
+		atomic.StoreInt64(&packager.requests, 0)
+		result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+			VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+			End:      3 * time.Second,
+			Interval: time.Second,
+			Height:   72,
+			Prime:    prime,
+			// maps 0s and 1s to the same thumbnail, as well as 2s and
+			// 3s.
+			TimecodeMapper: func(abs time.Duration) string {
+				return strconv.FormatInt(int64(abs/(2*time.Second)*2000), 10)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt64(&packager.requests); n != 2 {
+			t.Errorf("wrong number of requests (prime=%v)\nwant 2\ngot  %d", prime, n)
+		}
+		if len(result.Tiles) != 4 {
+			t.Fatalf("wrong number of tiles\nwant 4\ngot  %d", len(result.Tiles))
+		}
+		for i, tile := range result.Tiles {
+			if tile.Status != TileOK {
+				t.Errorf("wrong status for tile %d\nwant %v\ngot  %v", i, TileOK, tile.Status)
+			}
+		}
+	}
+}
+
+func TestGenPostersCoalescesDuplicateTimecodes(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	posters, err := generator.GenPosters(GenPostersOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Timecodes:   []time.Duration{2 * time.Second, 0, 2 * time.Second, 2*time.Second + 300*time.Microsecond},
+		Height:      72,
+		Passthrough: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&packager.requests); n != 2 {
+		t.Errorf("wrong number of requests\nwant 2\ngot  %d", n)
+	}
+	for _, i := range []int{2, 3} {
+		if !bytes.Equal(posters[i], posters[0]) {
+			t.Errorf("poster %d differs from poster 0", i)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image/draw"
+)
+
+// Compositing determines how thumbnails with transparency (e.g. returned by
+// a TileHook, or the Placeholder) are drawn in the sprite.
+type Compositing int
+
+const (
+	// CompositeSrc replaces the pixels of the sprite with the pixels of
+	// the thumbnail, including transparent ones, which end up black in
+	// JPEG sprites.
+	CompositeSrc Compositing = iota
+
+	// CompositeOver draws the thumbnail over the background of the
+	// sprite (see GenSpriteOptions.Background), so transparent pixels
+	// show the background instead.
+	CompositeOver
+)
+
+// ErrInvalidCompositing is returned when the compositing mode is unknown.
+var ErrInvalidCompositing = errors.New("invalid compositing mode")
+
+var compositingNames = map[Compositing]string{
+	CompositeSrc:  "src",
+	CompositeOver: "over",
+}
+
+// String returns the name of the compositing mode.
+func (c Compositing) String() string {
+	if name, ok := compositingNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compositing(%d)", int(c))
+}
+
+// valid reports whether the compositing mode is known.
+func (c Compositing) valid() bool {
+	_, ok := compositingNames[c]
+	return ok
+}
+
+func (c Compositing) op() draw.Op {
+	if c == CompositeOver {
+		return draw.Over
+	}
+	return draw.Src
+}
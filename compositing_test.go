@@ -0,0 +1,78 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteCompositing(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	// makes the left half of every thumbnail transparent.
+	tileHook := func(_ time.Duration, img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		dst := image.NewRGBA(b)
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+		draw.Draw(dst, image.Rect(b.Min.X, b.Min.Y, b.Min.X+b.Dx()/2, b.Max.Y), image.Transparent, image.Point{}, draw.Src)
+		return dst, nil
+	}
+	tests := []struct {
+		name        string
+		compositing Compositing
+		background  color.Color
+		expectedMin uint32
+		expectedMax uint32
+	}{
+		{"src", CompositeSrc, color.White, 0, 0x1000},
+		{"over - white background", CompositeOver, color.White, 0xf000, 0xffff},
+		{"over - default background", CompositeOver, nil, 0, 0x1000},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			data, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:         2 * time.Second,
+				Interval:    2 * time.Second,
+				Height:      72,
+				JPEGQuality: 100,
+				TileHook:    tileHook,
+				Compositing: test.compositing,
+				Background:  test.background,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sprite, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range []image.Point{{10, 10}, {10, 100}} {
+				r, g, b, _ := sprite.At(p.X, p.Y).RGBA()
+				for _, c := range []uint32{r, g, b} {
+					if c < test.expectedMin || c > test.expectedMax {
+						t.Errorf("wrong color at %v\nwant between %#x and %#x\ngot  %#x", p, test.expectedMin, test.expectedMax, c)
+					}
+				}
+			}
+		})
+	}
+
+	_, err := generator.GenSprite(GenSpriteOptions{End: time.Second, Interval: time.Second, Compositing: Compositing(42)})
+	if !errors.Is(err, ErrInvalidCompositing) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrInvalidCompositing, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGeneratorConcurrentUse exercises all entry points of a shared
+// Generator concurrently, and is meant to be run with the race detector.
+func TestGeneratorConcurrentUse(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator:     packager.translate,
+		MaxWorkers:     4,
+		CaptureHeaders: []string{"X-Served-By"},
+		Logger:         &fakeLogger{},
+	}
+	prefix, err := packager.translate("/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyframes := []time.Duration{4 * time.Second, 0, 2 * time.Second}
+	opts := GenSpriteOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:       4 * time.Second,
+		Interval:  2 * time.Second,
+		Columns:   2,
+		Height:    36,
+		Keyframes: keyframes,
+		Report:    true,
+	}
+	calls := []func() error{
+		func() error {
+			_, err := generator.GenSprite(opts)
+			return err
+		},
+		func() error {
+			opts := opts
+			opts.JobKey = "shared-job"
+			_, err := generator.GenSpriteWithMetadata(opts)
+			return err
+		},
+		func() error {
+			_, err := generator.GenPosters(GenPostersOptions{
+				VideoURL:  opts.VideoURL,
+				Timecodes: []time.Duration{0, 2 * time.Second},
+				Height:    72,
+			})
+			return err
+		},
+		func() error {
+			_, err := generator.GenPoster(context.Background(), opts.VideoURL, 2*time.Second, 0, 72, 80)
+			return err
+		},
+		func() error {
+			return generator.Prefetch(context.Background(), opts)
+		},
+		func() error {
+			return generator.FetchImages(context.Background(), []string{prefix + "/thumb-0-h72.jpg"}, func(int, image.Image) error {
+				return nil
+			})
+		},
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 5*len(calls))
+	for i := 0; i < 5; i++ {
+		for _, call := range calls {
+			wg.Add(1)
+			go func(call func() error) {
+				defer wg.Done()
+				errs <- call()
+			}(call)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if keyframes[0] != 4*time.Second {
+		t.Errorf("the keyframes in the options were modified: %v", keyframes)
+	}
+}
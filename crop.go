@@ -0,0 +1,59 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ErrInvalidCropRect is returned when the crop rectangle is empty or isn't
+// within the unit square.
+var ErrInvalidCropRect = errors.New("invalid crop rect: must be a non-empty rectangle within [0, 1]")
+
+// NormalizedRect is a rectangle in normalized coordinates, where (0, 0) is
+// the top-left corner of an image and (1, 1) is its bottom-right corner.
+//
+// For example, the following rectangle cuts the bottom 10% of an image:
+//
+//	NormalizedRect{X0: 0, Y0: 0, X1: 1, Y1: 0.9}
+type NormalizedRect struct {
+	X0, Y0 float64
+	X1, Y1 float64
+}
+
+func (r *NormalizedRect) validate() error {
+	if r.X0 < 0 || r.Y0 < 0 || r.X1 > 1 || r.Y1 > 1 || r.X0 >= r.X1 || r.Y0 >= r.Y1 {
+		return ErrInvalidCropRect
+	}
+	return nil
+}
+
+// apply returns the region of the given bounds described by the rectangle,
+// keeping at least one pixel in each dimension.
+func (r *NormalizedRect) apply(bounds image.Rectangle) image.Rectangle {
+	scale := func(min, size int, from, to float64) (int, int) {
+		start := min + int(math.Round(from*float64(size)))
+		end := min + int(math.Round(to*float64(size)))
+		if end <= start {
+			end = start + 1
+		}
+		return start, end
+	}
+	x0, x1 := scale(bounds.Min.X, bounds.Dx(), r.X0, r.X1)
+	y0, y1 := scale(bounds.Min.Y, bounds.Dy(), r.Y0, r.Y1)
+	return image.Rect(x0, y0, x1, y1).Intersect(bounds)
+}
+
+// crop returns a copy of the region of the given image described by the
+// given rectangle.
+func crop(img image.Image, r *NormalizedRect) image.Image {
+	region := r.apply(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, region.Min, draw.Src)
+	return dst
+}
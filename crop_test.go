@@ -0,0 +1,92 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalizedRectApply(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		rect     NormalizedRect
+		bounds   image.Rectangle
+		expected image.Rectangle
+	}{
+		{"whole image", NormalizedRect{0, 0, 1, 1}, image.Rect(0, 0, 127, 72), image.Rect(0, 0, 127, 72)},
+		{"bottom band", NormalizedRect{0, 0, 1, 0.9}, image.Rect(0, 0, 127, 72), image.Rect(0, 0, 127, 65)},
+		{"center", NormalizedRect{0.25, 0.25, 0.75, 0.75}, image.Rect(0, 0, 100, 40), image.Rect(25, 10, 75, 30)},
+		{"offset bounds", NormalizedRect{0.5, 0, 1, 0.5}, image.Rect(10, 10, 110, 50), image.Rect(60, 10, 110, 30)},
+		{"tiny region", NormalizedRect{0.5, 0.5, 0.501, 0.501}, image.Rect(0, 0, 10, 10), image.Rect(5, 5, 6, 6)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if got := test.rect.apply(test.bounds); got != test.expected {
+				t.Errorf("wrong region\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteCropRect(t *testing.T) {
+	t.Parallel()
+	const maxDiff = int64(11e5)
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	cropRect := NormalizedRect{X0: 0, Y0: 0, X1: 1, Y1: 0.5}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         2 * time.Second,
+		Interval:    2 * time.Second,
+		Columns:     2,
+		Height:      72,
+		JPEGQuality: 100,
+		CropRect:    &cropRect,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 254 || result.Height != 36 {
+		t.Fatalf("wrong sprite dimensions\nwant 254x36\ngot  %dx%d", result.Width, result.Height)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"img01.jpg", "img02.jpg"} {
+		src, err := loadSpriteFromDisk(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := crop(src, &cropRect)
+		tile := crop(sprite, &NormalizedRect{X0: float64(i) / 2, Y0: 0, X1: float64(i+1) / 2, Y1: 1})
+		if diff := imageDiff(tile, expected); int64(math.Abs(float64(diff))) > maxDiff {
+			t.Errorf("tile %d is too different from the cropped %s\nmax diff: %d\ngot diff: %d", i, name, maxDiff, diff)
+		}
+	}
+}
+
+func TestGenSpriteInvalidCropRect(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "", nil }}
+	for _, rect := range []NormalizedRect{{0, 0, 0, 1}, {0.5, 0, 0.4, 1}, {-0.1, 0, 1, 1}, {0, 0, 1, 1.1}} {
+		rect := rect
+		_, err := generator.GenSprite(GenSpriteOptions{End: time.Second, Interval: time.Second, CropRect: &rect})
+		if !errors.Is(err, ErrInvalidCropRect) {
+			t.Errorf("wrong error returned for %v\nwant %v\ngot  %v", rect, ErrInvalidCropRect, err)
+		}
+	}
+}
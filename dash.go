@@ -0,0 +1,139 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ErrIncompatibleDASHLayout is returned by WriteDASHAdaptationSet when the
+// layout of the sprite can't be described by a DASH-IF thumbnail tile grid:
+// tiles must have the same duration and be laid out in chronological order,
+// row by row, from left to right, in a single sheet, without gaps.
+var ErrIncompatibleDASHLayout = errors.New("sprite layout is incompatible with DASH thumbnail tiles")
+
+// dashThumbnailScheme is the scheme of the DASH-IF thumbnail tile property.
+const dashThumbnailScheme = "http://dashif.org/guidelines/thumbnail_tile"
+
+type dashAdaptationSet struct {
+	XMLName                xml.Name           `xml:"AdaptationSet"`
+	MimeType               string             `xml:"mimeType,attr"`
+	ContentType            string             `xml:"contentType,attr"`
+	SupplementalProperties []dashProperty     `xml:"SupplementalProperty"`
+	Representation         dashRepresentation `xml:"Representation"`
+}
+
+type dashProperty struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type dashRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       int64               `xml:"bandwidth,attr"`
+	Width           int                 `xml:"width,attr"`
+	Height          int                 `xml:"height,attr"`
+	SegmentTemplate dashSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type dashSegmentTemplate struct {
+	Media           string              `xml:"media,attr"`
+	Timescale       int64               `xml:"timescale,attr"`
+	SegmentTimeline dashSegmentTimeline `xml:"SegmentTimeline"`
+}
+
+type dashSegmentTimeline struct {
+	Segments []dashSegment `xml:"S"`
+}
+
+type dashSegment struct {
+	Time     int64 `xml:"t,attr"`
+	Duration int64 `xml:"d,attr"`
+}
+
+// WriteDASHAdaptationSet writes a DASH-IF thumbnail tiles AdaptationSet
+// describing the sprite, available at spriteURL, to the given writer, so the
+// sprite can be referenced from an MPD. id is the id of the representation.
+//
+// The sprite is described as a single segment, from the Start of the first
+// tile to the End of the last one, so tiles must have the same duration and be
+// laid out in chronological order (see ErrIncompatibleDASHLayout).
+func (r *GenSpriteResult) WriteDASHAdaptationSet(w io.Writer, id, spriteURL string) error {
+	layout := r.Layout()
+	return layout.WriteDASHAdaptationSet(w, id, spriteURL, len(r.Sprite))
+}
+
+// WriteDASHAdaptationSet writes a DASH-IF thumbnail tiles AdaptationSet
+// describing the layout to the given writer. spriteSize is the size of the
+// sprite in bytes, used for computing the bandwidth of the representation.
+// See GenSpriteResult.WriteDASHAdaptationSet.
+func (l *Layout) WriteDASHAdaptationSet(w io.Writer, id, spriteURL string, spriteSize int) error {
+	if len(l.Tiles) == 0 || l.TileWidth == 0 || l.TileHeight == 0 || len(l.Sheets) > 1 {
+		return ErrIncompatibleDASHLayout
+	}
+	// tiles must fill the whole sprite, without gaps.
+	if l.Width%l.TileWidth != 0 || l.Height%l.TileHeight != 0 {
+		return ErrIncompatibleDASHLayout
+	}
+	columns, rows := l.Width/l.TileWidth, l.Height/l.TileHeight
+	first := l.Tiles[0]
+	tileDuration := first.End - first.Start
+	if tileDuration <= 0 {
+		return ErrIncompatibleDASHLayout
+	}
+	for i, tile := range l.Tiles {
+		if tile.X%l.TileWidth != 0 || tile.Y%l.TileHeight != 0 {
+			return ErrIncompatibleDASHLayout
+		}
+		index := tile.Y/l.TileHeight*columns + tile.X/l.TileWidth
+		if tile.Start != first.Start+time.Duration(index)*tileDuration {
+			return ErrIncompatibleDASHLayout
+		}
+		// the last tile may be shorter, when the range excludes End.
+		if duration := tile.End - tile.Start; duration != tileDuration && (i < len(l.Tiles)-1 || duration > tileDuration) {
+			return ErrIncompatibleDASHLayout
+		}
+	}
+	// the last row may be partial and the last tile may be shorter, so the
+	// segment ends with the last tile rather than with the grid.
+	segmentDuration := l.Tiles[len(l.Tiles)-1].End - first.Start
+	adaptationSet := dashAdaptationSet{
+		MimeType:    l.Format.ContentType(),
+		ContentType: "image",
+		SupplementalProperties: []dashProperty{
+			{SchemeIDURI: dashThumbnailScheme, Value: fmt.Sprintf("%dx%d", columns, rows)},
+		},
+		Representation: dashRepresentation{
+			ID:        id,
+			Bandwidth: int64(math.Ceil(float64(spriteSize*8) / segmentDuration.Seconds())),
+			Width:     l.Width,
+			Height:    l.Height,
+			SegmentTemplate: dashSegmentTemplate{
+				Media:     spriteURL,
+				Timescale: 1000,
+				SegmentTimeline: dashSegmentTimeline{
+					Segments: []dashSegment{
+						{
+							Time:     int64(first.Start / time.Millisecond),
+							Duration: int64(segmentDuration / time.Millisecond),
+						},
+					},
+				},
+			},
+		},
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(adaptationSet); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
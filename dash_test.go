@@ -0,0 +1,171 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestWriteDASHAdaptationSet(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Sprite:     make([]byte, 1000),
+		Width:      256,
+		Height:     144,
+		TileWidth:  128,
+		TileHeight: 72,
+		Tiles: []Tile{
+			{Start: 10 * time.Second, End: 12 * time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+			{Start: 12 * time.Second, End: 14 * time.Second, X: 128, Y: 0, Width: 128, Height: 72},
+			{Start: 14 * time.Second, End: 15 * time.Second, X: 0, Y: 72, Width: 128, Height: 72},
+		},
+	}
+	var buf bytes.Buffer
+	if err := result.WriteDASHAdaptationSet(&buf, "thumbnails_128x72", "https://cdn/sprite.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `<AdaptationSet mimeType="image/jpeg" contentType="image">
+  <SupplementalProperty schemeIdUri="http://dashif.org/guidelines/thumbnail_tile" value="2x2"></SupplementalProperty>
+  <Representation id="thumbnails_128x72" bandwidth="1600" width="256" height="144">
+    <SegmentTemplate media="https://cdn/sprite.jpg" timescale="1000">
+      <SegmentTimeline>
+        <S t="10000" d="5000"></S>
+      </SegmentTimeline>
+    </SegmentTemplate>
+  </Representation>
+</AdaptationSet>
+`
+	if buf.String() != expected {
+		t.Errorf("wrong AdaptationSet\nwant %s\ngot  %s", expected, buf.String())
+	}
+	data, err := json.Marshal(result.Layout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := ParseLayout(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := layout.WriteDASHAdaptationSet(&buf, "thumbnails_128x72", "https://cdn/sprite.jpg", len(result.Sprite)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("wrong AdaptationSet from the layout\nwant %s\ngot  %s", expected, buf.String())
+	}
+}
+
+func TestWriteDASHAdaptationSetSegmentDuration(t *testing.T) {
+	t.Parallel()
+	tile := func(i int, duration time.Duration) Tile {
+		return Tile{
+			Start:  time.Duration(i) * 2 * time.Second,
+			End:    time.Duration(i)*2*time.Second + duration,
+			X:      i % 3 * 128,
+			Y:      i / 3 * 72,
+			Width:  128,
+			Height: 72,
+		}
+	}
+	var tests = []struct {
+		name              string
+		tiles             []Tile
+		expectedDuration  int64
+		expectedBandwidth int64
+	}{
+		{
+			name:              "full grid",
+			tiles:             []Tile{tile(0, 2*time.Second), tile(1, 2*time.Second), tile(2, 2*time.Second), tile(3, 2*time.Second), tile(4, 2*time.Second), tile(5, 2*time.Second)},
+			expectedDuration:  12000,
+			expectedBandwidth: 1000,
+		},
+		{
+			name:              "partial row",
+			tiles:             []Tile{tile(0, 2*time.Second), tile(1, 2*time.Second), tile(2, 2*time.Second), tile(3, 2*time.Second)},
+			expectedDuration:  8000,
+			expectedBandwidth: 1500,
+		},
+		{
+			name:              "short last tile",
+			tiles:             []Tile{tile(0, 2*time.Second), tile(1, 2*time.Second), tile(2, 2*time.Second), tile(3, 2*time.Second), tile(4, time.Second)},
+			expectedDuration:  9000,
+			expectedBandwidth: 1334,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			layout := Layout{Width: 384, Height: 144, TileWidth: 128, TileHeight: 72, Tiles: test.tiles}
+			var buf bytes.Buffer
+			if err := layout.WriteDASHAdaptationSet(&buf, "thumbnails", "https://cdn/sprite.jpg", 1500); err != nil {
+				t.Fatal(err)
+			}
+			var adaptationSet dashAdaptationSet
+			if err := xml.Unmarshal(buf.Bytes(), &adaptationSet); err != nil {
+				t.Fatal(err)
+			}
+			representation := adaptationSet.Representation
+			if d := representation.SegmentTemplate.SegmentTimeline.Segments[0].Duration; d != test.expectedDuration {
+				t.Errorf("wrong segment duration\nwant %d\ngot  %d", test.expectedDuration, d)
+			}
+			if representation.Bandwidth != test.expectedBandwidth {
+				t.Errorf("wrong bandwidth\nwant %d\ngot  %d", test.expectedBandwidth, representation.Bandwidth)
+			}
+		})
+	}
+}
+
+func TestWriteDASHAdaptationSetIncompatibleLayout(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name   string
+		tiles  []Tile
+		sheets []Sheet
+	}{
+		{
+			name: "no tiles",
+		},
+		{
+			name: "multiple sheets",
+			tiles: []Tile{
+				{Start: 0, End: 2 * time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+				{Start: 2 * time.Second, End: 4 * time.Second, Sheet: 1, X: 0, Y: 0, Width: 128, Height: 72},
+			},
+			sheets: []Sheet{{Width: 128, Height: 72}, {Width: 128, Height: 72}},
+		},
+		{
+			name: "right to left",
+			tiles: []Tile{
+				{Start: 0, End: 2 * time.Second, X: 128, Y: 0, Width: 128, Height: 72},
+				{Start: 2 * time.Second, End: 4 * time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+			},
+		},
+		{
+			name: "non-uniform intervals",
+			tiles: []Tile{
+				{Start: 0, End: time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+				{Start: time.Second, End: 4 * time.Second, X: 128, Y: 0, Width: 128, Height: 72},
+				{Start: 4 * time.Second, End: 6 * time.Second, X: 0, Y: 72, Width: 128, Height: 72},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			result := GenSpriteResult{Width: 256, Height: 144, TileWidth: 128, TileHeight: 72, Tiles: test.tiles, Sheets: test.sheets}
+			var buf bytes.Buffer
+			err := result.WriteDASHAdaptationSet(&buf, "thumbnails", "sprite.jpg")
+			if err != ErrIncompatibleDASHLayout {
+				t.Errorf("wrong error\nwant %v\ngot  %v", ErrIncompatibleDASHLayout, err)
+			}
+		})
+	}
+}
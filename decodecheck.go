@@ -0,0 +1,67 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"sync/atomic"
+)
+
+// ErrThumbDimensions is returned (wrapped in a ThumbDimensionsError) when a
+// thumbnail has more pixels than Generator.MaxThumbPixels.
+var ErrThumbDimensions = errors.New("thumbnail dimensions exceed the limit")
+
+// ThumbDimensionsError is returned when the header of a thumbnail declares
+// more pixels than Generator.MaxThumbPixels. The thumbnail isn't decoded.
+type ThumbDimensionsError struct {
+	URL       string
+	Width     int
+	Height    int
+	MaxPixels int
+}
+
+// Error returns the string representation of ThumbDimensionsError.
+func (err *ThumbDimensionsError) Error() string {
+	return fmt.Sprintf("%s: %s is %dx%d, at most %d pixels allowed", ErrThumbDimensions, err.URL, err.Width, err.Height, err.MaxPixels)
+}
+
+// Is reports whether target is ErrThumbDimensions.
+func (err *ThumbDimensionsError) Is(target error) bool {
+	return target == ErrThumbDimensions
+}
+
+// checkHeader validates the header of the given thumbnail before it's
+// decoded, so thumbnails that aren't JPEGs or that are too large are
+// rejected without spending CPU decoding them.
+func (w *worker) checkHeader(data []byte, thumbURL string, stats *fetchStats) error {
+	stats.addHeaderCheck()
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err == io.ErrUnexpectedEOF {
+		return errTruncated
+	}
+	if err == nil && w.maxThumbPixels > 0 && config.Width*config.Height > w.maxThumbPixels {
+		err = &ThumbDimensionsError{URL: thumbURL, Width: config.Width, Height: config.Height, MaxPixels: w.maxThumbPixels}
+	}
+	if err != nil {
+		stats.addHeaderRejection()
+	}
+	return err
+}
+
+func (s *fetchStats) addHeaderCheck() {
+	if s != nil {
+		atomic.AddInt64(&s.headerChecks, 1)
+	}
+}
+
+func (s *fetchStats) addHeaderRejection() {
+	if s != nil {
+		atomic.AddInt64(&s.headerRejections, 1)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenSpriteHeaderCheck(t *testing.T) {
+	t.Parallel()
+	img := image.NewGray(image.Rect(0, 0, 160, 90))
+	var jpegThumb, pngThumb bytes.Buffer
+	jpeg.Encode(&jpegThumb, img, nil)
+	png.Encode(&pngThumb, img)
+	// PNGs don't end with the JPEG End Of Image marker, which is checked
+	// before the header.
+	pngData := append(pngThumb.Bytes(), 0xff, 0xd9)
+	var tests = []struct {
+		name              string
+		thumb             []byte
+		maxPixels         int
+		expectedErr       error
+		expectedRejection int64
+	}{
+		{"no limit", jpegThumb.Bytes(), 0, nil, 0},
+		{"within the limit", jpegThumb.Bytes(), 160 * 90, nil, 0},
+		{"over the limit", jpegThumb.Bytes(), 160*90 - 1, ErrThumbDimensions, 1},
+		{"not a jpeg", pngData, 0, jpeg.FormatError("missing SOI marker"), 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(test.thumb)
+			}))
+			defer server.Close()
+			var usage Usage
+			generator := Generator{
+				Translator:     func(string) (string, error) { return server.URL, nil },
+				MaxThumbPixels: test.maxPixels,
+				UsageHook:      func(u Usage) { usage = u },
+			}
+			_, err := generator.GenSprite(GenSpriteOptions{VideoURL: "/video.mp4"})
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", test.expectedErr, err)
+			}
+			var dimErr *ThumbDimensionsError
+			if errors.As(err, &dimErr) && (dimErr.Width != 160 || dimErr.Height != 90) {
+				t.Errorf("wrong dimensions\nwant 160x90\ngot  %dx%d", dimErr.Width, dimErr.Height)
+			}
+			if usage.HeaderChecks != 1 || usage.HeaderRejections != test.expectedRejection {
+				t.Errorf("wrong header checks\nwant 1 checked, %d rejected\ngot  %d checked, %d rejected", test.expectedRejection, usage.HeaderChecks, usage.HeaderRejections)
+			}
+		})
+	}
+}
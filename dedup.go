@@ -0,0 +1,80 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrJobPanicked is returned to the calls waiting for a generation with the
+// same GenSpriteOptions.JobKey when that generation panics.
+var ErrJobPanicked = errors.New("the generation with the same job key panicked")
+
+// call represents an in-flight or completed sprite generation.
+type call struct {
+	done   chan struct{}
+	result *GenSpriteResult
+	err    error
+}
+
+// callGroup deduplicates concurrent generations that share the same key:
+// while a generation is in-flight, other calls with the same key wait for it
+// and share its result.
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do runs fn, unless a call with the same key is in-flight, in which case it
+// waits for that call until the given context is done. When the in-flight
+// call fails because its own context was canceled (or its deadline
+// exceeded), the waiting calls whose contexts are still live don't share the
+// error: one of them runs fn instead.
+func (g *callGroup) do(ctx context.Context, key string, fn func() (*GenSpriteResult, error)) (*GenSpriteResult, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*call)
+		}
+		c, ok := g.calls[key]
+		if !ok {
+			c = &call{done: make(chan struct{})}
+			g.calls[key] = c
+			g.mu.Unlock()
+			g.run(key, c, fn)
+			return c.result, c.err
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, wrapStage(ctx, StageCanceled, ctx.Err())
+		}
+		if isContextError(c.err) && ctx.Err() == nil {
+			continue
+		}
+		return c.result, c.err
+	}
+}
+
+// run runs fn for the given call, releasing the calls waiting for it even if
+// fn panics.
+func (g *callGroup) run(key string, c *call, fn func() (*GenSpriteResult, error)) {
+	// overwritten when fn returns.
+	c.err = &GenerationError{Stage: StagePanic, Err: ErrJobPanicked}
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.result, c.err = fn()
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallGroup(t *testing.T) {
+	t.Parallel()
+	var g callGroup
+	var calls int64
+	release := make(chan struct{})
+	fn := func() (*GenSpriteResult, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return &GenSpriteResult{Sprite: []byte("sprite")}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*GenSpriteResult, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), "key", fn)
+		}(i)
+	}
+	for atomic.LoadInt64(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("wrong number of calls\nwant 1\ngot  %d", calls)
+	}
+	for i, result := range results {
+		if !bytes.Equal(result.Sprite, []byte("sprite")) {
+			t.Errorf("wrong result for call %d: %q", i, result.Sprite)
+		}
+	}
+
+	// after the call is done, the key can be used again.
+	g.do(context.Background(), "key", func() (*GenSpriteResult, error) { return nil, nil })
+	if calls != 1 {
+		t.Errorf("completed call was reused")
+	}
+}
+
+// startLeader starts a call in the given group that blocks until release is
+// closed, returning once the call is in-flight.
+func startLeader(g *callGroup, release chan struct{}, fn func() (*GenSpriteResult, error)) <-chan error {
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errs <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		_, err := g.do(context.Background(), "key", func() (*GenSpriteResult, error) {
+			close(started)
+			<-release
+			return fn()
+		})
+		errs <- err
+	}()
+	<-started
+	return errs
+}
+
+func TestCallGroupFollowerCanceled(t *testing.T) {
+	t.Parallel()
+	var g callGroup
+	release := make(chan struct{})
+	defer close(release)
+	startLeader(&g, release, func() (*GenSpriteResult, error) { return nil, nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "key", func() (*GenSpriteResult, error) {
+			return nil, errors.New("the follower shouldn't run")
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var genErr *GenerationError
+		if !errors.As(err, &genErr) || genErr.Stage != StageCanceled || !errors.Is(err, context.Canceled) {
+			t.Errorf("wrong error\nwant %v error\ngot  %v", StageCanceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower didn't return after its context was canceled")
+	}
+}
+
+func TestCallGroupLeaderCanceled(t *testing.T) {
+	t.Parallel()
+	var g callGroup
+	release := make(chan struct{})
+	leader := startLeader(&g, release, func() (*GenSpriteResult, error) {
+		return nil, &GenerationError{Stage: StageCanceled, Err: context.Canceled}
+	})
+
+	done := make(chan *GenSpriteResult, 1)
+	go func() {
+		result, err := g.do(context.Background(), "key", func() (*GenSpriteResult, error) {
+			return &GenSpriteResult{Sprite: []byte("follower")}, nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error for the leader\nwant %v\ngot  %v", context.Canceled, err)
+	}
+	select {
+	case result := <-done:
+		if result == nil || string(result.Sprite) != "follower" {
+			t.Errorf("the follower didn't generate the sprite itself: %#v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower didn't return")
+	}
+}
+
+func TestCallGroupPanic(t *testing.T) {
+	t.Parallel()
+	var g callGroup
+	release := make(chan struct{})
+	leader := startLeader(&g, release, func() (*GenSpriteResult, error) {
+		panic("boom")
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(context.Background(), "key", func() (*GenSpriteResult, error) {
+			return nil, errors.New("the follower shouldn't run")
+		})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-leader; err == nil || err.Error() != "panic: boom" {
+		t.Errorf("the panic wasn't propagated to the leader: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrJobPanicked) {
+			t.Errorf("wrong error\nwant %v\ngot  %v", ErrJobPanicked, err)
+		}
+		var genErr *GenerationError
+		if !errors.As(err, &genErr) || genErr.Stage != StagePanic {
+			t.Errorf("expected %#v to be a GenerationError in the panic stage, but it wasn't", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower hung after the leader panicked")
+	}
+
+	// the key is released, so it can be used again.
+	result, err := g.do(context.Background(), "key", func() (*GenSpriteResult, error) {
+		return &GenSpriteResult{Sprite: []byte("sprite")}, nil
+	})
+	if err != nil || string(result.Sprite) != "sprite" {
+		t.Errorf("key wasn't released after the panic: %v, %v", result, err)
+	}
+}
+
+func TestGenSpriteJobKey(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.delay = 100 * time.Millisecond
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+		JobKey:   "credit-suisse-72p",
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = generator.GenSprite(opts)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests := atomic.LoadInt64(&packager.requests); requests != 10 {
+		t.Errorf("wrong number of thumbnail requests\nwant 10\ngot  %d", requests)
+	}
+}
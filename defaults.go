@@ -0,0 +1,59 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import "reflect"
+
+// exclusiveDefaults are groups of fields that describe the same aspect of the
+// sprite in different ways (e.g. Columns and Rows, which are mutually
+// exclusive). When the options of a call set any field in a group, none of
+// the fields in that group are taken from the defaults, so a template can't
+// turn a valid call into an invalid (or different) one.
+var exclusiveDefaults = [][]string{
+	{"Columns", "Rows", "Arrangement"},
+	{"Interval", "Intervals"},
+	{"ScalingMode", "KeepAspectRatio", "Width", "Height"},
+	{"FallbackWidth", "FallbackHeight", "Width", "Height"},
+	{"FillOrder", "RightToLeft"},
+}
+
+// perCallDefaults are fields that only make sense for a single call, so they
+// are never taken from the defaults.
+var perCallDefaults = []string{"Context", "JobKey"}
+
+// applyDefaults sets the fields of the given options that have their zero
+// value to the value of the corresponding field in the given defaults, except
+// for the fields in exclusiveDefaults whose group is set in the options and
+// for perCallDefaults. Unexported fields are left untouched.
+func applyDefaults(opts *GenSpriteOptions, defaults *GenSpriteOptions) {
+	if defaults == nil {
+		return
+	}
+	dst := reflect.ValueOf(opts).Elem()
+	src := reflect.ValueOf(defaults).Elem()
+	skip := make(map[string]bool)
+	for _, name := range perCallDefaults {
+		skip[name] = true
+	}
+	for _, group := range exclusiveDefaults {
+		var set bool
+		for _, name := range group {
+			set = set || !dst.FieldByName(name).IsZero()
+		}
+		for _, name := range group {
+			// a field may be in more than one group.
+			skip[name] = skip[name] || set
+		}
+	}
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if field.PkgPath != "" || skip[field.Name] {
+			continue
+		}
+		if value := dst.Field(i); value.IsZero() {
+			value.Set(src.Field(i))
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	t.Parallel()
+	defaults := GenSpriteOptions{
+		Columns:       10,
+		Height:        72,
+		JPEGQuality:   70,
+		QualityScores: true,
+		Labels:        map[string]string{"tenant": "default"},
+		prefix:        "http://packager/default",
+	}
+	opts := GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		Columns:  4,
+		TileURLs: true,
+	}
+	applyDefaults(&opts, &defaults)
+	expected := GenSpriteOptions{
+		VideoURL:      "/video.mp4",
+		Columns:       4,
+		Height:        72,
+		JPEGQuality:   70,
+		QualityScores: true,
+		TileURLs:      true,
+		Labels:        map[string]string{"tenant": "default"},
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("wrong options\nwant %#v\ngot  %#v", expected, opts)
+	}
+}
+
+func TestApplyDefaultsExclusiveFields(t *testing.T) {
+	t.Parallel()
+	defaults := GenSpriteOptions{
+		Columns:   10,
+		Interval:  2 * time.Second,
+		Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+		Height:    72,
+	}
+	var tests = []struct {
+		name     string
+		opts     GenSpriteOptions
+		expected GenSpriteOptions
+	}{
+		{
+			name: "nothing set",
+			opts: GenSpriteOptions{},
+			expected: GenSpriteOptions{
+				Columns:   10,
+				Interval:  2 * time.Second,
+				Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+				Height:    72,
+			},
+		},
+		{
+			name: "rows",
+			opts: GenSpriteOptions{Rows: 2},
+			expected: GenSpriteOptions{
+				Rows:      2,
+				Interval:  2 * time.Second,
+				Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+				Height:    72,
+			},
+		},
+		{
+			name:     "interval",
+			opts:     GenSpriteOptions{Interval: 5 * time.Second},
+			expected: GenSpriteOptions{Columns: 10, Interval: 5 * time.Second, Height: 72},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			opts := test.opts
+			applyDefaults(&opts, &defaults)
+			if !reflect.DeepEqual(opts, test.expected) {
+				t.Errorf("wrong options\nwant %#v\ngot  %#v", test.expected, opts)
+			}
+		})
+	}
+}
+
+func TestApplyDefaultsExclusiveGroups(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		defaults GenSpriteOptions
+		opts     GenSpriteOptions
+		expected GenSpriteOptions
+	}{
+		{
+			name:     "scaling mode",
+			defaults: GenSpriteOptions{ScalingMode: ScaleExact, Width: 160, Height: 90},
+			opts:     GenSpriteOptions{Height: 72},
+			expected: GenSpriteOptions{Height: 72},
+		},
+		{
+			name:     "keep aspect ratio",
+			defaults: GenSpriteOptions{KeepAspectRatio: true, Width: 160, Height: 90},
+			opts:     GenSpriteOptions{ScalingMode: ScaleExact, Width: 128, Height: 72},
+			expected: GenSpriteOptions{ScalingMode: ScaleExact, Width: 128, Height: 72},
+		},
+		{
+			name:     "fallback size",
+			defaults: GenSpriteOptions{FallbackWidth: 160},
+			opts:     GenSpriteOptions{Width: 120},
+			expected: GenSpriteOptions{Width: 120},
+		},
+		{
+			name:     "fallback size in the call",
+			defaults: GenSpriteOptions{Width: 320, Height: 180},
+			opts:     GenSpriteOptions{FallbackHeight: 90},
+			expected: GenSpriteOptions{FallbackHeight: 90},
+		},
+		{
+			name:     "fill order",
+			defaults: GenSpriteOptions{RightToLeft: true},
+			opts:     GenSpriteOptions{FillOrder: FillRightToLeft},
+			expected: GenSpriteOptions{FillOrder: FillRightToLeft},
+		},
+		{
+			name:     "right to left",
+			defaults: GenSpriteOptions{FillOrder: FillRightToLeft},
+			opts:     GenSpriteOptions{RightToLeft: true},
+			expected: GenSpriteOptions{RightToLeft: true},
+		},
+		{
+			name:     "unset groups",
+			defaults: GenSpriteOptions{ScalingMode: ScaleExact, Width: 160, Height: 90, FallbackWidth: 80, FallbackHeight: 45, FillOrder: FillRightToLeft},
+			opts:     GenSpriteOptions{},
+			expected: GenSpriteOptions{ScalingMode: ScaleExact, Width: 160, Height: 90, FallbackWidth: 80, FallbackHeight: 45, FillOrder: FillRightToLeft},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			opts := test.opts
+			applyDefaults(&opts, &test.defaults)
+			if !reflect.DeepEqual(opts, test.expected) {
+				t.Errorf("wrong options\nwant %#v\ngot  %#v", test.expected, opts)
+			}
+		})
+	}
+}
+
+func TestApplyDefaultsPerCallFields(t *testing.T) {
+	t.Parallel()
+	defaults := GenSpriteOptions{
+		Context: context.Background(),
+		JobKey:  "template",
+		Height:  72,
+	}
+	var opts GenSpriteOptions
+	applyDefaults(&opts, &defaults)
+	expected := GenSpriteOptions{Height: 72}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("wrong options\nwant %#v\ngot  %#v", expected, opts)
+	}
+}
+
+func TestGenSpriteDefaultOptionsScaling(t *testing.T) {
+	t.Parallel()
+	server := startSourcePackager(image.Pt(160, 90))
+	defer server.Close()
+	var tests = []struct {
+		name     string
+		defaults GenSpriteOptions
+		opts     GenSpriteOptions
+	}{
+		{"scaling mode", GenSpriteOptions{ScalingMode: ScaleExact}, GenSpriteOptions{Height: 72}},
+		{"fallback size", GenSpriteOptions{FallbackWidth: 160}, GenSpriteOptions{Width: 120}},
+	}
+	for _, test := range tests {
+		defaults := test.defaults
+		defaults.Interval = 2 * time.Second
+		generator := Generator{
+			Translator:     func(string) (string, error) { return server.URL, nil },
+			DefaultOptions: &defaults,
+		}
+		opts := test.opts
+		opts.VideoURL = "/video.mp4"
+		opts.End = 2 * time.Second
+		if _, err := generator.GenSpriteWithMetadata(opts); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestGenSpriteDefaultOptionsLayout(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator: packager.translate,
+		DefaultOptions: &GenSpriteOptions{
+			Interval: 2 * time.Second,
+			Columns:  5,
+			Height:   72,
+		},
+	}
+	var tests = []struct {
+		name            string
+		opts            GenSpriteOptions
+		expectedColumns int
+	}{
+		{"rows", GenSpriteOptions{Rows: 1}, 4},
+		{"arrangement", GenSpriteOptions{Arrangement: VerticalStrip}, 1},
+	}
+	for _, test := range tests {
+		opts := test.opts
+		opts.VideoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+		opts.End = 6 * time.Second
+		result, err := generator.GenSpriteWithMetadata(opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if expected := test.expectedColumns * result.TileWidth; result.Width != expected {
+			t.Errorf("%s: wrong sprite width\nwant %d\ngot  %d", test.name, expected, result.Width)
+		}
+	}
+}
+
+func TestGenSpriteTracksDefaultIntervals(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator: packager.translate,
+		DefaultOptions: &GenSpriteOptions{
+			Intervals: []IntervalStep{{Until: time.Minute, Interval: 2 * time.Second}},
+			Height:    72,
+		},
+	}
+	results, err := generator.GenSpriteTracks(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      8 * time.Second,
+	}, 4*time.Second, 8*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{3, 2} {
+		if n := len(results[i].Tiles); n != expected {
+			t.Errorf("wrong number of tiles in track %d\nwant %d\ngot  %d", i, expected, n)
+		}
+	}
+}
+
+func TestGenSpriteDefaultOptions(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator: packager.translate,
+		DefaultOptions: &GenSpriteOptions{
+			Interval: 2 * time.Second,
+			Columns:  2,
+			Height:   72,
+		},
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      6 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tiles) != 4 {
+		t.Fatalf("wrong number of tiles\nwant 4\ngot  %d", len(result.Tiles))
+	}
+	if result.TileHeight != 72 {
+		t.Errorf("wrong tile height\nwant 72\ngot  %d", result.TileHeight)
+	}
+	if expected := 2 * result.TileWidth; result.Width != expected {
+		t.Errorf("wrong sprite width\nwant %d\ngot  %d", expected, result.Width)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IPPreference determines the IP versions used for connecting to the
+// video-packager.
+type IPPreference int
+
+const (
+	// IPDefault uses the default dual-stack dialing of the standard
+	// library, racing IPv6 and IPv4 connections (see
+	// Generator.FallbackDelay).
+	IPDefault IPPreference = iota
+
+	// IPv4Only connects only through IPv4.
+	IPv4Only
+
+	// IPv6Only connects only through IPv6.
+	IPv6Only
+
+	// PreferIPv4 connects through IPv4, falling back to IPv6 when the
+	// connection fails.
+	PreferIPv4
+
+	// PreferIPv6 connects through IPv6, falling back to IPv4 when the
+	// connection fails.
+	PreferIPv6
+)
+
+// networks returns the networks to try, in order, when dialing for the given
+// network.
+func (p IPPreference) networks(network string) []string {
+	if network != "tcp" {
+		return []string{network}
+	}
+	switch p {
+	case IPv4Only:
+		return []string{"tcp4"}
+	case IPv6Only:
+		return []string{"tcp6"}
+	case PreferIPv4:
+		return []string{"tcp4", "tcp6"}
+	case PreferIPv6:
+		return []string{"tcp6", "tcp4"}
+	default:
+		return []string{network}
+	}
+}
+
+// configureDialer replaces the dialer of the given transport according to
+// the dialing preferences of the generator. The transport is left untouched
+// when no preferences are set.
+func (g *Generator) configureDialer(t *http.Transport) {
+	if g.IPPreference == IPDefault && g.FallbackDelay == 0 {
+		return
+	}
+	dialer := net.Dialer{
+		Timeout:       30 * time.Second,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: g.FallbackDelay,
+	}
+	preference := g.IPPreference
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var err error
+		for _, network := range preference.networks(network) {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, addr); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
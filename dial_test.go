@@ -0,0 +1,64 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIPPreferenceNetworks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		preference IPPreference
+		network    string
+		expected   []string
+	}{
+		{IPDefault, "tcp", []string{"tcp"}},
+		{IPv4Only, "tcp", []string{"tcp4"}},
+		{IPv6Only, "tcp", []string{"tcp6"}},
+		{PreferIPv4, "tcp", []string{"tcp4", "tcp6"}},
+		{PreferIPv6, "tcp", []string{"tcp6", "tcp4"}},
+		{IPv4Only, "tcp6", []string{"tcp6"}},
+	}
+	for _, test := range tests {
+		if networks := test.preference.networks(test.network); !reflect.DeepEqual(networks, test.expected) {
+			t.Errorf("wrong networks for preference %d and network %q\nwant %v\ngot  %v", test.preference, test.network, test.expected, networks)
+		}
+	}
+}
+
+func TestGeneratorIPPreference(t *testing.T) {
+	t.Parallel()
+	// httptest servers listen on 127.0.0.1.
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	tests := []struct {
+		name          string
+		preference    IPPreference
+		fallbackDelay time.Duration
+		expectedError bool
+	}{
+		{"default", IPDefault, 0, false},
+		{"fallback delay", IPDefault, 10 * time.Millisecond, false},
+		{"ipv4 only", IPv4Only, 0, false},
+		{"prefer ipv6", PreferIPv6, 0, false},
+		{"ipv6 only", IPv6Only, 0, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			generator := Generator{IPPreference: test.preference, FallbackDelay: test.fallbackDelay}
+			err := generator.Warm(context.Background(), server.URL, 1)
+			if gotError := err != nil; gotError != test.expectedError {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
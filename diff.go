@@ -0,0 +1,56 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// diffHeatmap returns the heatmap of the differences between the given
+// images, covering the area common to both. Each pixel is the root mean
+// square of the differences of the color channels of the images, ramping
+// from black through red to yellow.
+func diffHeatmap(img1, img2 image.Image) *image.RGBA {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	size := b1.Size()
+	if s := b2.Size(); s.X < size.X {
+		size.X = s.X
+	}
+	if s := b2.Size(); s.Y < size.Y {
+		size.Y = s.Y
+	}
+	heatmap := image.NewRGBA(image.Rectangle{Max: size})
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			r1, g1, bl1, _ := img1.At(b1.Min.X+x, b1.Min.Y+y).RGBA()
+			r2, g2, bl2, _ := img2.At(b2.Min.X+x, b2.Min.Y+y).RGBA()
+			accumError := sqDiff(r1, r2) + sqDiff(g1, g2) + sqDiff(bl1, bl2)
+			// scale the 16-bit difference down to 8 bits, then double
+			// it so the ramp covers red and yellow.
+			level := 2 * int(math.Sqrt(float64(accumError)/3)) >> 8
+			heatmap.SetRGBA(x, y, heatColor(level))
+		}
+	}
+	return heatmap
+}
+
+// heatColor maps a level between 0 and 510 to a color: black for 0, red for
+// 255 and yellow for 510.
+func heatColor(level int) color.RGBA {
+	if level > 510 {
+		level = 510
+	}
+	if level <= 255 {
+		return color.RGBA{R: uint8(level), A: 0xff}
+	}
+	return color.RGBA{R: 0xff, G: uint8(level - 255), A: 0xff}
+}
+
+func sqDiff(x, y uint32) int64 {
+	d := int64(x) - int64(y)
+	return d * d
+}
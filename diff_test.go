@@ -0,0 +1,66 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDiffHeatmap(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		color1   color.Color
+		color2   color.Color
+		expected color.RGBA
+	}{
+		{
+			name:     "identical",
+			color1:   color.RGBA{R: 10, G: 20, B: 30, A: 0xff},
+			color2:   color.RGBA{R: 10, G: 20, B: 30, A: 0xff},
+			expected: color.RGBA{A: 0xff},
+		},
+		{
+			name:     "half",
+			color1:   color.RGBA{R: 64, G: 64, B: 64, A: 0xff},
+			color2:   color.RGBA{A: 0xff},
+			expected: color.RGBA{R: 128, A: 0xff},
+		},
+		{
+			name:     "opposite",
+			color1:   color.White,
+			color2:   color.Black,
+			expected: color.RGBA{R: 0xff, G: 0xff, A: 0xff},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			img1 := image.NewRGBA(image.Rect(0, 0, 4, 3))
+			fill(img1, test.color1)
+			img2 := image.NewRGBA(image.Rect(10, 10, 13, 15))
+			fill(img2, test.color2)
+			heatmap := diffHeatmap(img1, img2)
+			if size := heatmap.Bounds().Size(); size != image.Pt(3, 3) {
+				t.Fatalf("wrong heatmap size\nwant %v\ngot  %v", image.Pt(3, 3), size)
+			}
+			if got := heatmap.RGBAAt(1, 1); got != test.expected {
+				t.Errorf("wrong heatmap color\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func fill(img *image.RGBA, c color.Color) {
+	bounds := img.Bounds()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			img.Set(x, y, c)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"image"
 	"image/draw"
 	"math"
+	"net/http"
+	"sync"
+	"time"
 )
 
 type drawInput struct {
@@ -19,79 +22,391 @@ type drawInput struct {
 }
 
 func (i *drawInput) dimensions() (width, height int) {
-	width = i.img.Bounds().Dx()
-	height = i.img.Bounds().Dy()
-	if i.workerOutput.input.letterbox {
-		width = int(i.workerOutput.input.width)
+	input := i.workerOutput.input
+	if input.scalingMode().boxed() {
+		box := image.Rect(0, 0, int(input.width), int(input.height))
+		if input.crop != nil {
+			box = input.crop.apply(box)
+		}
+		return box.Dx(), box.Dy()
 	}
-	return width, height
+	return i.img.Bounds().Dx(), i.img.Bounds().Dy()
 }
 
-func (g *Generator) drawSprite(opts GenSpriteOptions, imgs <-chan workerOutput, workersErrs <-chan error, inputErrs <-chan error) (*image.RGBA, error) {
-	var drawer spriteDrawer
-
-	columns := int(opts.Columns)
-	if n := opts.n(); columns > n {
-		columns = n
-	}
-	rows := int(math.Ceil(float64(opts.n()) / float64(columns)))
-
-	for {
-		select {
-		case output, ok := <-imgs:
-			if !ok {
-				select {
-				// check the for worker errors just one more
-				// time, just in case all workers have failed
-				case err := <-workersErrs:
-					return nil, err
-				default:
-					return drawer.sprite, nil
-				}
-			}
-			if output.img == nil {
-				continue
+// grid describes the distribution of thumbnails in the sprite, filled row by
+// row, from left to right (or from right to left, when rtl is set), unless
+// the cells of the thumbnails are set by an Arrangement.
+type grid struct {
+	columns int
+	rows    int
+	rtl     bool
+	cells   []image.Point
+}
+
+func newGrid(n int, columns uint) grid {
+	g := grid{columns: int(columns)}
+	if g.columns > n {
+		g.columns = n
+	}
+	g.rows = int(math.Ceil(float64(n) / float64(g.columns)))
+	return g
+}
+
+// position returns the column and the row of the i-th thumbnail.
+func (g grid) position(i int) (x, y int) {
+	x, y = i%g.columns, i/g.columns
+	if g.cells != nil {
+		x, y = g.cells[i].X, g.cells[i].Y
+	}
+	if g.rtl {
+		x = g.columns - 1 - x
+	}
+	return x, y
+}
+
+// drawSprite fetches the thumbnails and draws the sprite, returning it along
+// with a partial result containing the metadata of the sprite.
+func (g *Generator) drawSprite(opts GenSpriteOptions) (*image.RGBA, *GenSpriteResult, error) {
+	drawer := spriteDrawer{
+		op:     opts.Compositing.op(),
+		gaps:   opts.gaps(),
+		alignX: opts.AlignX,
+		alignY: opts.AlignY,
+	}
+	if opts.Background != nil {
+		drawer.background = image.NewUniform(opts.Background)
+	}
+	if opts.SpacingColor != nil {
+		drawer.gapFill = image.NewUniform(opts.SpacingColor)
+	}
+	var expires time.Time
+
+	timecodes := opts.timecodes()
+	grid, err := opts.grid(len(timecodes))
+	if err != nil {
+		return nil, nil, err
+	}
+	drawn := make([]bool, len(timecodes))
+	scores := make([]*tileScore, len(timecodes))
+	captured := make([]time.Duration, len(timecodes))
+	var urls []string
+	if opts.TileURLs {
+		urls = make([]string, len(timecodes))
+	}
+	var traces []*TileTrace
+	if len(g.CaptureHeaders) > 0 {
+		traces = make([]*TileTrace, len(timecodes))
+	}
+	drawTile, wait := drawer.draw, func() {}
+	if g.MaxDrawers > 1 {
+		drawTile, wait = drawer.parallel(int(g.MaxDrawers))
+		defer wait()
+	}
+	var scaled, degraded int
+	drawOutput := func(output workerOutput) {
+		if urls != nil {
+			urls[output.input.index] = opts.tileURL(output)
+		}
+		if traces != nil && output.header != nil {
+			traces[output.input.index] = &TileTrace{Header: output.header, Duration: output.latency}
+		}
+		if output.img == nil {
+			return
+		}
+		if output.scaled {
+			scaled++
+		}
+		if output.input.degraded {
+			degraded++
+		}
+		scores[output.input.index] = output.score
+		captured[output.input.index] = output.input.timecode
+		expires = earliest(expires, output.expires)
+		drawn[output.input.index] = true
+		opts.lossless.add(output.input.index, output.compressed)
+		xpos, ypos := grid.position(output.input.index)
+		drawTile(drawInput{
+			workerOutput: output,
+			xposition:    xpos,
+			yposition:    ypos,
+			rows:         grid.rows,
+			columns:      grid.columns,
+		})
+	}
+	handle := drawOutput
+	var outputs []workerOutput
+	if opts.TrimMissingTail {
+		// the size of the sprite is only known once all thumbnails
+		// are fetched.
+		outputs = make([]workerOutput, len(timecodes))
+		handle = func(output workerOutput) {
+			outputs[output.input.index] = output
+		}
+	}
+	if opts.progress != nil {
+		opts.progress.fetching(len(timecodes), opts.stats)
+		h := handle
+		handle = func(output workerOutput) {
+			h(output)
+			opts.progress.addTile()
+		}
+	}
+	inputs := opts.inputs(timecodes)
+	if urls != nil {
+		for _, input := range inputs {
+			urls[input.index] = opts.tileURL(workerOutput{input: input})
+		}
+	}
+	inputs = orderInputs(inputs, opts.FetchOrder, g.nworkers(len(timecodes)), opts.ShuffleSeed)
+	if err := g.fetch(opts.Context, inputs, opts.Prime, handle); err != nil {
+		return nil, nil, err
+	}
+	var warnings []Warning
+	if opts.TrimMissingTail {
+		n, err := trimMissingTail(outputs, opts.ContinueOnError)
+		if err != nil {
+			return nil, nil, err
+		}
+		if trimmed := len(timecodes) - n; trimmed > 0 {
+			warnings = append(warnings, warnf(SeverityDegraded, "%d tiles missing at the end of the range were trimmed, the sprite ends at %v", trimmed, timecodes[n]))
+		}
+		timecodes = timecodes[:n]
+		drawn = drawn[:n]
+		if grid, err = opts.grid(n); err != nil {
+			return nil, nil, err
+		}
+		for _, output := range outputs[:n] {
+			drawOutput(output)
+		}
+	}
+	wait()
+	statuses := make([]TileStatus, len(timecodes))
+	for i := range statuses {
+		switch {
+		case drawn[i]:
+			statuses[i] = TileOK
+		case opts.Placeholder != nil:
+			if drawer.sprite == nil {
+				drawer.init(opts.placeholderSize(), grid)
 			}
-			pos := int((output.input.timecode - opts.Start) / opts.Interval)
-			ypos := pos / columns
-			xpos := pos - ypos*columns
-			input := drawInput{
-				workerOutput: output,
-				xposition:    xpos,
-				yposition:    ypos,
-				rows:         rows,
-				columns:      columns,
+			xpos, ypos := grid.position(i)
+			drawer.fill(xpos, ypos, opts.Placeholder)
+			statuses[i] = TilePlaceholder
+		default:
+			statuses[i] = TileFailed
+		}
+	}
+	if opts.report != nil {
+		opts.report.TileStatuses = statuses
+	}
+	if scaled > 0 {
+		warnings = append(warnings, warnf(SeverityInfo, "%d thumbnails were scaled locally because the video-packager ignored the requested dimensions", scaled))
+	}
+	if degraded > 0 {
+		warnings = append(warnings, warnf(SeverityDegraded, "%d thumbnails were fetched at the fallback size because the video-packager was overloaded", degraded))
+	}
+	if count := countStatus(statuses, TileFailed); count > 0 {
+		warnings = append(warnings, warnf(SeverityDegraded, "%d tiles failed to be fetched and were left blank", count))
+	}
+	if count := countStatus(statuses, TilePlaceholder); count > 0 {
+		warnings = append(warnings, warnf(SeverityDegraded, "%d tiles failed to be fetched and were filled with the placeholder", count))
+	}
+	if drawer.sprite == nil {
+		return nil, nil, ErrNoThumbnails
+	}
+	tiles := make([]Tile, 0, len(timecodes))
+	for i, timecode := range timecodes {
+		if opts.OmitFailedTiles && statuses[i] != TileOK {
+			continue
+		}
+		origin := drawer.origin(grid.position(i))
+		tile := Tile{
+			Start:      timecode,
+			End:        timecode + opts.intervalAt(timecode),
+			CapturedAt: opts.captureTimecode(timecode),
+			Status:     statuses[i],
+			X:          origin.X,
+			Y:          origin.Y,
+			Width:      drawer.tileWidth,
+			Height:     drawer.tileHeight,
+		}
+		if drawn[i] {
+			tile.CapturedAt = captured[i]
+		}
+		if urls != nil {
+			tile.URL = urls[i]
+		}
+		if traces != nil {
+			tile.Trace = traces[i]
+		}
+		if score := scores[i]; score != nil {
+			quality := score.quality
+			if i > 0 && scores[i-1] != nil {
+				quality.Similarity = score.similarity(scores[i-1])
 			}
-			drawer.draw(input)
-		case err := <-workersErrs:
-			return nil, err
-		case err := <-inputErrs:
-			return nil, err
-		case <-opts.Context.Done():
-			return nil, opts.Context.Err()
+			tile.Quality = &quality
+		}
+		if i+1 < len(timecodes) {
+			tile.End = timecodes[i+1]
+		} else if opts.RangeEnd == EndExclusive && tile.End > opts.End {
+			tile.End = opts.End
+		}
+		tiles = append(tiles, tile)
+	}
+	result := GenSpriteResult{
+		TileWidth:  drawer.tileWidth,
+		TileHeight: drawer.tileHeight,
+		Tiles:      tiles,
+		Warnings:   warnings,
+	}
+	for i, status := range statuses {
+		if status != TileOK {
+			result.FailedTimecodes = append(result.FailedTimecodes, timecodes[i])
+		}
+	}
+	if !expires.IsZero() {
+		result.Expires = &expires
+	}
+	return drawer.sprite, &result, nil
+}
+
+func countStatus(statuses []TileStatus, status TileStatus) int {
+	var count int
+	for _, s := range statuses {
+		if s == status {
+			count++
+		}
+	}
+	return count
+}
+
+// trimMissingTail returns the number of thumbnails left after trimming the
+// consecutive failures at the end of the given outputs. Failures before the
+// last generated thumbnail are reported as errors, unless they're server
+// errors tolerated by ContinueOnError.
+func trimMissingTail(outputs []workerOutput, continueOnError bool) (int, error) {
+	n := len(outputs)
+	for n > 0 && outputs[n-1].failure != nil {
+		n--
+	}
+	if n == 0 {
+		return 0, fetchError(outputs[0].input, outputs[0].failure)
+	}
+	for _, output := range outputs[:n] {
+		if output.failure == nil {
+			continue
+		}
+		if continueOnError && output.failure.StatusCode >= http.StatusInternalServerError {
+			continue
 		}
+		return 0, fetchError(output.input, output.failure)
 	}
+	return n, nil
+}
+
+// placeholderSize returns the size of the tiles in the sprite based on the
+// placeholder image, for when no thumbnails are available.
+func (o *GenSpriteOptions) placeholderSize() image.Point {
+	input := workerInput{mode: o.mode, width: o.Width, height: o.Height}
+	width, height := input.expectedSize(o.Placeholder.Bounds())
+	if o.mode.boxed() {
+		width, height = int(o.Width), int(o.Height)
+	}
+	if o.CropRect != nil {
+		return o.CropRect.apply(image.Rect(0, 0, width, height)).Size()
+	}
+	return image.Pt(width, height)
 }
 
 type spriteDrawer struct {
-	sprite *image.RGBA
+	sprite     *image.RGBA
+	tileWidth  int
+	tileHeight int
+	op         draw.Op
+	background image.Image
+	gaps       gaps
+	alignX     Alignment
+	alignY     Alignment
+
+	// gapFill is the color of the gaps between tiles, when it differs
+	// from the background.
+	gapFill image.Image
+}
+
+func (d *spriteDrawer) init(tileSize image.Point, grid grid) {
+	d.tileWidth, d.tileHeight = tileSize.X, tileSize.Y
+	spriteRect := image.Rect(0, 0, d.gaps.length(grid.columns, d.tileWidth), d.gaps.length(grid.rows, d.tileHeight))
+	d.sprite = image.NewRGBA(spriteRect)
+	if d.gapFill != nil && !d.gaps.empty() {
+		d.fillGaps(d.gapFill, d.background, grid.columns, grid.rows)
+	} else if d.background != nil {
+		draw.Draw(d.sprite, spriteRect, d.background, image.Point{}, draw.Src)
+	}
+}
+
+// origin returns the top-left corner of the tile in the given position.
+func (d *spriteDrawer) origin(xpos, ypos int) image.Point {
+	return image.Pt(d.gaps.offset(xpos, d.tileWidth), d.gaps.offset(ypos, d.tileHeight))
 }
 
 func (d *spriteDrawer) draw(input drawInput) {
-	width, height := input.dimensions()
 	if d.sprite == nil {
-		spriteRect := image.Rect(0, 0, width*input.columns, height*input.rows)
-		d.sprite = image.NewRGBA(spriteRect)
+		d.init(image.Pt(input.dimensions()), grid{columns: input.columns, rows: input.rows})
 	}
 
-	var offset int
-	if input.workerOutput.input.letterbox {
-		if diff := width - input.img.Bounds().Dx(); diff > 0 {
-			offset = diff / 2
+	// boxed thumbnails are aligned in the tile (centered by default),
+	// with bars on the axis that doesn't match the aspect ratio of the
+	// tile.
+	var offset image.Point
+	if input.workerOutput.input.scalingMode().boxed() {
+		offset.X = d.alignX.offset(d.tileWidth - input.img.Bounds().Dx())
+		offset.Y = d.alignY.offset(d.tileHeight - input.img.Bounds().Dy())
+	}
+
+	sp := d.origin(input.xposition, input.yposition).Add(offset)
+	r := image.Rectangle{sp, sp.Add(image.Pt(d.tileWidth, d.tileHeight))}
+	draw.Draw(d.sprite, r, input.img, input.img.Bounds().Min, d.op)
+}
+
+// parallel returns a function that draws thumbnails using up to n
+// goroutines, along with a function that waits for all pending draws to
+// finish, which must be called before the sprite is used. Thumbnails occupy
+// non-overlapping regions of the sprite, so they can be drawn concurrently
+// once the sprite is initialized, which happens synchronously in the first
+// call.
+func (d *spriteDrawer) parallel(n int) (draw func(drawInput), wait func()) {
+	inputs := make(chan drawInput)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range inputs {
+				d.draw(input)
+			}
+		}()
+	}
+	draw = func(input drawInput) {
+		if d.sprite == nil {
+			d.init(image.Pt(input.dimensions()), grid{columns: input.columns, rows: input.rows})
 		}
+		inputs <- input
 	}
+	var once sync.Once
+	wait = func() {
+		once.Do(func() {
+			close(inputs)
+			wg.Wait()
+		})
+	}
+	return draw, wait
+}
 
-	sp := image.Pt(width*input.xposition+offset, height*input.yposition)
-	r := image.Rectangle{sp, sp.Add(image.Pt(width, height))}
-	draw.Draw(d.sprite, r, input.img, image.Pt(0, 0), draw.Src)
+// fill resizes the given image to the size of a tile and draws it in the
+// given position, covering the whole tile.
+func (d *spriteDrawer) fill(xpos, ypos int, img image.Image) {
+	img = resize(img, d.tileWidth, d.tileHeight)
+	sp := d.origin(xpos, ypos)
+	r := image.Rectangle{sp, sp.Add(image.Pt(d.tileWidth, d.tileHeight))}
+	draw.Draw(d.sprite, r, img, image.Pt(0, 0), d.op)
 }
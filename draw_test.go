@@ -0,0 +1,245 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGridPosition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		grid     grid
+		expected [][2]int
+	}{
+		{
+			"left to right",
+			grid{columns: 3, rows: 2},
+			[][2]int{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}},
+		},
+		{
+			"right to left",
+			grid{columns: 3, rows: 2, rtl: true},
+			[][2]int{{2, 0}, {1, 0}, {0, 0}, {2, 1}, {1, 1}},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			positions := make([][2]int, len(test.expected))
+			for i := range positions {
+				x, y := test.grid.position(i)
+				positions[i] = [2]int{x, y}
+			}
+			if !reflect.DeepEqual(positions, test.expected) {
+				t.Errorf("wrong positions\nwant %v\ngot  %v", test.expected, positions)
+			}
+		})
+	}
+}
+
+func TestGenSpriteRightToLeft(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         4 * time.Second,
+		Interval:    2 * time.Second,
+		Columns:     2,
+		Height:      72,
+		RightToLeft: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTiles := []Tile{
+		{Start: 0, End: 2 * time.Second, CapturedAt: 0, X: 127, Y: 0, Width: 127, Height: 72},
+		{Start: 2 * time.Second, End: 4 * time.Second, CapturedAt: 2 * time.Second, X: 0, Y: 0, Width: 127, Height: 72},
+		{Start: 4 * time.Second, End: 6 * time.Second, CapturedAt: 4 * time.Second, X: 127, Y: 72, Width: 127, Height: 72},
+	}
+	if !reflect.DeepEqual(result.Tiles, expectedTiles) {
+		t.Errorf("wrong tiles\nwant %#v\ngot  %#v", expectedTiles, result.Tiles)
+	}
+}
+
+func TestTrimMissingTail(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name            string
+		end             time.Duration
+		failAtTimecode  []int64
+		continueOnError bool
+		wantTiles       int
+		wantLastEnd     time.Duration
+		wantStatus      int
+	}{
+		{
+			name:        "missing tail",
+			end:         22 * time.Second,
+			wantTiles:   10,
+			wantLastEnd: 20 * time.Second,
+		},
+		{
+			name:        "no failures",
+			end:         18 * time.Second,
+			wantTiles:   10,
+			wantLastEnd: 20 * time.Second,
+		},
+		{
+			name:           "failure in the middle",
+			end:            22 * time.Second,
+			failAtTimecode: []int64{4000},
+			wantStatus:     http.StatusInternalServerError,
+		},
+		{
+			name:            "server error in the middle with ContinueOnError",
+			end:             22 * time.Second,
+			failAtTimecode:  []int64{4000},
+			continueOnError: true,
+			wantTiles:       10,
+			wantLastEnd:     20 * time.Second,
+		},
+		{
+			name:       "all missing",
+			end:        22 * time.Minute,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.failAtTimecode = test.failAtTimecode
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+			start := time.Duration(0)
+			if test.wantStatus == http.StatusBadRequest {
+				start = 20 * time.Minute
+			}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:           start,
+				End:             test.end,
+				Interval:        2 * time.Second,
+				Columns:         4,
+				Height:          72,
+				TrimMissingTail: true,
+				ContinueOnError: test.continueOnError,
+			})
+			if test.wantStatus != 0 {
+				var pkgErr *VideoPackagerError
+				if !errors.As(err, &pkgErr) {
+					t.Fatalf("wrong error\nwant *VideoPackagerError\ngot  %#v", err)
+				}
+				if pkgErr.StatusCode != test.wantStatus {
+					t.Errorf("wrong status code\nwant %d\ngot  %d", test.wantStatus, pkgErr.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Tiles) != test.wantTiles {
+				t.Fatalf("wrong number of tiles\nwant %d\ngot  %d", test.wantTiles, len(result.Tiles))
+			}
+			if lastEnd := result.Tiles[len(result.Tiles)-1].End; lastEnd != test.wantLastEnd {
+				t.Errorf("wrong end of the last tile\nwant %v\ngot  %v", test.wantLastEnd, lastEnd)
+			}
+			wantHeight := 72 * ((test.wantTiles + 3) / 4)
+			if result.Height != wantHeight {
+				t.Errorf("the sprite wasn't trimmed\nwant height %d\ngot  %d", wantHeight, result.Height)
+			}
+		})
+	}
+}
+
+func TestGenSpriteMaxDrawers(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	opts := GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  3,
+		Height:   72,
+	}
+	sequential := Generator{Translator: packager.translate, MaxWorkers: 4}
+	expected, err := sequential.GenSprite(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel := Generator{Translator: packager.translate, MaxWorkers: 4, MaxDrawers: 4}
+	got, err := parallel.GenSprite(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Error("sprite drawn in parallel differs from the sprite drawn sequentially")
+	}
+}
+
+func TestGenSpriteRows(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name            string
+		rows            uint
+		expectedColumns int
+		expectedRows    int
+	}{
+		{"two rows", 2, 5, 2},
+		{"incomplete last row", 3, 4, 3},
+		{"more rows than tiles", 20, 1, 10},
+		{"single row", 1, 10, 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:      18 * time.Second,
+				Interval: 2 * time.Second,
+				Height:   72,
+				Rows:     test.rows,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns, rows := result.Width/result.TileWidth, result.Height/result.TileHeight
+			if columns != test.expectedColumns || rows != test.expectedRows {
+				t.Errorf("wrong grid\nwant %dx%d\ngot  %dx%d", test.expectedColumns, test.expectedRows, columns, rows)
+			}
+		})
+	}
+}
+
+func TestGenSpriteRowsAndColumns(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://packager", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Rows:     2,
+		Columns:  5,
+	})
+	if !errors.Is(err, ErrInvalidGrid) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidGrid, err)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"time"
+)
+
+// DurationProvider is a function that returns the duration of the given
+// video, e.g. by probing its manifest.
+type DurationProvider func(ctx context.Context, videoURL string) (time.Duration, error)
+
+// clampEnd clamps the End of the given options to the duration of the video,
+// when the generator has a DurationProvider.
+func (g *Generator) clampEnd(opts *GenSpriteOptions) error {
+	if g.DurationProvider == nil {
+		return nil
+	}
+	duration, err := g.DurationProvider(opts.Context, opts.VideoURL)
+	if err != nil {
+		return err
+	}
+	if opts.End <= duration {
+		return nil
+	}
+	opts.End = duration
+	opts.endClamped = true
+	return opts.validate()
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteDurationProvider(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name          string
+		start         time.Duration
+		end           time.Duration
+		wantTiles     int
+		wantClamped   bool
+		expectedError error
+	}{
+		{
+			name:        "End past the duration",
+			end:         30 * time.Second,
+			wantTiles:   10,
+			wantClamped: true,
+		},
+		{
+			name:      "End within the duration",
+			end:       10 * time.Second,
+			wantTiles: 6,
+		},
+		{
+			name:          "Start past the duration",
+			start:         20 * time.Second,
+			end:           30 * time.Second,
+			expectedError: ErrInvalidRange,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			generator := Generator{
+				Translator: packager.translate,
+				MaxWorkers: 4,
+				DurationProvider: func(ctx context.Context, videoURL string) (time.Duration, error) {
+					return 18 * time.Second, nil
+				},
+			}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:    test.start,
+				End:      test.end,
+				Interval: 2 * time.Second,
+				Columns:  4,
+				Height:   72,
+			})
+			if test.expectedError != nil {
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("wrong error\nwant %v\ngot  %v", test.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Tiles) != test.wantTiles {
+				t.Errorf("wrong number of tiles\nwant %d\ngot  %d", test.wantTiles, len(result.Tiles))
+			}
+			if result.EndClamped != test.wantClamped {
+				t.Errorf("wrong EndClamped\nwant %v\ngot  %v", test.wantClamped, result.EndClamped)
+			}
+		})
+	}
+}
+
+func TestGenSpriteDurationProviderError(t *testing.T) {
+	t.Parallel()
+	providerErr := errors.New("manifest not found")
+	generator := Generator{
+		Translator: func(string) (string, error) { return "http://localhost", nil },
+		DurationProvider: func(ctx context.Context, videoURL string) (time.Duration, error) {
+			return 0, providerErr
+		},
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+	})
+	if !errors.Is(err, providerErr) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", providerErr, err)
+	}
+}
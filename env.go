@@ -0,0 +1,49 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by LoadEnv.
+const (
+	EnvMaxWorkers  = "SPRITE_MAX_WORKERS"
+	EnvJPEGQuality = "SPRITE_JPEG_QUALITY"
+)
+
+// LoadEnv fills the fields of the Generator that are left unset with the
+// values defined in the environment, so worker counts and quality can be
+// tuned without code changes:
+//
+//   - SPRITE_MAX_WORKERS sets MaxWorkers;
+//   - SPRITE_JPEG_QUALITY sets JPEGQuality (from 1 to 100).
+//
+// Fields set explicitly take precedence over the environment. LoadEnv must be
+// called before the first use of the Generator, and returns an error if any
+// of the variables holds an invalid value.
+func (g *Generator) LoadEnv() error {
+	return g.loadEnv(os.LookupEnv)
+}
+
+func (g *Generator) loadEnv(lookup func(string) (string, bool)) error {
+	if value, ok := lookup(EnvMaxWorkers); ok && g.MaxWorkers == 0 {
+		maxWorkers, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", EnvMaxWorkers, value, err)
+		}
+		g.MaxWorkers = uint(maxWorkers)
+	}
+	if value, ok := lookup(EnvJPEGQuality); ok && g.JPEGQuality == 0 {
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			return fmt.Errorf("invalid %s %q: must be an integer between 1 and 100", EnvJPEGQuality, value)
+		}
+		g.JPEGQuality = quality
+	}
+	return nil
+}
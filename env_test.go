@@ -0,0 +1,109 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLoadEnv(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name            string
+		env             map[string]string
+		maxWorkers      uint
+		jpegQuality     int
+		wantMaxWorkers  uint
+		wantJPEGQuality int
+		wantErr         bool
+	}{
+		{
+			name: "empty environment",
+		},
+		{
+			name:            "all variables",
+			env:             map[string]string{EnvMaxWorkers: "16", EnvJPEGQuality: "85"},
+			wantMaxWorkers:  16,
+			wantJPEGQuality: 85,
+		},
+		{
+			name:            "explicit fields take precedence",
+			env:             map[string]string{EnvMaxWorkers: "16", EnvJPEGQuality: "85"},
+			maxWorkers:      2,
+			jpegQuality:     50,
+			wantMaxWorkers:  2,
+			wantJPEGQuality: 50,
+		},
+		{
+			name:    "invalid max workers",
+			env:     map[string]string{EnvMaxWorkers: "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric quality",
+			env:     map[string]string{EnvJPEGQuality: "high"},
+			wantErr: true,
+		},
+		{
+			name:    "quality out of range",
+			env:     map[string]string{EnvJPEGQuality: "101"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			g := Generator{MaxWorkers: test.maxWorkers, JPEGQuality: test.jpegQuality}
+			err := g.loadEnv(func(name string) (string, bool) {
+				value, ok := test.env[name]
+				return value, ok
+			})
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("unexpected <nil> error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.MaxWorkers != test.wantMaxWorkers {
+				t.Errorf("wrong MaxWorkers\nwant %d\ngot  %d", test.wantMaxWorkers, g.MaxWorkers)
+			}
+			if g.JPEGQuality != test.wantJPEGQuality {
+				t.Errorf("wrong JPEGQuality\nwant %d\ngot  %d", test.wantJPEGQuality, g.JPEGQuality)
+			}
+		})
+	}
+}
+
+func TestGeneratorJPEGQuality(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	opts := GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  3,
+		Height:   72,
+	}
+	generator := Generator{Translator: packager.translate, JPEGQuality: 90}
+	withDefault, err := generator.GenSprite(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.JPEGQuality = 90
+	explicit, err := generator.GenSprite(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(withDefault, explicit) {
+		t.Error("the JPEGQuality of the Generator wasn't used as the default")
+	}
+}
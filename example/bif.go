@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"time"
+
+	sprite "github.com/fsouza/vod-module-sprite"
+)
+
+// bifMagic is the signature of Roku's BIF (Base Index Frames) files.
+var bifMagic = []byte{0x89, 0x42, 0x49, 0x46, 0x0d, 0x0a, 0x1a, 0x0a}
+
+// bifHeaderSize is the size of the BIF header, including the reserved
+// bytes, before the index.
+const bifHeaderSize = 64
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// writeBIF writes a BIF trick play file with the thumbnails in the sprite to
+// the given writer, cutting each tile out of the sprite, so the thumbnails
+// aren't downloaded again. Tiles must be spaced by interval.
+func writeBIF(w io.Writer, result *sprite.GenSpriteResult, interval time.Duration, quality int) error {
+	if interval <= 0 || interval%time.Millisecond != 0 {
+		return errors.New("bif: interval must be a positive number of milliseconds")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		return err
+	}
+	sub, ok := img.(subImager)
+	if !ok {
+		return errors.New("bif: unsupported sprite image")
+	}
+	frames := make([][]byte, len(result.Tiles))
+	for i, tile := range result.Tiles {
+		var buf bytes.Buffer
+		r := image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height).Add(img.Bounds().Min)
+		if err := jpeg.Encode(&buf, sub.SubImage(r), &jpeg.Options{Quality: quality}); err != nil {
+			return err
+		}
+		frames[i] = buf.Bytes()
+	}
+
+	header := make([]byte, bifHeaderSize)
+	copy(header, bifMagic)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(frames)))
+	binary.LittleEndian.PutUint32(header[16:], uint32(interval/time.Millisecond))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	// the index has an entry per frame, plus one marking the end of the
+	// last frame.
+	index := make([]byte, 8*(len(frames)+1))
+	offset := bifHeaderSize + len(index)
+	for i, tile := range result.Tiles {
+		binary.LittleEndian.PutUint32(index[8*i:], uint32(tile.Start/interval))
+		binary.LittleEndian.PutUint32(index[8*i+4:], uint32(offset))
+		offset += len(frames[i])
+	}
+	binary.LittleEndian.PutUint32(index[8*len(frames):], math.MaxUint32)
+	binary.LittleEndian.PutUint32(index[8*len(frames)+4:], uint32(offset))
+	if _, err := w.Write(index); err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	sprite "github.com/fsouza/vod-module-sprite"
+)
+
+// outputCache is a local cache of generated sprites, keyed by the options
+// used for generating them, so running the same command again reuses the
+// sprite instead of generating it again.
+type outputCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// key returns the cache key for the given configuration. Only options that
+// affect the generated sprite are part of the key.
+func (c *outputCache) key(cfg config) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%d\n%d\n%d\n%d\n%s\n%s\n%s\n%t\n%t\n%d\n%d\n",
+		cfg.packagerEndpoint, cfg.url, cfg.width, cfg.height, cfg.columns,
+		cfg.quality, cfg.interval, cfg.start, cfg.end, cfg.keepRatio,
+		cfg.continueOnError, cfg.fallbackWidth, cfg.fallbackHeight)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *outputCache) path(cfg config, ext string) string {
+	return filepath.Join(c.dir, c.key(cfg)+ext)
+}
+
+// lookup returns the cached sprite for the given configuration, along with
+// the position of its tiles, if it's present and hasn't expired. A nil cache
+// never has sprites.
+func (c *outputCache) lookup(cfg config) (*sprite.GenSpriteResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	path := c.path(cfg, ".jpg")
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	metadata, err := ioutil.ReadFile(c.path(cfg, ".json"))
+	if err != nil {
+		return nil, false
+	}
+	var result sprite.GenSpriteResult
+	if err := json.Unmarshal(metadata, &struct {
+		Tiles *[]sprite.Tile `json:"tiles"`
+	}{&result.Tiles}); err != nil {
+		return nil, false
+	}
+	result.Sprite = data
+	return &result, true
+}
+
+// put stores the sprite generated for the given configuration, along with
+// its metadata. Files are written to temporary files and then renamed, so
+// concurrent runs never see partial sprites. The metadata is written first,
+// as sprites without metadata are ignored.
+func (c *outputCache) put(cfg config, result *sprite.GenSpriteResult) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := c.write(c.path(cfg, ".json"), metadata); err != nil {
+		return err
+	}
+	return c.write(c.path(cfg, ".jpg"), result.Sprite)
+}
+
+func (c *outputCache) write(path string, data []byte) error {
+	f, err := ioutil.TempFile(c.dir, ".sprite-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
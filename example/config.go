@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of the environment variables that can be used to
+// configure the tool. Each flag can be set via an environment variable named
+// after the flag, e.g. SPRITE_MAX_WORKERS for -max-workers.
+const envPrefix = "SPRITE_"
+
+// configFileEnv is the environment variable that points to a JSON file with
+// the configuration. The file is an object keyed by flag name, e.g.
+// {"packager": "http://localhost:3030", "interval": "2s"}.
+const configFileEnv = envPrefix + "CONFIG"
+
+type config struct {
+	packagerEndpoint string
+	maxWorkers       uint
+	maxDecoders      uint
+	maxDrawers       uint
+	queueSize        uint
+	maxThumbBytes    int64
+	maxThumbPixels   int
+	maxAllowedTiles  int
+	granularity      time.Duration
+	checksumHeader   string
+	tokenFile        string
+	tokenHeader      string
+	fallbackWidth    uint
+	fallbackHeight   uint
+	output           string
+	vttOutput        string
+	bifOutput        string
+	spriteURL        string
+	url              string
+	width            uint
+	height           uint
+	columns          uint
+	quality          int
+	interval         time.Duration
+	start            time.Duration
+	end              time.Duration
+	keepRatio        bool
+	continueOnError  bool
+	cacheDir         string
+	cacheTTL         time.Duration
+	drainTimeout     time.Duration
+}
+
+// loadConfig loads the configuration, in order of precedence, from command
+// line flags, environment variables and the config file, falling back to the
+// defaults.
+func loadConfig(name string, args []string, getenv func(string) string) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&cfg.packagerEndpoint, "packager", "http://localhost:3030", "endpoint of the packager")
+	fs.UintVar(&cfg.maxWorkers, "max-workers", 32, "maximum number of workers to be used for thumbnail generation - 0 for picking it based on the number of thumbnails and GOMAXPROCS")
+	fs.UintVar(&cfg.maxDecoders, "max-decoders", 0, "maximum number of thumbnails decoded concurrently - 0 for GOMAXPROCS")
+	fs.UintVar(&cfg.maxDrawers, "max-drawers", 0, "maximum number of goroutines drawing thumbnails concurrently - 0 for drawing them sequentially")
+	fs.UintVar(&cfg.queueSize, "queue-size", 0, "number of thumbnails that can be queued waiting to be drawn")
+	fs.Int64Var(&cfg.maxThumbBytes, "max-thumb-bytes", 0, "maximum size of each thumbnail in bytes - 0 for no limit")
+	fs.IntVar(&cfg.maxThumbPixels, "max-thumb-pixels", 0, "maximum number of pixels of each thumbnail - 0 for no limit")
+	fs.IntVar(&cfg.maxAllowedTiles, "max-allowed-tiles", 0, "maximum number of thumbnails in the sprite - 0 for the library default, negative for no limit")
+	fs.DurationVar(&cfg.granularity, "granularity", 0, "minimum distance between thumbnails that the packager can resolve - 0 for not checking the interval")
+	fs.StringVar(&cfg.checksumHeader, "checksum-header", "", "response header with the checksum of each thumbnail - empty for not verifying thumbnails")
+	fs.StringVar(&cfg.tokenFile, "access-token-file", "", "file with the access token sent to the packager, read again when the token is rejected (e.g. a mounted secret) - empty for not sending a token")
+	fs.StringVar(&cfg.tokenHeader, "access-token-header", "", "header carrying the access token - defaults to Authorization, as a bearer token")
+	fs.UintVar(&cfg.fallbackWidth, "fallback-width", 0, "width of the thumbnails requested when the packager is overloaded - 0 for not degrading")
+	fs.UintVar(&cfg.fallbackHeight, "fallback-height", 0, "height of the thumbnails requested when the packager is overloaded - 0 for not degrading")
+	fs.StringVar(&cfg.output, "o", "thumb.jpg", "output file")
+	fs.StringVar(&cfg.vttOutput, "vtt", "", "output file for the WebVTT thumbnail track - empty for not generating it")
+	fs.StringVar(&cfg.bifOutput, "bif", "", "output file for the Roku BIF trick play file - empty for not generating it")
+	fs.StringVar(&cfg.spriteURL, "sprite-url", "", "url of the sprite referenced by the WebVTT track - defaults to the name of the output file")
+	fs.StringVar(&cfg.url, "url", "http://localhost:3030/videos/devito480p.mp4", "url of the source video")
+	fs.UintVar(&cfg.width, "width", 0, "width of each sprite item - 0 for keeping the aspect ratio/source")
+	fs.UintVar(&cfg.height, "height", 0, "height of each sprite item - 0 for keeping the aspect ratio/source")
+	fs.UintVar(&cfg.columns, "columns", 1, "number of columns in the sprite")
+	fs.IntVar(&cfg.quality, "quality", 80, "JPEG quality of the sprite (1-100)")
+	fs.DurationVar(&cfg.interval, "interval", 2*time.Second, "interval between captures")
+	fs.DurationVar(&cfg.start, "start", 0, "timecode for the starting point")
+	fs.DurationVar(&cfg.end, "end", 2*time.Minute, "timecode for the end point")
+	fs.BoolVar(&cfg.keepRatio, "keep-ratio", false, "keep aspect ratio?")
+	fs.BoolVar(&cfg.continueOnError, "continue-on-error", false, "keep generating the sprite when the packager fails to generate some thumbnails")
+	fs.StringVar(&cfg.cacheDir, "cache-dir", "", "directory for caching generated sprites - empty for disabling the cache")
+	fs.DurationVar(&cfg.cacheTTL, "cache-ttl", 24*time.Hour, "how long cached sprites are reused")
+	fs.DurationVar(&cfg.drainTimeout, "drain-timeout", 30*time.Second, "how long in-flight work may run after SIGINT/SIGTERM before it's canceled")
+
+	if path := getenv(configFileEnv); path != "" {
+		if err := loadConfigFile(fs, path); err != nil {
+			return cfg, err
+		}
+	}
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		envName := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if value := getenv(envName); value != "" && envErr == nil {
+			if err := fs.Set(f.Name, value); err != nil {
+				envErr = fmt.Errorf("invalid value %q for %s: %w", value, envName, err)
+			}
+		}
+	})
+	if envErr != nil {
+		return cfg, envErr
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var values map[string]interface{}
+	dec := json.NewDecoder(f)
+	// numbers are kept as written, as formatting a float64 would turn
+	// large integers into exponents (e.g. 1e+06), which flags reject.
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	for name, value := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("invalid config file %q: unknown option %q", path, name)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid config file %q: invalid value for %q: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+func (c *config) validate() error {
+	if u, err := url.Parse(c.packagerEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid packager endpoint %q", c.packagerEndpoint)
+	}
+	if c.url == "" {
+		return errors.New("missing video url")
+	}
+	if c.output == "" {
+		return errors.New("missing output file")
+	}
+	if c.maxThumbBytes < 0 || c.maxThumbPixels < 0 {
+		return errors.New("max-thumb-bytes and max-thumb-pixels must not be negative")
+	}
+	if c.granularity < 0 {
+		return errors.New("granularity must not be negative")
+	}
+	if c.tokenHeader != "" && c.tokenFile == "" {
+		return errors.New("access-token-header requires access-token-file")
+	}
+	if c.quality < 1 || c.quality > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+	if c.end < c.start {
+		return errors.New("end must not be before start")
+	}
+	if c.end > c.start && c.interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if c.bifOutput != "" && (c.interval <= 0 || c.interval%time.Millisecond != 0) {
+		return errors.New("bif requires an interval with millisecond precision")
+	}
+	if c.cacheDir != "" && c.cacheTTL <= 0 {
+		return errors.New("cache-ttl must be positive")
+	}
+	if c.drainTimeout < 0 {
+		return errors.New("drain-timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// drainOnSignal cancels the given context once the first of the given
+// signals is received and in-flight work had up to timeout to finish, so
+// rollouts don't throw away sprites that are almost done. A second signal
+// cancels it immediately.
+func drainOnSignal(ctx context.Context, timeout time.Duration, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, signals...)
+	go func() {
+		defer signal.Stop(c)
+		select {
+		case sig := <-c:
+			log.Printf("received %v, waiting up to %v for in-flight work to finish", sig, timeout)
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-c:
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+		log.Print("canceling in-flight work")
+		cancel()
+	}()
+	return ctx, cancel
+}
@@ -1,5 +1,12 @@
 module nyt-devito
 
+go 1.27.1
+
 require github.com/fsouza/vod-module-sprite v1.3.0
 
+require (
+	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+)
+
 replace github.com/fsouza/vod-module-sprite v1.3.0 => ../
@@ -1,76 +1,126 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"io"
+	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
+	"syscall"
 
 	sprite "github.com/fsouza/vod-module-sprite"
 )
 
 func main() {
-	packagerEndpoint := flag.String("packager", "http://localhost:3030", "endpoint of the packager")
-	maxWorkers := flag.Uint("max-workers", 32, "maximum number of workers to be used for thumbnail generation")
-	output := flag.String("o", "thumb.jpg", "output file")
-	url := flag.String("url", "http://localhost:3030/videos/devito480p.mp4", "url of the source video")
-	width := flag.Uint("width", 0, "width of each sprite item - 0 for keeping the aspect ratio/source")
-	height := flag.Uint("height", 0, "height of each sprite item - 0 for keeping the aspect ratio/source")
-	interval := flag.Duration("interval", 2*time.Second, "interval between captures")
-	start := flag.Duration("start", 0, "timecode for the starting point")
-	end := flag.Duration("end", 2*time.Minute, "timecode for the end point")
-	keepRatio := flag.Bool("keep-ratio", false, "keep aspect ratio?")
-	flag.Parse()
-
-	generator := sprite.Generator{
-		Translator: getTranslator(*packagerEndpoint),
-		MaxWorkers: *maxWorkers,
+	cfg, err := loadConfig(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(2)
 	}
-	data, err := generator.GenSprite(sprite.GenSpriteOptions{
-		VideoURL:        *url,
-		Width:           *width,
-		Height:          *height,
-		Start:           *start,
-		End:             *end,
-		Interval:        *interval,
-		KeepAspectRatio: *keepRatio,
-		JPEGQuality:     80,
-	})
-	if err != nil {
-		log.Fatalf("failed to generate sprite: %v", err)
-	}
-	f, err := os.Create(*output)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
-	n, err := f.Write(data)
-	if err != nil {
+
+	// on SIGINT/SIGTERM, the generation has up to drain-timeout to finish
+	// before the context is canceled, which aborts in-flight thumbnail
+	// requests instead of leaving them behind on the packager.
+	ctx, cancel := drainOnSignal(context.Background(), cfg.drainTimeout, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var cache *outputCache
+	if cfg.cacheDir != "" {
+		cache = &outputCache{dir: cfg.cacheDir, ttl: cfg.cacheTTL}
+	}
+	result, cached := cache.lookup(cfg)
+	if !cached {
+		generator := sprite.Generator{
+			Translator:        getTranslator(cfg.packagerEndpoint),
+			MaxWorkers:        cfg.maxWorkers,
+			MaxDecoders:       cfg.maxDecoders,
+			MaxDrawers:        cfg.maxDrawers,
+			QueueSize:         cfg.queueSize,
+			MaxThumbBytes:     cfg.maxThumbBytes,
+			MaxThumbPixels:    cfg.maxThumbPixels,
+			MaxAllowedTiles:   cfg.maxAllowedTiles,
+			Granularity:       cfg.granularity,
+			ChecksumHeader:    cfg.checksumHeader,
+			AccessTokenHeader: cfg.tokenHeader,
+		}
+		if cfg.tokenFile != "" {
+			generator.AccessToken = fileAccessToken(cfg.tokenFile)
+		}
+		result, err = generator.GenSpriteWithMetadata(sprite.GenSpriteOptions{
+			Context:         ctx,
+			VideoURL:        cfg.url,
+			Width:           cfg.width,
+			Height:          cfg.height,
+			Columns:         cfg.columns,
+			Start:           cfg.start,
+			End:             cfg.end,
+			Interval:        cfg.interval,
+			KeepAspectRatio: cfg.keepRatio,
+			ContinueOnError: cfg.continueOnError,
+			JPEGQuality:     cfg.quality,
+			FallbackWidth:   cfg.fallbackWidth,
+			FallbackHeight:  cfg.fallbackHeight,
+		})
+		if err != nil {
+			log.Fatalf("failed to generate sprite: %v", err)
+		}
+		if cache != nil {
+			if err := cache.put(cfg, result); err != nil {
+				log.Printf("failed to cache sprite: %v", err)
+			}
+		}
+	}
+
+	// all outputs are derived from the same sprite, so the thumbnails are
+	// downloaded only once.
+	outputs := []output{
+		{cfg.output, func(w io.Writer) error {
+			_, err := w.Write(result.Sprite)
+			return err
+		}},
+		{cfg.vttOutput, func(w io.Writer) error {
+			spriteURL := cfg.spriteURL
+			if spriteURL == "" {
+				spriteURL = filepath.Base(cfg.output)
+			}
+			return result.WriteVTT(w, spriteURL)
+		}},
+		{cfg.bifOutput, func(w io.Writer) error {
+			return writeBIF(w, result, cfg.interval, cfg.quality)
+		}},
+	}
+	if err := writeOutputs(outputs); err != nil {
 		log.Fatal(err)
 	}
-	if n != len(data) {
-		log.Fatalf("failed to write %q: %v", *output, io.ErrShortWrite)
+	if cached {
+		log.Printf("reused cached thumbnail for %q", cfg.output)
+		return
 	}
-	log.Printf("successfully generated thumbnail %q", *output)
+	log.Printf("successfully generated thumbnail %q", cfg.output)
 }
 
 func getTranslator(packagerEndpoint string) sprite.VideoURLTranslator {
-	videoMatch := regexp.MustCompile(`^/videos/(.*)$`)
-	packagerEndpoint = strings.TrimRight(packagerEndpoint, "/")
-	return func(videoURL string) (string, error) {
-		vurl, err := url.Parse(videoURL)
+	return sprite.PathRewriteTranslator(packagerEndpoint, sprite.PathRewrite{
+		Pattern:     regexp.MustCompile(`^/videos/(.*)$`),
+		Replacement: "/thumb/$1",
+	})
+}
+
+// fileAccessToken returns an AccessTokenFunc that reads the token from the
+// given file on every call, so rotated tokens (e.g. in a mounted secret) are
+// picked up when the packager rejects the previous one.
+func fileAccessToken(path string) sprite.AccessTokenFunc {
+	return func(context.Context, string, bool) (string, error) {
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			return "", err
 		}
-		path := videoMatch.ReplaceAllString(vurl.Path, "/thumb/$1")
-		if path == vurl.Path {
-			return "", errors.New("invalid video url")
-		}
-		return packagerEndpoint + path, nil
+		return strings.TrimSpace(string(data)), nil
 	}
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// output is a file generated by the tool. Outputs with an empty path are
+// skipped.
+type output struct {
+	path  string
+	write func(io.Writer) error
+}
+
+// writeOutputs writes the given outputs concurrently, returning the first
+// error.
+func writeOutputs(outputs []output) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(outputs))
+	for i, o := range outputs {
+		if o.path == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, o output) {
+			defer wg.Done()
+			if err := writeFile(o.path, o.write); err != nil {
+				errs[i] = fmt.Errorf("failed to write %q: %w", o.path, err)
+			}
+		}(i, o)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
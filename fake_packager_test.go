@@ -5,8 +5,11 @@
 package sprite
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,6 +18,8 @@ import (
 	"regexp"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -27,6 +32,24 @@ type fakePackager struct {
 	suffixRegexp   *regexp.Regexp
 	o              sync.Once
 	failAtTimecode []int64
+	delay          time.Duration
+	requests       int64
+	inFlight       int64
+	cacheControl   map[int64]string
+
+	// digest, when set, makes the packager send the Digest header with
+	// the SHA-256 of each thumbnail ("valid") or of something else
+	// ("invalid").
+	digest string
+
+	// truncate maps timecodes to the number of times the packager should
+	// send a truncated thumbnail for them. When truncateLength is set,
+	// the truncated responses declare the length of the whole thumbnail.
+	truncate       map[int64]int
+	truncateLength bool
+
+	mu          sync.Mutex
+	concurrency []int64
 }
 
 func startFakePackager(folder string) *fakePackager {
@@ -45,6 +68,7 @@ func (p *fakePackager) stop() {
 
 func (p *fakePackager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p.o.Do(p.initRouter)
+	w.Header().Set("X-Served-By", "fake-packager")
 	p.router.ServeHTTP(w, r)
 }
 
@@ -69,12 +93,24 @@ func (p *fakePackager) translate(videoURL string) (string, error) {
 }
 
 func (p *fakePackager) genImage(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&p.requests, 1)
+	p.mu.Lock()
+	p.concurrency = append(p.concurrency, atomic.AddInt64(&p.inFlight, 1))
+	p.mu.Unlock()
+	defer atomic.AddInt64(&p.inFlight, -1)
 	vars := mux.Vars(r)
 	timecode, _ := strconv.ParseInt(vars["timecode"], 10, 64)
 	if p.shouldFail(timecode) {
 		http.Error(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
 	fileName := p.fileName(timecode)
 	if fileName == "" {
 		http.Error(w, "invalid timecode", http.StatusBadRequest)
@@ -86,10 +122,48 @@ func (p *fakePackager) genImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer f.Close()
+	if cacheControl, ok := p.cacheControl[timecode]; ok {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
 	w.Header().Set("Content-Type", "image/jpeg")
+	if p.digest != "" {
+		data, _ := ioutil.ReadAll(f)
+		if p.digest == "invalid" {
+			data = data[:len(data)/2]
+		}
+		sum := sha256.Sum256(data)
+		w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		f.Seek(0, io.SeekStart)
+	}
+	if p.shouldTruncate(timecode) {
+		data, _ := ioutil.ReadAll(f)
+		if p.truncateLength {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		w.Write(data[:len(data)/2])
+		return
+	}
 	io.Copy(w, f)
 }
 
+func (p *fakePackager) shouldTruncate(timecode int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.truncate[timecode] > 0 {
+		p.truncate[timecode]--
+		return true
+	}
+	return false
+}
+
+// requestConcurrency returns, for each request received by the packager, the
+// number of requests in-flight when it arrived (including itself).
+func (p *fakePackager) requestConcurrency() []int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int64(nil), p.concurrency...)
+}
+
 func (p *fakePackager) shouldFail(timecode int64) bool {
 	for _, t := range p.failAtTimecode {
 		if t == timecode {
@@ -0,0 +1,121 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net"
+	"sync/atomic"
+)
+
+// ErrInvalidFallbackSize is returned when FallbackWidth or FallbackHeight
+// aren't smaller than the requested dimensions, or are set for a dimension
+// that isn't requested.
+var ErrInvalidFallbackSize = errors.New("invalid fallback size: must be smaller than the requested dimensions")
+
+// errOriginPressure is returned by the worker when the video-packager
+// responds with 503 and the input can fall back to a smaller size.
+var errOriginPressure = errors.New("video-packager is overloaded")
+
+// fallbackPolicy holds the state of the graceful degradation of a single
+// generation: once a thumbnail fails because the video-packager is
+// overloaded, all remaining thumbnails are fetched at the fallback size.
+type fallbackPolicy struct {
+	width   uint
+	height  uint
+	engaged int32
+}
+
+func (o *GenSpriteOptions) validateFallback() error {
+	if o.FallbackWidth == 0 && o.FallbackHeight == 0 {
+		return nil
+	}
+	if !fallbackDimensionValid(o.FallbackWidth, o.Width) || !fallbackDimensionValid(o.FallbackHeight, o.Height) {
+		return ErrInvalidFallbackSize
+	}
+	return nil
+}
+
+func fallbackDimensionValid(fallback, requested uint) bool {
+	if requested == 0 {
+		return fallback == 0
+	}
+	return fallback > 0 && fallback < requested
+}
+
+func (o *GenSpriteOptions) fallbackPolicy() *fallbackPolicy {
+	if o.FallbackWidth == 0 && o.FallbackHeight == 0 {
+		return nil
+	}
+	return &fallbackPolicy{width: o.FallbackWidth, height: o.FallbackHeight}
+}
+
+// active reports whether the remaining thumbnails should be fetched at
+// the fallback size.
+func (p *fallbackPolicy) active() bool {
+	return p != nil && atomic.LoadInt32(&p.engaged) == 1
+}
+
+// engage switches the generation to the fallback size, reporting whether
+// this call was the one that did it.
+func (p *fallbackPolicy) engage() bool {
+	return atomic.CompareAndSwapInt32(&p.engaged, 0, 1)
+}
+
+// restore scales a thumbnail fetched at the fallback size up to the size
+// it'd have if fetched at the requested dimensions of the given input, so the
+// layout of the sprite doesn't change.
+func (p *fallbackPolicy) restore(img image.Image, input workerInput) image.Image {
+	bounds := img.Bounds()
+	width, height := input.expectedSize(bounds)
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img
+	}
+	return resize(img, width, height)
+}
+
+// fetchSize returns the dimensions requested to the video-packager for the
+// given input: the fallback size when the input is degraded, and the
+// requested dimensions otherwise.
+func (i *workerInput) fetchSize() (width, height uint) {
+	if i.degraded {
+		return i.fallback.width, i.fallback.height
+	}
+	return i.width, i.height
+}
+
+// isOriginPressure reports whether the given error indicates that the
+// video-packager is overloaded: either it responded with 503, or the
+// request timed out while the generation itself is still running.
+func isOriginPressure(ctx context.Context, err error) bool {
+	if err == errOriginPressure {
+		return true
+	}
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// processWithFallback processes the given input at the requested size,
+// falling back to the smaller size when the video-packager is overloaded.
+func (w *worker) processWithFallback(ctx context.Context, input workerInput) (workerOutput, error) {
+	if !input.fallback.active() {
+		output, err := w.processRequested(ctx, input)
+		if !isOriginPressure(ctx, err) {
+			return output, err
+		}
+		if input.fallback.engage() && w.logger != nil {
+			w.logger.Printf("video-packager is overloaded (%v), fetching the remaining thumbnails at the fallback size", err)
+		}
+	}
+	degraded := input
+	degraded.degraded = true
+	degraded.passthrough = false
+	return w.processRequested(ctx, degraded)
+}
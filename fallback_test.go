@@ -0,0 +1,210 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsOriginPressure(t *testing.T) {
+	t.Parallel()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	var tests = []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		{"service unavailable", context.Background(), errOriginPressure, true},
+		{"timeout", context.Background(), fmt.Errorf("get: %w", timeoutError{}), true},
+		{"timeout after cancellation", canceled, timeoutError{}, false},
+		{"other error", context.Background(), errors.New("connection refused"), false},
+		{"no error", context.Background(), nil, false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := isOriginPressure(test.ctx, test.err)
+			if got != test.expected {
+				t.Errorf("wrong result\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteFallbackSize(t *testing.T) {
+	t.Parallel()
+	thumbRegexp := regexp.MustCompile(`thumb-(\d+)-w(\d+)-h(\d+)`)
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := thumbRegexp.FindStringSubmatch(r.URL.Path)
+		timecode, _ := strconv.ParseInt(parts[1], 10, 64)
+		width, _ := strconv.Atoi(parts[2])
+		height, _ := strconv.Atoi(parts[3])
+		requested = append(requested, parts[0])
+		if timecode >= 4000 && width == 64 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		fill(img, color.Gray{Y: 128})
+		jpeg.Encode(w, img, nil)
+	}))
+	defer server.Close()
+	generator := Generator{
+		Translator: func(string) (string, error) { return server.URL, nil },
+		MaxWorkers: 1,
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:       "/video.mp4",
+		End:            8 * time.Second,
+		Interval:       2 * time.Second,
+		Width:          64,
+		Height:         36,
+		FallbackWidth:  32,
+		FallbackHeight: 18,
+		Columns:        5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRequests := []string{
+		"thumb-0-w64-h36",
+		"thumb-2000-w64-h36",
+		"thumb-4000-w64-h36",
+		"thumb-4000-w32-h18",
+		"thumb-6000-w32-h18",
+		"thumb-8000-w32-h18",
+	}
+	if !reflect.DeepEqual(requested, expectedRequests) {
+		t.Errorf("wrong requests\nwant %v\ngot  %v", expectedRequests, requested)
+	}
+	for i, tile := range result.Tiles {
+		if tile.Width != 64 || tile.Height != 36 {
+			t.Errorf("wrong size for tile %d\nwant 64x36\ngot  %dx%d", i, tile.Width, tile.Height)
+		}
+	}
+	expectedWarnings := []Warning{
+		{Severity: SeverityDegraded, Message: "3 thumbnails were fetched at the fallback size because the video-packager was overloaded"},
+	}
+	if !reflect.DeepEqual(result.Warnings, expectedWarnings) {
+		t.Errorf("wrong warnings\nwant %#v\ngot  %#v", expectedWarnings, result.Warnings)
+	}
+}
+
+func TestGenSpriteFallbackSizeLetterbox(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(90, 160))
+	defer source.Close()
+	handler := source.Config.Handler
+	source.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/thumb-0-") && strings.HasSuffix(r.URL.Path, "-h72.jpg") {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	generator := Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+		MaxWorkers: 1,
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Width:           160,
+		Height:          72,
+		FallbackWidth:   80,
+		FallbackHeight:  36,
+		KeepAspectRatio: true,
+		Columns:         3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := []Warning{
+		{Severity: SeverityDegraded, Message: "2 thumbnails were fetched at the fallback size because the video-packager was overloaded"},
+	}
+	if !reflect.DeepEqual(result.Warnings, expectedWarnings) {
+		t.Errorf("wrong warnings\nwant %#v\ngot  %#v", expectedWarnings, result.Warnings)
+	}
+	if result.Width != 480 || result.Height != 72 {
+		t.Errorf("wrong sprite size\nwant 480x72\ngot  %dx%d", result.Width, result.Height)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every thumbnail is 40x72 (the degraded ones are scaled back up),
+	// centered in its 160x72 tile.
+	for i := 0; i < 3; i++ {
+		x := i * 160
+		for _, p := range []image.Point{{x + 63, 3}, {x + 96, 68}} {
+			if y := luminance(sprite, p); y < 100 {
+				t.Errorf("expected the thumbnail of tile %d at %v, got luminance %d", i, p, y)
+			}
+		}
+		if p := image.Pt(x+50, 36); luminance(sprite, p) > 30 {
+			t.Errorf("expected a bar in tile %d at %v, got luminance %d", i, p, luminance(sprite, p))
+		}
+	}
+}
+
+func TestGenSpriteInvalidFallbackSize(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name           string
+		width          uint
+		height         uint
+		fallbackWidth  uint
+		fallbackHeight uint
+	}{
+		{"larger than requested", 64, 36, 128, 18},
+		{"same as requested", 64, 36, 64, 36},
+		{"missing dimension", 64, 36, 32, 0},
+		{"dimension not requested", 64, 0, 32, 18},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL:       "/video.mp4",
+				End:            4 * time.Second,
+				Interval:       2 * time.Second,
+				Width:          test.width,
+				Height:         test.height,
+				FallbackWidth:  test.fallbackWidth,
+				FallbackHeight: test.fallbackHeight,
+			})
+			if !errors.Is(err, ErrInvalidFallbackSize) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidFallbackSize, err)
+			}
+		})
+	}
+}
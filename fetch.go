@@ -0,0 +1,46 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+
+	"github.com/fsouza/vod-module-sprite/internal/pool"
+)
+
+// FetchImages downloads and decodes the JPEG images at the given URLs using
+// the same pool of workers and HTTP client used for generating sprites,
+// invoking handle with each image and its position in urls.
+//
+// Images may be handled in any order, but handle is never invoked
+// concurrently. The first error reported by the server or returned by handle
+// aborts all pending downloads and is returned by FetchImages. Failures
+// fetching images (and the cancellation of ctx) are returned as a
+// *GenerationError, while the errors returned by handle are returned as is.
+func (g *Generator) FetchImages(ctx context.Context, urls []string, handle func(i int, img image.Image) error) error {
+	g.initGenerator()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	w := g.newWorker()
+	err := pool.Run(ctx, len(urls), g.nworkers(len(urls)), func(ctx context.Context, i int) (interface{}, error) {
+		output, err := w.getWithRefetch(func() (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, urls[i], nil)
+		}, workerInput{index: i})
+		if err != nil {
+			return nil, &GenerationError{Stage: StageFetch, URL: urls[i], Err: err}
+		}
+		return output.img, nil
+	}, func(i int, result interface{}) error {
+		return handle(i, result.(image.Image))
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return wrapStage(ctx, StageCanceled, err)
+	}
+	return err
+}
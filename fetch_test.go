@@ -0,0 +1,76 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestFetchImages(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{MaxWorkers: 4}
+	prefix, err := packager.translate("/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{
+		prefix + "/thumb-4000-h72.jpg",
+		prefix + "/thumb-0-h72.jpg",
+		prefix + "/thumb-18000-h72.jpg",
+	}
+	imgs := make([]image.Image, len(urls))
+	err = generator.FetchImages(context.Background(), urls, func(i int, img image.Image) error {
+		imgs[i] = img
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range imgs {
+		if img == nil {
+			t.Errorf("missing image for %s", urls[i])
+			continue
+		}
+		if expected := image.Rect(0, 0, 127, 72); img.Bounds() != expected {
+			t.Errorf("wrong bounds for %s\nwant %v\ngot  %v", urls[i], expected, img.Bounds())
+		}
+	}
+}
+
+func TestFetchImagesErrors(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{MaxWorkers: 4}
+	prefix, err := packager.translate("/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = generator.FetchImages(context.Background(), []string{prefix + "/thumb-40000-h72.jpg"}, func(int, image.Image) error {
+		return nil
+	})
+	var verr *VideoPackagerError
+	if !errors.As(err, &verr) {
+		t.Errorf("expected %#v to be VideoPackagerError, but it wasn't", err)
+	}
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) || genErr.Stage != StageFetch || genErr.URL != prefix+"/thumb-40000-h72.jpg" {
+		t.Errorf("expected %#v to be a GenerationError in the fetch stage with the URL, but it wasn't", err)
+	}
+
+	handleErr := errors.New("something went wrong")
+	err = generator.FetchImages(context.Background(), []string{prefix + "/thumb-0-h72.jpg"}, func(int, image.Image) error {
+		return handleErr
+	})
+	if err != handleErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", handleErr, err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FillOrder determines how tiles fill the rows of the sprite.
+type FillOrder int
+
+const (
+	// FillLeftToRight fills the rows of the sprite from left to right.
+	FillLeftToRight FillOrder = iota
+
+	// FillRightToLeft fills the rows of the sprite from right to left,
+	// for players that mirror the scrubber in right-to-left locales. The
+	// metadata reflects the mirrored layout.
+	FillRightToLeft
+)
+
+// ErrInvalidFillOrder is returned when the fill order is unknown.
+var ErrInvalidFillOrder = errors.New("invalid fill order")
+
+var fillOrderNames = map[FillOrder]string{
+	FillLeftToRight: "left-to-right",
+	FillRightToLeft: "right-to-left",
+}
+
+// String returns the name of the fill order.
+func (o FillOrder) String() string {
+	if name, ok := fillOrderNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("FillOrder(%d)", int(o))
+}
+
+// valid reports whether the fill order is known.
+func (o FillOrder) valid() bool {
+	_, ok := fillOrderNames[o]
+	return ok
+}
+
+// rightToLeft reports whether the tiles fill the rows of the sprite from
+// right to left, either via FillOrder or the deprecated RightToLeft.
+func (o *GenSpriteOptions) rightToLeft() bool {
+	return o.FillOrder == FillRightToLeft || o.RightToLeft
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteFillOrder(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:       4 * time.Second,
+		Interval:  2 * time.Second,
+		Columns:   2,
+		Height:    72,
+		FillOrder: FillRightToLeft,
+	}
+	result, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.FillOrder = FillLeftToRight
+	opts.RightToLeft = true
+	deprecated, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Tiles, deprecated.Tiles) {
+		t.Errorf("wrong tiles\nwant %#v\ngot  %#v", deprecated.Tiles, result.Tiles)
+	}
+	if tile := result.Tiles[0]; tile.X == 0 {
+		t.Errorf("first tile should be on the right, got %#v", tile)
+	}
+}
+
+func TestGenSpriteInvalidFillOrder(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:  "/video.mp4",
+		End:       4 * time.Second,
+		Interval:  2 * time.Second,
+		FillOrder: FillOrder(42),
+	})
+	if !errors.Is(err, ErrInvalidFillOrder) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidFillOrder, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// OutputFormat is the image format of the generated sprite.
+type OutputFormat int
+
+const (
+	// JPEG encodes the sprite as JPEG, with the configured JPEGQuality.
+	JPEG OutputFormat = iota
+
+	// PNG encodes the sprite as PNG, losslessly, so text overlays and
+	// transparency survive without compression artifacts. JPEGQuality is
+	// ignored. Areas of the sprite not covered by opaque thumbnails are
+	// transparent, unless Background is set.
+	PNG
+
+	// AVIF encodes the sprite as AVIF, which is considerably smaller than
+	// JPEG at equivalent quality. This package doesn't include an AVIF
+	// encoder: it requires Generator.AVIFEncoder, which receives
+	// JPEGQuality as the quality.
+	AVIF
+)
+
+// ErrInvalidOutputFormat is returned when the output format is unknown.
+var ErrInvalidOutputFormat = errors.New("invalid output format")
+
+// ErrMissingEncoder is returned when the output format is AVIF and the
+// Generator has no AVIFEncoder.
+var ErrMissingEncoder = errors.New("missing encoder for the output format")
+
+// Encoder encodes the given image to the given writer. quality is the
+// JPEGQuality of the options, which is zero when unset.
+type Encoder func(w io.Writer, img image.Image, quality int) error
+
+var formatNames = map[OutputFormat]string{
+	JPEG: "jpeg",
+	PNG:  "png",
+	AVIF: "avif",
+}
+
+// String returns the name of the format.
+func (f OutputFormat) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("OutputFormat(%d)", int(f))
+}
+
+// valid reports whether the format is known.
+func (f OutputFormat) valid() bool {
+	_, ok := formatNames[f]
+	return ok
+}
+
+// ContentType returns the MIME type of sprites encoded in the format.
+func (f OutputFormat) ContentType() string {
+	return "image/" + f.String()
+}
+
+// MarshalText encodes the format as its name.
+func (f OutputFormat) MarshalText() ([]byte, error) {
+	if _, ok := formatNames[f]; !ok {
+		return nil, fmt.Errorf("invalid output format %d", int(f))
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText decodes a format from its name.
+func (f *OutputFormat) UnmarshalText(text []byte) error {
+	for format, name := range formatNames {
+		if name == string(text) {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q", text)
+}
+
+// encode encodes the given image in the format to the given writer, using
+// the given encoder for AVIF.
+func (f OutputFormat) encode(w io.Writer, img image.Image, quality int, avif Encoder) error {
+	switch f {
+	case PNG:
+		return png.Encode(w, img)
+	case AVIF:
+		return avif(w, img, quality)
+	default:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+}
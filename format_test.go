@@ -0,0 +1,168 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOutputFormatText(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		format      OutputFormat
+		name        string
+		contentType string
+	}{
+		{JPEG, "jpeg", "image/jpeg"},
+		{PNG, "png", "image/png"},
+		{AVIF, "avif", "image/avif"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			text, err := test.format.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(text) != test.name {
+				t.Errorf("wrong name\nwant %q\ngot  %q", test.name, text)
+			}
+			var format OutputFormat
+			if err := format.UnmarshalText(text); err != nil {
+				t.Fatal(err)
+			}
+			if format != test.format {
+				t.Errorf("wrong format\nwant %v\ngot  %v", test.format, format)
+			}
+			if contentType := format.ContentType(); contentType != test.contentType {
+				t.Errorf("wrong content type\nwant %q\ngot  %q", test.contentType, contentType)
+			}
+		})
+	}
+}
+
+func TestOutputFormatInvalidText(t *testing.T) {
+	t.Parallel()
+	if _, err := OutputFormat(42).MarshalText(); err == nil {
+		t.Error("unexpected <nil> error marshaling unknown format")
+	}
+	var format OutputFormat
+	if err := format.UnmarshalText([]byte("gif")); err == nil {
+		t.Error("unexpected <nil> error unmarshaling unknown format")
+	}
+}
+
+func TestGenSpritePNG(t *testing.T) {
+	t.Parallel()
+	server := startSourcePackager(image.Pt(90, 160))
+	defer server.Close()
+	generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             2 * time.Second,
+		Interval:        2 * time.Second,
+		Width:           160,
+		Height:          90,
+		KeepAspectRatio: true,
+		OutputFormat:    PNG,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != PNG {
+		t.Errorf("wrong format in the result\nwant %v\ngot  %v", PNG, result.Format)
+	}
+	img, err := png.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(result.Width, result.Height) {
+		t.Errorf("wrong sprite size\nwant %dx%d\ngot  %v", result.Width, result.Height, size)
+	}
+	// the bars around portrait thumbnails stay transparent, as there's
+	// no background.
+	if _, _, _, a := img.At(10, 45).RGBA(); a != 0 {
+		t.Errorf("wrong alpha in the bars\nwant 0\ngot  %d", a)
+	}
+	if c := color.NRGBAModel.Convert(img.At(80, 45)).(color.NRGBA); c.A != 255 || c.R < 100 {
+		t.Errorf("wrong color in the thumbnail: %v", c)
+	}
+}
+
+func TestGenSpriteInvalidOutputFormat(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          4 * time.Second,
+		Interval:     2 * time.Second,
+		OutputFormat: OutputFormat(42),
+	})
+	if !errors.Is(err, ErrInvalidOutputFormat) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidOutputFormat, err)
+	}
+}
+
+func TestGenSpriteAVIF(t *testing.T) {
+	t.Parallel()
+	server := startSourcePackager(image.Pt(160, 90))
+	defer server.Close()
+	var encoded image.Rectangle
+	var quality int
+	generator := Generator{
+		Translator: func(string) (string, error) { return server.URL, nil },
+		AVIFEncoder: func(w io.Writer, img image.Image, q int) error {
+			encoded, quality = img.Bounds(), q
+			_, err := w.Write([]byte("avif"))
+			return err
+		},
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          2 * time.Second,
+		Interval:     2 * time.Second,
+		Columns:      2,
+		Height:       90,
+		JPEGQuality:  60,
+		OutputFormat: AVIF,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Sprite) != "avif" {
+		t.Errorf("wrong sprite\nwant %q\ngot  %q", "avif", result.Sprite)
+	}
+	if expected := image.Rect(0, 0, 320, 90); encoded != expected {
+		t.Errorf("wrong image encoded\nwant %v\ngot  %v", expected, encoded)
+	}
+	if quality != 60 {
+		t.Errorf("wrong quality\nwant 60\ngot  %d", quality)
+	}
+	if result.Format != AVIF {
+		t.Errorf("wrong format in the result\nwant %v\ngot  %v", AVIF, result.Format)
+	}
+}
+
+func TestGenSpriteAVIFMissingEncoder(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          4 * time.Second,
+		Interval:     2 * time.Second,
+		OutputFormat: AVIF,
+	})
+	if !errors.Is(err, ErrMissingEncoder) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrMissingEncoder, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiresAt returns the time when a response with the given headers, received
+// at the given time, is no longer fresh, based on the Cache-Control, Age and
+// Expires headers. It returns false when the response doesn't declare its
+// freshness.
+func expiresAt(header http.Header, now time.Time) (time.Time, bool) {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-store" || directive == "no-cache" {
+				return now, true
+			}
+		}
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if !strings.HasPrefix(directive, "max-age=") {
+				continue
+			}
+			maxAge, err := strconv.ParseInt(strings.Trim(directive[len("max-age="):], `"`), 10, 64)
+			if err != nil {
+				return now, true
+			}
+			age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+			return now.Add(time.Duration(maxAge-age) * time.Second), true
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// invalid dates represent a time in the past.
+			return now, true
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// earliest returns the earliest of the given times, ignoring zero values.
+func earliest(t1, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpiresAt(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2018, 5, 26, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		header        http.Header
+		expected      time.Time
+		expectedFound bool
+	}{
+		{"no headers", http.Header{}, time.Time{}, false},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=60"}}, now.Add(time.Minute), true},
+		{"max-age with age", http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, now.Add(40 * time.Second), true},
+		{"no-cache", http.Header{"Cache-Control": {"max-age=60, no-cache"}}, now, true},
+		{"no-store", http.Header{"Cache-Control": {"No-Store"}}, now, true},
+		{"max-age over expires", http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Sat, 26 May 2018 12:00:00 GMT"}}, now.Add(time.Minute), true},
+		{"expires", http.Header{"Expires": {"Sat, 26 May 2018 12:00:00 GMT"}}, now.Add(2 * time.Hour), true},
+		{"invalid expires", http.Header{"Expires": {"0"}}, now, true},
+		{"other directives", http.Header{"Cache-Control": {"public"}}, time.Time{}, false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			expires, found := expiresAt(test.header, now)
+			if found != test.expectedFound || !expires.Equal(test.expected) {
+				t.Errorf("wrong expiry\nwant %v (%v)\ngot  %v (%v)", test.expected, test.expectedFound, expires, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the buckets of HostStats.Latency.
+var latencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBuckets returns the upper bounds of the buckets of
+// HostStats.Latency.
+func LatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), latencyBuckets...)
+}
+
+// HostStats summarizes the requests sent to a single video-packager host
+// during a call, so degraded hosts can be detected (and drained) when
+// thumbnails are spread across multiple hosts (e.g. with RoundRobinHosts).
+type HostStats struct {
+	// Requests is the number of requests sent to the host.
+	Requests int64
+
+	// Errors is the number of requests that failed, either because the
+	// host responded with a status other than 200 or because the request
+	// couldn't be completed, and Timeouts is the number of those that
+	// timed out.
+	Errors   int64
+	Timeouts int64
+
+	// Latency is the histogram of the time until the host responded (or
+	// the request failed): Latency[i] counts the requests that took at
+	// most LatencyBuckets()[i], and the last element counts the slower
+	// ones.
+	Latency []int64
+}
+
+func (s *HostStats) observe(latency time.Duration, resp *http.Response, err error) {
+	if s.Latency == nil {
+		s.Latency = make([]int64, len(latencyBuckets)+1)
+	}
+	s.Requests++
+	bucket := len(latencyBuckets)
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.Latency[bucket]++
+	if err != nil || resp.StatusCode != http.StatusOK {
+		s.Errors++
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		s.Timeouts++
+	}
+}
+
+func (s *fetchStats) observeResponse(host string, latency time.Duration, resp *http.Response, err error) {
+	if s == nil {
+		return
+	}
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+	if s.hosts == nil {
+		s.hosts = make(map[string]*HostStats)
+	}
+	stats, ok := s.hosts[host]
+	if !ok {
+		stats = &HostStats{}
+		s.hosts[host] = stats
+	}
+	stats.observe(latency, resp, err)
+}
+
+// hostStats returns a copy of the stats of each host.
+func (s *fetchStats) hostStats() map[string]HostStats {
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+	if len(s.hosts) == 0 {
+		return nil
+	}
+	hosts := make(map[string]HostStats, len(s.hosts))
+	for host, stats := range s.hosts {
+		stats := *stats
+		stats.Latency = append([]int64(nil), stats.Latency...)
+		hosts[host] = stats
+	}
+	return hosts
+}
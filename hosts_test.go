@@ -0,0 +1,74 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHostStatsObserve(t *testing.T) {
+	t.Parallel()
+	ok := &http.Response{StatusCode: http.StatusOK}
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	timeout := &url.Error{Op: "Get", URL: "http://packager/thumb-0.jpg", Err: timeoutError{}}
+	var stats HostStats
+	stats.observe(10*time.Millisecond, ok, nil)
+	stats.observe(50*time.Millisecond, ok, nil)
+	stats.observe(300*time.Millisecond, unavailable, nil)
+	stats.observe(time.Minute, nil, timeout)
+	stats.observe(time.Millisecond, nil, errors.New("connection refused"))
+	expected := HostStats{
+		Requests: 5,
+		Errors:   3,
+		Timeouts: 1,
+		Latency:  []int64{3, 0, 0, 1, 0, 0, 0, 0, 1},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("wrong stats\nwant %#v\ngot  %#v", expected, stats)
+	}
+}
+
+func TestUsageHookHosts(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{2000}
+	var usage Usage
+	generator := Generator{
+		Translator: packager.translate,
+		MaxWorkers: 2,
+		UsageHook:  func(u Usage) { usage = u },
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Height:          72,
+		ContinueOnError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := packager.server.Listener.Addr().String()
+	if len(usage.Hosts) != 1 {
+		t.Fatalf("wrong hosts\nwant only %s\ngot  %v", host, usage.Hosts)
+	}
+	stats := usage.Hosts[host]
+	if stats.Requests != 3 || stats.Errors != 1 || stats.Timeouts != 0 {
+		t.Errorf("wrong stats\nwant 3 requests, 1 error and 0 timeouts\ngot  %d requests, %d errors and %d timeouts", stats.Requests, stats.Errors, stats.Timeouts)
+	}
+	var observed int64
+	for _, n := range stats.Latency {
+		observed += n
+	}
+	if len(stats.Latency) != len(LatencyBuckets())+1 || observed != 3 {
+		t.Errorf("wrong latency histogram: %v", stats.Latency)
+	}
+}
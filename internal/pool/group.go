@@ -0,0 +1,55 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Group is a collection of goroutines working on subtasks of the same task,
+// modeled after golang.org/x/sync/errgroup: the first error reported by any
+// of the goroutines cancels the context of the group and is returned by
+// Wait.
+type Group struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// WithContext returns a new Group and a context derived from ctx, which is
+// canceled when a goroutine in the group fails or when Wait returns.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Go runs the given function in a new goroutine, failing the group if it
+// returns an error.
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all goroutines in the group have returned, returning the
+// first error reported.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
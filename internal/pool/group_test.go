@@ -0,0 +1,45 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+	g, ctx := WithContext(context.Background())
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("context wasn't canceled after Wait returned")
+	}
+}
+
+func TestGroupFirstError(t *testing.T) {
+	t.Parallel()
+	firstErr := errors.New("first error")
+	g, ctx := WithContext(context.Background())
+	g.Go(func() error {
+		return firstErr
+	})
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+	if err := g.Wait(); err != firstErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", firstErr, err)
+	}
+}
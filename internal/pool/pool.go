@@ -0,0 +1,150 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pool implements a bounded pool of workers that process a list of
+// items concurrently, aborting all pending work on the first error.
+package pool
+
+import "context"
+
+// ProcessFunc processes the item at the given index. It's invoked
+// concurrently by the workers in the pool.
+type ProcessFunc func(ctx context.Context, i int) (interface{}, error)
+
+// HandleFunc handles the result of processing the item at the given index.
+type HandleFunc func(i int, result interface{}) error
+
+type output struct {
+	index  int
+	result interface{}
+}
+
+// Config is the configuration of a pool.
+type Config struct {
+	// Workers is the maximum number of goroutines processing items.
+	Workers int
+
+	// Buffer is the number of results that can be queued waiting to be
+	// handled, so workers don't block when handle is slower than
+	// process. The zero value means workers wait for each result to be
+	// handled before processing the next item.
+	Buffer int
+
+	// QueueDepth, when set, is invoked from the calling goroutine before
+	// each result is handled, with the number of results queued behind
+	// it.
+	QueueDepth func(depth int)
+}
+
+// Run processes the items in the range [0, n) using at most nworkers
+// goroutines, invoking handle with the result of each item. Items are handed
+// to the workers in order, but results may arrive in any order. handle is
+// always invoked from the calling goroutine.
+//
+// Run returns the first error returned by process or handle, canceling the
+// context passed to process so in-flight work is aborted. Errors returned by
+// process after the cancellation are considered consequences of it and are
+// discarded. When the given context is canceled before all items are
+// handled, Run returns its error. In any case, Run only returns after all
+// goroutines it started have exited.
+func Run(ctx context.Context, n, nworkers int, process ProcessFunc, handle HandleFunc) error {
+	return RunConfig(ctx, n, Config{Workers: nworkers}, process, handle)
+}
+
+// RunConfig is like Run, but takes the full configuration of the pool.
+func RunConfig(ctx context.Context, n int, config Config, process ProcessFunc, handle HandleFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nworkers := config.Workers
+	if nworkers < 1 {
+		nworkers = 1
+	}
+
+	// workers get their own context so in-flight work can be canceled
+	// as soon as the process fails.
+	g, workersCtx := WithContext(ctx)
+	inputs := make(chan int)
+	outputs := make(chan output, config.Buffer)
+	g.Go(func() error {
+		sendInputs(workersCtx, n, inputs)
+		return nil
+	})
+	for i := 0; i < nworkers; i++ {
+		g.Go(func() error {
+			return runWorker(workersCtx, process, inputs, outputs)
+		})
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Wait()
+		close(outputs)
+	}()
+
+	var handled int
+	var handleErr error
+	for output := range outputs {
+		if handleErr != nil {
+			// keep draining until all workers exit.
+			continue
+		}
+		if config.QueueDepth != nil {
+			config.QueueDepth(len(outputs))
+		}
+		if handleErr = handle(output.index, output.result); handleErr != nil {
+			g.cancel()
+			continue
+		}
+		handled++
+	}
+	// errors reported by the workers after handle fails are discarded,
+	// so any error here happened first.
+	if err := <-done; err != nil {
+		return err
+	}
+	if handleErr != nil {
+		return handleErr
+	}
+	if handled < n {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// sendInputs sends the indexes of the items to the workers, stopping early
+// when the context is canceled.
+func sendInputs(ctx context.Context, n int, inputs chan<- int) {
+	defer close(inputs)
+	for i := 0; i < n; i++ {
+		select {
+		case inputs <- i:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runWorker processes the items received from the inputs channel until it's
+// closed or the context is canceled. Errors returned by process after the
+// cancellation are discarded.
+func runWorker(ctx context.Context, process ProcessFunc, inputs <-chan int, outputs chan<- output) error {
+	for i := range inputs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		result, err := process(ctx, i)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case outputs <- output{index: i, result: result}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
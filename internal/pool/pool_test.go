@@ -0,0 +1,218 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	const n = 50
+	var inFlight, maxInFlight int64
+	seen := make([]bool, n)
+	err := Run(context.Background(), n, 4, func(ctx context.Context, i int) (interface{}, error) {
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return i * 2, nil
+	}, func(i int, result interface{}) error {
+		if result.(int) != i*2 {
+			t.Errorf("wrong result for item %d: %v", i, result)
+		}
+		seen[i] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("item %d wasn't handled", i)
+		}
+	}
+	if maxInFlight > 4 {
+		t.Errorf("too many concurrent workers\nwant at most 4\ngot  %d", maxInFlight)
+	}
+}
+
+func TestRunProcessError(t *testing.T) {
+	t.Parallel()
+	processErr := errors.New("something went wrong")
+	err := Run(context.Background(), 100, 8, func(ctx context.Context, i int) (interface{}, error) {
+		if i == 10 {
+			return nil, processErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+			return i, nil
+		}
+	}, func(int, interface{}) error { return nil })
+	if err != processErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", processErr, err)
+	}
+}
+
+func TestRunHandleError(t *testing.T) {
+	t.Parallel()
+	handleErr := errors.New("something went wrong")
+	err := Run(context.Background(), 100, 8, func(ctx context.Context, i int) (interface{}, error) {
+		return i, nil
+	}, func(i int, _ interface{}) error {
+		if i == 5 {
+			return handleErr
+		}
+		return nil
+	})
+	if err != handleErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", handleErr, err)
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Run(ctx, 10, 2, func(ctx context.Context, i int) (interface{}, error) {
+		return i, nil
+	}, func(int, interface{}) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", context.Canceled, err)
+	}
+}
+
+func TestRunErrorStorm(t *testing.T) {
+	t.Parallel()
+	for attempt := 0; attempt < 50; attempt++ {
+		err := Run(context.Background(), 200, 16, func(ctx context.Context, i int) (interface{}, error) {
+			return nil, fmt.Errorf("item %d failed", i)
+		}, func(int, interface{}) error {
+			t.Error("handle shouldn't be called")
+			return nil
+		})
+		if err == nil || errors.Is(err, context.Canceled) {
+			t.Fatalf("expected one of the process errors, got %v", err)
+		}
+	}
+}
+
+func TestRunReturnsFirstError(t *testing.T) {
+	t.Parallel()
+	firstErr := errors.New("first error")
+	err := Run(context.Background(), 100, 8, func(ctx context.Context, i int) (interface{}, error) {
+		if i == 0 {
+			return nil, firstErr
+		}
+		// every other item fails as a consequence of the first error.
+		<-ctx.Done()
+		return nil, fmt.Errorf("item %d: %w", i, ctx.Err())
+	}, func(int, interface{}) error { return nil })
+	if err != firstErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", firstErr, err)
+	}
+}
+
+func TestRunHandleErrorWithFailingWorkers(t *testing.T) {
+	t.Parallel()
+	handleErr := errors.New("handle failed")
+	var handled int32
+	err := Run(context.Background(), 100, 8, func(ctx context.Context, i int) (interface{}, error) {
+		if atomic.LoadInt32(&handled) == 0 {
+			return i, nil
+		}
+		<-ctx.Done()
+		return nil, errors.New("failed after the handle error")
+	}, func(int, interface{}) error {
+		atomic.StoreInt32(&handled, 1)
+		return handleErr
+	})
+	if err != handleErr {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", handleErr, err)
+	}
+}
+
+func TestRunDoesNotLeakGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for attempt := 0; attempt < 20; attempt++ {
+		Run(context.Background(), 100, 8, func(ctx context.Context, i int) (interface{}, error) {
+			if i%7 == 3 {
+				return nil, errors.New("something went wrong")
+			}
+			return i, nil
+		}, func(i int, _ interface{}) error {
+			if i%11 == 5 {
+				return errors.New("handle failed")
+			}
+			return nil
+		})
+	}
+	// give goroutines from parallel tests some slack.
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("goroutines leaked\nwant at most %d\ngot  %d", before+10, after)
+	}
+}
+
+func TestRunConfigBuffer(t *testing.T) {
+	t.Parallel()
+	const n = 10
+	var processed int64
+	var depths []int
+	err := RunConfig(context.Background(), n, Config{
+		Workers: 2,
+		Buffer:  n,
+		QueueDepth: func(depth int) {
+			depths = append(depths, depth)
+		},
+	}, func(ctx context.Context, i int) (interface{}, error) {
+		atomic.AddInt64(&processed, 1)
+		return i, nil
+	}, func(i int, _ interface{}) error {
+		if len(depths) > 1 {
+			return nil
+		}
+		// with enough buffer, workers don't wait for results to be
+		// handled.
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt64(&processed) < n {
+			if time.Now().After(deadline) {
+				return errors.New("workers blocked waiting for handle")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(depths) != n {
+		t.Fatalf("wrong number of queue depth reports\nwant %d\ngot  %d", n, len(depths))
+	}
+	if last := depths[len(depths)-1]; last != 0 {
+		t.Errorf("wrong depth for the last result\nwant 0\ngot  %d", last)
+	}
+	var max int
+	for _, depth := range depths {
+		if depth > max {
+			max = depth
+		}
+	}
+	if max == 0 {
+		t.Errorf("results were never queued: %v", depths)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phase identifies what a sprite generation started with StartSprite is
+// doing.
+type Phase int
+
+const (
+	// PhasePending indicates that the options are being validated and the
+	// video is being resolved.
+	PhasePending Phase = iota
+
+	// PhaseFetching indicates that thumbnails are being fetched and drawn
+	// into the sprite.
+	PhaseFetching
+
+	// PhaseEncoding indicates that all thumbnails were fetched, and the
+	// sprite is being post-processed and encoded.
+	PhaseEncoding
+
+	// PhaseDone indicates that the generation finished, successfully or
+	// not.
+	PhaseDone
+)
+
+var phaseNames = map[Phase]string{
+	PhasePending:  "pending",
+	PhaseFetching: "fetching",
+	PhaseEncoding: "encoding",
+	PhaseDone:     "done",
+}
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	if name, ok := phaseNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Progress is a snapshot of the progress of a sprite generation.
+type Progress struct {
+	Phase Phase
+
+	// TilesDone is the number of thumbnails fetched so far (including
+	// the ones that failed and were tolerated), out of TilesTotal. Both
+	// are zero until the job reaches PhaseFetching.
+	TilesDone  int
+	TilesTotal int
+
+	BytesDownloaded int64
+
+	// Elapsed is the time since the job started.
+	Elapsed time.Duration
+
+	// TilesPerSecond is the throughput of the job, over the thumbnails
+	// fetched within the last ProgressWindow, so it follows changes in
+	// the load of the video-packager.
+	TilesPerSecond float64
+
+	// ETA is the estimated time until all thumbnails are fetched, given
+	// TilesPerSecond. It's zero when there's no estimate (e.g. no
+	// thumbnail was fetched within the window), and after the thumbnails
+	// are fetched.
+	ETA time.Duration
+}
+
+// ProgressWindow is the sliding window over which the throughput of a job is
+// measured for Progress.TilesPerSecond and Progress.ETA.
+const ProgressWindow = 10 * time.Second
+
+// Job is a sprite generation running in the background, started with
+// StartSprite.
+type Job struct {
+	progress *progress
+	done     chan struct{}
+	result   *GenSpriteResult
+	err      error
+}
+
+// StartSprite starts generating the sprite for the given video in a new
+// goroutine, returning a Job that can be used for polling its progress (e.g.
+// from a status endpoint) and waiting for its result.
+//
+// A job deduplicated by GenSpriteOptions.JobKey into another generation in
+// flight stays in PhasePending until that generation finishes.
+func (g *Generator) StartSprite(opts GenSpriteOptions) *Job {
+	p := &progress{clock: g.Clock, started: now(g.Clock)}
+	opts.progress = p
+	job := &Job{progress: p, done: make(chan struct{})}
+	go func() {
+		defer close(job.done)
+		job.result, job.err = g.GenSpriteWithMetadata(opts)
+		p.finish()
+	}()
+	return job
+}
+
+// Progress returns a snapshot of the progress of the job. It's safe to call
+// Progress from multiple goroutines while the job is running.
+func (j *Job) Progress() Progress {
+	return j.progress.snapshot()
+}
+
+// Done returns a channel that's closed when the job finishes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job to finish, returning the same values as
+// GenSpriteWithMetadata.
+func (j *Job) Wait() (*GenSpriteResult, error) {
+	<-j.done
+	return j.result, j.err
+}
+
+// progress tracks the progress of a job. All methods are no-ops on a nil
+// progress, so generations that aren't started with StartSprite don't pay for
+// tracking.
+type progress struct {
+	clock   Clock
+	started time.Time
+
+	mu         sync.Mutex
+	phase      Phase
+	done       int
+	total      int
+	fetchStart time.Time
+	stats      *fetchStats
+
+	// recent holds the times when the thumbnails fetched within the last
+	// ProgressWindow were fetched, oldest first.
+	recent []time.Time
+}
+
+// fetching moves the job to PhaseFetching, with the given number of
+// thumbnails to fetch.
+func (p *progress) fetching(total int, stats *fetchStats) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = PhaseFetching
+	p.total = total
+	p.stats = stats
+	p.fetchStart = now(p.clock)
+}
+
+// addTile records that one more thumbnail was fetched.
+func (p *progress) addTile() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	t := now(p.clock)
+	p.recent = append(p.recent, t)
+	p.expire(t)
+}
+
+// expire drops the thumbnails fetched before the window that ends at the
+// given time.
+func (p *progress) expire(t time.Time) {
+	var n int
+	for n < len(p.recent) && t.Sub(p.recent[n]) >= ProgressWindow {
+		n++
+	}
+	p.recent = p.recent[n:]
+}
+
+// encoding moves the job to PhaseEncoding.
+func (p *progress) encoding() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = PhaseEncoding
+}
+
+// finish moves the job to PhaseDone.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = PhaseDone
+}
+
+func (p *progress) snapshot() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := now(p.clock)
+	snapshot := Progress{
+		Phase:      p.phase,
+		TilesDone:  p.done,
+		TilesTotal: p.total,
+		Elapsed:    t.Sub(p.started),
+	}
+	if p.stats != nil {
+		snapshot.BytesDownloaded = atomic.LoadInt64(&p.stats.bytes)
+	}
+	if p.phase != PhaseFetching {
+		return snapshot
+	}
+	p.expire(t)
+	// the window is shorter in the beginning of the fetching phase.
+	window := ProgressWindow
+	if elapsed := t.Sub(p.fetchStart); elapsed < window {
+		window = elapsed
+	}
+	if n := len(p.recent); n > 0 && window > 0 {
+		snapshot.TilesPerSecond = float64(n) / window.Seconds()
+		if p.done < p.total {
+			snapshot.ETA = window * time.Duration(p.total-p.done) / time.Duration(n)
+		}
+	}
+	return snapshot
+}
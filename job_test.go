@@ -0,0 +1,157 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStartSpriteProgress(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	gate := make(chan struct{})
+	handler := source.Config.Handler
+	source.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-gate
+		handler.ServeHTTP(w, r)
+	})
+	clock := &fakeClock{now: time.Date(2018, 5, 26, 0, 0, 0, 0, time.UTC)}
+	generator := Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+		MaxWorkers: 1,
+		Clock:      clock,
+	}
+	job := generator.StartSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   90,
+	})
+	progress := waitForProgress(t, job, func(p Progress) bool { return p.Phase == PhaseFetching })
+	if progress.TilesDone != 0 || progress.TilesTotal != 3 || progress.ETA != 0 {
+		t.Errorf("wrong initial progress\nwant 0/3 tiles with no ETA\ngot  %d/%d tiles with ETA %v", progress.TilesDone, progress.TilesTotal, progress.ETA)
+	}
+
+	clock.advance(2 * time.Second)
+	gate <- struct{}{}
+	progress = waitForProgress(t, job, func(p Progress) bool { return p.TilesDone == 1 })
+	if expected := 4 * time.Second; progress.ETA != expected {
+		t.Errorf("wrong ETA\nwant %v\ngot  %v", expected, progress.ETA)
+	}
+	if progress.TilesPerSecond != 0.5 {
+		t.Errorf("wrong throughput\nwant 0.5\ngot  %v", progress.TilesPerSecond)
+	}
+	if expected := 2 * time.Second; progress.Elapsed != expected {
+		t.Errorf("wrong elapsed time\nwant %v\ngot  %v", expected, progress.Elapsed)
+	}
+	if progress.BytesDownloaded == 0 {
+		t.Error("bytes downloaded weren't reported")
+	}
+
+	close(gate)
+	result, err := job.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress = job.Progress()
+	if progress.Phase != PhaseDone || progress.TilesDone != 3 || progress.ETA != 0 {
+		t.Errorf("wrong final progress\nwant done with 3 tiles and no ETA\ngot  %v with %d tiles and ETA %v", progress.Phase, progress.TilesDone, progress.ETA)
+	}
+	if progress.BytesDownloaded != result.BytesDownloaded {
+		t.Errorf("wrong bytes downloaded\nwant %d\ngot  %d", result.BytesDownloaded, progress.BytesDownloaded)
+	}
+}
+
+func TestProgressRollingThroughput(t *testing.T) {
+	t.Parallel()
+	clock := &fakeClock{now: time.Date(2018, 5, 26, 0, 0, 0, 0, time.UTC)}
+	p := &progress{clock: clock, started: clock.Now()}
+	p.fetching(100, nil)
+	// 20 tiles at one per second, then 5 tiles at one every 4 seconds.
+	for i := 0; i < 20; i++ {
+		clock.advance(time.Second)
+		p.addTile()
+	}
+	snapshot := p.snapshot()
+	if snapshot.TilesPerSecond != 1 || snapshot.ETA != 80*time.Second {
+		t.Errorf("wrong estimate at full speed\nwant 1 tile/s and ETA 1m20s\ngot  %v tiles/s and ETA %v", snapshot.TilesPerSecond, snapshot.ETA)
+	}
+	for i := 0; i < 5; i++ {
+		clock.advance(4 * time.Second)
+		p.addTile()
+	}
+	// the window holds only the tiles fetched at 32s, 36s and 40s.
+	snapshot = p.snapshot()
+	if snapshot.TilesPerSecond != 0.3 || snapshot.ETA != 250*time.Second {
+		t.Errorf("wrong estimate after slowing down\nwant 0.3 tiles/s and ETA 4m10s\ngot  %v tiles/s and ETA %v", snapshot.TilesPerSecond, snapshot.ETA)
+	}
+	clock.advance(ProgressWindow)
+	snapshot = p.snapshot()
+	if snapshot.TilesPerSecond != 0 || snapshot.ETA != 0 {
+		t.Errorf("wrong estimate after stalling\nwant no estimate\ngot  %v tiles/s and ETA %v", snapshot.TilesPerSecond, snapshot.ETA)
+	}
+}
+
+func TestStartSpriteError(t *testing.T) {
+	t.Parallel()
+	var generator Generator
+	job := generator.StartSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		Start:    4 * time.Second,
+		End:      2 * time.Second,
+		Interval: time.Second,
+	})
+	<-job.Done()
+	if _, err := job.Wait(); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidRange, err)
+	}
+	if phase := job.Progress().Phase; phase != PhaseDone {
+		t.Errorf("wrong phase\nwant %v\ngot  %v", PhaseDone, phase)
+	}
+}
+
+func TestPhaseString(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		phase    Phase
+		expected string
+	}{
+		{PhasePending, "pending"},
+		{PhaseFetching, "fetching"},
+		{PhaseEncoding, "encoding"},
+		{PhaseDone, "done"},
+		{Phase(42), "Phase(42)"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.expected, func(t *testing.T) {
+			t.Parallel()
+			if got := test.phase.String(); got != test.expected {
+				t.Errorf("wrong name\nwant %q\ngot  %q", test.expected, got)
+			}
+		})
+	}
+}
+
+// waitForProgress polls the progress of the given job until it satisfies the
+// given condition.
+func waitForProgress(t *testing.T, job *Job, cond func(Progress) bool) Progress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if p := job.Progress(); cond(p) {
+			return p
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p := job.Progress()
+	t.Fatalf("timed out waiting for the job: %+v", p)
+	return p
+}
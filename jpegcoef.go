@@ -0,0 +1,803 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// errUnsupportedJPEG is returned when decoding JPEGs whose coefficients
+// can't be reused by the lossless assembly of sprites: anything but
+// baseline JPEGs with one or three components, encoded in a single scan.
+var errUnsupportedJPEG = errors.New("thumbnail isn't a single-scan baseline JPEG")
+
+// errInvalidScan is returned when the entropy-coded data of a JPEG is
+// corrupted or truncated.
+var errInvalidScan = errors.New("invalid entropy-coded data in thumbnail")
+
+// errUnencodable is returned when coefficients can't be represented with the
+// standard Huffman tables used for encoding sprites.
+var errUnencodable = errors.New("coefficients out of the range of baseline JPEGs")
+
+// jpegCoefficients is a baseline JPEG decoded up to its quantized DCT
+// coefficients, which is as far as decoding goes without losing
+// information.
+type jpegCoefficients struct {
+	width  int
+	height int
+
+	// hmax and vmax are the largest sampling factors of the components,
+	// determining the size of an MCU: 8*hmax x 8*vmax pixels.
+	hmax int
+	vmax int
+
+	components []jpegComponent
+}
+
+type jpegComponent struct {
+	id    byte
+	h     int
+	v     int
+	tq    byte
+	quant [64]byte
+
+	// blocks holds the coefficients of the component, row by row, in
+	// zig-zag order, with absolute (not differential) DC coefficients.
+	// There are columns blocks in each row.
+	blocks  [][64]int16
+	columns int
+
+	dc *huffmanDecoder
+	ac *huffmanDecoder
+}
+
+// mcuSize returns the width and the height of an MCU, in pixels.
+func (c *jpegCoefficients) mcuSize() (width, height int) {
+	return 8 * c.hmax, 8 * c.vmax
+}
+
+// mcus returns the number of MCUs in each row and in each column.
+func (c *jpegCoefficients) mcus() (columns, rows int) {
+	width, height := c.mcuSize()
+	return (c.width + width - 1) / width, (c.height + height - 1) / height
+}
+
+// compatible reports whether the given JPEG can be stitched with c: both
+// have the same components, subsampling and quantization tables.
+func (c *jpegCoefficients) compatible(other *jpegCoefficients) bool {
+	if len(c.components) != len(other.components) {
+		return false
+	}
+	for i, comp := range c.components {
+		o := other.components[i]
+		if comp.id != o.id || comp.h != o.h || comp.v != o.v || comp.quant != o.quant {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeCoefficients decodes the given JPEG up to its quantized DCT
+// coefficients. When maxPixels is positive, JPEGs with more pixels are
+// rejected before the coefficients are allocated (see
+// Generator.MaxThumbPixels).
+func decodeCoefficients(data []byte, maxPixels int) (*jpegCoefficients, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errUnsupportedJPEG
+	}
+	var c jpegCoefficients
+	var quant [4]*[64]byte
+	var tables [2][4]*huffmanDecoder
+	var restartInterval int
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return nil, errUnsupportedJPEG
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			// fill byte.
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, errUnsupportedJPEG
+		}
+		segment := data[pos+4 : pos+2+length]
+		pos += 2 + length
+		var err error
+		switch {
+		case marker == 0xdb:
+			err = parseQuantizationTables(segment, &quant)
+		case marker == 0xc4:
+			err = parseHuffmanTables(segment, &tables)
+		case marker == 0xdd:
+			if len(segment) != 2 {
+				return nil, errUnsupportedJPEG
+			}
+			restartInterval = int(binary.BigEndian.Uint16(segment))
+		case marker == 0xc0:
+			err = c.parseFrame(segment)
+		case marker == 0xda:
+			if err := c.parseScan(segment, len(data)-pos, maxPixels, &quant, &tables); err != nil {
+				return nil, err
+			}
+			if err := c.decodeScan(data[pos:], restartInterval); err != nil {
+				return nil, err
+			}
+			return &c, nil
+		case marker == 0xee:
+			// Adobe color transforms would be lost.
+			return nil, errUnsupportedJPEG
+		case marker >= 0xe0 && marker <= 0xef, marker == 0xfe:
+			// application data and comments.
+		default:
+			return nil, errUnsupportedJPEG
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseQuantizationTables(segment []byte, quant *[4]*[64]byte) error {
+	for len(segment) > 0 {
+		precision, id := segment[0]>>4, segment[0]&0x0f
+		if precision != 0 || id > 3 || len(segment) < 65 {
+			return errUnsupportedJPEG
+		}
+		var table [64]byte
+		copy(table[:], segment[1:65])
+		quant[id] = &table
+		segment = segment[65:]
+	}
+	return nil
+}
+
+func parseHuffmanTables(segment []byte, tables *[2][4]*huffmanDecoder) error {
+	for len(segment) > 0 {
+		class, id := segment[0]>>4, segment[0]&0x0f
+		if class > 1 || id > 3 || len(segment) < 17 {
+			return errUnsupportedJPEG
+		}
+		var counts [16]byte
+		copy(counts[:], segment[1:17])
+		var n int
+		for _, count := range counts {
+			n += int(count)
+		}
+		if len(segment) < 17+n {
+			return errUnsupportedJPEG
+		}
+		decoder, err := newHuffmanDecoder(counts, segment[17:17+n])
+		if err != nil {
+			return err
+		}
+		tables[class][id] = decoder
+		segment = segment[17+n:]
+	}
+	return nil
+}
+
+func (c *jpegCoefficients) parseFrame(segment []byte) error {
+	if c.components != nil || len(segment) < 6 || segment[0] != 8 {
+		return errUnsupportedJPEG
+	}
+	c.height = int(binary.BigEndian.Uint16(segment[1:]))
+	c.width = int(binary.BigEndian.Uint16(segment[3:]))
+	n := int(segment[5])
+	if c.width == 0 || c.height == 0 || (n != 1 && n != 3) || len(segment) != 6+3*n {
+		return errUnsupportedJPEG
+	}
+	c.components = make([]jpegComponent, n)
+	c.hmax, c.vmax = 1, 1
+	for i := range c.components {
+		comp := &c.components[i]
+		comp.id = segment[6+3*i]
+		comp.h, comp.v = int(segment[7+3*i]>>4), int(segment[7+3*i]&0x0f)
+		comp.tq = segment[8+3*i]
+		if comp.h < 1 || comp.h > 4 || comp.v < 1 || comp.v > 4 || comp.tq > 3 {
+			return errUnsupportedJPEG
+		}
+		if n == 1 {
+			// a single component is coded one block at a time,
+			// regardless of its sampling factors.
+			comp.h, comp.v = 1, 1
+		}
+		if comp.h > c.hmax {
+			c.hmax = comp.h
+		}
+		if comp.v > c.vmax {
+			c.vmax = comp.v
+		}
+	}
+	return nil
+}
+
+// parseScan parses the header of the scan, which must include all the
+// components in the order of the frame, and resolves the tables used by each
+// component. size is the number of bytes following the header.
+func (c *jpegCoefficients) parseScan(segment []byte, size, maxPixels int, quant *[4]*[64]byte, tables *[2][4]*huffmanDecoder) error {
+	n := len(c.components)
+	if n == 0 || len(segment) != 4+2*n || int(segment[0]) != n {
+		return errUnsupportedJPEG
+	}
+	if maxPixels > 0 && c.width*c.height > maxPixels {
+		return fmt.Errorf("%w: %dx%d, at most %d pixels allowed", ErrThumbDimensions, c.width, c.height, maxPixels)
+	}
+	if start, end, approx := segment[1+2*n], segment[2+2*n], segment[3+2*n]; start != 0 || end != 63 || approx != 0 {
+		return errUnsupportedJPEG
+	}
+	columns, rows := c.mcus()
+	var blocks int
+	for _, comp := range c.components {
+		blocks += columns * rows * comp.h * comp.v
+	}
+	if blocks > 4*size {
+		// every block takes at least two bits (a DC code and an EOB
+		// code), so the frame can't fit in the data that's left.
+		return errInvalidScan
+	}
+	for i := range c.components {
+		comp := &c.components[i]
+		id, selectors := segment[1+2*i], segment[2+2*i]
+		dc, ac := selectors>>4, selectors&0x0f
+		if id != comp.id || dc > 3 || ac > 3 {
+			return errUnsupportedJPEG
+		}
+		comp.dc, comp.ac = tables[0][dc], tables[1][ac]
+		if comp.dc == nil || comp.ac == nil || quant[comp.tq] == nil {
+			return errUnsupportedJPEG
+		}
+		comp.quant = *quant[comp.tq]
+		comp.columns = columns * comp.h
+		comp.blocks = make([][64]int16, comp.columns*rows*comp.v)
+	}
+	return nil
+}
+
+// decodeScan decodes the entropy-coded data of the scan, which starts at the
+// beginning of the given data.
+func (c *jpegCoefficients) decodeScan(data []byte, restartInterval int) error {
+	r := bitReader{data: data}
+	preds := make([]int32, len(c.components))
+	columns, rows := c.mcus()
+	for mcu := 0; mcu < columns*rows; mcu++ {
+		if restartInterval > 0 && mcu > 0 && mcu%restartInterval == 0 {
+			if err := r.restart(mcu/restartInterval - 1); err != nil {
+				return err
+			}
+			for i := range preds {
+				preds[i] = 0
+			}
+		}
+		x, y := mcu%columns, mcu/columns
+		for i := range c.components {
+			comp := &c.components[i]
+			for by := 0; by < comp.v; by++ {
+				for bx := 0; bx < comp.h; bx++ {
+					block := &comp.blocks[(y*comp.v+by)*comp.columns+x*comp.h+bx]
+					if err := r.decodeBlock(block, comp, &preds[i]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// huffmanLookupBits is the number of bits looked up at once when decoding
+// Huffman codes. Longer codes are decoded bit by bit.
+const huffmanLookupBits = 9
+
+// huffmanDecoder decodes the Huffman codes of a table, as described in
+// section F.2.2.3 of the JPEG specification.
+type huffmanDecoder struct {
+	// lookup maps the next huffmanLookupBits bits to value<<8 | length
+	// for codes up to huffmanLookupBits long, and to zero otherwise.
+	lookup [1 << huffmanLookupBits]uint16
+
+	mincode [17]int32
+	maxcode [17]int32
+	valptr  [17]int32
+	values  []byte
+}
+
+func newHuffmanDecoder(counts [16]byte, values []byte) (*huffmanDecoder, error) {
+	d := huffmanDecoder{values: values}
+	var code, k int32
+	for length := 1; length <= 16; length++ {
+		n := int32(counts[length-1])
+		if code+n > 1<<uint(length) || int(k+n) > len(values) {
+			return nil, errUnsupportedJPEG
+		}
+		d.mincode[length], d.valptr[length] = code, k
+		for i := int32(0); i < n && length <= huffmanLookupBits; i++ {
+			shift := uint(huffmanLookupBits - length)
+			prefix := (code + i) << shift
+			for j := int32(0); j < 1<<shift; j++ {
+				d.lookup[prefix|j] = uint16(values[k+i])<<8 | uint16(length)
+			}
+		}
+		code += n
+		k += n
+		d.maxcode[length] = code - 1
+		code <<= 1
+	}
+	return &d, nil
+}
+
+// bitReader reads the entropy-coded data of a scan, removing the stuffed
+// zero bytes.
+type bitReader struct {
+	data []byte
+	pos  int
+
+	// acc holds n bits read ahead, in its least significant bits. When
+	// the data reaches a marker, acc is padded with zeros, which must
+	// not be consumed.
+	acc     uint64
+	n       uint
+	padding uint
+	marker  bool
+}
+
+// fill reads ahead at least 57 bits, enough for decoding a Huffman code and
+// the value that follows it.
+func (r *bitReader) fill() {
+	for r.n <= 56 {
+		var b byte
+		if !r.marker && r.pos < len(r.data) {
+			b = r.data[r.pos]
+			switch {
+			case b != 0xff:
+				r.pos++
+			case r.pos+1 < len(r.data) && r.data[r.pos+1] == 0:
+				r.pos += 2
+			default:
+				r.marker = true
+			}
+		} else {
+			r.marker = true
+		}
+		if r.marker {
+			b = 0
+			r.padding += 8
+		}
+		r.acc = r.acc<<8 | uint64(b)
+		r.n += 8
+	}
+}
+
+// peek returns the next n bits, with n <= 16, without consuming them.
+func (r *bitReader) peek(n uint) uint32 {
+	return uint32(r.acc>>(r.n-n)) & (1<<n - 1)
+}
+
+// consume consumes the next n bits, which must not be padding.
+func (r *bitReader) consume(n uint) error {
+	if r.n-r.padding < n {
+		return errInvalidScan
+	}
+	r.n -= n
+	return nil
+}
+
+// decodeHuffman decodes the next symbol using the given table. At least 16
+// bits must be read ahead.
+func (r *bitReader) decodeHuffman(d *huffmanDecoder) (byte, error) {
+	if entry := d.lookup[r.peek(huffmanLookupBits)]; entry != 0 {
+		return byte(entry >> 8), r.consume(uint(entry & 0xff))
+	}
+	for length := uint(huffmanLookupBits + 1); length <= 16; length++ {
+		if code := int32(r.peek(length)); code <= d.maxcode[length] {
+			return d.values[d.valptr[length]+code-d.mincode[length]], r.consume(length)
+		}
+	}
+	return 0, errInvalidScan
+}
+
+// receiveExtend reads a coefficient of the given magnitude category, which
+// must have been read ahead.
+func (r *bitReader) receiveExtend(s byte) (int32, error) {
+	if s == 0 {
+		return 0, nil
+	}
+	v := int32(r.peek(uint(s)))
+	if err := r.consume(uint(s)); err != nil {
+		return 0, err
+	}
+	if v < 1<<(s-1) {
+		v -= 1<<s - 1
+	}
+	return v, nil
+}
+
+func (r *bitReader) decodeBlock(block *[64]int16, comp *jpegComponent, pred *int32) error {
+	// each coefficient takes up to 27 bits: a Huffman code of up to 16
+	// bits and a value of up to 11 bits.
+	if r.n < 32 {
+		r.fill()
+	}
+	s, err := r.decodeHuffman(comp.dc)
+	if err != nil {
+		return err
+	}
+	if s > 11 {
+		return errInvalidScan
+	}
+	diff, err := r.receiveExtend(s)
+	if err != nil {
+		return err
+	}
+	*pred += diff
+	if *pred < -2048 || *pred > 2047 {
+		return errInvalidScan
+	}
+	block[0] = int16(*pred)
+	for k := 1; k < 64; k++ {
+		if r.n < 32 {
+			r.fill()
+		}
+		rs, err := r.decodeHuffman(comp.ac)
+		if err != nil {
+			return err
+		}
+		run, s := int(rs>>4), rs&0x0f
+		if s == 0 {
+			if run != 15 {
+				// end of block.
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 || s > 10 {
+			return errInvalidScan
+		}
+		v, err := r.receiveExtend(s)
+		if err != nil {
+			return err
+		}
+		block[k] = int16(v)
+	}
+	return nil
+}
+
+// restart skips the restart marker with the given number, discarding the
+// bits left in the current interval.
+func (r *bitReader) restart(n int) error {
+	r.fill()
+	if !r.marker || r.n-r.padding >= 8 {
+		return errInvalidScan
+	}
+	for r.pos+1 < len(r.data) && r.data[r.pos+1] == 0xff {
+		r.pos++
+	}
+	if r.pos+1 >= len(r.data) || r.data[r.pos+1] != 0xd0+byte(n%8) {
+		return errInvalidScan
+	}
+	r.pos += 2
+	r.acc, r.n, r.padding, r.marker = 0, 0, 0, false
+	return nil
+}
+
+// huffmanSpec is a Huffman table as stored in a JPEG: the number of codes of
+// each length, from 1 to 16 bits, and the values in the order of the codes.
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// standardHuffmanSpecs are the tables suggested in section K.3 of the JPEG
+// specification (DC and AC for luminance, followed by DC and AC for
+// chrominance), which cover every symbol of baseline JPEGs, so any
+// coefficients can be encoded with them.
+var standardHuffmanSpecs = [4]huffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanEncoder maps each symbol to length<<16 | code. Symbols that aren't
+// in the table map to zero.
+type huffmanEncoder [256]uint32
+
+func newHuffmanEncoder(spec huffmanSpec) *huffmanEncoder {
+	var e huffmanEncoder
+	var code uint32
+	var k int
+	for length := uint32(1); length <= 16; length++ {
+		for i := 0; i < int(spec.counts[length-1]); i++ {
+			e[spec.values[k]] = length<<16 | code
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return &e
+}
+
+var standardHuffmanEncoders = [4]*huffmanEncoder{
+	newHuffmanEncoder(standardHuffmanSpecs[0]),
+	newHuffmanEncoder(standardHuffmanSpecs[1]),
+	newHuffmanEncoder(standardHuffmanSpecs[2]),
+	newHuffmanEncoder(standardHuffmanSpecs[3]),
+}
+
+// bitWriter writes entropy-coded data, stuffing a zero byte after each 0xff.
+// Errors are sticky: once a symbol can't be encoded, err is set and the
+// output is invalid.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+	err error
+}
+
+// write writes the n least significant bits of bits, with n <= 16.
+func (w *bitWriter) write(bits uint32, n uint) {
+	w.acc = w.acc<<n | uint64(bits&(1<<n-1))
+	w.n += n
+	if w.n >= 32 {
+		w.drain()
+	}
+}
+
+// drain moves the complete bytes in the accumulator to buf.
+func (w *bitWriter) drain() {
+	for w.n >= 8 {
+		b := byte(w.acc >> (w.n - 8))
+		w.buf = append(w.buf, b)
+		if b == 0xff {
+			w.buf = append(w.buf, 0)
+		}
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) writeHuffman(e *huffmanEncoder, symbol byte) {
+	entry := e[symbol]
+	if entry == 0 {
+		w.err = errUnencodable
+		return
+	}
+	w.write(entry&0xffff, uint(entry>>16))
+}
+
+// writeValue writes the given coefficient, prefixed by the Huffman code of
+// its magnitude category combined with the given run of zeros.
+func (w *bitWriter) writeValue(e *huffmanEncoder, run byte, v int32) {
+	magnitude, value := v, v
+	if v < 0 {
+		magnitude, value = -v, v-1
+	}
+	s := uint(bits.Len32(uint32(magnitude)))
+	if s > 15 {
+		w.err = errUnencodable
+		return
+	}
+	w.writeHuffman(e, run<<4|byte(s))
+	if s > 0 {
+		w.write(uint32(value), s)
+	}
+}
+
+func (w *bitWriter) writeBlock(block *[64]int16, pred *int32, dc, ac *huffmanEncoder) {
+	w.writeValue(dc, 0, int32(block[0])-*pred)
+	*pred = int32(block[0])
+	var run byte
+	for k := 1; k < 64; k++ {
+		if block[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			w.writeHuffman(ac, 0xf0)
+		}
+		w.writeValue(ac, run, int32(block[k]))
+		run = 0
+	}
+	if run > 0 {
+		// end of block.
+		w.writeHuffman(ac, 0x00)
+	}
+}
+
+// flush pads the last byte with ones, and moves all bytes to buf.
+func (w *bitWriter) flush() {
+	if pad := (8 - w.n%8) % 8; pad > 0 {
+		w.acc = w.acc<<pad | (1<<pad - 1)
+		w.n += pad
+	}
+	w.drain()
+}
+
+// encodeMosaic encodes a JPEG with the given JPEGs laid out in a grid with
+// the given number of columns, row by row, using the components and
+// quantization tables of the first one. All JPEGs must be compatible and
+// have the same dimensions, which must be multiples of the size of an MCU.
+func encodeMosaic(cells []*jpegCoefficients, columns int) ([]byte, error) {
+	first := cells[0]
+	rows := len(cells) / columns
+	width, height := first.width*columns, first.height*rows
+	if width > 0xffff || height > 0xffff {
+		return nil, errUnencodable
+	}
+	var buf bytes.Buffer
+	first.writeHeaders(&buf, width, height)
+	first.writeScanHeader(&buf)
+	var w bitWriter
+	preds := make([]int32, len(first.components))
+	cellColumns, cellRows := first.mcus()
+	for y := 0; y < rows*cellRows; y++ {
+		for x := 0; x < columns*cellColumns; x++ {
+			cell := cells[y/cellRows*columns+x/cellColumns]
+			cx, cy := x%cellColumns, y%cellRows
+			for i := range cell.components {
+				comp := &cell.components[i]
+				dc, ac := standardHuffmanEncoders[0], standardHuffmanEncoders[1]
+				if i > 0 {
+					dc, ac = standardHuffmanEncoders[2], standardHuffmanEncoders[3]
+				}
+				for by := 0; by < comp.v; by++ {
+					for bx := 0; bx < comp.h; bx++ {
+						block := &comp.blocks[(cy*comp.v+by)*comp.columns+cx*comp.h+bx]
+						w.writeBlock(block, &preds[i], dc, ac)
+					}
+				}
+			}
+		}
+		if w.err != nil {
+			return nil, w.err
+		}
+	}
+	w.flush()
+	buf.Write(w.buf)
+	buf.Write([]byte{0xff, 0xd9})
+	return buf.Bytes(), nil
+}
+
+// writeHeaders writes the beginning of a JPEG with the given dimensions and
+// the components and quantization tables of c, up to the Huffman tables,
+// which are the standard ones.
+func (c *jpegCoefficients) writeHeaders(buf *bytes.Buffer, width, height int) {
+	buf.Write([]byte{0xff, 0xd8})
+
+	// each distinct quantization table is written once.
+	tq := make([]byte, len(c.components))
+	var quant [][64]byte
+	for i, comp := range c.components {
+		tq[i] = byte(len(quant))
+		for j, table := range quant {
+			if table == comp.quant {
+				tq[i] = byte(j)
+			}
+		}
+		if int(tq[i]) == len(quant) {
+			quant = append(quant, comp.quant)
+		}
+	}
+	writeSegment(buf, 0xdb, func(b *bytes.Buffer) {
+		for i, table := range quant {
+			b.WriteByte(byte(i))
+			b.Write(table[:])
+		}
+	})
+	writeSegment(buf, 0xc0, func(b *bytes.Buffer) {
+		b.WriteByte(8)
+		binary.Write(b, binary.BigEndian, uint16(height))
+		binary.Write(b, binary.BigEndian, uint16(width))
+		b.WriteByte(byte(len(c.components)))
+		for i, comp := range c.components {
+			b.Write([]byte{comp.id, byte(comp.h<<4 | comp.v), tq[i]})
+		}
+	})
+	// luminance tables for the first component, and chrominance tables
+	// for the others.
+	tables := 1
+	if len(c.components) > 1 {
+		tables = 2
+	}
+	writeSegment(buf, 0xc4, func(b *bytes.Buffer) {
+		for i := 0; i < tables; i++ {
+			for class := 0; class < 2; class++ {
+				spec := standardHuffmanSpecs[2*i+class]
+				b.WriteByte(byte(class<<4 | i))
+				b.Write(spec.counts[:])
+				b.Write(spec.values)
+			}
+		}
+	})
+}
+
+// writeScanHeader writes the header of a scan with all the components of c,
+// using the tables written by writeHeaders.
+func (c *jpegCoefficients) writeScanHeader(buf *bytes.Buffer) {
+	writeSegment(buf, 0xda, func(b *bytes.Buffer) {
+		b.WriteByte(byte(len(c.components)))
+		for i, comp := range c.components {
+			table := 0
+			if i > 0 {
+				table = 1
+			}
+			b.Write([]byte{comp.id, byte(table<<4 | table)})
+		}
+		b.Write([]byte{0, 63, 0})
+	})
+}
+
+// writeSegment writes a marker segment whose contents are written by fn.
+func writeSegment(buf *bytes.Buffer, marker byte, fn func(*bytes.Buffer)) {
+	var segment bytes.Buffer
+	fn(&segment)
+	buf.Write([]byte{0xff, marker})
+	binary.Write(buf, binary.BigEndian, uint16(segment.Len()+2))
+	buf.Write(segment.Bytes())
+}
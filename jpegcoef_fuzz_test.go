@@ -0,0 +1,26 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package sprite
+
+import (
+	"image"
+	"testing"
+)
+
+func FuzzDecodeCoefficients(f *testing.F) {
+	f.Add(noisyJPEG(f, 1, image.Pt(32, 16), false))
+	f.Add(noisyJPEG(f, 2, image.Pt(24, 8), true))
+	f.Add(noisyJPEG(f, 3, image.Pt(127, 72), false))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := decodeCoefficients(data, 1<<16)
+		if err != nil {
+			return
+		}
+		encodeMosaic([]*jpegCoefficients{c, c}, 2)
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// noisyJPEG returns a JPEG with random pixels, generated from the given seed.
+func noisyJPEG(t testing.TB, seed int64, size image.Point, gray bool) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	var img draw.Image = image.NewRGBA(image.Rectangle{Max: size})
+	if gray {
+		img = image.NewGray(image.Rectangle{Max: size})
+	}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(rng.Intn(256)), G: uint8(x * 4), B: uint8(y * 4), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// samePixels reports whether the region of the given image starting at the
+// given point is identical to the other image.
+func samePixels(img image.Image, p image.Point, other image.Image) bool {
+	b := other.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.At(p.X+x-b.Min.X, p.Y+y-b.Min.Y) != other.At(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEncodeMosaic(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name string
+		gray bool
+	}{
+		{"ycbcr", false},
+		{"gray", true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			size := image.Pt(32, 16)
+			thumbs := make([][]byte, 6)
+			cells := make([]*jpegCoefficients, len(thumbs))
+			for i := range thumbs {
+				thumbs[i] = noisyJPEG(t, int64(i), size, test.gray)
+				var err error
+				if cells[i], err = decodeCoefficients(thumbs[i], 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := encodeMosaic(cells, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mosaic, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := image.Rect(0, 0, 96, 32); mosaic.Bounds() != expected {
+				t.Fatalf("wrong bounds\nwant %v\ngot  %v", expected, mosaic.Bounds())
+			}
+			for i, thumb := range thumbs {
+				img, err := jpeg.Decode(bytes.NewReader(thumb))
+				if err != nil {
+					t.Fatal(err)
+				}
+				p := image.Pt(i%3*size.X, i/3*size.Y)
+				if !samePixels(mosaic, p, img) {
+					t.Errorf("thumbnail %d wasn't copied losslessly to %v", i, p)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeCoefficientsErrors(t *testing.T) {
+	t.Parallel()
+	valid := noisyJPEG(t, 1, image.Pt(32, 16), false)
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 16, 16)))
+	var tests = []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		expected  error
+	}{
+		{"png", pngData.Bytes(), 0, errUnsupportedJPEG},
+		{"truncated header", valid[:20], 0, errUnsupportedJPEG},
+		{"truncated scan", valid[:len(valid)-200], 0, errInvalidScan},
+		{"too many pixels", valid, 32*16 - 1, ErrThumbDimensions},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := decodeCoefficients(test.data, test.maxPixels)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewHuffmanDecoderOverflow(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name   string
+		counts [16]byte
+		values int
+	}{
+		{"too many codes", [16]byte{32}, 32},
+		{"too few values", [16]byte{1, 2}, 2},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := newHuffmanDecoder(test.counts, make([]byte, test.values))
+			if err != errUnsupportedJPEG {
+				t.Errorf("wrong error\nwant %v\ngot  %v", errUnsupportedJPEG, err)
+			}
+		})
+	}
+}
+
+// encodeWithRestarts encodes the given JPEG again, with a restart marker
+// every interval MCUs.
+func encodeWithRestarts(c *jpegCoefficients, interval int) []byte {
+	var buf bytes.Buffer
+	c.writeHeaders(&buf, c.width, c.height)
+	writeSegment(&buf, 0xdd, func(b *bytes.Buffer) {
+		binary.Write(b, binary.BigEndian, uint16(interval))
+	})
+	c.writeScanHeader(&buf)
+	var w bitWriter
+	preds := make([]int32, len(c.components))
+	columns, rows := c.mcus()
+	for mcu := 0; mcu < columns*rows; mcu++ {
+		if mcu > 0 && mcu%interval == 0 {
+			w.flush()
+			w.buf = append(w.buf, 0xff, 0xd0+byte((mcu/interval-1)%8))
+			for i := range preds {
+				preds[i] = 0
+			}
+		}
+		x, y := mcu%columns, mcu/columns
+		for i := range c.components {
+			comp := &c.components[i]
+			dc, ac := standardHuffmanEncoders[0], standardHuffmanEncoders[1]
+			if i > 0 {
+				dc, ac = standardHuffmanEncoders[2], standardHuffmanEncoders[3]
+			}
+			for by := 0; by < comp.v; by++ {
+				for bx := 0; bx < comp.h; bx++ {
+					w.writeBlock(&comp.blocks[(y*comp.v+by)*comp.columns+x*comp.h+bx], &preds[i], dc, ac)
+				}
+			}
+		}
+	}
+	w.flush()
+	buf.Write(w.buf)
+	buf.Write([]byte{0xff, 0xd9})
+	return buf.Bytes()
+}
+
+func TestDecodeCoefficientsRestartMarkers(t *testing.T) {
+	t.Parallel()
+	data := noisyJPEG(t, 1, image.Pt(128, 64), false)
+	original, err := decodeCoefficients(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := encodeWithRestarts(original, 3)
+	expected, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(restarted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(img, image.Point{}, expected) {
+		t.Fatal("the JPEG with restart markers doesn't match the original")
+	}
+	decoded, err := decodeCoefficients(restarted, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, comp := range decoded.components {
+		if !reflect.DeepEqual(comp.blocks, original.components[i].blocks) {
+			t.Errorf("wrong coefficients for component %d", i)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// KeyframeProvider is a function that returns the timecodes of the keyframes
+// of the given video, e.g. by parsing its manifest.
+type KeyframeProvider func(ctx context.Context, videoURL string) ([]time.Duration, error)
+
+// resolveKeyframes returns the sorted list of keyframes that thumbnails should
+// be snapped to, either from the options or from the generator's
+// KeyframeProvider.
+func (g *Generator) resolveKeyframes(opts *GenSpriteOptions) ([]time.Duration, error) {
+	keyframes := opts.Keyframes
+	if len(keyframes) == 0 && g.KeyframeProvider != nil {
+		var err error
+		keyframes, err = g.KeyframeProvider(opts.Context, opts.VideoURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyframes = append([]time.Duration(nil), keyframes...)
+	sort.Slice(keyframes, func(i, j int) bool { return keyframes[i] < keyframes[j] })
+	return keyframes, nil
+}
+
+// nearestKeyframe returns the keyframe nearest to the given timecode, or the
+// timecode itself if there are no keyframes. The list of keyframes must be
+// sorted.
+func nearestKeyframe(keyframes []time.Duration, timecode time.Duration) time.Duration {
+	if len(keyframes) == 0 {
+		return timecode
+	}
+	i := sort.Search(len(keyframes), func(i int) bool { return keyframes[i] >= timecode })
+	if i == len(keyframes) {
+		return keyframes[i-1]
+	}
+	if i > 0 && timecode-keyframes[i-1] <= keyframes[i]-timecode {
+		return keyframes[i-1]
+	}
+	return keyframes[i]
+}
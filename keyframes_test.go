@@ -0,0 +1,95 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNearestKeyframe(t *testing.T) {
+	t.Parallel()
+	keyframes := []time.Duration{0, 4 * time.Second, 8 * time.Second}
+	tests := []struct {
+		name      string
+		keyframes []time.Duration
+		timecode  time.Duration
+		expected  time.Duration
+	}{
+		{"no keyframes", nil, 3 * time.Second, 3 * time.Second},
+		{"exact match", keyframes, 4 * time.Second, 4 * time.Second},
+		{"closer to the previous keyframe", keyframes, 5 * time.Second, 4 * time.Second},
+		{"closer to the next keyframe", keyframes, 7 * time.Second, 8 * time.Second},
+		{"tie favors the previous keyframe", keyframes, 2 * time.Second, 0},
+		{"after the last keyframe", keyframes, 20 * time.Second, 8 * time.Second},
+		{"before the first keyframe", []time.Duration{time.Second}, 0, time.Second},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := nearestKeyframe(test.keyframes, test.timecode)
+			if got != test.expected {
+				t.Errorf("wrong keyframe\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteKeyframeProvider(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator: packager.translate,
+		MaxWorkers: 4,
+		KeyframeProvider: func(ctx context.Context, videoURL string) ([]time.Duration, error) {
+			return []time.Duration{12 * time.Second, 0, 6 * time.Second}, nil
+		},
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      16 * time.Second,
+		Interval: 4 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{0, 6 * time.Second, 6 * time.Second, 12 * time.Second, 12 * time.Second}
+	for i, tile := range result.Tiles {
+		if tile.CapturedAt != expected[i] {
+			t.Errorf("wrong capture timecode for tile %d\nwant %v\ngot  %v", i, expected[i], tile.CapturedAt)
+		}
+		if start := time.Duration(i) * 4 * time.Second; tile.Start != start {
+			t.Errorf("wrong start for tile %d\nwant %v\ngot  %v", i, start, tile.Start)
+		}
+	}
+}
+
+func TestGenSpriteKeyframeProviderError(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	providerErr := errors.New("manifest not found")
+	generator := Generator{
+		Translator: packager.translate,
+		MaxWorkers: 4,
+		KeyframeProvider: func(ctx context.Context, videoURL string) ([]time.Duration, error) {
+			return nil, providerErr
+		},
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      16 * time.Second,
+		Interval: 4 * time.Second,
+		Height:   72,
+	})
+	if !errors.Is(err, providerErr) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", providerErr, err)
+	}
+}
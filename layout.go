@@ -0,0 +1,142 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// LayoutVersion is the version of the Layout format written by this package.
+// It's increased whenever the format changes in a backwards-incompatible way.
+const LayoutVersion = 1
+
+// UnsupportedLayoutVersionError is returned by ParseLayout when the layout
+// was written with a version of the format that isn't supported by this
+// package.
+type UnsupportedLayoutVersionError struct {
+	Version int
+}
+
+// Error returns the string representation of UnsupportedLayoutVersionError.
+func (err *UnsupportedLayoutVersionError) Error() string {
+	return fmt.Sprintf("unsupported layout version %d (supported: %d)", err.Version, LayoutVersion)
+}
+
+// Layout is the versioned, serializable description of the layout of a
+// sprite: its dimensions, its sheets, and the position and time range of
+// each tile. It's the format used for exchanging sprite metadata, so
+// artifacts generated by different versions of this package remain
+// interoperable: the WebVTT and DASH emitters and PatchSprite all work from
+// it. The JSON schema of the format is available in layout.schema.json.
+type Layout struct {
+	Version int          `json:"version"`
+	Format  OutputFormat `json:"format"`
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+
+	// TileWidth and TileHeight are the dimensions of each cell of the
+	// grid, in pixels.
+	TileWidth  int `json:"tile_width"`
+	TileHeight int `json:"tile_height"`
+
+	Tiles []Tile `json:"tiles"`
+
+	// Sheets describes the images of a sprite split into sheets. It's
+	// empty when the sprite is a single image.
+	Sheets []Sheet `json:"sheets,omitempty"`
+
+	// FailedTimecodes lists the timecodes of the thumbnails that failed to
+	// be generated, including the ones left out of Tiles.
+	FailedTimecodes []time.Duration `json:"-"`
+}
+
+// MarshalJSON encodes the layout as JSON, representing timecodes in seconds.
+func (l Layout) MarshalJSON() ([]byte, error) {
+	type layout Layout
+	failed := make([]float64, len(l.FailedTimecodes))
+	for i, timecode := range l.FailedTimecodes {
+		failed[i] = timecode.Seconds()
+	}
+	return json.Marshal(struct {
+		layout
+		FailedTimecodes []float64 `json:"failed_timecodes,omitempty"`
+	}{layout(l), failed})
+}
+
+// UnmarshalJSON decodes a layout encoded by MarshalJSON.
+func (l *Layout) UnmarshalJSON(data []byte) error {
+	type layout Layout
+	decoded := struct {
+		*layout
+		FailedTimecodes []float64 `json:"failed_timecodes"`
+	}{layout: (*layout)(l)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	l.FailedTimecodes = nil
+	for _, timecode := range decoded.FailedTimecodes {
+		l.FailedTimecodes = append(l.FailedTimecodes, seconds(timecode))
+	}
+	return nil
+}
+
+// Layout returns the layout of the sprite.
+func (r *GenSpriteResult) Layout() Layout {
+	return Layout{
+		Version:         LayoutVersion,
+		Format:          r.Format,
+		Width:           r.Width,
+		Height:          r.Height,
+		TileWidth:       r.TileWidth,
+		TileHeight:      r.TileHeight,
+		Tiles:           r.Tiles,
+		Sheets:          r.Sheets,
+		FailedTimecodes: r.FailedTimecodes,
+	}
+}
+
+// result returns a GenSpriteResult with the given layout, and no images.
+func (l *Layout) result() GenSpriteResult {
+	return GenSpriteResult{
+		Format:          l.Format,
+		Width:           l.Width,
+		Height:          l.Height,
+		TileWidth:       l.TileWidth,
+		TileHeight:      l.TileHeight,
+		Tiles:           l.Tiles,
+		Sheets:          l.Sheets,
+		FailedTimecodes: l.FailedTimecodes,
+	}
+}
+
+// ParseLayout decodes a layout encoded as JSON. It returns an
+// *UnsupportedLayoutVersionError if the layout was written with an unknown
+// version of the format.
+func ParseLayout(data []byte) (*Layout, error) {
+	var layout Layout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, err
+	}
+	if layout.Version != LayoutVersion {
+		return nil, &UnsupportedLayoutVersionError{Version: layout.Version}
+	}
+	return &layout, nil
+}
+
+// WriteVTT writes a WebVTT thumbnail track describing the layout to the
+// given writer. See GenSpriteResult.WriteVTT.
+func (l *Layout) WriteVTT(w io.Writer, spriteURL string) error {
+	return writeVTT(w, l.Tiles, []string{spriteURL})
+}
+
+// WriteSheetsVTT writes a WebVTT thumbnail track describing the layout of a
+// sprite split into sheets to the given writer. See
+// GenSpriteResult.WriteSheetsVTT.
+func (l *Layout) WriteSheetsVTT(w io.Writer, sheetURLs []string) error {
+	return writeVTT(w, l.Tiles, sheetURLs)
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLayoutRoundTrip(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Format:     PNG,
+		Width:      128,
+		Height:     144,
+		TileWidth:  128,
+		TileHeight: 72,
+		Tiles: []Tile{
+			{Start: 0, End: 1500 * time.Millisecond, X: 0, Y: 0, Width: 128, Height: 72},
+			{Start: 1500 * time.Millisecond, End: 3 * time.Second, CapturedAt: 2 * time.Second, Status: TilePlaceholder, X: 0, Y: 72, Width: 128, Height: 72},
+		},
+		FailedTimecodes: []time.Duration{1500 * time.Millisecond},
+	}
+	data, err := json.Marshal(result.Layout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"version":1,"format":"png","width":128,"height":144,"tile_width":128,"tile_height":72,"tiles":[{"start":0,"end":1.5,"captured_at":0,"status":"ok","x":0,"y":0,"width":128,"height":72},{"start":1.5,"end":3,"captured_at":2,"status":"placeholder","x":0,"y":72,"width":128,"height":72}],"failed_timecodes":[1.5]}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON\nwant %s\ngot  %s", expected, data)
+	}
+	layout, err := ParseLayout(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := result.Layout(); !reflect.DeepEqual(*layout, want) {
+		t.Errorf("wrong layout\nwant %#v\ngot  %#v", want, *layout)
+	}
+	var fromLayout, fromResult bytes.Buffer
+	if err := layout.WriteVTT(&fromLayout, "sprite.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := result.WriteVTT(&fromResult, "sprite.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if fromLayout.String() != fromResult.String() {
+		t.Errorf("wrong VTT\nwant %s\ngot  %s", fromResult.String(), fromLayout.String())
+	}
+}
+
+func TestLayoutSheets(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Width:      128,
+		Height:     72,
+		TileWidth:  128,
+		TileHeight: 72,
+		Tiles: []Tile{
+			{Start: 0, End: 2 * time.Second, Width: 128, Height: 72},
+			{Start: 2 * time.Second, End: 4 * time.Second, Sheet: 1, Width: 128, Height: 72},
+		},
+		Sheets: []Sheet{
+			{Sprite: []byte("first"), Width: 128, Height: 72, End: 2 * time.Second},
+			{Sprite: []byte("second"), Width: 128, Height: 72, Start: 2 * time.Second, End: 4 * time.Second},
+		},
+	}
+	data, err := json.Marshal(result.Layout())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := ParseLayout(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Sheet{
+		{Width: 128, Height: 72, End: 2 * time.Second},
+		{Width: 128, Height: 72, Start: 2 * time.Second, End: 4 * time.Second},
+	}
+	if !reflect.DeepEqual(layout.Sheets, expected) {
+		t.Errorf("wrong sheets\nwant %#v\ngot  %#v", expected, layout.Sheets)
+	}
+	var fromLayout, fromResult bytes.Buffer
+	urls := []string{"sheet-0.jpg", "sheet-1.jpg"}
+	if err := layout.WriteSheetsVTT(&fromLayout, urls); err != nil {
+		t.Fatal(err)
+	}
+	if err := result.WriteSheetsVTT(&fromResult, urls); err != nil {
+		t.Fatal(err)
+	}
+	if fromLayout.String() != fromResult.String() {
+		t.Errorf("wrong VTT\nwant %s\ngot  %s", fromResult.String(), fromLayout.String())
+	}
+	if err := layout.WriteDASHAdaptationSet(&fromLayout, "thumbnails", "sprite.jpg", 1000); err != ErrIncompatibleDASHLayout {
+		t.Errorf("wrong error for DASH\nwant %v\ngot  %v", ErrIncompatibleDASHLayout, err)
+	}
+}
+
+func TestParseLayoutErrors(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name    string
+		data    string
+		version int
+	}{
+		{
+			name:    "future version",
+			data:    `{"version":2,"width":128,"height":72,"tiles":[]}`,
+			version: 2,
+		},
+		{
+			name: "missing version",
+			data: `{"width":128,"height":72,"tiles":[]}`,
+		},
+		{
+			name: "invalid status",
+			data: `{"version":1,"tiles":[{"status":"broken"}]}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseLayout([]byte(test.data))
+			if err == nil {
+				t.Fatal("unexpected <nil> error")
+			}
+			var versionErr *UnsupportedLayoutVersionError
+			if errors.As(err, &versionErr) && versionErr.Version != test.version {
+				t.Errorf("wrong version in the error\nwant %d\ngot  %d", test.version, versionErr.Version)
+			}
+		})
+	}
+}
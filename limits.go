@@ -0,0 +1,108 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// MaxJPEGDimension is the largest width or height, in pixels, of a JPEG
+// image.
+const MaxJPEGDimension = 65500
+
+// ErrSpriteTooLarge is returned when the sprite (or each of its sheets)
+// would exceed the maximum dimensions of the output format. The error
+// returned is a *SpriteTooLargeError, which can be compared with
+// errors.Is.
+var ErrSpriteTooLarge = errors.New("sprite too large")
+
+// SpriteTooLargeError is returned, before any thumbnails are fetched, when
+// the dimensions of the sprite can be derived from the options and exceed
+// the limit of the output format. Sprites that are too tall can be split
+// with GenSpriteOptions.MaxSheetHeight, and sprites that are too wide need
+// fewer Columns. Width or Height is zero when that dimension is unknown
+// before fetching.
+type SpriteTooLargeError struct {
+	Width  int
+	Height int
+	Max    int
+}
+
+// Error returns the string representation of SpriteTooLargeError.
+func (err *SpriteTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %dx%d, at most %d pixels allowed in each dimension", ErrSpriteTooLarge, err.Width, err.Height, err.Max)
+}
+
+// Is reports whether target is ErrSpriteTooLarge.
+func (err *SpriteTooLargeError) Is(target error) bool {
+	return target == ErrSpriteTooLarge
+}
+
+// checkDimensions ensures that the tiles can be arranged in the sprite and
+// that it doesn't exceed the limits of JPEG, before any requests are sent.
+// Dimensions derived from the source aren't checked, as they're unknown at
+// this point.
+func (o *GenSpriteOptions) checkDimensions() error {
+	grid, err := o.grid(o.N())
+	if err != nil {
+		return err
+	}
+	if o.OutputFormat != JPEG {
+		return nil
+	}
+	tileWidth, tileHeight := o.tileSize()
+	var width, height int
+	gaps := o.gaps()
+	if tileWidth > 0 {
+		width = gaps.length(grid.columns, tileWidth)
+	}
+	if tileHeight > 0 {
+		rows := grid.rows
+		if sheetRows := o.sheetRows(tileHeight); sheetRows > 0 && sheetRows < rows {
+			rows = sheetRows
+		}
+		height = gaps.length(rows, tileHeight)
+	}
+	if o.Orientation != OrientationNormal {
+		width, height = height, width
+	}
+	if width > MaxJPEGDimension || height > MaxJPEGDimension {
+		return &SpriteTooLargeError{Width: width, Height: height, Max: MaxJPEGDimension}
+	}
+	return nil
+}
+
+// tileSize returns the dimensions of the tiles, as far as they can be
+// derived from the options, with 0 for the unknown ones.
+func (o *GenSpriteOptions) tileSize() (width, height int) {
+	switch o.mode {
+	case ScaleExact, ScaleLetterbox, ScaleLetterboxWidth:
+		width, height = int(o.Width), int(o.Height)
+	case ScaleFitWidth:
+		width = int(o.Width)
+	case ScaleFitHeight:
+		height = int(o.Height)
+	}
+	if o.CropRect != nil {
+		// unknown dimensions are cropped as a single pixel and ignored.
+		bounds := image.Rect(0, 0, width, height)
+		if width == 0 {
+			bounds.Max.X = 1
+		}
+		if height == 0 {
+			bounds.Max.Y = 1
+		}
+		cropped := o.CropRect.apply(bounds)
+		if width > 0 {
+			width = cropped.Dx()
+		}
+		if height > 0 {
+			height = cropped.Dy()
+		}
+	}
+	return width, height
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteTooLarge(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		opts     GenSpriteOptions
+		expected *SpriteTooLargeError
+	}{
+		{
+			"too tall",
+			GenSpriteOptions{Width: 1280, Height: 720},
+			&SpriteTooLargeError{Width: 1280, Height: 72000, Max: MaxJPEGDimension},
+		},
+		{
+			"split into sheets",
+			GenSpriteOptions{Width: 1280, Height: 720, MaxSheetHeight: 7200},
+			nil,
+		},
+		{
+			"too wide",
+			GenSpriteOptions{Width: 1280, Height: 720, Columns: 100},
+			&SpriteTooLargeError{Width: 128000, Height: 720, Max: MaxJPEGDimension},
+		},
+		{
+			"rotated",
+			GenSpriteOptions{Width: 1280, Height: 720, Columns: 100, Orientation: OrientationRotate90},
+			&SpriteTooLargeError{Width: 720, Height: 128000, Max: MaxJPEGDimension},
+		},
+		{
+			"cropped",
+			GenSpriteOptions{Width: 1280, Height: 720, CropRect: &NormalizedRect{X1: 1, Y1: 0.5}},
+			nil,
+		},
+		{
+			"height derived from the source",
+			GenSpriteOptions{Width: 1280},
+			nil,
+		},
+		{
+			"height only",
+			GenSpriteOptions{Height: 720},
+			&SpriteTooLargeError{Height: 72000, Max: MaxJPEGDimension},
+		},
+		{
+			"png",
+			GenSpriteOptions{Width: 1280, Height: 720, OutputFormat: PNG},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			generator := Generator{Translator: func(string) (string, error) { return "http://packager", nil }}
+			opts := test.opts
+			opts.VideoURL = "/video.mp4"
+			opts.End = 198 * time.Second
+			opts.Interval = 2 * time.Second
+			err := generator.prepare(&opts)
+			if test.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var tooLarge *SpriteTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("wrong error\nwant %v\ngot  %v", test.expected, err)
+			}
+			if *tooLarge != *test.expected {
+				t.Errorf("wrong error\nwant %#v\ngot  %#v", test.expected, tooLarge)
+			}
+			if !errors.Is(err, ErrSpriteTooLarge) {
+				t.Errorf("error %v should match ErrSpriteTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestGenSpriteTooLargeNoRequests(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+	generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      198 * time.Second,
+		Interval: 2 * time.Second,
+		Width:    1280,
+		Height:   720,
+	})
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) || genErr.Stage != StageValidation || !errors.Is(err, ErrSpriteTooLarge) {
+		t.Errorf("wrong error\nwant %v at %v\ngot  %v", ErrSpriteTooLarge, StageValidation, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("unexpected requests sent to the video-packager: %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// losslessSprite collects the JPEGs returned by the video-packager for a
+// sprite generated with LosslessJPEG, so the sprite can be assembled from
+// their coefficients instead of being encoded from its pixels.
+type losslessSprite struct {
+	// thumbs holds the JPEG of each tile, by index.
+	thumbs [][]byte
+	tiles  []Tile
+
+	// maxPixels is the maximum number of pixels in each thumbnail (see
+	// Generator.MaxThumbPixels).
+	maxPixels int
+
+	// err is the reason why the sprite couldn't be assembled.
+	err error
+}
+
+// checkLossless returns the reason why the options prevent the sprite from
+// being assembled from the thumbnails, or nil when they don't.
+func (o *GenSpriteOptions) checkLossless() error {
+	switch {
+	case o.OutputFormat != JPEG:
+		return fmt.Errorf("the output format is %v", o.OutputFormat)
+	case o.sheeted():
+		return errors.New("the sprite is split into sheets")
+	case !o.gaps().empty():
+		return errors.New("the sprite has gaps between tiles")
+	case o.Orientation != OrientationNormal:
+		return errors.New("the sprite is rotated")
+	case o.PostProcess != nil:
+		return errors.New("the sprite is post-processed")
+	}
+	return nil
+}
+
+// enabled reports whether the thumbnails should be collected.
+func (s *losslessSprite) enabled() bool {
+	return s != nil && s.err == nil
+}
+
+// add records the JPEG of the tile with the given index.
+func (s *losslessSprite) add(index int, data []byte) {
+	if !s.enabled() {
+		return
+	}
+	for len(s.thumbs) <= index {
+		s.thumbs = append(s.thumbs, nil)
+	}
+	s.thumbs[index] = data
+}
+
+// assemble returns the sprite with the given dimensions assembled from the
+// thumbnails, reporting whether it could be assembled. When it can't, the
+// reason is recorded in s.err.
+func (s *losslessSprite) assemble(size image.Point) ([]byte, bool) {
+	if !s.enabled() {
+		return nil, false
+	}
+	data, err := s.stitch(size)
+	if err != nil {
+		s.err = err
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *losslessSprite) stitch(size image.Point) ([]byte, error) {
+	if len(s.tiles) == 0 {
+		return nil, errors.New("the sprite has no tiles")
+	}
+	tileWidth, tileHeight := s.tiles[0].Width, s.tiles[0].Height
+	columns, rows := size.X/tileWidth, size.Y/tileHeight
+	if columns*tileWidth != size.X || rows*tileHeight != size.Y || columns*rows != len(s.tiles) {
+		return nil, errors.New("the tiles don't cover the whole sprite")
+	}
+	cells := make([]*jpegCoefficients, len(s.tiles))
+	var first *jpegCoefficients
+	for i, tile := range s.tiles {
+		if tile.Status != TileOK || i >= len(s.thumbs) || s.thumbs[i] == nil {
+			return nil, fmt.Errorf("tile %d isn't an unmodified thumbnail", i)
+		}
+		thumb, err := decodeCoefficients(s.thumbs[i], s.maxPixels)
+		if err != nil {
+			return nil, fmt.Errorf("tile %d: %w", i, err)
+		}
+		if thumb.width != tileWidth || thumb.height != tileHeight {
+			return nil, fmt.Errorf("tile %d: thumbnail is %dx%d, the tile is %dx%d", i, thumb.width, thumb.height, tileWidth, tileHeight)
+		}
+		if first == nil {
+			first = thumb
+			if width, height := thumb.mcuSize(); tileWidth%width != 0 || tileHeight%height != 0 {
+				return nil, fmt.Errorf("the tiles aren't aligned to the %dx%d blocks of the thumbnails", width, height)
+			}
+		} else if !first.compatible(thumb) {
+			return nil, errors.New("the thumbnails use different quantization tables or subsampling")
+		}
+		cell := tile.Y/tileHeight*columns + tile.X/tileWidth
+		if tile.X%tileWidth != 0 || tile.Y%tileHeight != 0 || cells[cell] != nil {
+			return nil, errors.New("the tiles don't cover the whole sprite")
+		}
+		cells[cell] = thumb
+	}
+	return encodeMosaic(cells, columns)
+}
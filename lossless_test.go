@@ -0,0 +1,152 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startNoisyPackager starts a video-packager that returns noisy JPEGs of the
+// given size, generated from the timecode of each thumbnail, ignoring the
+// requested dimensions.
+func startNoisyPackager(t *testing.T, size image.Point) *httptest.Server {
+	thumbRegexp := regexp.MustCompile(`thumb-(\d+)`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := thumbRegexp.FindStringSubmatch(r.URL.Path)
+		if parts == nil {
+			http.Error(w, "invalid thumbnail", http.StatusBadRequest)
+			return
+		}
+		timecode, _ := strconv.ParseInt(parts[1], 10, 64)
+		w.Write(noisyJPEG(t, timecode, size, false))
+	}))
+}
+
+func TestGenSpriteLosslessJPEG(t *testing.T) {
+	t.Parallel()
+	size := image.Pt(64, 32)
+	packager := startNoisyPackager(t, size)
+	defer packager.Close()
+	generator := Generator{
+		Translator: func(string) (string, error) { return packager.URL, nil },
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          6 * time.Second,
+		Interval:     2 * time.Second,
+		Columns:      2,
+		JPEGQuality:  10,
+		LosslessJPEG: true,
+		FillOrder:    FillRightToLeft,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", result.Warnings)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := image.Rect(0, 0, 128, 64); sprite.Bounds() != expected {
+		t.Fatalf("wrong bounds\nwant %v\ngot  %v", expected, sprite.Bounds())
+	}
+	for i, tile := range result.Tiles {
+		thumb, err := jpeg.Decode(bytes.NewReader(noisyJPEG(t, int64(tile.Start/time.Millisecond), size, false)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePixels(sprite, image.Pt(tile.X, tile.Y), thumb) {
+			t.Errorf("tile %d wasn't copied losslessly", i)
+		}
+	}
+}
+
+func TestGenSpriteLosslessJPEGFallback(t *testing.T) {
+	t.Parallel()
+	noisy := startNoisyPackager(t, image.Pt(64, 32))
+	defer noisy.Close()
+	unaligned := startNoisyPackager(t, image.Pt(60, 32))
+	defer unaligned.Close()
+	var tests = []struct {
+		name     string
+		server   *httptest.Server
+		opts     GenSpriteOptions
+		expected string
+	}{
+		{
+			name:     "png",
+			server:   noisy,
+			opts:     GenSpriteOptions{Columns: 2, OutputFormat: PNG},
+			expected: "the output format is png",
+		},
+		{
+			name:     "sheets",
+			server:   noisy,
+			opts:     GenSpriteOptions{Columns: 2, SheetRows: 1},
+			expected: "split into sheets",
+		},
+		{
+			name:     "unaligned",
+			server:   unaligned,
+			opts:     GenSpriteOptions{Columns: 2},
+			expected: "aren't aligned to the 16x16 blocks",
+		},
+		{
+			name:     "incomplete grid",
+			server:   noisy,
+			opts:     GenSpriteOptions{Columns: 3},
+			expected: "don't cover the whole sprite",
+		},
+		{
+			name:   "tile hook",
+			server: noisy,
+			opts: GenSpriteOptions{
+				Columns: 2,
+				TileHook: func(_ time.Duration, img image.Image) (image.Image, error) {
+					return resize(img, 64, 32), nil
+				},
+			},
+			expected: "isn't an unmodified thumbnail",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			generator := Generator{
+				Translator: func(string) (string, error) { return test.server.URL, nil },
+			}
+			opts := test.opts
+			opts.VideoURL = "/video.mp4"
+			opts.End = 6 * time.Second
+			opts.Interval = 2 * time.Second
+			opts.LosslessJPEG = true
+			result, err := generator.GenSpriteWithMetadata(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(result.Sprite)); err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, warning := range result.Warnings {
+				found = found || (warning.Severity == SeverityInfo && strings.Contains(warning.Message, test.expected))
+			}
+			if !found {
+				t.Errorf("missing warning %q in %v", test.expected, result.Warnings)
+			}
+		})
+	}
+}
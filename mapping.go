@@ -0,0 +1,163 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+)
+
+// MappingTranslator translates video URLs for nginx-vod-module running in
+// mapped mode, where the module queries an upstream service for a JSON
+// mapping describing the media sets of each URI.
+//
+// It queries the mapping endpoint before translating a video URL, so videos
+// without a valid mapping fail fast with ErrUntranslatableURL (or with a
+// MappingError), instead of failing every thumbnail request. Successful
+// lookups are cached for CacheTTL.
+//
+// Its Translate method can be used as the ContextTranslator of a
+// Generator.
+type MappingTranslator struct {
+	// MappingEndpoint is the base URL of the mapping service. The path of
+	// the video URL is appended to it to get the URL of the mapping.
+	MappingEndpoint string
+
+	// ThumbEndpoint is the base URL of the nginx-vod-module location that
+	// serves thumbnails in mapped mode. The path of the video URL is
+	// appended to it to get the thumb prefix.
+	ThumbEndpoint string
+
+	// Client is the HTTP client used for querying the mapping service.
+	// When nil, a default pooled client is used.
+	Client *http.Client
+
+	// CacheTTL is how long successful lookups are cached. The zero value
+	// disables caching.
+	CacheTTL time.Duration
+
+	// Clock is used for expiring cached lookups. When nil, the system
+	// clock is used.
+	Clock Clock
+
+	o     sync.Once
+	mu    sync.Mutex
+	cache map[string]mappingEntry
+}
+
+type mappingEntry struct {
+	prefix  string
+	expires time.Time
+}
+
+// MappingError represents an error reported by the mapping service.
+type MappingError struct {
+	StatusCode   int
+	ResponseBody []byte
+}
+
+// Error returns the string representation of MappingError.
+func (err *MappingError) Error() string {
+	return fmt.Sprintf("invalid response from mapping service: %d - %s", err.StatusCode, err.ResponseBody)
+}
+
+// mediaSet is the subset of nginx-vod-module's JSON mapping format needed for
+// validating the mapping.
+type mediaSet struct {
+	Sequences []struct {
+		Clips []json.RawMessage `json:"clips"`
+	} `json:"sequences"`
+}
+
+func (s *mediaSet) empty() bool {
+	for _, sequence := range s.Sequences {
+		if len(sequence.Clips) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Translate translates the given video URL into a thumb prefix URL. It
+// implements ContextVideoURLTranslator.
+func (t *MappingTranslator) Translate(ctx context.Context, videoURL string) (string, error) {
+	t.o.Do(t.init)
+	vurl, err := url.Parse(videoURL)
+	if err != nil {
+		return "", err
+	}
+	path := vurl.EscapedPath()
+	if prefix, ok := t.cached(path); ok {
+		return prefix, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(t.MappingEndpoint, "/")+path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrUntranslatableURL
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &MappingError{StatusCode: resp.StatusCode, ResponseBody: data}
+	}
+	var set mediaSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return "", err
+	}
+	if set.empty() {
+		return "", ErrUntranslatableURL
+	}
+	prefix := strings.TrimRight(t.ThumbEndpoint, "/") + path
+	t.store(path, prefix)
+	return prefix, nil
+}
+
+func (t *MappingTranslator) init() {
+	if t.Client == nil {
+		t.Client = cleanhttp.DefaultPooledClient()
+	}
+	t.cache = make(map[string]mappingEntry)
+}
+
+func (t *MappingTranslator) cached(path string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.cache[path]
+	if !ok {
+		return "", false
+	}
+	if now(t.Clock).After(entry.expires) {
+		delete(t.cache, path)
+		return "", false
+	}
+	return entry.prefix, true
+}
+
+func (t *MappingTranslator) store(path, prefix string) {
+	if t.CacheTTL <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cache[path] = mappingEntry{prefix: prefix, expires: now(t.Clock).Add(t.CacheTTL)}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startFakeMappingService(requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		switch r.URL.Path {
+		case "/video.mp4":
+			w.Write([]byte(`{"sequences":[{"clips":[{"type":"source","path":"/data/video.mp4"}]}]}`))
+		case "/empty.mp4":
+			w.Write([]byte(`{"sequences":[]}`))
+		case "/missing.mp4":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "something went wrong", http.StatusInternalServerError)
+		}
+	}))
+}
+
+func TestMappingTranslator(t *testing.T) {
+	t.Parallel()
+	var requests int64
+	server := startFakeMappingService(&requests)
+	defer server.Close()
+	translator := MappingTranslator{
+		MappingEndpoint: server.URL + "/",
+		ThumbEndpoint:   "http://packager/thumb/",
+		CacheTTL:        time.Minute,
+	}
+	for i := 0; i < 3; i++ {
+		prefix, err := translator.Translate(context.Background(), "https://cdn/video.mp4?token=abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "http://packager/thumb/video.mp4"; prefix != expected {
+			t.Errorf("wrong prefix returned\nwant %q\ngot  %q", expected, prefix)
+		}
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("wrong number of requests to the mapping service\nwant 1\ngot  %d", n)
+	}
+}
+
+func TestMappingTranslatorErrors(t *testing.T) {
+	t.Parallel()
+	var requests int64
+	server := startFakeMappingService(&requests)
+	defer server.Close()
+	translator := MappingTranslator{MappingEndpoint: server.URL, ThumbEndpoint: "http://packager/thumb"}
+	tests := []struct {
+		name  string
+		input string
+		check func(error) bool
+	}{
+		{"empty mapping", "/empty.mp4", func(err error) bool { return err == ErrUntranslatableURL }},
+		{"missing mapping", "/missing.mp4", func(err error) bool { return err == ErrUntranslatableURL }},
+		{"server error", "/other.mp4", func(err error) bool {
+			var merr *MappingError
+			return errors.As(err, &merr) && merr.StatusCode == http.StatusInternalServerError
+		}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, err := translator.Translate(context.Background(), test.input)
+			if !test.check(err) {
+				t.Errorf("unexpected error returned: %v", err)
+			}
+		})
+	}
+}
+
+func TestMappingTranslatorNoCache(t *testing.T) {
+	t.Parallel()
+	var requests int64
+	server := startFakeMappingService(&requests)
+	defer server.Close()
+	translator := MappingTranslator{MappingEndpoint: server.URL, ThumbEndpoint: "http://packager/thumb"}
+	for i := 0; i < 2; i++ {
+		if _, err := translator.Translate(context.Background(), "/video.mp4"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("wrong number of requests to the mapping service\nwant 2\ngot  %d", n)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrEmptyMosaic is returned when GenMosaic is called without videos or
+// without timecodes.
+var ErrEmptyMosaic = errors.New("mosaic requires at least one video and one timecode")
+
+// ErrInvalidDifferences is returned when GenMosaicOptions.Differences is set,
+// but the mosaic doesn't have exactly two videos.
+var ErrInvalidDifferences = errors.New("differences require exactly two videos")
+
+// GenMosaicOptions is the set of options that control the generation of a
+// mosaic comparing multiple videos (or renditions of the same video).
+type GenMosaicOptions struct {
+	Context context.Context
+
+	// VideoURLs are the videos in the mosaic, one per row, from top to
+	// bottom.
+	VideoURLs []string
+
+	// Timecodes are the timecodes where the videos are sampled, one per
+	// column, from left to right.
+	Timecodes []time.Duration
+
+	Width       uint
+	Height      uint
+	JPEGQuality int
+
+	// Differences indicates whether a row with the difference heatmap
+	// between the thumbnails of the two videos in the mosaic should be
+	// added to the bottom of the mosaic, for each timecode. Identical
+	// pixels are black, and the larger the difference, the brighter the
+	// pixel (from red to yellow).
+	Differences bool
+
+	// Labels are caller-provided labels (e.g. the tenant) attached to the
+	// Usage reported to Generator.UsageHook.
+	Labels map[string]string
+}
+
+// GenMosaic generates a mosaic of thumbnails where each row is one of the
+// given videos and each column is one of the given timecodes, so renditions
+// (or A/B encodes) can be compared side by side. All thumbnails are fetched
+// using the same pool of workers.
+func (g *Generator) GenMosaic(opts GenMosaicOptions) (_ []byte, err error) {
+	g.initGenerator()
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.JPEGQuality == 0 {
+		opts.JPEGQuality = g.JPEGQuality
+	}
+	if len(opts.VideoURLs) == 0 || len(opts.Timecodes) == 0 {
+		return nil, wrapStage(opts.Context, StageValidation, ErrEmptyMosaic)
+	}
+	if opts.Differences && len(opts.VideoURLs) != 2 {
+		return nil, wrapStage(opts.Context, StageValidation, ErrInvalidDifferences)
+	}
+	var stats *fetchStats
+	if g.UsageHook != nil {
+		stats = &fetchStats{}
+	}
+	inputs := make([]workerInput, 0, len(opts.VideoURLs)*len(opts.Timecodes))
+	for _, videoURL := range opts.VideoURLs {
+		prefix, err := g.translate(opts.Context, videoURL)
+		if err != nil {
+			return nil, wrapStage(opts.Context, StageResolve, err)
+		}
+		token, err := g.newAccessToken(opts.Context, videoURL)
+		if err != nil {
+			return nil, wrapStage(opts.Context, StageResolve, err)
+		}
+		for _, timecode := range opts.Timecodes {
+			inputs = append(inputs, workerInput{
+				index:    len(inputs),
+				prefix:   prefix,
+				timecode: timecode,
+				width:    opts.Width,
+				height:   opts.Height,
+				stats:    stats,
+				token:    token,
+			})
+		}
+	}
+	if stats != nil {
+		defer func() {
+			g.UsageHook(stats.usage(opts.Labels, len(inputs), err))
+		}()
+	}
+	grid := grid{columns: len(opts.Timecodes), rows: len(opts.VideoURLs)}
+	if opts.Differences {
+		grid.rows++
+	}
+	drawer := spriteDrawer{op: CompositeSrc.op()}
+	outputs := make([]workerOutput, len(inputs))
+	err = g.fetch(opts.Context, inputs, false, func(output workerOutput) {
+		outputs[output.input.index] = output
+		xpos, ypos := grid.position(output.input.index)
+		drawer.draw(drawInput{
+			workerOutput: output,
+			xposition:    xpos,
+			yposition:    ypos,
+			rows:         grid.rows,
+			columns:      grid.columns,
+		})
+	})
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageFetch, err)
+	}
+	if opts.Differences {
+		for i := range opts.Timecodes {
+			output := outputs[i]
+			output.img = diffHeatmap(outputs[i].img, outputs[len(opts.Timecodes)+i].img)
+			drawer.draw(drawInput{
+				workerOutput: output,
+				xposition:    i,
+				yposition:    grid.rows - 1,
+			})
+		}
+	}
+	encodeStart := time.Now()
+	mosaic, err := encodeJPEG(drawer.sprite, opts.JPEGQuality)
+	stats.addProcessing(time.Since(encodeStart))
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageEncode, err)
+	}
+	return mosaic, nil
+}
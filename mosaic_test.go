@@ -0,0 +1,171 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenMosaic(t *testing.T) {
+	t.Parallel()
+	const maxDiff = int64(11e5)
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	data, err := generator.GenMosaic(GenMosaicOptions{
+		VideoURLs: []string{
+			"/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+			"/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_720p.mp4",
+		},
+		Timecodes:   []time.Duration{18 * time.Second, 0, 4 * time.Second},
+		Height:      72,
+		JPEGQuality: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mosaic, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := mosaic.Bounds().Size(); size != image.Pt(127*3, 72*2) {
+		t.Fatalf("wrong mosaic size\nwant %v\ngot  %v", image.Pt(127*3, 72*2), size)
+	}
+	expectedFiles := []string{"img10.jpg", "img01.jpg", "img03.jpg"}
+	for row := 0; row < 2; row++ {
+		for col, file := range expectedFiles {
+			expected, err := loadSpriteFromDisk(filepath.Join("testdata", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tile := image.NewRGBA(image.Rect(0, 0, 127, 72))
+			draw.Draw(tile, tile.Bounds(), mosaic, image.Pt(col*127, row*72), draw.Src)
+			if diff := imageDiff(tile, expected); diff > maxDiff {
+				t.Errorf("tile (%d, %d) is too different from %s\nmax diff: %d\ngot diff: %d", col, row, file, maxDiff, diff)
+			}
+		}
+	}
+}
+
+func TestGenMosaicDifferences(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	data, err := generator.GenMosaic(GenMosaicOptions{
+		VideoURLs: []string{
+			"/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+			"/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_720p.mp4",
+		},
+		Timecodes:   []time.Duration{0, 4 * time.Second},
+		Height:      72,
+		JPEGQuality: 100,
+		Differences: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mosaic, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := mosaic.Bounds().Size(); size != image.Pt(127*2, 72*3) {
+		t.Fatalf("wrong mosaic size\nwant %v\ngot  %v", image.Pt(127*2, 72*3), size)
+	}
+	// both rows come from the same images, so the heatmap is black.
+	const maxDiff = int64(1e5)
+	black := image.NewRGBA(image.Rect(0, 0, 127*2, 72))
+	draw.Draw(black, black.Bounds(), image.Black, image.Point{}, draw.Src)
+	heatmaps := image.NewRGBA(image.Rect(0, 0, 127*2, 72))
+	draw.Draw(heatmaps, heatmaps.Bounds(), mosaic, image.Pt(0, 72*2), draw.Src)
+	if diff := imageDiff(heatmaps, black); diff > maxDiff {
+		t.Errorf("heatmap of identical thumbnails isn't black\nmax diff: %d\ngot diff: %d", maxDiff, diff)
+	}
+}
+
+func TestGenMosaicErrors(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	const videoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+	errTranslate := errors.New("unknown video")
+	var tests = []struct {
+		name          string
+		opts          GenMosaicOptions
+		translator    VideoURLTranslator
+		expectedStage Stage
+		expectedError error
+	}{
+		{
+			name:          "no videos",
+			opts:          GenMosaicOptions{Timecodes: []time.Duration{0}},
+			expectedStage: StageValidation,
+			expectedError: ErrEmptyMosaic,
+		},
+		{
+			name:          "no timecodes",
+			opts:          GenMosaicOptions{VideoURLs: []string{videoURL}},
+			expectedStage: StageValidation,
+			expectedError: ErrEmptyMosaic,
+		},
+		{
+			name: "differences with a single video",
+			opts: GenMosaicOptions{
+				VideoURLs:   []string{videoURL},
+				Timecodes:   []time.Duration{0},
+				Differences: true,
+			},
+			expectedStage: StageValidation,
+			expectedError: ErrInvalidDifferences,
+		},
+		{
+			name: "translator failure",
+			opts: GenMosaicOptions{
+				VideoURLs: []string{videoURL},
+				Timecodes: []time.Duration{0},
+			},
+			translator:    func(string) (string, error) { return "", errTranslate },
+			expectedStage: StageResolve,
+			expectedError: errTranslate,
+		},
+		{
+			name: "missing thumbnail",
+			opts: GenMosaicOptions{
+				VideoURLs: []string{videoURL},
+				Timecodes: []time.Duration{40 * time.Second},
+				Height:    72,
+			},
+			expectedStage: StageFetch,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			translator := test.translator
+			if translator == nil {
+				translator = packager.translate
+			}
+			generator := Generator{Translator: translator}
+			_, err := generator.GenMosaic(test.opts)
+			var genErr *GenerationError
+			if !errors.As(err, &genErr) {
+				t.Fatalf("wrong error type\nwant *GenerationError\ngot  %#v", err)
+			}
+			if genErr.Stage != test.expectedStage {
+				t.Errorf("wrong stage\nwant %v\ngot  %v", test.expectedStage, genErr.Stage)
+			}
+			if test.expectedError != nil && !errors.Is(err, test.expectedError) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", test.expectedError, err)
+			}
+		})
+	}
+}
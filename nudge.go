@@ -0,0 +1,64 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInvalidBlackFrameNudge is returned when BlackFrameNudge or
+// BlackFrameAttempts are negative.
+var ErrInvalidBlackFrameNudge = errors.New("invalid black frame nudge: must not be negative")
+
+// defaultBlackFrameAttempts is the number of alternative timecodes tried
+// when BlackFrameAttempts is zero.
+const defaultBlackFrameAttempts = 2
+
+func (o *GenSpriteOptions) blackFrameAttempts() int {
+	if o.BlackFrameAttempts == 0 {
+		return defaultBlackFrameAttempts
+	}
+	return o.BlackFrameAttempts
+}
+
+// nudgeCandidates returns the alternative timecodes tried when the
+// thumbnail at the given timecode is black, alternating after and before
+// it, nearest first. Negative timecodes are skipped.
+func nudgeCandidates(timecode, delta time.Duration, attempts int) []time.Duration {
+	candidates := make([]time.Duration, 0, attempts)
+	for k := time.Duration(1); len(candidates) < attempts; k++ {
+		candidates = append(candidates, timecode+k*delta)
+		if before := timecode - k*delta; before >= 0 && len(candidates) < attempts {
+			candidates = append(candidates, before)
+		}
+	}
+	return candidates
+}
+
+// processAvoidingBlack fetches the thumbnail described by the given input
+// and, when it's black, fetches thumbnails at nearby timecodes until one of
+// them isn't, returning it instead. Failures of the alternatives are
+// ignored, and the original thumbnail is returned when all of them are
+// black or fail.
+func (w *worker) processAvoidingBlack(ctx context.Context, input workerInput) (workerOutput, error) {
+	output, err := w.fetchThumbnail(ctx, input)
+	if err != nil || !output.black {
+		return output, err
+	}
+	for _, timecode := range nudgeCandidates(input.timecode, input.nudge, input.nudgeAttempts) {
+		alternative := input
+		alternative.timecode = timecode
+		alternativeOutput, err := w.fetchThumbnail(ctx, alternative)
+		if ctx.Err() != nil {
+			return output, ctx.Err()
+		}
+		if err == nil && alternativeOutput.img != nil && !alternativeOutput.black {
+			return alternativeOutput, nil
+		}
+	}
+	return output, nil
+}
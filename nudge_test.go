@@ -0,0 +1,107 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNudgeCandidates(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		timecode time.Duration
+		attempts int
+		expected []time.Duration
+	}{
+		{
+			name:     "alternating",
+			timecode: 10 * time.Second,
+			attempts: 3,
+			expected: []time.Duration{11 * time.Second, 9 * time.Second, 12 * time.Second},
+		},
+		{
+			name:     "start of the video",
+			timecode: 0,
+			attempts: 2,
+			expected: []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := nudgeCandidates(test.timecode, time.Second, test.attempts)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("wrong candidates\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteBlackFrameNudge(t *testing.T) {
+	t.Parallel()
+	black := map[int64]bool{2000: true, 4000: true, 4500: true, 3500: true}
+	thumbRegexp := regexp.MustCompile(`thumb-(\d+)`)
+	var requested []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timecode, _ := strconv.ParseInt(thumbRegexp.FindStringSubmatch(r.URL.Path)[1], 10, 64)
+		requested = append(requested, timecode)
+		img := image.NewRGBA(image.Rect(0, 0, 32, 18))
+		if !black[timecode] {
+			fill(img, color.Gray{Y: 128})
+		}
+		jpeg.Encode(w, img, nil)
+	}))
+	defer server.Close()
+	generator := Generator{
+		Translator: func(string) (string, error) { return server.URL, nil },
+		MaxWorkers: 1,
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         3,
+		BlackFrameNudge: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{0, 2500 * time.Millisecond, 4 * time.Second}
+	for i, tile := range result.Tiles {
+		if tile.CapturedAt != expected[i] {
+			t.Errorf("wrong capture timecode for tile %d\nwant %v\ngot  %v", i, expected[i], tile.CapturedAt)
+		}
+	}
+	expectedRequests := []int64{0, 2000, 2500, 4000, 4500, 3500}
+	if !reflect.DeepEqual(requested, expectedRequests) {
+		t.Errorf("wrong requests\nwant %v\ngot  %v", expectedRequests, requested)
+	}
+}
+
+func TestGenSpriteInvalidBlackFrameNudge(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		BlackFrameNudge: -time.Second,
+	})
+	if !errors.Is(err, ErrInvalidBlackFrameNudge) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidBlackFrameNudge, err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// FetchOrder determines the order in which thumbnails are requested from the
+// video-packager. Thumbnails are always placed in chronological order in the
+// sprite, regardless of the order in which they're fetched.
+type FetchOrder int
+
+const (
+	// FetchSequential requests thumbnails in chronological order.
+	FetchSequential FetchOrder = iota
+
+	// FetchStrided splits the timeline into one region per worker and
+	// interleaves them, so concurrent requests target distant regions of
+	// the video instead of making the video-packager seek through the
+	// same region of the file from multiple workers.
+	FetchStrided
+
+	// FetchShuffled requests thumbnails in random order. See
+	// GenSpriteOptions.ShuffleSeed.
+	FetchShuffled
+)
+
+// ErrInvalidFetchOrder is returned when the fetch order is unknown.
+var ErrInvalidFetchOrder = errors.New("invalid fetch order")
+
+var fetchOrderNames = map[FetchOrder]string{
+	FetchSequential: "sequential",
+	FetchStrided:    "strided",
+	FetchShuffled:   "shuffled",
+}
+
+// String returns the name of the fetch order.
+func (o FetchOrder) String() string {
+	if name, ok := fetchOrderNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("FetchOrder(%d)", int(o))
+}
+
+// valid reports whether the fetch order is known.
+func (o FetchOrder) valid() bool {
+	_, ok := fetchOrderNames[o]
+	return ok
+}
+
+// orderInputs returns a copy of the given inputs, sorted according to the
+// given fetch order.
+func orderInputs(inputs []workerInput, order FetchOrder, nworkers int, seed int64) []workerInput {
+	ordered := make([]workerInput, 0, len(inputs))
+	switch order {
+	case FetchStrided:
+		if nworkers < 1 {
+			nworkers = 1
+		}
+		stride := (len(inputs) + nworkers - 1) / nworkers
+		for offset := 0; offset < stride; offset++ {
+			for i := offset; i < len(inputs); i += stride {
+				ordered = append(ordered, inputs[i])
+			}
+		}
+	case FetchShuffled:
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		ordered = append(ordered, inputs...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(ordered), func(i, j int) {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		})
+	default:
+		ordered = append(ordered, inputs...)
+	}
+	return ordered
+}
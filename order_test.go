@@ -0,0 +1,68 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOrderInputs(t *testing.T) {
+	t.Parallel()
+	inputs := make([]workerInput, 10)
+	for i := range inputs {
+		inputs[i].index = i
+	}
+	tests := []struct {
+		name     string
+		order    FetchOrder
+		nworkers int
+		expected []int
+	}{
+		{"sequential", FetchSequential, 4, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"strided", FetchStrided, 4, []int{0, 3, 6, 9, 1, 4, 7, 2, 5, 8}},
+		{"strided - single worker", FetchStrided, 1, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"strided - more workers than inputs", FetchStrided, 32, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ordered := orderInputs(inputs, test.order, test.nworkers, 0)
+			if indexes := inputIndexes(ordered); !reflect.DeepEqual(indexes, test.expected) {
+				t.Errorf("wrong order\nwant %v\ngot  %v", test.expected, indexes)
+			}
+		})
+	}
+}
+
+func TestOrderInputsShuffled(t *testing.T) {
+	t.Parallel()
+	inputs := make([]workerInput, 10)
+	for i := range inputs {
+		inputs[i].index = i
+	}
+	first := inputIndexes(orderInputs(inputs, FetchShuffled, 4, 42))
+	second := inputIndexes(orderInputs(inputs, FetchShuffled, 4, 42))
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed produced different orders: %v and %v", first, second)
+	}
+	if reflect.DeepEqual(first, inputIndexes(inputs)) {
+		t.Errorf("inputs weren't shuffled: %v", first)
+	}
+	sort.Ints(first)
+	if !reflect.DeepEqual(first, inputIndexes(inputs)) {
+		t.Errorf("shuffled inputs don't match the original inputs: %v", first)
+	}
+}
+
+func inputIndexes(inputs []workerInput) []int {
+	indexes := make([]int, len(inputs))
+	for i, input := range inputs {
+		indexes[i] = input.index
+	}
+	return indexes
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// Orientation determines how the final sprite is rotated or transposed
+// before being encoded. Tiles in the metadata are adjusted accordingly.
+type Orientation int
+
+const (
+	// OrientationNormal keeps the sprite as drawn.
+	OrientationNormal Orientation = iota
+
+	// OrientationTranspose swaps the axes of the sprite (mirroring it
+	// along its main diagonal), for UIs that map storyboards in
+	// column-major orientation.
+	OrientationTranspose
+
+	// OrientationRotate90 rotates the sprite 90 degrees clockwise.
+	OrientationRotate90
+
+	// OrientationRotate270 rotates the sprite 90 degrees
+	// counterclockwise.
+	OrientationRotate270
+)
+
+// ErrInvalidOrientation is returned when the orientation is unknown.
+var ErrInvalidOrientation = errors.New("invalid orientation")
+
+var orientationNames = map[Orientation]string{
+	OrientationNormal:    "normal",
+	OrientationTranspose: "transpose",
+	OrientationRotate90:  "rotate-90",
+	OrientationRotate270: "rotate-270",
+}
+
+// String returns the name of the orientation.
+func (o Orientation) String() string {
+	if name, ok := orientationNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Orientation(%d)", int(o))
+}
+
+// valid reports whether the orientation is known.
+func (o Orientation) valid() bool {
+	_, ok := orientationNames[o]
+	return ok
+}
+
+// orient returns a copy of the given sprite in the given orientation.
+func orient(src *image.RGBA, o Orientation) *image.RGBA {
+	if o == OrientationNormal {
+		return src
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dx, dy := orientPoint(x, y, b.Dx(), b.Dy(), o)
+			dst.SetRGBA(dx, dy, src.RGBAAt(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// orientPoint returns the position of the pixel (x, y) of an image with the
+// given dimensions once it's in the given orientation.
+func orientPoint(x, y, width, height int, o Orientation) (int, int) {
+	switch o {
+	case OrientationTranspose:
+		return y, x
+	case OrientationRotate90:
+		return height - 1 - y, x
+	case OrientationRotate270:
+		return y, width - 1 - x
+	default:
+		return x, y
+	}
+}
+
+// orientTile returns the given tile of a sprite with the given dimensions,
+// adjusted to the given orientation.
+func orientTile(t Tile, width, height int, o Orientation) Tile {
+	if o == OrientationNormal {
+		return t
+	}
+	// the top-left and bottom-right pixels of the tile end up in
+	// opposite corners of the new tile, depending on the orientation.
+	x0, y0 := orientPoint(t.X, t.Y, width, height, o)
+	x1, y1 := orientPoint(t.X+t.Width-1, t.Y+t.Height-1, width, height, o)
+	if x1 < x0 {
+		x0, x1 = x1, x0
+	}
+	if y1 < y0 {
+		y0, y1 = y1, y0
+	}
+	t.X, t.Y = x0, y0
+	t.Width, t.Height = x1-x0+1, y1-y0+1
+	return t
+}
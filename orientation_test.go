@@ -0,0 +1,115 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestOrient(t *testing.T) {
+	t.Parallel()
+	// 3x2 image where each pixel has a distinct red value:
+	//
+	//	0 1 2
+	//	3 4 5
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.SetRGBA(i%3, i/3, color.RGBA{R: uint8(i), A: 255})
+	}
+	tests := []struct {
+		orientation Orientation
+		expected    [][]uint8
+	}{
+		{OrientationNormal, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{OrientationTranspose, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{OrientationRotate90, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{OrientationRotate270, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, test := range tests {
+		dst := orient(src, test.orientation)
+		if dst.Bounds().Dy() != len(test.expected) || dst.Bounds().Dx() != len(test.expected[0]) {
+			t.Errorf("wrong bounds for orientation %d: %v", test.orientation, dst.Bounds())
+			continue
+		}
+		for y, row := range test.expected {
+			for x, want := range row {
+				if got := dst.RGBAAt(x, y).R; got != want {
+					t.Errorf("wrong pixel at (%d, %d) for orientation %d\nwant %d\ngot  %d", x, y, test.orientation, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestOrientTile(t *testing.T) {
+	t.Parallel()
+	// sprite with 2x2 tiles of 30x20 pixels, each filled with a distinct
+	// color.
+	const tileWidth, tileHeight = 30, 20
+	sprite := image.NewRGBA(image.Rect(0, 0, 2*tileWidth, 2*tileHeight))
+	var tiles []Tile
+	for i := 0; i < 3; i++ {
+		tile := Tile{X: (i % 2) * tileWidth, Y: (i / 2) * tileHeight, Width: tileWidth, Height: tileHeight}
+		r := image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height)
+		draw.Draw(sprite, r, image.NewUniform(color.RGBA{R: uint8(i + 1), A: 255}), image.Point{}, draw.Src)
+		tiles = append(tiles, tile)
+	}
+	for _, orientation := range []Orientation{OrientationNormal, OrientationTranspose, OrientationRotate90, OrientationRotate270} {
+		dst := orient(sprite, orientation)
+		for i, tile := range tiles {
+			oriented := orientTile(tile, sprite.Bounds().Dx(), sprite.Bounds().Dy(), orientation)
+			if oriented.Width*oriented.Height != tile.Width*tile.Height {
+				t.Errorf("wrong tile size for orientation %d: %#v", orientation, oriented)
+			}
+			for y := oriented.Y; y < oriented.Y+oriented.Height; y++ {
+				for x := oriented.X; x < oriented.X+oriented.Width; x++ {
+					if got := dst.RGBAAt(x, y).R; got != uint8(i+1) {
+						t.Fatalf("wrong pixel at (%d, %d) of tile %d for orientation %d\nwant %d\ngot  %d", x, y, i, orientation, i+1, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGenSpriteOrientation(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         2 * time.Second,
+		Interval:    2 * time.Second,
+		Columns:     2,
+		Height:      72,
+		Orientation: OrientationRotate90,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 72 || result.Height != 254 {
+		t.Errorf("wrong sprite dimensions\nwant 72x254\ngot  %dx%d", result.Width, result.Height)
+	}
+	expected := []Tile{
+		{Start: 0, End: 2 * time.Second, X: 0, Y: 0, Width: 72, Height: 127},
+		{Start: 2 * time.Second, End: 4 * time.Second, CapturedAt: 2 * time.Second, X: 0, Y: 127, Width: 72, Height: 127},
+	}
+	for i, tile := range result.Tiles {
+		if tile != expected[i] {
+			t.Errorf("wrong tile %d\nwant %#v\ngot  %#v", i, expected[i], tile)
+		}
+	}
+
+	_, err = generator.GenSprite(GenSpriteOptions{End: time.Second, Interval: time.Second, Orientation: Orientation(42)})
+	if !errors.Is(err, ErrInvalidOrientation) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrInvalidOrientation, err)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnpatchable is returned by PatchSprite when the existing sprite can't be
+// patched: its metadata has no tiles, or it's split into sheets, or it was
+// rotated (see GenSpriteOptions.Orientation).
+var ErrUnpatchable = errors.New("sprite can't be patched: missing layout metadata, split into sheets or rotated")
+
+// ErrNothingToPatch is returned by PatchSprite when no tile of the existing
+// sprite starts within the range to regenerate.
+var ErrNothingToPatch = errors.New("no tiles of the sprite start within the range to patch")
+
+// PatchSpriteOptions describes the existing sprite patched by PatchSprite and
+// the range of tiles to regenerate.
+type PatchSpriteOptions struct {
+	// Sprite is the existing sprite, as returned by GenSpriteWithMetadata
+	// or decoded from the JSON stored along with it. The layout of the
+	// sprite is taken from its Layout. When its Sprite field is empty,
+	// the image is downloaded from SpriteURL.
+	Sprite *GenSpriteResult
+
+	// Layout is the layout of the existing sprite, as stored along with
+	// it (see ParseLayout), used when Sprite is nil. The image is
+	// downloaded from SpriteURL.
+	Layout *Layout
+
+	// SpriteURL is the URL of the existing sprite, used when the image
+	// isn't in Sprite.
+	SpriteURL string
+
+	// Start and End delimit the range of tiles to regenerate: the ones
+	// whose Start is within [Start, End].
+	Start time.Duration
+	End   time.Duration
+}
+
+// PatchSprite regenerates the tiles of an existing sprite within a range of
+// timecodes (e.g. after the corresponding segment of the video is
+// re-transcoded), without regenerating the whole sprite. Only the thumbnails
+// in the range are fetched, drawn over the existing sprite at the positions
+// described by its metadata, and the sprite is encoded again.
+//
+// opts must be equivalent to the options used for generating the existing
+// sprite (VideoURL, dimensions, scaling, and so on), except for Start and End,
+// which are ignored: the regenerated tiles keep the timecodes in the layout.
+// Tiles that fail to be fetched are filled with opts.Placeholder or left
+// blank, like in GenSprite. Since the rest of the sprite was already
+// post-processed, opts.PostProcess is called with each regenerated tile
+// rather than with the whole sprite. The result is a copy of patch.Sprite (or a result with
+// patch.Layout) with the new image, the updated tiles, and BytesDownloaded
+// accounting only for the patch.
+func (g *Generator) PatchSprite(opts GenSpriteOptions, patch PatchSpriteOptions) (*GenSpriteResult, error) {
+	previous := patch.Sprite
+	if previous == nil && patch.Layout != nil {
+		result := patch.Layout.result()
+		previous = &result
+	}
+	if previous == nil || opts.Orientation != OrientationNormal {
+		return nil, &GenerationError{Stage: StageValidation, Err: ErrUnpatchable}
+	}
+	layout := previous.Layout()
+	if len(layout.Tiles) == 0 || len(layout.Sheets) > 0 {
+		return nil, &GenerationError{Stage: StageValidation, Err: ErrUnpatchable}
+	}
+	var indexes []int
+	var timecodes []time.Duration
+	for i, tile := range layout.Tiles {
+		if tile.Start >= patch.Start && tile.Start <= patch.End {
+			indexes = append(indexes, i)
+			timecodes = append(timecodes, tile.Start)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, &GenerationError{Stage: StageValidation, Err: ErrNothingToPatch}
+	}
+	// the timecodes come from the layout, so only the options that don't
+	// depend on the range of the sprite are prepared.
+	opts.OutputFormat = layout.Format
+	if err := g.prepareTiles(&opts); err != nil {
+		return nil, err
+	}
+	opts.stats = &fetchStats{}
+
+	canvas, err := g.loadSprite(&opts, previous.Sprite, patch.SpriteURL)
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageResolve, err)
+	}
+	result := *previous
+	result.Tiles = append([]Tile(nil), layout.Tiles...)
+	result.Warnings = nil
+	result.Report = nil
+
+	var background image.Image = image.Transparent
+	if opts.Background != nil {
+		background = image.NewUniform(opts.Background)
+	}
+	op := opts.Compositing.op()
+	inputs := opts.inputs(timecodes)
+	err = g.fetch(opts.Context, inputs, false, func(output workerOutput) {
+		tile := &result.Tiles[indexes[output.input.index]]
+		if output.header != nil {
+			tile.Trace = &TileTrace{Header: output.header, Duration: output.latency}
+		}
+		if opts.TileURLs {
+			tile.URL = opts.tileURL(output)
+		}
+		r := image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height)
+		draw.Draw(canvas, r, background, image.Point{}, draw.Src)
+		if output.img == nil {
+			// the previous thumbnail is outdated, so it's replaced
+			// the same way drawSprite fills failed tiles.
+			tile.Status = TileFailed
+			if opts.Placeholder != nil {
+				draw.Draw(canvas, r, resize(opts.Placeholder, tile.Width, tile.Height), image.Point{}, op)
+				tile.Status = TilePlaceholder
+			}
+			return
+		}
+		var offset image.Point
+		if output.input.scalingMode().boxed() {
+			offset.X = opts.AlignX.offset(tile.Width - output.img.Bounds().Dx())
+			offset.Y = opts.AlignY.offset(tile.Height - output.img.Bounds().Dy())
+		}
+		draw.Draw(canvas, r.Intersect(r.Add(offset)), output.img, output.img.Bounds().Min, op)
+		tile.CapturedAt = output.input.timecode
+		tile.Status = TileOK
+		if !output.expires.IsZero() {
+			expires := output.expires
+			if result.Expires != nil {
+				expires = earliest(*result.Expires, expires)
+			}
+			result.Expires = &expires
+		}
+	})
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageFetch, err)
+	}
+	patched := make(map[time.Duration]bool, len(timecodes))
+	for _, timecode := range timecodes {
+		patched[timecode] = true
+	}
+	var failed []time.Duration
+	for _, timecode := range layout.FailedTimecodes {
+		// failures of tiles left out of the metadata (see
+		// GenSpriteOptions.OmitFailedTiles) have no position in the
+		// sprite to patch, so they're kept.
+		if !patched[timecode] {
+			failed = append(failed, timecode)
+		}
+	}
+	for _, i := range indexes {
+		if result.Tiles[i].Status != TileOK {
+			failed = append(failed, result.Tiles[i].Start)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i] < failed[j] })
+	result.FailedTimecodes = failed
+
+	if opts.PostProcess != nil {
+		for _, i := range indexes {
+			tile := result.Tiles[i]
+			if tile.Status != TileOK {
+				continue
+			}
+			r := image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height)
+			if err := opts.PostProcess(canvas.SubImage(r).(draw.Image)); err != nil {
+				return nil, wrapStage(opts.Context, StageEncode, err)
+			}
+		}
+	}
+	result.Sprite, _, err = g.encodeSheet(&opts, canvas, nil, false)
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageEncode, err)
+	}
+	result.BytesDownloaded = atomic.LoadInt64(&opts.stats.bytes)
+	return &result, nil
+}
+
+// loadSprite decodes the given sprite, downloading it from the given URL when
+// it's empty, into an image that can be patched.
+func (g *Generator) loadSprite(opts *GenSpriteOptions, data []byte, spriteURL string) (*image.RGBA, error) {
+	if len(data) == 0 {
+		var err error
+		if data, err = g.downloadSprite(opts, spriteURL); err != nil {
+			return nil, err
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding sprite: %w", err)
+	}
+	b := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, b.Min, draw.Src)
+	return canvas, nil
+}
+
+func (g *Generator) downloadSprite(opts *GenSpriteOptions, spriteURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(opts.Context, http.MethodGet, spriteURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading sprite from %s: unexpected status %d", spriteURL, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,457 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPatchSprite(t *testing.T) {
+	t.Parallel()
+	original := startSourcePackager(image.Pt(160, 90))
+	defer original.Close()
+	var requests int64
+	retranscoded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		img := image.NewRGBA(image.Rect(0, 0, 160, 90))
+		fill(img, color.White)
+		jpeg.Encode(w, img, nil)
+	}))
+	defer retranscoded.Close()
+	opts := GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          8 * time.Second,
+		Interval:     2 * time.Second,
+		Columns:      5,
+		Height:       90,
+		OutputFormat: PNG,
+	}
+	generator := Generator{
+		Translator: func(string) (string, error) { return original.URL, nil },
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(previous.Sprite)
+	}))
+	defer stored.Close()
+	metadata, err := json.Marshal(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name      string
+		sprite    func() *GenSpriteResult
+		layout    func() *Layout
+		spriteURL string
+	}{
+		{
+			name:   "sprite bytes",
+			sprite: func() *GenSpriteResult { return previous },
+		},
+		{
+			name: "stored sprite",
+			sprite: func() *GenSpriteResult {
+				var decoded GenSpriteResult
+				if err := json.Unmarshal(metadata, &decoded); err != nil {
+					t.Fatal(err)
+				}
+				return &decoded
+			},
+			spriteURL: stored.URL + "/sprite.png",
+		},
+		{
+			name: "stored layout",
+			layout: func() *Layout {
+				data, err := json.Marshal(previous.Layout())
+				if err != nil {
+					t.Fatal(err)
+				}
+				layout, err := ParseLayout(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return layout
+			},
+			spriteURL: stored.URL + "/sprite.png",
+		},
+	}
+	for _, test := range tests {
+		atomic.StoreInt64(&requests, 0)
+		generator := Generator{
+			Translator: func(string) (string, error) { return retranscoded.URL, nil },
+		}
+		patch := PatchSpriteOptions{
+			SpriteURL: test.spriteURL,
+			Start:     time.Second,
+			End:       4 * time.Second,
+		}
+		if test.sprite != nil {
+			patch.Sprite = test.sprite()
+		} else {
+			patch.Layout = test.layout()
+		}
+		result, err := generator.PatchSprite(opts, patch)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if n := atomic.LoadInt64(&requests); n != 2 {
+			t.Errorf("%s: wrong number of requests\nwant 2\ngot  %d", test.name, n)
+		}
+		if result.BytesDownloaded == 0 || result.BytesDownloaded >= previous.BytesDownloaded {
+			t.Errorf("%s: wrong bytes downloaded: %d (original sprite: %d)", test.name, result.BytesDownloaded, previous.BytesDownloaded)
+		}
+		if len(result.Tiles) != len(previous.Tiles) {
+			t.Fatalf("%s: wrong number of tiles\nwant %d\ngot  %d", test.name, len(previous.Tiles), len(result.Tiles))
+		}
+		img, err := png.Decode(bytes.NewReader(result.Sprite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != previous.Width || img.Bounds().Dy() != previous.Height {
+			t.Errorf("%s: wrong size\nwant %dx%d\ngot  %v", test.name, previous.Width, previous.Height, img.Bounds())
+		}
+		expected := []uint8{128, 255, 255, 128, 128}
+		for i, tile := range result.Tiles {
+			p := image.Pt(tile.X+tile.Width/2, tile.Y+tile.Height/2)
+			if y := luminance(img, p); y != expected[i] {
+				t.Errorf("%s: wrong luminance for tile %d\nwant %d\ngot  %d", test.name, i, expected[i], y)
+			}
+		}
+	}
+}
+
+func TestPatchSpriteStoredFailures(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/thumb-2000-") {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		source.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	opts := GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         3,
+		Height:          90,
+		ContinueOnError: true,
+	}
+	generator := Generator{
+		Translator: func(string) (string, error) { return failing.URL, nil },
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := json.Marshal(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored GenSpriteResult
+	if err := json.Unmarshal(metadata, &stored); err != nil {
+		t.Fatal(err)
+	}
+	expectedFailures := []time.Duration{2 * time.Second}
+	if !reflect.DeepEqual(stored.FailedTimecodes, expectedFailures) {
+		t.Fatalf("wrong failed timecodes after decoding\nwant %v\ngot  %v", expectedFailures, stored.FailedTimecodes)
+	}
+	stored.Sprite = previous.Sprite
+
+	generator = Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+	}
+	var tests = []struct {
+		name             string
+		start            time.Duration
+		end              time.Duration
+		expectedFailures []time.Duration
+		expectedStatus   TileStatus
+	}{
+		{"other tile", 4 * time.Second, 4 * time.Second, expectedFailures, TileFailed},
+		{"failed tile", 2 * time.Second, 2 * time.Second, nil, TileOK},
+	}
+	for _, test := range tests {
+		result, err := generator.PatchSprite(opts, PatchSpriteOptions{
+			Sprite: &stored,
+			Start:  test.start,
+			End:    test.end,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(result.FailedTimecodes, test.expectedFailures) {
+			t.Errorf("%s: wrong failed timecodes\nwant %v\ngot  %v", test.name, test.expectedFailures, result.FailedTimecodes)
+		}
+		if status := result.Tiles[1].Status; status != test.expectedStatus {
+			t.Errorf("%s: wrong status for the failed tile\nwant %v\ngot  %v", test.name, test.expectedStatus, status)
+		}
+	}
+}
+
+func TestPatchSpriteFailedTile(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	opts := GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         3,
+		Height:          90,
+		Background:      color.Black,
+		OutputFormat:    PNG,
+		ContinueOnError: true,
+	}
+	generator := Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	placeholder := image.NewRGBA(image.Rect(0, 0, 32, 18))
+	fill(placeholder, color.White)
+
+	var tests = []struct {
+		name              string
+		placeholder       image.Image
+		expectedStatus    TileStatus
+		expectedLuminance uint8
+	}{
+		{"background", nil, TileFailed, 0},
+		{"placeholder", placeholder, TilePlaceholder, 255},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := Generator{
+				Translator: func(string) (string, error) { return failing.URL, nil },
+			}
+			opts := opts
+			opts.Placeholder = test.placeholder
+			result, err := generator.PatchSprite(opts, PatchSpriteOptions{
+				Sprite: previous,
+				Start:  2 * time.Second,
+				End:    2 * time.Second,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status := result.Tiles[1].Status; status != test.expectedStatus {
+				t.Errorf("wrong status\nwant %v\ngot  %v", test.expectedStatus, status)
+			}
+			expectedFailures := []time.Duration{2 * time.Second}
+			if !reflect.DeepEqual(result.FailedTimecodes, expectedFailures) {
+				t.Errorf("wrong failed timecodes\nwant %v\ngot  %v", expectedFailures, result.FailedTimecodes)
+			}
+			img, err := png.Decode(bytes.NewReader(result.Sprite))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []uint8{128, test.expectedLuminance, 128}
+			for i, tile := range result.Tiles {
+				p := image.Pt(tile.X+tile.Width/2, tile.Y+tile.Height/2)
+				if y := luminance(img, p); y != expected[i] {
+					t.Errorf("wrong luminance for tile %d\nwant %d\ngot  %d", i, expected[i], y)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchSpriteSingleTile(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	opts := GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		End:          8 * time.Second,
+		RangeEnd:     EndExclusive,
+		Interval:     2 * time.Second,
+		Columns:      4,
+		Height:       90,
+		OutputFormat: PNG,
+	}
+	generator := Generator{
+		Translator:  func(string) (string, error) { return source.URL, nil },
+		Granularity: 2 * time.Second,
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := generator.PatchSprite(opts, PatchSpriteOptions{
+		Sprite: previous,
+		Start:  2 * time.Second,
+		End:    2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Tiles, previous.Tiles) {
+		t.Errorf("wrong tiles\nwant %#v\ngot  %#v", previous.Tiles, result.Tiles)
+	}
+}
+
+func TestPatchSpriteOmittedFailures(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/thumb-2000-") {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		source.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	opts := GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         3,
+		Height:          90,
+		ContinueOnError: true,
+		OmitFailedTiles: true,
+	}
+	generator := Generator{
+		Translator: func(string) (string, error) { return failing.URL, nil },
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(previous.Tiles) != 2 {
+		t.Fatalf("wrong number of tiles\nwant 2\ngot  %d", len(previous.Tiles))
+	}
+	generator = Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+	}
+	result, err := generator.PatchSprite(opts, PatchSpriteOptions{
+		Sprite: previous,
+		End:    4 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{2 * time.Second}
+	if !reflect.DeepEqual(result.FailedTimecodes, expected) {
+		t.Errorf("wrong failed timecodes\nwant %v\ngot  %v", expected, result.FailedTimecodes)
+	}
+}
+
+func TestPatchSpritePostProcess(t *testing.T) {
+	t.Parallel()
+	source := startSourcePackager(image.Pt(160, 90))
+	defer source.Close()
+	opts := GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      8 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  5,
+		Height:   90,
+	}
+	generator := Generator{
+		Translator: func(string) (string, error) { return source.URL, nil },
+	}
+	previous, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var processed []image.Rectangle
+	opts.PostProcess = func(img draw.Image) error {
+		processed = append(processed, img.Bounds())
+		return nil
+	}
+	_, err = generator.PatchSprite(opts, PatchSpriteOptions{
+		Sprite: previous,
+		Start:  time.Second,
+		End:    4 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []image.Rectangle
+	for _, tile := range previous.Tiles[1:3] {
+		expected = append(expected, image.Rect(tile.X, tile.Y, tile.X+tile.Width, tile.Y+tile.Height))
+	}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("wrong post-processed regions\nwant %v\ngot  %v", expected, processed)
+	}
+}
+
+func TestPatchSpriteErrors(t *testing.T) {
+	t.Parallel()
+	previous := &GenSpriteResult{
+		Tiles: []Tile{{Start: 0, End: 2 * time.Second, Width: 160, Height: 90}},
+	}
+	var tests = []struct {
+		name     string
+		opts     GenSpriteOptions
+		patch    PatchSpriteOptions
+		expected error
+	}{
+		{
+			name:     "no metadata",
+			patch:    PatchSpriteOptions{End: time.Second},
+			expected: ErrUnpatchable,
+		},
+		{
+			name: "sheets",
+			patch: PatchSpriteOptions{
+				Sprite: &GenSpriteResult{Tiles: previous.Tiles, Sheets: []Sheet{{}, {}}},
+				End:    time.Second,
+			},
+			expected: ErrUnpatchable,
+		},
+		{
+			name:     "rotated",
+			opts:     GenSpriteOptions{Orientation: OrientationRotate90},
+			patch:    PatchSpriteOptions{Sprite: previous, End: time.Second},
+			expected: ErrUnpatchable,
+		},
+		{
+			name:     "empty range",
+			patch:    PatchSpriteOptions{Sprite: previous, Start: time.Second, End: 10 * time.Second},
+			expected: ErrNothingToPatch,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var generator Generator
+			_, err := generator.PatchSprite(test.opts, test.patch)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", test.expected, err)
+			}
+		})
+	}
+}
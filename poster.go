@@ -0,0 +1,173 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"image"
+	"time"
+)
+
+// GenPoster generates a single thumbnail (poster frame) for the given video,
+// captured at the given timecode and encoded as JPEG with the given quality.
+//
+// Width and height follow the same rules as in GenSpriteOptions: a zero value
+// lets the video-packager derive that dimension from the source. A zero
+// quality falls back to Generator.JPEGQuality.
+func (g *Generator) GenPoster(ctx context.Context, videoURL string, timecode time.Duration, width, height uint, quality int) (_ []byte, err error) {
+	g.initGenerator()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if quality == 0 {
+		quality = g.JPEGQuality
+	}
+	prefix, err := g.translate(ctx, videoURL)
+	if err != nil {
+		return nil, wrapStage(ctx, StageResolve, err)
+	}
+	token, err := g.newAccessToken(ctx, videoURL)
+	if err != nil {
+		return nil, wrapStage(ctx, StageResolve, err)
+	}
+	var stats *fetchStats
+	if g.UsageHook != nil {
+		stats = &fetchStats{}
+		defer func() {
+			g.UsageHook(stats.usage(nil, 1, err))
+		}()
+	}
+	w := g.newWorker()
+	input := workerInput{
+		prefix:   prefix,
+		timecode: timecode,
+		width:    width,
+		height:   height,
+		token:    token,
+		stats:    stats,
+	}
+	output, err := w.process(ctx, input)
+	if err != nil {
+		return nil, wrapStage(ctx, StageFetch, fetchError(input, err))
+	}
+	encodeStart := time.Now()
+	data, err := encodeJPEG(output.img, quality)
+	stats.addProcessing(time.Since(encodeStart))
+	if err != nil {
+		return nil, wrapStage(ctx, StageEncode, err)
+	}
+	return data, nil
+}
+
+// GenPostersOptions is the set of options that control the generation of
+// individual thumbnails for a video rendition.
+type GenPostersOptions struct {
+	Context     context.Context
+	VideoURL    string
+	Timecodes   []time.Duration
+	Width       uint
+	Height      uint
+	JPEGQuality int
+
+	// QualityFor, when set, is invoked for each timecode to determine the
+	// JPEG quality of the corresponding thumbnail, overriding JPEGQuality.
+	// It can be used to encode key moments (e.g. chapter starts) at a
+	// higher quality.
+	QualityFor func(timecode time.Duration) int
+
+	// TimecodeMapper, when set, translates the timecode of each thumbnail
+	// into the offset used in the thumbnail URL. See
+	// GenSpriteOptions.TimecodeMapper.
+	TimecodeMapper TimecodeMapper
+
+	// Selectors are additional nginx-vod-module selectors appended to the
+	// thumbnail suffix. See GenSpriteOptions.Selectors.
+	Selectors []string
+
+	// Passthrough indicates whether the JPEGs returned by the
+	// video-packager should be returned as is, instead of being decoded
+	// and re-encoded, saving CPU and avoiding generation loss. Only the
+	// headers of the thumbnails are checked, and thumbnails that don't
+	// match the requested dimensions are still decoded, resized and
+	// re-encoded. JPEGQuality and QualityFor only apply to those.
+	Passthrough bool
+
+	// Labels are caller-provided labels (e.g. the tenant) attached to the
+	// Usage reported to Generator.UsageHook.
+	Labels map[string]string
+}
+
+func (o *GenPostersOptions) quality(timecode time.Duration) int {
+	if o.QualityFor != nil {
+		return o.QualityFor(timecode)
+	}
+	return o.JPEGQuality
+}
+
+// GenPosters generates one thumbnail for each of the timecodes in the given
+// options, using the same pool of workers used for generating sprites.
+//
+// Thumbnails aren't stitched together: each of them is encoded as a separate
+// JPEG and returned in the same order as opts.Timecodes.
+func (g *Generator) GenPosters(opts GenPostersOptions) (_ [][]byte, err error) {
+	g.initGenerator()
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.JPEGQuality == 0 {
+		opts.JPEGQuality = g.JPEGQuality
+	}
+	prefix, err := g.translate(opts.Context, opts.VideoURL)
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageResolve, err)
+	}
+	token, err := g.newAccessToken(opts.Context, opts.VideoURL)
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageResolve, err)
+	}
+	var stats *fetchStats
+	if g.UsageHook != nil {
+		stats = &fetchStats{}
+		defer func() {
+			g.UsageHook(stats.usage(opts.Labels, len(opts.Timecodes), err))
+		}()
+	}
+	inputs := make([]workerInput, len(opts.Timecodes))
+	for i, timecode := range opts.Timecodes {
+		inputs[i] = workerInput{
+			index:          i,
+			prefix:         prefix,
+			timecode:       timecode,
+			width:          opts.Width,
+			height:         opts.Height,
+			timecodeMapper: opts.TimecodeMapper,
+			selectors:      opts.Selectors,
+			passthrough:    opts.Passthrough,
+			stats:          stats,
+			token:          token,
+		}
+	}
+	posters := make([][]byte, len(inputs))
+	imgs := make([]image.Image, len(inputs))
+	err = g.fetch(opts.Context, inputs, false, func(output workerOutput) {
+		posters[output.input.index] = output.raw
+		imgs[output.input.index] = output.img
+	})
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageFetch, err)
+	}
+	for i, img := range imgs {
+		if posters[i] != nil {
+			continue
+		}
+		encodeStart := time.Now()
+		posters[i], err = encodeJPEG(img, opts.quality(opts.Timecodes[i]))
+		stats.addProcessing(time.Since(encodeStart))
+		if err != nil {
+			return nil, wrapStage(opts.Context, StageEncode, err)
+		}
+	}
+	return posters, nil
+}
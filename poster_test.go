@@ -0,0 +1,224 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenPoster(t *testing.T) {
+	t.Parallel()
+	const maxDiff = int64(11e5)
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	data, err := generator.GenPoster(context.Background(), "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4", 4*time.Second, 0, 72, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poster, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("GenPoster didn't generate a valid jpeg: %v", err)
+	}
+	expected, err := loadSpriteFromDisk(filepath.Join("testdata", "img03.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poster.Bounds() != expected.Bounds() {
+		t.Errorf("image bounds don't match\nwant %v\ngot  %v", expected.Bounds(), poster.Bounds())
+	}
+	if diff := imageDiff(poster, expected); int64(math.Abs(float64(diff))) > maxDiff {
+		t.Errorf("images are too different\nmax diff: %d\ngot diff: %d", maxDiff, diff)
+	}
+}
+
+func TestGenPosterDefaultQuality(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4, JPEGQuality: 10}
+	const videoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+
+	defaultQuality, err := generator.GenPoster(context.Background(), videoURL, 4*time.Second, 0, 72, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicitQuality, err := generator.GenPoster(context.Background(), videoURL, 4*time.Second, 0, 72, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(defaultQuality, explicitQuality) {
+		t.Errorf("poster without quality didn't use Generator.JPEGQuality\nwant %d bytes\ngot  %d bytes", len(explicitQuality), len(defaultQuality))
+	}
+}
+
+func TestGenPosterErrors(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	data, err := generator.GenPoster(context.Background(), "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4", 40*time.Second, 0, 72, 100)
+	if data != nil {
+		t.Error("got unexpected non-nil data")
+	}
+	var verr *VideoPackagerError
+	if !errors.As(err, &verr) {
+		t.Errorf("expected %#v to be VideoPackagerError, but it wasn't", err)
+	}
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) || genErr.Stage != StageFetch || genErr.Timecode != 40*time.Second {
+		t.Errorf("expected %#v to be a GenerationError in the fetch stage at 40s, but it wasn't", err)
+	}
+}
+
+func TestGenPosters(t *testing.T) {
+	t.Parallel()
+	const maxDiff = int64(11e5)
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	posters, err := generator.GenPosters(GenPostersOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Timecodes:   []time.Duration{18 * time.Second, 0, 4 * time.Second},
+		Height:      72,
+		JPEGQuality: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{"img10.jpg", "img01.jpg", "img03.jpg"}
+	if len(posters) != len(expectedFiles) {
+		t.Fatalf("wrong number of posters\nwant %d\ngot  %d", len(expectedFiles), len(posters))
+	}
+	for i, data := range posters {
+		poster, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("GenPosters didn't generate a valid jpeg at position %d: %v", i, err)
+		}
+		expected, err := loadSpriteFromDisk(filepath.Join("testdata", expectedFiles[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := imageDiff(poster, expected); int64(math.Abs(float64(diff))) > maxDiff {
+			t.Errorf("poster %d is too different from %s\nmax diff: %d\ngot diff: %d", i, expectedFiles[i], maxDiff, diff)
+		}
+	}
+}
+
+func TestGenPostersPassthrough(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	tests := []struct {
+		name          string
+		height        uint
+		expectedRaw   bool
+		expectedBound image.Rectangle
+	}{
+		{"matching dimensions", 72, true, image.Rect(0, 0, 127, 72)},
+		{"ignored dimensions", 36, false, image.Rect(0, 0, 64, 36)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			posters, err := generator.GenPosters(GenPostersOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Timecodes:   []time.Duration{18 * time.Second, 0},
+				Height:      test.height,
+				Passthrough: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, name := range []string{"img10.jpg", "img01.jpg"} {
+				expected, err := ioutil.ReadFile(filepath.Join("testdata", name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if raw := bytes.Equal(posters[i], expected); raw != test.expectedRaw {
+					t.Errorf("wrong passthrough for poster %d\nwant %v\ngot  %v", i, test.expectedRaw, raw)
+				}
+				config, err := jpeg.DecodeConfig(bytes.NewReader(posters[i]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bounds := image.Rect(0, 0, config.Width, config.Height); bounds != test.expectedBound {
+					t.Errorf("wrong dimensions for poster %d\nwant %v\ngot  %v", i, test.expectedBound, bounds)
+				}
+			}
+		})
+	}
+}
+
+func TestGenPostersQualityFor(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	opts := GenPostersOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Timecodes:   []time.Duration{0, 2 * time.Second},
+		Height:      72,
+		JPEGQuality: 10,
+	}
+	lowQuality, err := generator.GenPosters(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.QualityFor = func(timecode time.Duration) int {
+		if timecode == 2*time.Second {
+			return 100
+		}
+		return opts.JPEGQuality
+	}
+	posters, err := generator.GenPosters(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(posters[0], lowQuality[0]) {
+		t.Error("QualityFor changed the poster that should have used the default quality")
+	}
+	if len(posters[1]) <= len(lowQuality[1]) {
+		t.Errorf("QualityFor didn't increase the quality of the poster\nlow quality size:  %d\nhigh quality size: %d", len(lowQuality[1]), len(posters[1]))
+	}
+}
+
+func TestGenPostersErrors(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	posters, err := generator.GenPosters(GenPostersOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Timecodes: []time.Duration{0, 40 * time.Second},
+		Height:    72,
+	})
+	if posters != nil {
+		t.Error("got unexpected non-nil posters")
+	}
+	var verr *VideoPackagerError
+	if !errors.As(err, &verr) {
+		t.Errorf("expected %#v to be VideoPackagerError, but it wasn't", err)
+	}
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) || genErr.Stage != StageFetch || genErr.Timecode != 40*time.Second {
+		t.Errorf("expected %#v to be a GenerationError in the fetch stage at 40s, but it wasn't", err)
+	}
+}
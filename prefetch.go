@@ -0,0 +1,29 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import "context"
+
+// Prefetch requests all thumbnails of the sprite described by the given
+// options without decoding them or assembling the sprite, warming the caches
+// of the video-packager (and of any CDN in front of it) ahead of an
+// anticipated GenSprite call, e.g. when a video is published.
+//
+// Options are validated and limits are applied just like in GenSprite. The
+// given context takes precedence over opts.Context.
+func (g *Generator) Prefetch(ctx context.Context, opts GenSpriteOptions) error {
+	if ctx != nil {
+		opts.Context = ctx
+	}
+	if err := g.prepare(&opts); err != nil {
+		return err
+	}
+	inputs := opts.inputs(opts.timecodes())
+	for i := range inputs {
+		inputs[i].discard = true
+	}
+	inputs = orderInputs(inputs, opts.FetchOrder, g.nworkers(len(inputs)), opts.ShuffleSeed)
+	return g.fetch(opts.Context, inputs, false, func(workerOutput) {})
+}
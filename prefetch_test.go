@@ -0,0 +1,66 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	err := generator.Prefetch(context.Background(), GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&packager.requests); n != 10 {
+		t.Errorf("wrong number of requests\nwant 10\ngot  %d", n)
+	}
+}
+
+func TestPrefetchErrors(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{4000}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	tests := []struct {
+		name            string
+		continueOnError bool
+		check           func(error) bool
+	}{
+		{"failure", false, func(err error) bool {
+			var verr *VideoPackagerError
+			return errors.As(err, &verr)
+		}},
+		{"continue on error", true, func(err error) bool { return err == nil }},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			err := generator.Prefetch(context.Background(), GenSpriteOptions{
+				VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:             18 * time.Second,
+				Interval:        2 * time.Second,
+				Height:          72,
+				ContinueOnError: test.continueOnError,
+			})
+			if !test.check(err) {
+				t.Errorf("unexpected error returned: %v", err)
+			}
+		})
+	}
+}
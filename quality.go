@@ -0,0 +1,100 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"math"
+)
+
+// TileQuality contains simple heuristics describing the content of a tile,
+// so storyboards that are mostly slates or black frames can be detected. See
+// GenSpriteOptions.QualityScores.
+type TileQuality struct {
+	// Luminance is the mean luminance of the thumbnail, from 0 (black) to
+	// 1 (white).
+	Luminance float64 `json:"luminance"`
+
+	// Sharpness is the mean magnitude of the luminance gradient of the
+	// thumbnail, from 0 (flat, e.g. blank or very blurry frames) to 1.
+	Sharpness float64 `json:"sharpness"`
+
+	// Similarity is how similar the thumbnail is to the thumbnail of the
+	// previous tile, from 0 to 1 (identical). It's zero when the previous
+	// tile has no thumbnail.
+	Similarity float64 `json:"similarity"`
+}
+
+// blackLuminance is the luminance under which a thumbnail is considered
+// black.
+const blackLuminance = 0.06
+
+// Black reports whether the thumbnail is essentially black.
+func (q *TileQuality) Black() bool {
+	return q.Luminance < blackLuminance
+}
+
+// signatureSize is the size of the grid used for comparing thumbnails.
+const signatureSize = 8
+
+// tileScore is the quality of a thumbnail, along with the signature used
+// for comparing it to its neighbors.
+type tileScore struct {
+	quality   TileQuality
+	signature [signatureSize * signatureSize]float64
+}
+
+// scoreTile computes the luminance, sharpness and signature of the given
+// image. Similarity is left for the caller, as it depends on the previous
+// tile.
+func scoreTile(img image.Image) *tileScore {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return &tileScore{}
+	}
+	luma := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			luma[y*width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+		}
+	}
+	var score tileScore
+	var counts [signatureSize * signatureSize]int
+	var sum, gradient float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			l := luma[y*width+x]
+			sum += l
+			if x+1 < width {
+				gradient += math.Abs(luma[y*width+x+1] - l)
+			}
+			if y+1 < height {
+				gradient += math.Abs(luma[(y+1)*width+x] - l)
+			}
+			cell := (y*signatureSize/height)*signatureSize + x*signatureSize/width
+			score.signature[cell] += l
+			counts[cell]++
+		}
+	}
+	for i, count := range counts {
+		if count > 0 {
+			score.signature[i] /= float64(count)
+		}
+	}
+	score.quality.Luminance = sum / float64(width*height)
+	score.quality.Sharpness = gradient / float64(2*width*height)
+	return &score
+}
+
+// similarity returns how similar the given scores are, from 0 to 1.
+func (s *tileScore) similarity(other *tileScore) float64 {
+	var diff float64
+	for i := range s.signature {
+		diff += math.Abs(s.signature[i] - other.signature[i])
+	}
+	return 1 - diff/float64(len(s.signature))
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScoreTile(t *testing.T) {
+	t.Parallel()
+	checkerboard := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			if (x+y)%2 == 0 {
+				checkerboard.Set(x, y, color.White)
+			} else {
+				checkerboard.Set(x, y, color.Black)
+			}
+		}
+	}
+	black := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	fill(black, color.Black)
+	white := image.NewRGBA(image.Rect(5, 5, 21, 21))
+	fill(white, color.White)
+	var tests = []struct {
+		name          string
+		img           image.Image
+		wantLuminance float64
+		wantSharpness float64
+		wantBlack     bool
+	}{
+		{
+			name:          "black",
+			img:           black,
+			wantLuminance: 0,
+			wantSharpness: 0,
+			wantBlack:     true,
+		},
+		{
+			name:          "white",
+			img:           white,
+			wantLuminance: 1,
+			wantSharpness: 0,
+		},
+		{
+			name:          "checkerboard",
+			img:           checkerboard,
+			wantLuminance: 0.5,
+			wantSharpness: 2 * 15 * 16 / float64(2*16*16),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			score := scoreTile(test.img)
+			if !almostEqual(score.quality.Luminance, test.wantLuminance) {
+				t.Errorf("wrong luminance\nwant %f\ngot  %f", test.wantLuminance, score.quality.Luminance)
+			}
+			if !almostEqual(score.quality.Sharpness, test.wantSharpness) {
+				t.Errorf("wrong sharpness\nwant %f\ngot  %f", test.wantSharpness, score.quality.Sharpness)
+			}
+			if black := score.quality.Black(); black != test.wantBlack {
+				t.Errorf("wrong Black\nwant %v\ngot  %v", test.wantBlack, black)
+			}
+			if similarity := score.similarity(score); !almostEqual(similarity, 1) {
+				t.Errorf("wrong similarity to itself\nwant 1\ngot  %f", similarity)
+			}
+		})
+	}
+	if similarity := scoreTile(black).similarity(scoreTile(white)); !almostEqual(similarity, 0) {
+		t.Errorf("wrong similarity between black and white\nwant 0\ngot  %f", similarity)
+	}
+}
+
+func TestGenSpriteQualityScores(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:      "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:           6 * time.Second,
+		Interval:      2 * time.Second,
+		Columns:       4,
+		Height:        72,
+		QualityScores: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tile := range result.Tiles {
+		if tile.Quality == nil {
+			t.Fatalf("missing quality for tile %d", i)
+		}
+		q := tile.Quality
+		if q.Luminance <= 0 || q.Luminance >= 1 || q.Sharpness <= 0 || q.Sharpness >= 1 {
+			t.Errorf("quality of tile %d out of bounds: %#v", i, *q)
+		}
+		if i == 0 && q.Similarity != 0 {
+			t.Errorf("wrong similarity for the first tile\nwant 0\ngot  %f", q.Similarity)
+		}
+		if i > 0 && (q.Similarity <= 0 || q.Similarity > 1) {
+			t.Errorf("similarity of tile %d out of bounds: %f", i, q.Similarity)
+		}
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
@@ -0,0 +1,224 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const modulePath = "github.com/fsouza/vod-module-sprite"
+
+// Report is a machine-readable summary of a sprite generation, suitable as
+// an audit artifact. See GenSpriteOptions.Report.
+type Report struct {
+	// Version is the version of this package used for generating the
+	// sprite, as recorded in the build information of the binary.
+	Version string
+
+	VideoURL string
+	Start    time.Duration
+	End      time.Duration
+	Interval time.Duration
+	Columns  uint
+	Width    uint
+	Height   uint
+	Quality  int
+
+	// StartedAt is the time when the generation started, and Duration
+	// is how long it took. FetchDuration and EncodeDuration break down
+	// the time spent fetching and drawing the thumbnails and encoding
+	// the sprite.
+	StartedAt      time.Time
+	Duration       time.Duration
+	FetchDuration  time.Duration
+	EncodeDuration time.Duration
+
+	// Requests is the number of requests sent to the video-packager,
+	// including Refetches (thumbnails fetched again because they were
+	// truncated). BytesDownloaded is the size of all responses.
+	Requests        int64
+	Refetches       int64
+	BytesDownloaded int64
+
+	// MaxQueueDepth is the maximum number of thumbnails that were queued
+	// waiting to be drawn. When it's close to Generator.QueueSize,
+	// drawing is the bottleneck of the generation.
+	MaxQueueDepth int
+
+	// TileStatuses contains the status of every tile, in chronological
+	// order, including tiles omitted from the metadata.
+	TileStatuses []TileStatus
+
+	// SpriteSHA256 is the hex-encoded SHA-256 checksum of the encoded
+	// sprite, which is the first sheet when it's split into sheets.
+	SpriteSHA256 string
+
+	// SheetSHA256 contains the hex-encoded SHA-256 checksum of every
+	// sheet, in the order of GenSpriteResult.Sheets. It's empty when the
+	// sprite isn't split into sheets.
+	SheetSHA256 []string
+}
+
+type jsonReport struct {
+	Version         string       `json:"version"`
+	VideoURL        string       `json:"video_url"`
+	Start           float64      `json:"start"`
+	End             float64      `json:"end"`
+	Interval        float64      `json:"interval"`
+	Columns         uint         `json:"columns"`
+	Width           uint         `json:"width"`
+	Height          uint         `json:"height"`
+	Quality         int          `json:"quality"`
+	StartedAt       time.Time    `json:"started_at"`
+	Duration        float64      `json:"duration"`
+	FetchDuration   float64      `json:"fetch_duration"`
+	EncodeDuration  float64      `json:"encode_duration"`
+	Requests        int64        `json:"requests"`
+	Refetches       int64        `json:"refetches"`
+	BytesDownloaded int64        `json:"bytes_downloaded"`
+	MaxQueueDepth   int          `json:"max_queue_depth"`
+	TileStatuses    []TileStatus `json:"tile_statuses"`
+	SpriteSHA256    string       `json:"sprite_sha256"`
+	SheetSHA256     []string     `json:"sheet_sha256,omitempty"`
+}
+
+// MarshalJSON encodes the report as JSON, representing timecodes and
+// durations in seconds.
+func (r Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonReport{
+		Version:         r.Version,
+		VideoURL:        r.VideoURL,
+		Start:           r.Start.Seconds(),
+		End:             r.End.Seconds(),
+		Interval:        r.Interval.Seconds(),
+		Columns:         r.Columns,
+		Width:           r.Width,
+		Height:          r.Height,
+		Quality:         r.Quality,
+		StartedAt:       r.StartedAt,
+		Duration:        r.Duration.Seconds(),
+		FetchDuration:   r.FetchDuration.Seconds(),
+		EncodeDuration:  r.EncodeDuration.Seconds(),
+		Requests:        r.Requests,
+		Refetches:       r.Refetches,
+		BytesDownloaded: r.BytesDownloaded,
+		MaxQueueDepth:   r.MaxQueueDepth,
+		TileStatuses:    r.TileStatuses,
+		SpriteSHA256:    r.SpriteSHA256,
+		SheetSHA256:     r.SheetSHA256,
+	})
+}
+
+// newReport returns a report describing the given options.
+func newReport(opts *GenSpriteOptions, startedAt time.Time) *Report {
+	return &Report{
+		Version:   moduleVersion(),
+		VideoURL:  opts.VideoURL,
+		Start:     opts.Start,
+		End:       opts.End,
+		Interval:  opts.Interval,
+		Columns:   opts.Columns,
+		Width:     opts.Width,
+		Height:    opts.Height,
+		Quality:   opts.JPEGQuality,
+		StartedAt: startedAt,
+	}
+}
+
+// finish fills the statistics of the generation in the report. sheetSums
+// holds the checksums of the sheets, and is nil when the sprite isn't split.
+func (r *Report) finish(stats *fetchStats, spriteSum []byte, sheetSums [][]byte, fetched, encoded time.Time) {
+	r.Duration = encoded.Sub(r.StartedAt)
+	r.FetchDuration = fetched.Sub(r.StartedAt)
+	r.EncodeDuration = encoded.Sub(fetched)
+	r.Requests = atomic.LoadInt64(&stats.requests)
+	r.Refetches = atomic.LoadInt64(&stats.refetches)
+	r.BytesDownloaded = atomic.LoadInt64(&stats.bytes)
+	r.MaxQueueDepth = stats.maxQueueDepth
+	r.SpriteSHA256 = hex.EncodeToString(spriteSum)
+	for _, sum := range sheetSums {
+		r.SheetSHA256 = append(r.SheetSHA256, hex.EncodeToString(sum))
+	}
+}
+
+// fetchStats collects statistics of the requests sent by the workers.
+type fetchStats struct {
+	requests  int64
+	refetches int64
+	bytes     int64
+
+	// processing is the time, in nanoseconds, spent decoding, resizing
+	// and encoding images.
+	processing int64
+
+	// headerChecks is the number of thumbnails whose header was checked
+	// before decoding, and headerRejections the number of them that were
+	// rejected.
+	headerChecks     int64
+	headerRejections int64
+
+	// maxQueueDepth is only accessed from the goroutine that draws the
+	// sprite.
+	maxQueueDepth int
+
+	hostsMu sync.Mutex
+	hosts   map[string]*HostStats
+}
+
+func (s *fetchStats) addRequest() {
+	if s != nil {
+		atomic.AddInt64(&s.requests, 1)
+	}
+}
+
+func (s *fetchStats) addRefetch() {
+	if s != nil {
+		atomic.AddInt64(&s.refetches, 1)
+	}
+}
+
+func (s *fetchStats) addBytes(n int64) {
+	if s != nil {
+		atomic.AddInt64(&s.bytes, n)
+	}
+}
+
+func (s *fetchStats) addProcessing(d time.Duration) {
+	if s != nil {
+		atomic.AddInt64(&s.processing, int64(d))
+	}
+}
+
+func (s *fetchStats) observeQueueDepth(depth int) {
+	if depth > s.maxQueueDepth {
+		s.maxQueueDepth = depth
+	}
+}
+
+// moduleVersion returns the version of this package in the build
+// information of the running binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
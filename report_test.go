@@ -0,0 +1,175 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteReport(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{2000}
+	packager.truncate = map[int64]int{4000: 1}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	before := time.Now()
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Height:          72,
+		JPEGQuality:     80,
+		ContinueOnError: true,
+		OmitFailedTiles: true,
+		Report:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := result.Report
+	if report == nil {
+		t.Fatal("unexpected nil report")
+	}
+
+	var expectedBytes int64
+	for _, name := range []string{"img01.jpg", "img03.jpg"} {
+		info, err := os.Stat(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedBytes += info.Size()
+		if name == "img03.jpg" {
+			// the truncated response.
+			expectedBytes += info.Size() / 2
+		}
+	}
+	sum := sha256.Sum256(result.Sprite)
+	expected := Report{
+		Version:         report.Version,
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         1,
+		Height:          72,
+		Quality:         80,
+		StartedAt:       report.StartedAt,
+		Duration:        report.Duration,
+		FetchDuration:   report.FetchDuration,
+		EncodeDuration:  report.EncodeDuration,
+		Requests:        4,
+		Refetches:       1,
+		BytesDownloaded: expectedBytes,
+		TileStatuses:    []TileStatus{TileOK, TileFailed, TileOK},
+		SpriteSHA256:    hex.EncodeToString(sum[:]),
+	}
+	if !reflect.DeepEqual(*report, expected) {
+		t.Errorf("wrong report\nwant %#v\ngot  %#v", expected, *report)
+	}
+	if report.Version == "" {
+		t.Error("unexpected empty version")
+	}
+	if report.StartedAt.Before(before) || report.Duration != report.FetchDuration+report.EncodeDuration {
+		t.Errorf("inconsistent timings: %#v", report)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Report map[string]interface{} `json:"report"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if statuses := decoded.Report["tile_statuses"]; !reflect.DeepEqual(statuses, []interface{}{"ok", "failed", "ok"}) {
+		t.Errorf("wrong statuses in the JSON report: %v", statuses)
+	}
+	if end := decoded.Report["end"]; end != 4.0 {
+		t.Errorf("wrong end in the JSON report\nwant 4\ngot  %v", end)
+	}
+}
+
+func TestGenSpriteReportQueueDepth(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4, QueueSize: 2}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  5,
+		Height:   72,
+		Report:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := result.Report.MaxQueueDepth; depth < 0 || depth > 2 {
+		t.Errorf("queue depth out of bounds\nwant between 0 and 2\ngot  %d", depth)
+	}
+}
+
+func TestGenSpriteReportSheets(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:       18 * time.Second,
+		Interval:  2 * time.Second,
+		Columns:   2,
+		Height:    72,
+		SheetRows: 2,
+		Report:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, sheet := range result.Sheets {
+		sum := sha256.Sum256(sheet.Sprite)
+		expected = append(expected, hex.EncodeToString(sum[:]))
+	}
+	if len(expected) != 3 {
+		t.Fatalf("wrong number of sheets\nwant 3\ngot  %d", len(expected))
+	}
+	if !reflect.DeepEqual(result.Report.SheetSHA256, expected) {
+		t.Errorf("wrong sheet checksums\nwant %v\ngot  %v", expected, result.Report.SheetSHA256)
+	}
+	if result.Report.SpriteSHA256 != expected[0] {
+		t.Errorf("wrong sprite checksum\nwant %s\ngot  %s", expected[0], result.Report.SpriteSHA256)
+	}
+}
+
+func TestGenSpriteNoReport(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      2 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Report != nil {
+		t.Errorf("unexpected report: %#v", result.Report)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ThumbnailRequest describes a thumbnail to be requested from the
+// video-packager.
+type ThumbnailRequest struct {
+	// URL is the nginx-vod-module URL of the thumbnail, derived from the
+	// thumb prefix.
+	URL string
+
+	// Prefix is the thumb prefix returned by the translator.
+	Prefix string
+
+	// Timecode is the timecode of the thumbnail.
+	Timecode time.Duration
+
+	// Width and Height are the requested dimensions of the thumbnail. A
+	// zero value means that the dimension should be derived from the
+	// source.
+	Width  uint
+	Height uint
+}
+
+// RequestBuilder builds the HTTP requests sent for retrieving thumbnails,
+// allowing the Generator to work with services that don't follow the
+// nginx-vod-module URL scheme (e.g. frame-extraction services that take a
+// POST with a JSON body). Responses must still be JPEG images.
+type RequestBuilder interface {
+	BuildRequest(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error)
+}
+
+// RequestBuilderFunc is a function that implements RequestBuilder.
+type RequestBuilderFunc func(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error)
+
+// BuildRequest invokes f.
+func (f RequestBuilderFunc) BuildRequest(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error) {
+	return f(ctx, thumb)
+}
+
+// defaultRequestBuilder sends GET requests to the nginx-vod-module URL of the
+// thumbnail.
+var defaultRequestBuilder = RequestBuilderFunc(func(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, thumb.URL, nil)
+})
@@ -0,0 +1,95 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type frameRequest struct {
+	Video     string `json:"video"`
+	Timestamp int64  `json:"timestamp_ms"`
+	Height    uint   `json:"height"`
+}
+
+func TestGenSpriteRequestBuilder(t *testing.T) {
+	t.Parallel()
+	var packager fakePackager
+	var mu sync.Mutex
+	var received []frameRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req frameRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+		fileName := packager.fileName(req.Timestamp)
+		if fileName == "" {
+			http.Error(w, "invalid timestamp", http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", fileName))
+	}))
+	defer server.Close()
+
+	generator := Generator{
+		Translator: func(videoURL string) (string, error) {
+			return videoURL, nil
+		},
+		RequestBuilder: RequestBuilderFunc(func(ctx context.Context, thumb ThumbnailRequest) (*http.Request, error) {
+			body, err := json.Marshal(frameRequest{
+				Video:     thumb.Prefix,
+				Timestamp: int64(thumb.Timecode / time.Millisecond),
+				Height:    thumb.Height,
+			})
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		}),
+		MaxWorkers: 4,
+	}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "video-123",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tiles) != 3 || result.Width != 127 || result.Height != 216 {
+		t.Errorf("wrong sprite generated: %dx%d with %d tiles", result.Width, result.Height, len(result.Tiles))
+	}
+	expected := map[int64]frameRequest{
+		0:    {Video: "video-123", Timestamp: 0, Height: 72},
+		2000: {Video: "video-123", Timestamp: 2000, Height: 72},
+		4000: {Video: "video-123", Timestamp: 4000, Height: 72},
+	}
+	got := make(map[int64]frameRequest)
+	for _, req := range received {
+		got[req.Timestamp] = req
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong requests received\nwant %#v\ngot  %#v", expected, got)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// GenSpriteResult is the result of a sprite generation: the encoded sprite
+// along with the metadata describing its layout.
+//
+// GenSpriteResult can be encoded as JSON, in which case the sprite itself is
+// omitted.
+type GenSpriteResult struct {
+	Sprite []byte `json:"-"`
+
+	// Format is the image format of Sprite.
+	Format OutputFormat `json:"format"`
+
+	// Width and Height are the dimensions of the sprite, in pixels.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// TileWidth and TileHeight are the dimensions of each tile in the
+	// sprite, in pixels.
+	TileWidth  int `json:"tile_width"`
+	TileHeight int `json:"tile_height"`
+
+	// Tiles describes each thumbnail in the sprite, in chronological
+	// order.
+	Tiles []Tile `json:"tiles"`
+
+	// Sheets lists the images of the sprite, in chronological order,
+	// when it's split by GenSpriteOptions.SheetRows or MaxSheetHeight,
+	// along with the timecodes each one covers. Sprite, Width and
+	// Height are those of the first sheet in that case.
+	Sheets []Sheet `json:"sheets,omitempty"`
+
+	// FailedTimecodes lists the start timecodes of the tiles whose
+	// thumbnails failed to be fetched (see
+	// GenSpriteOptions.ContinueOnError), including tiles omitted from
+	// Tiles.
+	FailedTimecodes []time.Duration `json:"-"`
+
+	// BytesDownloaded is the size of all responses received from the
+	// video-packager.
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+
+	// Expires is the earliest expiration time declared (via
+	// Cache-Control or Expires) by the video-packager for the thumbnails
+	// in the sprite, indicating how long the sprite can be considered
+	// fresh. It's nil when the video-packager didn't declare it.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// EndClamped indicates whether the End of the sprite was clamped to
+	// the duration of the video. See Generator.DurationProvider.
+	EndClamped bool `json:"end_clamped,omitempty"`
+
+	// Warnings lists the non-fatal conditions that happened during the
+	// generation, in no particular order.
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// Report summarizes the generation. It's only set when
+	// GenSpriteOptions.Report is true.
+	Report *Report `json:"report,omitempty"`
+}
+
+// MarshalJSON encodes the result as JSON, representing timecodes in
+// seconds.
+func (r GenSpriteResult) MarshalJSON() ([]byte, error) {
+	type result GenSpriteResult
+	failed := make([]float64, len(r.FailedTimecodes))
+	for i, timecode := range r.FailedTimecodes {
+		failed[i] = timecode.Seconds()
+	}
+	return json.Marshal(struct {
+		result
+		FailedTimecodes []float64 `json:"failed_timecodes,omitempty"`
+	}{result(r), failed})
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON. The sprite itself
+// isn't part of the JSON, so Sprite is left empty.
+func (r *GenSpriteResult) UnmarshalJSON(data []byte) error {
+	type result GenSpriteResult
+	decoded := struct {
+		*result
+		FailedTimecodes []float64 `json:"failed_timecodes"`
+	}{result: (*result)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	r.FailedTimecodes = nil
+	for _, timecode := range decoded.FailedTimecodes {
+		r.FailedTimecodes = append(r.FailedTimecodes, seconds(timecode))
+	}
+	return nil
+}
+
+// Tile describes the position of a thumbnail in the sprite and the time range
+// it represents.
+type Tile struct {
+	// Start is the timecode of the thumbnail, and End is the timecode of
+	// the next thumbnail in the sprite (or Start plus the sampling
+	// interval for the last thumbnail).
+	Start time.Duration
+	End   time.Duration
+
+	// CapturedAt is the timecode where the thumbnail was captured. It
+	// differs from Start when thumbnails are snapped to keyframes.
+	CapturedAt time.Duration
+
+	// Status indicates whether the thumbnail was fetched successfully.
+	Status TileStatus
+
+	// Sheet is the index of the sheet that contains the thumbnail, when
+	// the sprite is split into sheets (see GenSpriteOptions.SheetRows and
+	// MaxSheetHeight).
+	Sheet int
+
+	// X, Y, Width and Height describe the region of the sprite (or of
+	// its sheet) that contains the thumbnail.
+	X      int
+	Y      int
+	Width  int
+	Height int
+
+	// Quality contains heuristics describing the content of the tile.
+	// It's only set when GenSpriteOptions.QualityScores is true and the
+	// thumbnail was fetched.
+	Quality *TileQuality
+
+	// URL is the URL the thumbnail was fetched from, as built by
+	// Generator.RequestBuilder. It's only set when
+	// GenSpriteOptions.TileURLs is true.
+	URL string
+
+	// Trace describes the response of the video-packager for the
+	// thumbnail. It's only set when Generator.CaptureHeaders isn't empty
+	// and a response was received.
+	Trace *TileTrace
+}
+
+// TileTrace describes the response of the video-packager for a thumbnail, so
+// failed or slow tiles can be traced to specific packager or CDN nodes.
+type TileTrace struct {
+	// Header contains the response headers listed in
+	// Generator.CaptureHeaders.
+	Header http.Header
+
+	// Duration is how long the video-packager took to respond.
+	Duration time.Duration
+}
+
+type jsonTileTrace struct {
+	Header   http.Header `json:"header"`
+	Duration float64     `json:"duration"`
+}
+
+// MarshalJSON encodes the trace as JSON, representing the duration in
+// seconds.
+func (t TileTrace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonTileTrace{Header: t.Header, Duration: t.Duration.Seconds()})
+}
+
+// UnmarshalJSON decodes a trace encoded by MarshalJSON.
+func (t *TileTrace) UnmarshalJSON(data []byte) error {
+	var jt jsonTileTrace
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return err
+	}
+	*t = TileTrace{Header: jt.Header, Duration: seconds(jt.Duration)}
+	return nil
+}
+
+type jsonTile struct {
+	Start      float64      `json:"start"`
+	End        float64      `json:"end"`
+	CapturedAt float64      `json:"captured_at"`
+	Status     TileStatus   `json:"status"`
+	Sheet      int          `json:"sheet,omitempty"`
+	X          int          `json:"x"`
+	Y          int          `json:"y"`
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	Quality    *TileQuality `json:"quality,omitempty"`
+	URL        string       `json:"url,omitempty"`
+	Trace      *TileTrace   `json:"trace,omitempty"`
+}
+
+// MarshalJSON encodes the tile as JSON, representing timecodes in seconds.
+func (t Tile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonTile{
+		Start:      t.Start.Seconds(),
+		End:        t.End.Seconds(),
+		CapturedAt: t.CapturedAt.Seconds(),
+		Status:     t.Status,
+		Sheet:      t.Sheet,
+		X:          t.X,
+		Y:          t.Y,
+		Width:      t.Width,
+		Height:     t.Height,
+		Quality:    t.Quality,
+		URL:        t.URL,
+		Trace:      t.Trace,
+	})
+}
+
+// UnmarshalJSON decodes a tile encoded by MarshalJSON.
+func (t *Tile) UnmarshalJSON(data []byte) error {
+	var jt jsonTile
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return err
+	}
+	*t = Tile{
+		Start:      seconds(jt.Start),
+		End:        seconds(jt.End),
+		CapturedAt: seconds(jt.CapturedAt),
+		Status:     jt.Status,
+		Sheet:      jt.Sheet,
+		X:          jt.X,
+		Y:          jt.Y,
+		Width:      jt.Width,
+		Height:     jt.Height,
+		Quality:    jt.Quality,
+		URL:        jt.URL,
+		Trace:      jt.Trace,
+	}
+	return nil
+}
+
+// seconds converts a number of seconds into a duration, rounded to the
+// nearest nanosecond.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+// TileStatus represents the outcome of fetching the thumbnail of a tile.
+type TileStatus int
+
+const (
+	// TileOK indicates that the thumbnail was fetched and drawn in the
+	// sprite.
+	TileOK TileStatus = iota
+
+	// TileFailed indicates that the video-packager failed to generate
+	// the thumbnail and the generation continued without it (see
+	// GenSpriteOptions.ContinueOnError), leaving the tile blank.
+	TileFailed
+
+	// TilePlaceholder indicates that the video-packager failed to
+	// generate the thumbnail and the tile was filled with the
+	// placeholder image (see GenSpriteOptions.Placeholder).
+	TilePlaceholder
+)
+
+var tileStatusNames = map[TileStatus]string{
+	TileOK:          "ok",
+	TileFailed:      "failed",
+	TilePlaceholder: "placeholder",
+}
+
+// String returns the name of the status.
+func (s TileStatus) String() string {
+	if name, ok := tileStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("TileStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status as its name.
+func (s TileStatus) MarshalText() ([]byte, error) {
+	if _, ok := tileStatusNames[s]; !ok {
+		return nil, fmt.Errorf("invalid tile status %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status from its name.
+func (s *TileStatus) UnmarshalText(text []byte) error {
+	for status, name := range tileStatusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid tile status %q", text)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteResultJSON(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Sprite:     []byte("sprite"),
+		Width:      128,
+		Height:     144,
+		TileWidth:  128,
+		TileHeight: 72,
+		Tiles: []Tile{
+			{Start: 0, End: 1500 * time.Millisecond, X: 0, Y: 0, Width: 128, Height: 72},
+			{Start: 1500 * time.Millisecond, End: 3 * time.Second, CapturedAt: 2 * time.Second, Status: TileFailed, X: 0, Y: 72, Width: 128, Height: 72},
+		},
+		FailedTimecodes: []time.Duration{1500 * time.Millisecond},
+		BytesDownloaded: 4096,
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"format":"jpeg","width":128,"height":144,"tile_width":128,"tile_height":72,"tiles":[{"start":0,"end":1.5,"captured_at":0,"status":"ok","x":0,"y":0,"width":128,"height":72},{"start":1.5,"end":3,"captured_at":2,"status":"failed","x":0,"y":72,"width":128,"height":72}],"bytes_downloaded":4096,"failed_timecodes":[1.5]}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON\nwant %s\ngot  %s", expected, data)
+	}
+}
+
+func TestTileStatusString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		status   TileStatus
+		expected string
+	}{
+		{TileOK, "ok"},
+		{TileFailed, "failed"},
+		{TilePlaceholder, "placeholder"},
+		{TileStatus(42), "TileStatus(42)"},
+	}
+	for _, test := range tests {
+		if got := test.status.String(); got != test.expected {
+			t.Errorf("wrong string for status %d\nwant %q\ngot  %q", int(test.status), test.expected, got)
+		}
+	}
+	if _, err := TileStatus(42).MarshalText(); err == nil {
+		t.Error("got unexpected <nil> error when marshaling invalid status")
+	}
+}
+
+func TestGenSpriteWithMetadataFailedTimecodes(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{2000, 6000}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             8 * time.Second,
+		Interval:        2 * time.Second,
+		Columns:         5,
+		Height:          72,
+		ContinueOnError: true,
+		OmitFailedTiles: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []time.Duration{2 * time.Second, 6 * time.Second}
+	if !reflect.DeepEqual(result.FailedTimecodes, expected) {
+		t.Errorf("wrong failed timecodes\nwant %v\ngot  %v", expected, result.FailedTimecodes)
+	}
+	if result.TileWidth != 127 || result.TileHeight != 72 {
+		t.Errorf("wrong tile size\nwant 127x72\ngot  %dx%d", result.TileWidth, result.TileHeight)
+	}
+	if result.BytesDownloaded == 0 {
+		t.Error("unexpected zero BytesDownloaded")
+	}
+}
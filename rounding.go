@@ -0,0 +1,78 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Rounding determines how timecodes are aligned to
+// GenSpriteOptions.TimecodeStep before being requested from the
+// video-packager.
+type Rounding int
+
+const (
+	// RoundDown aligns timecodes to the previous step.
+	RoundDown Rounding = iota
+
+	// RoundNearest aligns timecodes to the nearest step, rounding half
+	// away from zero.
+	RoundNearest
+
+	// RoundUp aligns timecodes to the next step.
+	RoundUp
+)
+
+// ErrInvalidRounding is returned when the rounding mode is unknown or the
+// timecode step is negative.
+var ErrInvalidRounding = errors.New("invalid timecode rounding")
+
+var roundingNames = map[Rounding]string{
+	RoundDown:    "down",
+	RoundNearest: "nearest",
+	RoundUp:      "up",
+}
+
+// String returns the name of the rounding mode.
+func (r Rounding) String() string {
+	if name, ok := roundingNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Rounding(%d)", int(r))
+}
+
+// valid reports whether the rounding mode is known.
+func (r Rounding) valid() bool {
+	_, ok := roundingNames[r]
+	return ok
+}
+
+// round aligns the given timecode to the given step. A zero step leaves the
+// timecode untouched.
+func (r Rounding) round(timecode, step time.Duration) time.Duration {
+	if step <= 0 {
+		return timecode
+	}
+	switch r {
+	case RoundNearest:
+		return timecode.Round(step)
+	case RoundUp:
+		if rounded := timecode.Truncate(step); rounded != timecode {
+			return rounded + step
+		}
+		return timecode
+	default:
+		return timecode.Truncate(step)
+	}
+}
+
+// captureTimecode returns the timecode where the thumbnail for the given
+// timecode is captured, after snapping it to keyframes and aligning it to
+// the timecode step.
+func (o *GenSpriteOptions) captureTimecode(timecode time.Duration) time.Duration {
+	return o.TimecodeRounding.round(nearestKeyframe(o.keyframes, timecode), o.TimecodeStep)
+}
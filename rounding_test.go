@@ -0,0 +1,81 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRoundingRound(t *testing.T) {
+	t.Parallel()
+	const ms = time.Millisecond
+	tests := []struct {
+		name     string
+		rounding Rounding
+		timecode time.Duration
+		step     time.Duration
+		expected time.Duration
+	}{
+		{"no step", RoundNearest, 1234567 * time.Microsecond, 0, 1234567 * time.Microsecond},
+		{"down", RoundDown, 1999 * ms, time.Second, time.Second},
+		{"down - aligned", RoundDown, 2 * time.Second, time.Second, 2 * time.Second},
+		{"nearest - below half", RoundNearest, 1240 * ms, 500 * ms, 1000 * ms},
+		{"nearest - half", RoundNearest, 1250 * ms, 500 * ms, 1500 * ms},
+		{"nearest - above half", RoundNearest, 1400 * ms, 500 * ms, 1500 * ms},
+		{"up", RoundUp, 1001 * ms, 500 * ms, 1500 * ms},
+		{"up - aligned", RoundUp, 1500 * ms, 500 * ms, 1500 * ms},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if got := test.rounding.round(test.timecode, test.step); got != test.expected {
+				t.Errorf("wrong timecode\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpriteTimecodeStep(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:         "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:              4500 * time.Millisecond,
+		Interval:         1500 * time.Millisecond,
+		Height:           72,
+		TimecodeStep:     2 * time.Second,
+		TimecodeRounding: RoundNearest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var capturedAt []time.Duration
+	for _, tile := range result.Tiles {
+		capturedAt = append(capturedAt, tile.CapturedAt)
+	}
+	expected := []time.Duration{0, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	if !reflect.DeepEqual(capturedAt, expected) {
+		t.Errorf("wrong capture timecodes\nwant %v\ngot  %v", expected, capturedAt)
+	}
+	if n := atomic.LoadInt64(&packager.requests); n != 3 {
+		t.Errorf("wrong number of requests\nwant 3\ngot  %d", n)
+	}
+
+	for _, opts := range []GenSpriteOptions{
+		{End: time.Second, Interval: time.Second, TimecodeRounding: Rounding(42)},
+		{End: time.Second, Interval: time.Second, TimecodeStep: -time.Second},
+	} {
+		if _, err := generator.GenSprite(opts); !errors.Is(err, ErrInvalidRounding) {
+			t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrInvalidRounding, err)
+		}
+	}
+}
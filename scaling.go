@@ -0,0 +1,224 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// ScalingMode determines how the video-packager is asked to size each
+// thumbnail.
+type ScalingMode int
+
+const (
+	// ScaleAuto derives the scaling mode from the combination of Width,
+	// Height and KeepAspectRatio: ScaleLetterbox when KeepAspectRatio is
+	// set and both dimensions are specified (ScaleLetterboxWidth when
+	// Height is greater than Width), ScaleExact when both
+	// dimensions are specified, ScaleFitWidth or ScaleFitHeight when only
+	// one of them is specified, and ScaleSource when none is.
+	ScaleAuto ScalingMode = iota
+
+	// ScaleSource requests thumbnails in the resolution of the source
+	// video, ignoring Width and Height.
+	ScaleSource
+
+	// ScaleFitWidth requests thumbnails with the given Width, letting the
+	// video-packager derive the height from the aspect ratio of the
+	// source.
+	ScaleFitWidth
+
+	// ScaleFitHeight requests thumbnails with the given Height, letting
+	// the video-packager derive the width from the aspect ratio of the
+	// source.
+	ScaleFitHeight
+
+	// ScaleExact requests thumbnails with the given Width and Height,
+	// stretching the source if the aspect ratio doesn't match.
+	ScaleExact
+
+	// ScaleLetterbox requests thumbnails with the given Height and wraps
+	// them with vertical bars so each item in the sprite is Width pixels
+	// wide. Thumbnails wider than Width (e.g. landscape sources in
+	// portrait tiles) are scaled down to fit and wrapped with horizontal
+	// bars instead.
+	ScaleLetterbox
+
+	// ScaleLetterboxWidth is the counterpart of ScaleLetterbox for
+	// portrait tiles: it requests thumbnails with the given Width and
+	// wraps them with horizontal bars so each item in the sprite is
+	// Height pixels tall. Thumbnails taller than Height (e.g. portrait
+	// sources in landscape tiles) are scaled down to fit and wrapped with
+	// vertical bars instead.
+	ScaleLetterboxWidth
+)
+
+// ErrInvalidScalingMode is returned when the scaling mode is unknown or when
+// the dimensions it requires are missing.
+var ErrInvalidScalingMode = errors.New("invalid scaling mode: unknown mode or missing dimensions")
+
+var scalingModeNames = map[ScalingMode]string{
+	ScaleAuto:           "auto",
+	ScaleSource:         "source",
+	ScaleFitWidth:       "fit-width",
+	ScaleFitHeight:      "fit-height",
+	ScaleExact:          "exact",
+	ScaleLetterbox:      "letterbox",
+	ScaleLetterboxWidth: "letterbox-width",
+}
+
+// String returns the name of the scaling mode.
+func (m ScalingMode) String() string {
+	if name, ok := scalingModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ScalingMode(%d)", int(m))
+}
+
+// valid reports whether the scaling mode is known.
+func (m ScalingMode) valid() bool {
+	_, ok := scalingModeNames[m]
+	return ok
+}
+
+// resolveScalingMode translates ScaleAuto into the explicit scaling mode that
+// matches the given dimensions, validating that explicit modes have the
+// dimensions they need.
+func resolveScalingMode(mode ScalingMode, width, height uint, keepAspectRatio bool) (ScalingMode, error) {
+	switch mode {
+	case ScaleAuto:
+		switch {
+		case width > 0 && height > 0 && keepAspectRatio && height > width:
+			return ScaleLetterboxWidth, nil
+		case width > 0 && height > 0 && keepAspectRatio:
+			return ScaleLetterbox, nil
+		case width > 0 && height > 0:
+			return ScaleExact, nil
+		case width > 0:
+			return ScaleFitWidth, nil
+		case height > 0:
+			return ScaleFitHeight, nil
+		default:
+			return ScaleSource, nil
+		}
+	case ScaleSource:
+		return mode, nil
+	case ScaleFitWidth:
+		if width > 0 {
+			return mode, nil
+		}
+	case ScaleFitHeight:
+		if height > 0 {
+			return mode, nil
+		}
+	case ScaleExact, ScaleLetterbox, ScaleLetterboxWidth:
+		if width > 0 && height > 0 {
+			return mode, nil
+		}
+	}
+	return mode, ErrInvalidScalingMode
+}
+
+// expectedSize returns the dimensions that a thumbnail requested with the
+// given input should have. Zero values indicate that the corresponding
+// dimension is derived from the aspect ratio of the source, given its
+// current size.
+func (i *workerInput) expectedSize(current image.Rectangle) (width, height int) {
+	switch i.scalingMode() {
+	case ScaleExact:
+		return int(i.width), int(i.height)
+	case ScaleFitWidth, ScaleLetterboxWidth:
+		width = int(i.width)
+		return width, (current.Dy()*width + current.Dx()/2) / current.Dx()
+	case ScaleFitHeight, ScaleLetterbox:
+		height = int(i.height)
+		return (current.Dx()*height + current.Dy()/2) / current.Dy(), height
+	default:
+		return current.Dx(), current.Dy()
+	}
+}
+
+// scalingMode returns the scaling mode of the input, translating ScaleAuto
+// into the mode that matches its dimensions.
+func (i *workerInput) scalingMode() ScalingMode {
+	if i.mode == ScaleAuto {
+		mode, _ := resolveScalingMode(i.mode, i.width, i.height, false)
+		return mode
+	}
+	return i.mode
+}
+
+// boxed reports whether the mode wraps thumbnails with bars, so every item
+// in the sprite is Width pixels wide and Height pixels tall.
+func (m ScalingMode) boxed() bool {
+	return m == ScaleLetterbox || m == ScaleLetterboxWidth
+}
+
+// fitToBox scales down thumbnails that don't fit in the box of the boxed
+// scaling modes, keeping their aspect ratio, so they get bars on the other
+// axis instead of being cut.
+func (i *workerInput) fitToBox(img image.Image) image.Image {
+	if !i.scalingMode().boxed() {
+		return img
+	}
+	b := img.Bounds()
+	boxWidth, boxHeight := int(i.width), int(i.height)
+	if b.Dx() <= boxWidth && b.Dy() <= boxHeight {
+		return img
+	}
+	width, height := boxWidth, (b.Dy()*boxWidth+b.Dx()/2)/b.Dx()
+	if height > boxHeight {
+		width, height = (b.Dx()*boxHeight+b.Dy()/2)/b.Dy(), boxHeight
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	return resize(img, width, height)
+}
+
+// resize scales the given image to the given dimensions, averaging
+// the source pixels that map into each destination pixel.
+func resize(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+	for y := 0; y < height; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/height
+		sy1 := b.Min.Y + (y+1)*b.Dy()/height
+		if sy1 == sy0 {
+			sy1++
+		}
+		for x := 0; x < width; x++ {
+			sx0 := b.Min.X + x*b.Dx()/width
+			sx1 := b.Min.X + (x+1)*b.Dx()/width
+			if sx1 == sx0 {
+				sx1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
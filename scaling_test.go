@@ -0,0 +1,268 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResolveScalingMode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		mode            ScalingMode
+		width           uint
+		height          uint
+		keepAspectRatio bool
+		expected        ScalingMode
+		expectedErr     error
+	}{
+		{"auto - no dimensions", ScaleAuto, 0, 0, false, ScaleSource, nil},
+		{"auto - width only", ScaleAuto, 128, 0, false, ScaleFitWidth, nil},
+		{"auto - height only", ScaleAuto, 0, 72, true, ScaleFitHeight, nil},
+		{"auto - width and height", ScaleAuto, 128, 72, false, ScaleExact, nil},
+		{"auto - width and height keeping aspect ratio", ScaleAuto, 128, 72, true, ScaleLetterbox, nil},
+		{"auto - portrait keeping aspect ratio", ScaleAuto, 72, 128, true, ScaleLetterboxWidth, nil},
+		{"source", ScaleSource, 128, 72, false, ScaleSource, nil},
+		{"fit-width", ScaleFitWidth, 128, 72, false, ScaleFitWidth, nil},
+		{"fit-width - missing width", ScaleFitWidth, 0, 72, false, ScaleFitWidth, ErrInvalidScalingMode},
+		{"fit-height", ScaleFitHeight, 128, 72, false, ScaleFitHeight, nil},
+		{"fit-height - missing height", ScaleFitHeight, 128, 0, false, ScaleFitHeight, ErrInvalidScalingMode},
+		{"exact", ScaleExact, 128, 72, true, ScaleExact, nil},
+		{"exact - missing height", ScaleExact, 128, 0, false, ScaleExact, ErrInvalidScalingMode},
+		{"letterbox", ScaleLetterbox, 128, 72, false, ScaleLetterbox, nil},
+		{"letterbox - missing width", ScaleLetterbox, 0, 72, false, ScaleLetterbox, ErrInvalidScalingMode},
+		{"letterbox-width", ScaleLetterboxWidth, 72, 128, false, ScaleLetterboxWidth, nil},
+		{"letterbox-width - missing height", ScaleLetterboxWidth, 72, 0, false, ScaleLetterboxWidth, ErrInvalidScalingMode},
+		{"unknown mode", ScalingMode(42), 128, 72, false, ScalingMode(42), ErrInvalidScalingMode},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			mode, err := resolveScalingMode(test.mode, test.width, test.height, test.keepAspectRatio)
+			if err != test.expectedErr {
+				t.Errorf("wrong error returned\nwant %v\ngot  %v", test.expectedErr, err)
+			}
+			if mode != test.expected {
+				t.Errorf("wrong mode returned\nwant %d\ngot  %d", test.expected, mode)
+			}
+		})
+	}
+}
+
+func TestGenSpriteKeepAspectRatioConflict(t *testing.T) {
+	t.Parallel()
+	generator := Generator{Translator: func(string) (string, error) { return "http://localhost", nil }}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video.mp4",
+		End:             4 * time.Second,
+		Interval:        2 * time.Second,
+		Width:           128,
+		Height:          72,
+		KeepAspectRatio: true,
+		ScalingMode:     ScaleExact,
+	})
+	if !errors.Is(err, ErrInvalidScalingMode) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidScalingMode, err)
+	}
+}
+
+func TestExpectedSize(t *testing.T) {
+	t.Parallel()
+	current := image.Rect(0, 0, 1280, 720)
+	tests := []struct {
+		name           string
+		input          workerInput
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"source", workerInput{mode: ScaleSource, width: 128, height: 72}, 1280, 720},
+		{"auto without dimensions", workerInput{}, 1280, 720},
+		{"fit-width", workerInput{mode: ScaleFitWidth, width: 128, height: 10}, 128, 72},
+		{"fit-height", workerInput{mode: ScaleFitHeight, width: 10, height: 36}, 64, 36},
+		{"auto with height", workerInput{height: 36}, 64, 36},
+		{"exact", workerInput{mode: ScaleExact, width: 100, height: 100}, 100, 100},
+		{"letterbox", workerInput{mode: ScaleLetterbox, width: 200, height: 72}, 128, 72},
+		{"letterbox-width", workerInput{mode: ScaleLetterboxWidth, width: 64, height: 200}, 64, 36},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			width, height := test.input.expectedSize(current)
+			if width != test.expectedWidth || height != test.expectedHeight {
+				t.Errorf("wrong size\nwant %dx%d\ngot  %dx%d", test.expectedWidth, test.expectedHeight, width, height)
+			}
+		})
+	}
+}
+
+func TestFitToBox(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    workerInput
+		img      image.Rectangle
+		expected image.Rectangle
+	}{
+		{"pillarbox", workerInput{mode: ScaleLetterbox, width: 128, height: 72}, image.Rect(0, 0, 41, 72), image.Rect(0, 0, 41, 72)},
+		{"letterbox", workerInput{mode: ScaleLetterboxWidth, width: 72, height: 128}, image.Rect(0, 0, 72, 41), image.Rect(0, 0, 72, 41)},
+		{"landscape source in portrait box", workerInput{mode: ScaleLetterbox, width: 72, height: 128}, image.Rect(0, 0, 228, 128), image.Rect(0, 0, 72, 40)},
+		{"portrait source in landscape box", workerInput{mode: ScaleLetterboxWidth, width: 128, height: 72}, image.Rect(0, 0, 128, 228), image.Rect(0, 0, 40, 72)},
+		{"not boxed", workerInput{mode: ScaleFitHeight, width: 72, height: 128}, image.Rect(0, 0, 228, 128), image.Rect(0, 0, 228, 128)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := test.input.fitToBox(image.NewRGBA(test.img)).Bounds()
+			if got != test.expected {
+				t.Errorf("wrong bounds\nwant %v\ngot  %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenSpritePortrait(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		source       image.Point
+		width        uint
+		height       uint
+		expectedRect image.Rectangle
+	}{
+		{"portrait source in landscape tiles", image.Pt(90, 160), 160, 90, image.Rect(55, 0, 105, 90)},
+		{"portrait source in portrait tiles", image.Pt(90, 160), 90, 160, image.Rect(0, 0, 90, 160)},
+		{"portrait source in wider portrait tiles", image.Pt(90, 160), 120, 160, image.Rect(15, 0, 105, 160)},
+		{"landscape source in portrait tiles", image.Pt(160, 90), 90, 160, image.Rect(0, 55, 90, 105)},
+		{"landscape source in wider landscape tiles", image.Pt(160, 90), 160, 120, image.Rect(0, 15, 160, 105)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := startSourcePackager(test.source)
+			defer server.Close()
+			generator := Generator{
+				Translator: func(string) (string, error) { return server.URL, nil },
+			}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL:        "/video.mp4",
+				End:             2 * time.Second,
+				Interval:        2 * time.Second,
+				Width:           test.width,
+				Height:          test.height,
+				KeepAspectRatio: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, tile := range result.Tiles {
+				if tile.Width != int(test.width) || tile.Height != int(test.height) {
+					t.Errorf("wrong size for tile %d\nwant %dx%d\ngot  %dx%d", i, test.width, test.height, tile.Width, tile.Height)
+				}
+			}
+			sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// sample pixels a few pixels inside and outside of the edges
+			// of the thumbnail, avoiding JPEG artifacts.
+			r := test.expectedRect
+			inside := []image.Point{{r.Min.X + 2, r.Min.Y + 2}, {r.Max.X - 3, r.Max.Y - 3}}
+			for _, p := range inside {
+				if y := color.GrayModel.Convert(sprite.At(p.X, p.Y)).(color.Gray).Y; y < 100 {
+					t.Errorf("expected thumbnail at %v, got luminance %d", p, y)
+				}
+			}
+			var outside []image.Point
+			if r.Min.X > 2 {
+				outside = append(outside, image.Pt(r.Min.X-3, r.Min.Y+2))
+			}
+			if r.Min.Y > 2 {
+				outside = append(outside, image.Pt(r.Min.X+2, r.Min.Y-3))
+			}
+			for _, p := range outside {
+				if y := color.GrayModel.Convert(sprite.At(p.X, p.Y)).(color.Gray).Y; y > 30 {
+					t.Errorf("expected bar at %v, got luminance %d", p, y)
+				}
+			}
+		})
+	}
+}
+
+// startSourcePackager starts a video-packager that scales thumbnails of a
+// source with the given dimensions, honoring either the width or the height
+// in the request.
+func startSourcePackager(source image.Point) *httptest.Server {
+	thumbRegexp := regexp.MustCompile(`thumb-\d+(?:-w(\d+))?(?:-h(\d+))?\.jpg$`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := thumbRegexp.FindStringSubmatch(r.URL.Path)
+		if parts == nil {
+			http.Error(w, "invalid thumbnail", http.StatusBadRequest)
+			return
+		}
+		width, height := source.X, source.Y
+		if parts[1] != "" {
+			width, _ = strconv.Atoi(parts[1])
+			height = source.Y * width / source.X
+		} else if parts[2] != "" {
+			height, _ = strconv.Atoi(parts[2])
+			width = source.X * height / source.Y
+		}
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		fill(img, color.Gray{Y: 128})
+		jpeg.Encode(w, img, nil)
+	}))
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+	src := image.NewRGBA(image.Rect(10, 10, 110, 60))
+	draw.Draw(src, image.Rect(10, 10, 60, 60), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(60, 10, 110, 60), image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+
+	dst := resize(src, 10, 5)
+	if expected := image.Rect(0, 0, 10, 5); dst.Bounds() != expected {
+		t.Fatalf("wrong bounds\nwant %v\ngot  %v", expected, dst.Bounds())
+	}
+	if c := dst.RGBAAt(2, 2); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("wrong color on the left half: %v", c)
+	}
+	if c := dst.RGBAAt(7, 2); c != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("wrong color on the right half: %v", c)
+	}
+}
+
+func TestResizeUp(t *testing.T) {
+	t.Parallel()
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	src.SetRGBA(1, 0, color.RGBA{B: 255, A: 255})
+
+	dst := resize(src, 4, 2)
+	if expected := image.Rect(0, 0, 4, 2); dst.Bounds() != expected {
+		t.Fatalf("wrong bounds\nwant %v\ngot  %v", expected, dst.Bounds())
+	}
+	if c := dst.RGBAAt(1, 1); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("wrong color on the left half: %v", c)
+	}
+	if c := dst.RGBAAt(2, 0); c != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("wrong color on the right half: %v", c)
+	}
+}
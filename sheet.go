@@ -0,0 +1,140 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+)
+
+// ErrMissingSheetURL is returned when writing a WebVTT track for a sprite
+// split into more sheets than the given URLs.
+var ErrMissingSheetURL = errors.New("missing url for sprite sheet")
+
+// Sheet is one of the images of a sprite split by GenSpriteOptions.SheetRows
+// or GenSpriteOptions.MaxSheetHeight.
+type Sheet struct {
+	Sprite []byte
+
+	// Width and Height are the dimensions of the sheet, in pixels. The
+	// last sheet may be shorter than the others.
+	Width  int
+	Height int
+
+	// Start is the timecode of the first thumbnail in the sheet, and End
+	// is the End of its last thumbnail, so players can tell which sheet
+	// to load for a given timecode without going through the tiles.
+	Start time.Duration
+	End   time.Duration
+}
+
+type jsonSheet struct {
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+}
+
+// MarshalJSON encodes the sheet as JSON, representing timecodes in seconds.
+// The image itself isn't included.
+func (s Sheet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSheet{
+		Width:  s.Width,
+		Height: s.Height,
+		Start:  s.Start.Seconds(),
+		End:    s.End.Seconds(),
+	})
+}
+
+// UnmarshalJSON decodes a sheet encoded by MarshalJSON.
+func (s *Sheet) UnmarshalJSON(data []byte) error {
+	var js jsonSheet
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	*s = Sheet{
+		Width:  js.Width,
+		Height: js.Height,
+		Start:  seconds(js.Start),
+		End:    seconds(js.End),
+	}
+	return nil
+}
+
+// sheetRows returns the number of rows of tiles in each sheet, given the
+// height of the tiles, or 0 when the sprite isn't split.
+func (o *GenSpriteOptions) sheetRows(tileHeight int) int {
+	rows := int(o.SheetRows)
+	if o.MaxSheetHeight > 0 && tileHeight > 0 {
+		maxRows := o.gaps().count(int(o.MaxSheetHeight), tileHeight)
+		if maxRows < 1 {
+			maxRows = 1
+		}
+		if rows == 0 || maxRows < rows {
+			rows = maxRows
+		}
+	}
+	return rows
+}
+
+// sheeted reports whether the sprite may be split into sheets.
+func (o *GenSpriteOptions) sheeted() bool {
+	return o.SheetRows > 0 || o.MaxSheetHeight > 0
+}
+
+// splitSheets splits the given sprite into sheets with at most the given
+// number of rows of tiles, moving each tile to the sheet that contains it.
+// Each sheet keeps the padding of the sprite around its edges. It also
+// returns the range of timecodes covered by each sheet.
+func splitSheets(sprite *image.RGBA, result *GenSpriteResult, rows int, g gaps) ([]*image.RGBA, []Sheet) {
+	bounds := sprite.Bounds()
+	tileHeight := result.TileHeight
+	totalRows := g.count(bounds.Dy(), tileHeight)
+	var sheets []*image.RGBA
+	for row := 0; row < totalRows; row += rows {
+		n := rows
+		if row+n > totalRows {
+			n = totalRows - row
+		}
+		sheet := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), g.length(n, tileHeight)))
+		band := image.Rect(bounds.Min.X, g.offset(row, tileHeight), bounds.Max.X, g.offset(row+n-1, tileHeight)+tileHeight)
+		draw.Draw(sheet, band.Sub(image.Pt(bounds.Min.X, band.Min.Y-g.padding)), sprite, band.Min, draw.Src)
+		if g.padding > 0 {
+			// the top padding of the sprite is copied to the top and
+			// bottom of the sheet.
+			padding := image.Rect(0, 0, bounds.Dx(), g.padding)
+			draw.Draw(sheet, padding, sprite, bounds.Min, draw.Src)
+			draw.Draw(sheet, padding.Add(image.Pt(0, sheet.Bounds().Dy()-g.padding)), sprite, bounds.Min, draw.Src)
+		}
+		sheets = append(sheets, sheet)
+	}
+	ranges := make([]Sheet, len(sheets))
+	for i, tile := range result.Tiles {
+		sheet := (tile.Y - g.padding) / (tileHeight + g.spacing) / rows
+		result.Tiles[i].Sheet = sheet
+		result.Tiles[i].Y = tile.Y - g.offset(sheet*rows, tileHeight) + g.padding
+		r := &ranges[sheet]
+		if r.End == 0 || tile.Start < r.Start {
+			r.Start = tile.Start
+		}
+		if tile.End > r.End {
+			r.End = tile.End
+		}
+	}
+	return sheets, ranges
+}
+
+// WriteSheetsVTT writes a WebVTT thumbnail track describing a sprite split
+// into sheets to the given writer, like WriteVTT, with each cue pointing to
+// the sheet that contains the thumbnail, available at the URL with the same
+// index in sheetURLs.
+func (r *GenSpriteResult) WriteSheetsVTT(w io.Writer, sheetURLs []string) error {
+	layout := r.Layout()
+	return layout.WriteSheetsVTT(w, sheetURLs)
+}
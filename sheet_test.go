@@ -0,0 +1,205 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteSheetRows(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL:     "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:          18 * time.Second,
+		Interval:     2 * time.Second,
+		Columns:      2,
+		Height:       72,
+		OutputFormat: PNG,
+	}
+	full, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.SheetRows = 2
+	result, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileWidth, tileHeight := full.TileWidth, full.TileHeight
+	expectedSheets := []image.Point{
+		{2 * tileWidth, 2 * tileHeight},
+		{2 * tileWidth, 2 * tileHeight},
+		{2 * tileWidth, tileHeight},
+	}
+	if len(result.Sheets) != len(expectedSheets) {
+		t.Fatalf("wrong number of sheets\nwant %d\ngot  %d", len(expectedSheets), len(result.Sheets))
+	}
+	for i, sheet := range result.Sheets {
+		if size := image.Pt(sheet.Width, sheet.Height); size != expectedSheets[i] {
+			t.Errorf("wrong size for sheet %d\nwant %v\ngot  %v", i, expectedSheets[i], size)
+		}
+	}
+	if !bytes.Equal(result.Sprite, result.Sheets[0].Sprite) {
+		t.Error("Sprite should contain the first sheet")
+	}
+	if result.Width != expectedSheets[0].X || result.Height != expectedSheets[0].Y {
+		t.Errorf("wrong sprite size\nwant %v\ngot  %dx%d", expectedSheets[0], result.Width, result.Height)
+	}
+
+	fullImg, err := png.Decode(bytes.NewReader(full.Sprite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets := make([]image.Image, len(result.Sheets))
+	for i, sheet := range result.Sheets {
+		if sheets[i], err = png.Decode(bytes.NewReader(sheet.Sprite)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, tile := range result.Tiles {
+		fullTile := full.Tiles[i]
+		expectedSheet, expectedY := fullTile.Y/(2*tileHeight), fullTile.Y%(2*tileHeight)
+		if tile.Sheet != expectedSheet || tile.X != fullTile.X || tile.Y != expectedY {
+			t.Errorf("wrong position for tile %d\nwant sheet %d at (%d, %d)\ngot  sheet %d at (%d, %d)", i, expectedSheet, fullTile.X, expectedY, tile.Sheet, tile.X, tile.Y)
+			continue
+		}
+		for y := 0; y < tile.Height; y++ {
+			for x := 0; x < tile.Width; x++ {
+				got := sheets[tile.Sheet].At(tile.X+x, tile.Y+y)
+				want := fullImg.At(fullTile.X+x, fullTile.Y+y)
+				if got != want {
+					t.Fatalf("wrong pixel at (%d, %d) of tile %d\nwant %v\ngot  %v", x, y, i, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteSheetsVTT(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Tiles: []Tile{
+			{Start: 0, End: time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+			{Start: time.Second, End: 2 * time.Second, Sheet: 1, X: 0, Y: 0, Width: 128, Height: 72},
+		},
+	}
+	var buf bytes.Buffer
+	err := result.WriteSheetsVTT(&buf, []string{"sprite-0.jpg", "sprite-1.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `WEBVTT
+
+00:00:00.000 --> 00:00:01.000
+sprite-0.jpg#xywh=0,0,128,72
+
+00:00:01.000 --> 00:00:02.000
+sprite-1.jpg#xywh=0,0,128,72
+`
+	if buf.String() != expected {
+		t.Errorf("wrong VTT\nwant:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	err = result.WriteVTT(&buf, "sprite.jpg")
+	if err != ErrMissingSheetURL {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrMissingSheetURL, err)
+	}
+}
+
+func TestGenSpriteMaxSheetHeight(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name           string
+		sheetRows      uint
+		maxSheetHeight uint
+		expectedRows   int
+	}{
+		{"two rows", 0, 150, 2},
+		{"shorter than a tile", 0, 50, 1},
+		{"taller than the sprite", 0, 1000, 5},
+		{"smaller than SheetRows", 3, 150, 2},
+		{"larger than SheetRows", 1, 150, 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL:       "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:            18 * time.Second,
+				Interval:       2 * time.Second,
+				Columns:        2,
+				Height:         72,
+				SheetRows:      test.sheetRows,
+				MaxSheetHeight: test.maxSheetHeight,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			const rows = 5
+			expectedSheets := (rows + test.expectedRows - 1) / test.expectedRows
+			if len(result.Sheets) != expectedSheets {
+				t.Fatalf("wrong number of sheets\nwant %d\ngot  %d", expectedSheets, len(result.Sheets))
+			}
+			// each row covers two tiles of 2 seconds.
+			rowDuration := 4 * time.Second
+			for i, sheet := range result.Sheets {
+				expectedHeight := test.expectedRows * result.TileHeight
+				if i == len(result.Sheets)-1 && rows%test.expectedRows != 0 {
+					expectedHeight = rows % test.expectedRows * result.TileHeight
+				}
+				if sheet.Height != expectedHeight {
+					t.Errorf("wrong height for sheet %d\nwant %d\ngot  %d", i, expectedHeight, sheet.Height)
+				}
+				expectedStart := time.Duration(i*test.expectedRows) * rowDuration
+				expectedEnd := expectedStart + time.Duration(test.expectedRows)*rowDuration
+				if expectedEnd > rows*rowDuration {
+					expectedEnd = rows * rowDuration
+				}
+				if sheet.Start != expectedStart || sheet.End != expectedEnd {
+					t.Errorf("wrong range for sheet %d\nwant [%v, %v)\ngot  [%v, %v)", i, expectedStart, expectedEnd, sheet.Start, sheet.End)
+				}
+			}
+		})
+	}
+}
+
+func TestSheetJSON(t *testing.T) {
+	t.Parallel()
+	sheet := Sheet{
+		Sprite: []byte("sprite"),
+		Width:  256,
+		Height: 144,
+		Start:  1500 * time.Millisecond,
+		End:    10 * time.Second,
+	}
+	data, err := json.Marshal(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"width":256,"height":144,"start":1.5,"end":10}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON\nwant %s\ngot  %s", expected, data)
+	}
+	var decoded Sheet
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	sheet.Sprite = nil
+	if !reflect.DeepEqual(decoded, sheet) {
+		t.Errorf("wrong sheet\nwant %#v\ngot  %#v", sheet, decoded)
+	}
+}
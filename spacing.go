@@ -0,0 +1,63 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image"
+	"image/draw"
+)
+
+// gaps describes the space, in pixels, between adjacent tiles (spacing) and
+// around the edges of the sprite (padding).
+type gaps struct {
+	spacing int
+	padding int
+}
+
+func (o *GenSpriteOptions) gaps() gaps {
+	return gaps{spacing: int(o.TileSpacing), padding: int(o.CanvasPadding)}
+}
+
+// offset returns the offset, along one axis, of the i-th tile with the
+// given size.
+func (g gaps) offset(i, size int) int {
+	return g.padding + i*(size+g.spacing)
+}
+
+// length returns the length, along one axis, of n tiles with the given size.
+func (g gaps) length(n, size int) int {
+	if n == 0 {
+		return 0
+	}
+	return 2*g.padding + n*size + (n-1)*g.spacing
+}
+
+// count returns the number of tiles with the given size that fit in the
+// given length, along one axis.
+func (g gaps) count(length, size int) int {
+	return (length - 2*g.padding + g.spacing) / (size + g.spacing)
+}
+
+// empty reports whether tiles are drawn without gaps.
+func (g gaps) empty() bool {
+	return g.spacing == 0 && g.padding == 0
+}
+
+// fillGaps fills the gaps of the given sprite with the given color, leaving
+// the cells of the grid filled with background (or transparent, when it's
+// nil).
+func (d *spriteDrawer) fillGaps(fill, background image.Image, columns, rows int) {
+	draw.Draw(d.sprite, d.sprite.Bounds(), fill, image.Point{}, draw.Src)
+	if background == nil {
+		background = image.Transparent
+	}
+	for y := 0; y < rows; y++ {
+		for x := 0; x < columns; x++ {
+			sp := d.origin(x, y)
+			r := image.Rectangle{sp, sp.Add(image.Pt(d.tileWidth, d.tileHeight))}
+			draw.Draw(d.sprite, r, background, image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestGaps(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name           string
+		gaps           gaps
+		expectedOffset int
+		expectedLength int
+	}{
+		{"no gaps", gaps{}, 180, 270},
+		{"spacing", gaps{spacing: 2}, 184, 274},
+		{"padding", gaps{padding: 3}, 183, 276},
+		{"spacing and padding", gaps{spacing: 2, padding: 3}, 187, 280},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if offset := test.gaps.offset(2, 90); offset != test.expectedOffset {
+				t.Errorf("wrong offset\nwant %d\ngot  %d", test.expectedOffset, offset)
+			}
+			length := test.gaps.length(3, 90)
+			if length != test.expectedLength {
+				t.Errorf("wrong length\nwant %d\ngot  %d", test.expectedLength, length)
+			}
+			if count := test.gaps.count(length, 90); count != 3 {
+				t.Errorf("wrong count\nwant 3\ngot  %d", count)
+			}
+			if count := test.gaps.count(length-1, 90); count != 2 {
+				t.Errorf("wrong count\nwant 2\ngot  %d", count)
+			}
+		})
+	}
+}
+
+func TestGenSpriteSpacing(t *testing.T) {
+	t.Parallel()
+	red := color.RGBA{R: 255, A: 255}
+	var tests = []struct {
+		name            string
+		sheetRows       uint
+		maxSheetHeight  uint
+		expectedSheets  []image.Point
+		expectedOrigins []image.Point
+		gapPixels       []image.Point
+	}{
+		{
+			"single sheet",
+			0, 0,
+			[]image.Point{{328, 188}},
+			[]image.Point{{3, 3}, {165, 3}, {3, 95}, {165, 95}},
+			[]image.Point{{0, 0}, {163, 10}, {10, 93}, {327, 187}},
+		},
+		{
+			"sheet rows",
+			1, 0,
+			[]image.Point{{328, 96}, {328, 96}},
+			[]image.Point{{3, 3}, {165, 3}, {3, 3}, {165, 3}},
+			[]image.Point{{0, 0}, {163, 10}, {10, 93}, {327, 95}},
+		},
+		{
+			"max sheet height fitting two rows",
+			0, 188,
+			[]image.Point{{328, 188}},
+			[]image.Point{{3, 3}, {165, 3}, {3, 95}, {165, 95}},
+			[]image.Point{{0, 0}, {163, 10}, {10, 93}, {327, 187}},
+		},
+		{
+			"max sheet height fitting one row",
+			0, 187,
+			[]image.Point{{328, 96}, {328, 96}},
+			[]image.Point{{3, 3}, {165, 3}, {3, 3}, {165, 3}},
+			[]image.Point{{0, 0}, {163, 10}, {10, 93}, {327, 95}},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := startSourcePackager(image.Pt(160, 90))
+			defer server.Close()
+			generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL:       "/video.mp4",
+				End:            6 * time.Second,
+				Interval:       2 * time.Second,
+				Width:          160,
+				Height:         90,
+				Columns:        2,
+				TileSpacing:    2,
+				CanvasPadding:  3,
+				SpacingColor:   red,
+				OutputFormat:   PNG,
+				SheetRows:      test.sheetRows,
+				MaxSheetHeight: test.maxSheetHeight,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sheets := [][]byte{result.Sprite}
+			if len(result.Sheets) > 0 {
+				sheets = sheets[:0]
+				for _, sheet := range result.Sheets {
+					sheets = append(sheets, sheet.Sprite)
+				}
+			}
+			if len(sheets) != len(test.expectedSheets) {
+				t.Fatalf("wrong number of sheets\nwant %d\ngot  %d", len(test.expectedSheets), len(sheets))
+			}
+			imgs := make([]image.Image, len(sheets))
+			for i, data := range sheets {
+				if imgs[i], err = png.Decode(bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+				if size := imgs[i].Bounds().Size(); size != test.expectedSheets[i] {
+					t.Errorf("wrong size for sheet %d\nwant %v\ngot  %v", i, test.expectedSheets[i], size)
+				}
+			}
+			for i, tile := range result.Tiles {
+				if origin := image.Pt(tile.X, tile.Y); origin != test.expectedOrigins[i] {
+					t.Errorf("wrong origin for tile %d\nwant %v\ngot  %v", i, test.expectedOrigins[i], origin)
+				}
+				img := imgs[tile.Sheet]
+				corners := []image.Point{{tile.X, tile.Y}, {tile.X + tile.Width - 1, tile.Y + tile.Height - 1}}
+				for _, p := range corners {
+					if got := color.GrayModel.Convert(img.At(p.X, p.Y)).(color.Gray); got.Y < 120 || got.Y > 136 {
+						t.Errorf("wrong color at %v of tile %d\nwant a gray close to 128\ngot  %v", p, i, got)
+					}
+				}
+			}
+			for i, img := range imgs {
+				for _, p := range test.gapPixels {
+					if got := color.RGBAModel.Convert(img.At(p.X, p.Y)); got != red {
+						t.Errorf("wrong color at %v of sheet %d\nwant %v\ngot  %v", p, i, red, got)
+					}
+				}
+			}
+			if len(result.Sheets) <= 1 {
+				if err := result.WriteDASHAdaptationSet(ioutil.Discard, "thumbs", "sprite.png"); err != ErrIncompatibleDASHLayout {
+					t.Errorf("wrong error\nwant %v\ngot  %v", ErrIncompatibleDASHLayout, err)
+				}
+			}
+		})
+	}
+}
@@ -7,21 +7,195 @@ package sprite
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
+	"io"
 	"net/http"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsouza/vod-module-sprite/internal/pool"
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
 )
 
 // Generator generates sprites for videos using the video-packager.
+//
+// A Generator is safe for concurrent use by multiple goroutines (e.g. HTTP
+// handlers sharing a single Generator), and concurrent calls share its pool
+// of connections. Its fields must not be modified after its first use, and a
+// Generator must not be copied after its first use.
 type Generator struct {
 	Translator VideoURLTranslator
+
+	// ContextTranslator is an alternative to Translator that also receives
+	// the context of the sprite generation, so deadlines and values
+	// carried by the context (e.g. trace IDs or credentials) are
+	// available when translating the URL. When set, it takes precedence
+	// over Translator.
+	ContextTranslator ContextVideoURLTranslator
+
+	// MaxWorkers is the maximum number of concurrent requests sent to the
+	// video-packager in each call. Calls never use more than one worker
+	// for every two thumbnails (plus one), so small sprites don't start
+	// idle workers. The zero value means four workers per CPU (see
+	// runtime.GOMAXPROCS).
 	MaxWorkers uint
 
+	// MaxDecoders is the maximum number of thumbnails decoded (and
+	// resized) concurrently. Decoding is CPU-bound, so it's limited
+	// independently of MaxWorkers, which bounds the network-bound
+	// requests. The zero value means GOMAXPROCS.
+	MaxDecoders uint
+
+	// MaxThumbBytes, when positive, is the maximum size of the response
+	// of the video-packager for a thumbnail. Downloads of larger
+	// thumbnails are aborted as soon as the size is known, either from
+	// the Content-Length header or while reading the body, failing with
+	// a ThumbTooLargeError.
+	MaxThumbBytes int64
+
+	// MaxThumbPixels, when positive, is the maximum number of pixels
+	// (width times height) of a thumbnail. The dimensions are read from
+	// the header of each thumbnail before it's decoded, so larger
+	// thumbnails fail with a ThumbDimensionsError without being decoded.
+	MaxThumbPixels int
+
+	// QueueSize is the number of thumbnails that can be queued waiting
+	// to be drawn, so workers can move on to the next request when
+	// drawing is slower than fetching (e.g. on fast video-packagers). The
+	// zero value means workers wait for each thumbnail to be drawn. Each
+	// queued thumbnail is held decoded in memory. See
+	// Report.MaxQueueDepth.
+	QueueSize uint
+
+	// MaxDrawers is the maximum number of goroutines drawing thumbnails
+	// in the sprite concurrently, removing the single-threaded assembly
+	// bottleneck of sprites with thousands of tiles. The zero value means
+	// thumbnails are drawn sequentially, as they're fetched.
+	MaxDrawers uint
+
+	// CaptureHeaders lists response headers (e.g. X-Cache or request IDs)
+	// to be captured from each thumbnail response, so failures can be
+	// traced to specific packager or CDN nodes. Captured headers are
+	// included in VideoPackagerError and, along with the response time,
+	// in the metadata of each tile (see Tile.Trace), so slow tiles can
+	// be traced too.
+	CaptureHeaders []string
+
+	// Logger is used to report non-fatal conditions, such as thumbnails
+	// that had to be scaled down locally because the video-packager
+	// ignored the requested dimensions. When nil, nothing is logged.
+	Logger Logger
+
+	// KeyframeProvider, when set, is used to find the keyframes of videos
+	// for which GenSpriteOptions.Keyframes is empty, so thumbnails are
+	// captured at keyframes. See GenSpriteOptions.Keyframes.
+	KeyframeProvider KeyframeProvider
+
+	// DurationProvider, when set, is used to find the duration of videos,
+	// so End is clamped to it instead of sending requests for thumbnails
+	// past the end of the video, when the metadata of the caller
+	// overestimates the length of the video. See
+	// GenSpriteResult.EndClamped.
+	DurationProvider DurationProvider
+
+	// IPPreference determines the IP versions used for connecting to the
+	// video-packager, and FallbackDelay is how long to wait for an IPv6
+	// connection before racing an IPv4 one when IPPreference is
+	// IPDefault (see net.Dialer.FallbackDelay). Hosts with broken IPv6
+	// should use IPv4Only or PreferIPv4 instead of paying the delay on
+	// every connection.
+	IPPreference  IPPreference
+	FallbackDelay time.Duration
+
+	// RequestBuilder, when set, builds the requests sent for retrieving
+	// thumbnails, replacing the default GET request to the
+	// nginx-vod-module URL of each thumbnail.
+	RequestBuilder RequestBuilder
+
+	// ChecksumHeader names a response header (e.g. Content-MD5 or Digest)
+	// carrying the checksum of each thumbnail, which is verified after
+	// the download. Thumbnails that don't match fail with
+	// ErrChecksumMismatch, so corrupted thumbnails aren't drawn in the
+	// sprite. Responses without the header aren't verified.
+	ChecksumHeader string
+
+	// AccessToken, when set, is invoked once per video in each call for
+	// the access token required by the video-packager, which is attached to
+	// each thumbnail request in the AccessTokenHeader header
+	// ("Authorization", as a bearer token, by default). Rejected tokens
+	// (401 or 403) are refreshed, once for all the requests rejected
+	// with the same token, and the rejected requests are retried once.
+	AccessToken       AccessTokenFunc
+	AccessTokenHeader string
+
+	// Granularity is the minimum distance between thumbnails that the
+	// video-packager can resolve (e.g. the keyframe interval of the
+	// videos it serves). When set, generating a sprite with a finer
+	// sampling interval fails with ErrIntervalTooFine, instead of
+	// producing many identical adjacent tiles.
+	Granularity time.Duration
+
+	// MaxAllowedTiles is the maximum number of thumbnails in a sprite,
+	// protecting the video-packager against mistakes such as a tiny
+	// Interval over a long video. The zero value means
+	// DefaultMaxAllowedTiles, and a negative value disables the limit.
+	// It can be overridden per call with GenSpriteOptions.MaxAllowedTiles.
+	MaxAllowedTiles int
+
+	// JPEGQuality is the quality used for encoding sprites and posters
+	// whose options don't specify one.
+	JPEGQuality int
+
+	// AVIFEncoder is the encoder used for sprites whose OutputFormat is
+	// AVIF, e.g. a wrapper of libavif.
+	AVIFEncoder Encoder
+
+	// DefaultOptions, when set, is the template of the options of every
+	// sprite generated by the Generator: fields left with their zero
+	// value in the options of a call are taken from it, so calls only
+	// need to specify what differs (e.g. the VideoURL). As zero values
+	// mean "unset", calls can't override a field of the template back to
+	// its zero value (e.g. a boolean set to true in the template).
+	//
+	// Fields that describe the same aspect of the sprite are exempt as a
+	// group: when a call sets any of the fields in a group, none of them
+	// is taken from the template. The groups are the layout (Columns,
+	// Rows and Arrangement), the sampling (Interval and Intervals), the
+	// scaling (ScalingMode, KeepAspectRatio, Width and Height), the
+	// fallback size (FallbackWidth, FallbackHeight, Width and Height) and
+	// the fill order (FillOrder and RightToLeft). Context and JobKey are
+	// never taken from the template.
+	DefaultOptions *GenSpriteOptions
+
+	// UsageHook, when set, is invoked after each sprite, poster or mosaic
+	// generation that passes validation, successful or not, reporting the
+	// resources it consumed along with the Labels of the call, so
+	// multi-tenant services can enforce quotas and bill their callers.
+	// Calls deduplicated by GenSpriteOptions.JobKey are accounted once,
+	// to the call that performed the generation.
+	UsageHook func(Usage)
+
+	// Clock is used for time-based decisions, such as the freshness of
+	// the thumbnails (see GenSpriteResult.Expires). When nil, the system
+	// clock is used.
+	Clock Clock
+
 	client *http.Client
 	o      sync.Once
+	jobs   callGroup
+}
+
+// Logger is the interface used by the Generator for logging. It's
+// implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
 }
 
 // VideoURLTranslator is a function that translates a video URL into a
@@ -34,6 +208,56 @@ type Generator struct {
 // thumbnail asset.
 type VideoURLTranslator func(string) (string, error)
 
+// ContextVideoURLTranslator is like VideoURLTranslator, but takes the context
+// of the sprite generation as its first argument.
+type ContextVideoURLTranslator func(context.Context, string) (string, error)
+
+// TimecodeMapper is a function that translates an absolute timecode into the
+// offset component of a thumbnail URL.
+type TimecodeMapper func(abs time.Duration) string
+
+// IntervalStep defines the sampling interval to be used up to a given
+// timecode. See GenSpriteOptions.Intervals.
+type IntervalStep struct {
+	Until    time.Duration
+	Interval time.Duration
+}
+
+// RangeEnd determines whether GenSpriteOptions.End is part of the range of
+// timecodes in the sprite.
+type RangeEnd int
+
+const (
+	// EndInclusive includes End in the sprite, so a range from 0 to 10
+	// seconds sampled every 2 seconds produces 6 thumbnails.
+	EndInclusive RangeEnd = iota
+
+	// EndExclusive excludes End from the sprite, which is the natural
+	// choice when End is the duration of the video: a range from 0 to 10
+	// seconds sampled every 2 seconds produces 5 thumbnails, and the last
+	// tile ends at End.
+	EndExclusive
+)
+
+var rangeEndNames = map[RangeEnd]string{
+	EndInclusive: "inclusive",
+	EndExclusive: "exclusive",
+}
+
+// String returns the name of the range end.
+func (e RangeEnd) String() string {
+	if name, ok := rangeEndNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("RangeEnd(%d)", int(e))
+}
+
+// valid reports whether the range end is known.
+func (e RangeEnd) valid() bool {
+	_, ok := rangeEndNames[e]
+	return ok
+}
+
 // GenSpriteOptions is the set of options that control the sprite generation
 // for a video rendition.
 type GenSpriteOptions struct {
@@ -47,6 +271,114 @@ type GenSpriteOptions struct {
 	Height      uint
 	JPEGQuality int
 
+	// OutputFormat is the image format of the sprite. The default is
+	// JPEG.
+	OutputFormat OutputFormat
+
+	// LosslessJPEG indicates whether JPEG sprites should be assembled
+	// from the coefficients of the JPEGs returned by the video-packager,
+	// instead of being encoded again from their pixels, which saves the
+	// CPU spent encoding the sprite and avoids a generation loss.
+	// JPEGQuality doesn't apply to sprites assembled this way. The
+	// thumbnails are still decoded and drawn, since the sprite is encoded
+	// from its pixels when it can't be assembled, so only the cost of
+	// encoding the sprite is saved, not the cost of decoding the
+	// thumbnails.
+	//
+	// It requires every tile to be an unmodified baseline JPEG of the
+	// size of the tile, aligned to the blocks of the JPEG (multiples of
+	// 16 pixels with 4:2:0 subsampling), and all of them to share the
+	// quantization tables and the subsampling, which is the case for
+	// thumbnails of the same video-packager. Sprites that don't meet
+	// these conditions, or that are changed after the tiles are drawn
+	// (sheets, gaps, Orientation or PostProcess), are encoded from their
+	// pixels as usual, with a warning describing why.
+	LosslessJPEG bool
+
+	// Arrangement, when set, places the tiles in the sprite, replacing
+	// the grid with a fixed number of columns, e.g. for players that
+	// expect the tiles in a vertical strip, or in a custom order (see
+	// FixedColumns, VerticalStrip, HorizontalStrip and NearSquare). It
+	// can't be combined with Columns or Rows, and FillOrder mirrors the
+	// arranged grid.
+	Arrangement Arrangement
+
+	// Rows, when set, fixes the number of rows of tiles in the sprite,
+	// deriving the number of columns from the number of thumbnails, for
+	// players whose storyboards are specified by rows. The last row may
+	// be incomplete, so sprites with few thumbnails may have fewer rows,
+	// as may sprites whose tail is trimmed (see TrimMissingTail). It
+	// can't be combined with Columns.
+	Rows uint
+
+	// SheetRows, when set, limits the number of rows of tiles in each
+	// image, for players that cap the number of tiles per storyboard
+	// image (e.g. legacy smart TVs that only support grids of up to
+	// 10x10 tiles, with Columns and SheetRows set to 10). Sprites with
+	// more rows are split into multiple sheets, described in
+	// GenSpriteResult.Sheets and Tile.Sheet. Orientation and PostProcess
+	// apply to each sheet.
+	SheetRows uint
+
+	// MaxSheetHeight, when set, limits the height of each image, in
+	// pixels, splitting the sprite into sheets like SheetRows (whichever
+	// is smaller wins), so long videos don't produce images too large for
+	// players and CDNs. Sheets have at least one row of tiles, and the
+	// height is measured before Orientation is applied.
+	MaxSheetHeight uint
+
+	// RangeEnd determines whether End is included in the sprite. The
+	// default is EndInclusive.
+	RangeEnd RangeEnd
+
+	// Intervals defines a non-uniform sampling policy, overriding Interval
+	// in the beginning of the video: the Interval of each step is used for
+	// timecodes before its Until, and Interval is used after the last
+	// step. Steps must be sorted by Until.
+	//
+	// For example, the following steps sample a frame every second in the
+	// first minute of the video, and every 10 seconds afterwards:
+	//
+	//	Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+	//	Interval:  10 * time.Second,
+	Intervals []IntervalStep
+
+	// Keyframes lists the timecodes of the keyframes of the video. When
+	// set, each thumbnail is captured at the keyframe nearest to its
+	// timecode, which is much cheaper for the video-packager and visually
+	// equivalent for previews. The metadata keeps the sampled timecodes,
+	// with the actual capture timecodes available in Tile.CapturedAt.
+	Keyframes []time.Duration
+
+	// FetchOrder determines the order in which thumbnails are requested
+	// from the video-packager. Spreading the requests over the timeline
+	// (with FetchStrided or FetchShuffled) avoids having multiple workers
+	// making the video-packager seek through the same region of the file.
+	FetchOrder FetchOrder
+
+	// ShuffleSeed is the seed used to shuffle the requests when FetchOrder
+	// is FetchShuffled. The zero value uses a random seed; set it to get a
+	// deterministic order.
+	ShuffleSeed int64
+
+	// MaxAllowedTiles overrides Generator.MaxAllowedTiles for this call.
+	// The zero value uses the limit of the Generator.
+	MaxAllowedTiles int
+
+	// Report indicates whether a Report summarizing the generation should
+	// be included in the result.
+	Report bool
+
+	// Labels are caller-provided labels (e.g. the tenant) attached to the
+	// Usage reported to Generator.UsageHook.
+	Labels map[string]string
+
+	// Prime indicates whether the first thumbnail should be requested
+	// alone, before the other thumbnails are requested in parallel. This
+	// lets the video-packager parse (and cache) the index of the video
+	// once, instead of doing it in every concurrent request.
+	Prime bool
+
 	// Whether to keep the original aspect ratio on each item sprite item.
 	//
 	// When set to true, the library will not stretch the items, wrapping
@@ -54,113 +386,772 @@ type GenSpriteOptions struct {
 	// both Width and Height are specified.
 	//
 	// When both width and height are specified and KeepAspectRatio is set
-	// to true, the plugin will use the height as the reference, meaning
-	// that it can only add vertical bars, not horizontal bars.
+	// to true, the plugin will use the height as the reference for
+	// landscape tiles (ScaleLetterbox) and the width as the reference for
+	// portrait tiles (ScaleLetterboxWidth). Thumbnails that don't fit in
+	// the tile, such as vertical videos in landscape tiles, are scaled
+	// down and wrapped with bars on the other axis.
 	KeepAspectRatio bool
 
+	// AlignX and AlignY determine where thumbnails wrapped with bars (see
+	// KeepAspectRatio) are placed in their tiles, horizontally (left,
+	// center or right) and vertically (top, center or bottom). The
+	// default is AlignCenter on both axes.
+	AlignX Alignment
+	AlignY Alignment
+
+	// ScalingMode determines how the video-packager is asked to size each
+	// thumbnail. The default value, ScaleAuto, derives it from Width,
+	// Height and KeepAspectRatio.
+	ScalingMode ScalingMode
+
 	// ContinueOnError indicate whether the generator should continue to
 	// generate the whole sprite if one or more of the thumbnails fail to
 	// get generated by the vod-module.
 	ContinueOnError bool
 
-	prefix string
+	// Placeholder is an optional image drawn in place of the thumbnails
+	// that failed to be generated when ContinueOnError is set. It's
+	// resized to the size of the tile, and the corresponding tiles are
+	// reported with TilePlaceholder status.
+	Placeholder image.Image
+
+	// OmitFailedTiles indicates whether tiles whose thumbnails failed to
+	// be generated (either blank or filled with the Placeholder) should be
+	// left out of the metadata, so no VTT cues point to them.
+	OmitFailedTiles bool
+
+	// TrimMissingTail indicates whether thumbnails that the
+	// video-packager fails to generate at the end of the range should be
+	// left out of the sprite and of the metadata, as it's common with
+	// live-to-VOD assets whose packaging lags behind. Only consecutive
+	// failures at the end of the range are trimmed: failures before the
+	// last generated thumbnail are handled as usual.
+	TrimMissingTail bool
+
+	// PostProcess, when set, is called with the assembled sprite right
+	// before it's encoded, allowing callers to stamp overlays, redact
+	// regions or apply filters to it. Returning an error aborts the
+	// generation.
+	PostProcess func(draw.Image) error
+
+	// TileHook, when set, is invoked for each thumbnail right after it's
+	// fetched, along with the timecode where it was captured, and the
+	// image it returns is drawn in the sprite instead. It can be used for
+	// annotating individual frames (e.g. marking ad breaks). TileHook is
+	// invoked concurrently by multiple workers, and returning an error
+	// aborts the generation.
+	TileHook func(timecode time.Duration, img image.Image) (image.Image, error)
+
+	// Timestamps, when set, renders the timecode where each thumbnail
+	// was captured onto it, after TileHook. See TimestampOverlay.
+	Timestamps *TimestampOverlay
+
+	// FillOrder determines how tiles fill the rows of the sprite. The
+	// default is FillLeftToRight.
+	FillOrder FillOrder
+
+	// RightToLeft indicates whether tiles should fill the rows of the
+	// sprite from right to left.
+	//
+	// Deprecated: use FillOrder instead.
+	RightToLeft bool
+
+	// Compositing determines how thumbnails with transparency are drawn
+	// in the sprite, and Background is the color of the areas of the
+	// sprite not covered by opaque thumbnails (e.g. letterbox bars or
+	// transparent pixels drawn with CompositeOver). The default
+	// background is black, or transparent when OutputFormat is PNG.
+	Compositing Compositing
+	Background  color.Color
+
+	// TileSpacing and CanvasPadding insert gaps, in pixels, between
+	// adjacent tiles and around the edges of the sprite (and of each
+	// sheet), so tiles don't bleed into each other when the sprite is
+	// scaled by the browser. Gaps are filled with SpacingColor, or with
+	// Background when it's nil. Sprites with gaps can't be described by
+	// WriteDASHAdaptationSet.
+	TileSpacing   uint
+	CanvasPadding uint
+	SpacingColor  color.Color
+
+	// Orientation rotates or transposes the final sprite, adjusting the
+	// metadata accordingly. It's applied before PostProcess.
+	Orientation Orientation
+
+	// TimecodeStep aligns the timecode of each thumbnail to a multiple
+	// of the given step before requesting it, according to
+	// TimecodeRounding, for video-packagers that only honor a coarser
+	// granularity (e.g. 500ms) or to match the preview logic of a
+	// player. Timecodes are only truncated to milliseconds by default.
+	// The aligned timecodes are reported in Tile.CapturedAt.
+	TimecodeStep     time.Duration
+	TimecodeRounding Rounding
+
+	// CropRect, when set, crops every thumbnail to the given region
+	// before placing it in the sprite, e.g. to cut a ticker or watermark
+	// band off the bottom of all frames. It's applied after scaling, so
+	// tiles are smaller than the requested dimensions.
+	CropRect *NormalizedRect
+
+	// QualityScores indicates whether quality heuristics (black frames,
+	// near-duplicates and blurriness) should be computed for each tile
+	// and included in the metadata. See TileQuality.
+	QualityScores bool
+
+	// TileURLs indicates whether the URL each thumbnail was fetched from
+	// should be included in the metadata (see Tile.URL), so the exact
+	// frame can be fetched again when debugging a sprite. RedactURL, when
+	// set, is applied to each URL before it's recorded, e.g. to strip
+	// signatures from the query string (see RedactQuery).
+	TileURLs  bool
+	RedactURL func(string) string
+
+	// BlackFrameNudge, when set, makes the generator look for a
+	// representative frame when a thumbnail is essentially black (see
+	// TileQuality.Black), trying the timecodes after and before it, in
+	// multiples of BlackFrameNudge, up to BlackFrameAttempts
+	// alternatives (2 when zero). The CapturedAt of the tile reflects the
+	// timecode of the thumbnail in the sprite.
+	BlackFrameNudge    time.Duration
+	BlackFrameAttempts int
+
+	// FallbackWidth and FallbackHeight, when set, make the generator
+	// degrade gracefully when the video-packager is overloaded: once a
+	// thumbnail request fails with 503 or times out, it's retried, along
+	// with all the remaining thumbnails, at the fallback size, and then
+	// scaled up to the requested size, trading quality for completing
+	// the sprite. They must be smaller than Width and Height, and only
+	// set for the requested dimensions. The number of degraded tiles is
+	// reported in the warnings of the result.
+	FallbackWidth  uint
+	FallbackHeight uint
+
+	// TimecodeMapper, when set, translates the absolute timecode of each
+	// thumbnail into the offset used in the thumbnail URL (the
+	// `{timecode}` in `thumb-{timecode}-w{width}-h{height}`). It's useful
+	// for nginx-vod-module mappings that expect segment-relative offsets
+	// instead of absolute milliseconds.
+	TimecodeMapper TimecodeMapper
+
+	// Selectors are additional nginx-vod-module selectors appended to the
+	// thumbnail suffix, without the leading dash. For example, use "v2"
+	// to capture thumbnails from the second video track of a multi-track
+	// asset.
+	Selectors []string
+
+	// JobKey identifies the sprite being generated. When set, concurrent
+	// calls to GenSprite (or GenSpriteWithMetadata) on the same Generator
+	// with the same JobKey are deduplicated: only one of them generates
+	// the sprite, while the others wait and share its result (including
+	// errors). Callers are responsible for using the same JobKey only for
+	// equivalent options, and must not modify the returned data, as it's
+	// shared.
+	//
+	// Waiting calls return as soon as their own Context is done. When the
+	// generation fails because its Context was canceled, waiting calls
+	// with live contexts generate the sprite themselves instead of
+	// sharing that error. When it panics, they return ErrJobPanicked.
+	JobKey string
+
+	prefix     string
+	token      *accessToken
+	shared     *sharedThumbnails
+	mode       ScalingMode
+	keyframes  []time.Duration
+	endClamped bool
+	stats      *fetchStats
+	report     *Report
+	progress   *progress
+	lossless   *losslessSprite
 }
 
-// n returns the number of items expected to be present in the generated
-// sprite.
-func (o *GenSpriteOptions) n() int {
-	return int((o.End-o.Start)/o.Interval) + 1
+// ErrNoThumbnails is returned when ContinueOnError is set, but none of the
+// thumbnails could be generated and there's no Placeholder to fill the
+// sprite with.
+var ErrNoThumbnails = errors.New("no thumbnails were generated")
+
+// ErrInvalidRange is returned when End is before Start, or when the range is
+// empty.
+var ErrInvalidRange = errors.New("invalid range: End must not be before Start")
+
+// ErrInvalidInterval is returned when the sampling intervals aren't positive
+// and End is after Start, or when the steps in Intervals aren't sorted. When
+// Start and End are equal, a single thumbnail is generated and intervals are
+// ignored.
+var ErrInvalidInterval = errors.New("invalid interval: must be positive")
+
+// ErrInvalidGrid is returned when both Rows and Columns are set.
+var ErrInvalidGrid = errors.New("invalid grid: Rows and Columns are mutually exclusive")
+
+// DefaultMaxAllowedTiles is the maximum number of thumbnails in a sprite when
+// no limit is configured.
+const DefaultMaxAllowedTiles = 10000
+
+// ErrTooManyTiles is returned (wrapped in a TooManyTilesError) when the
+// sprite would exceed the maximum number of tiles allowed.
+var ErrTooManyTiles = errors.New("too many tiles")
+
+// TooManyTilesError is the error returned when the sprite would have more
+// tiles than allowed. It matches ErrTooManyTiles with errors.Is.
+type TooManyTilesError struct {
+	Tiles int
+	Max   int
 }
 
-// GenSprite generates the sprite for the given video, using the specified
-// options.
-func (g *Generator) GenSprite(opts GenSpriteOptions) ([]byte, error) {
+// Error returns the string representation of TooManyTilesError.
+func (err *TooManyTilesError) Error() string {
+	return fmt.Sprintf("%s: %d tiles requested, at most %d allowed", ErrTooManyTiles, err.Tiles, err.Max)
+}
+
+// Is reports whether target is ErrTooManyTiles.
+func (err *TooManyTilesError) Is(target error) bool {
+	return target == ErrTooManyTiles
+}
+
+// ErrIntervalTooFine is returned when the sampling interval is finer than
+// the granularity of the video-packager. See Generator.Granularity.
+var ErrIntervalTooFine = errors.New("invalid interval: finer than the granularity of the video-packager")
+
+func (o *GenSpriteOptions) validate() error {
+	if o.End < o.Start || !o.RangeEnd.valid() {
+		return ErrInvalidRange
+	}
+	if o.End == o.Start && o.RangeEnd == EndExclusive {
+		return ErrInvalidRange
+	}
+	if err := o.validateTiles(); err != nil {
+		return err
+	}
+	if o.End == o.Start {
+		return nil
+	}
+	for i, step := range o.Intervals {
+		if step.Interval <= 0 || (i > 0 && step.Until <= o.Intervals[i-1].Until) {
+			return ErrInvalidInterval
+		}
+	}
+	usesInterval := len(o.Intervals) == 0 || o.Intervals[len(o.Intervals)-1].Until <= o.End
+	if usesInterval && o.Interval <= 0 {
+		return ErrInvalidInterval
+	}
+	return nil
+}
+
+// validateTiles validates the options that don't depend on the range of the
+// sprite, but only on how each tile is fetched and drawn.
+func (o *GenSpriteOptions) validateTiles() error {
+	if !o.FetchOrder.valid() {
+		return ErrInvalidFetchOrder
+	}
+	if !o.FillOrder.valid() {
+		return ErrInvalidFillOrder
+	}
+	if !o.TimecodeRounding.valid() || o.TimecodeStep < 0 {
+		return ErrInvalidRounding
+	}
+	if !o.Compositing.valid() {
+		return ErrInvalidCompositing
+	}
+	if !o.Orientation.valid() {
+		return ErrInvalidOrientation
+	}
+	if !o.AlignX.valid() || !o.AlignY.valid() {
+		return ErrInvalidAlignment
+	}
+	if o.Timestamps != nil {
+		if err := o.Timestamps.validate(); err != nil {
+			return err
+		}
+	}
+	if !o.OutputFormat.valid() {
+		return ErrInvalidOutputFormat
+	}
+	// KeepAspectRatio contradicts explicit modes that stretch or ignore
+	// one of the dimensions.
+	if o.KeepAspectRatio && o.ScalingMode != ScaleAuto && !o.ScalingMode.boxed() {
+		return ErrInvalidScalingMode
+	}
+	if o.BlackFrameNudge < 0 || o.BlackFrameAttempts < 0 {
+		return ErrInvalidBlackFrameNudge
+	}
+	if err := o.validateFallback(); err != nil {
+		return err
+	}
+	if o.CropRect != nil {
+		if err := o.CropRect.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepare fills the defaults in the given options and validates them,
+// resolving everything needed for fetching the thumbnails.
+func (g *Generator) prepare(opts *GenSpriteOptions) error {
+	g.fillDefaults(opts)
+	if opts.Arrangement != nil && (opts.Columns > 0 || opts.Rows > 0) {
+		return wrapStage(opts.Context, StageValidation, ErrInvalidArrangement)
+	}
+	if opts.Rows > 0 {
+		if opts.Columns > 0 {
+			return wrapStage(opts.Context, StageValidation, ErrInvalidGrid)
+		}
+		opts.Columns = opts.columnsForRows()
+	}
+	if opts.Columns == 0 {
+		opts.Columns = 1
+	}
+	if err := opts.validate(); err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
+	}
+	if opts.OutputFormat == AVIF && g.AVIFEncoder == nil {
+		return wrapStage(opts.Context, StageValidation, ErrMissingEncoder)
+	}
+	if err := g.clampEnd(opts); err != nil {
+		return wrapStage(opts.Context, StageResolve, err)
+	}
+	if err := g.checkTileCount(opts); err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
+	}
+	if err := g.checkGranularity(opts); err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
+	}
+	return g.resolveTiles(opts)
+}
+
+// prepareTiles is the part of prepare that doesn't depend on the range of
+// the sprite, for when the timecodes are known upfront (see PatchSprite).
+func (g *Generator) prepareTiles(opts *GenSpriteOptions) error {
+	g.fillDefaults(opts)
+	if err := opts.validateTiles(); err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
+	}
+	if opts.OutputFormat == AVIF && g.AVIFEncoder == nil {
+		return wrapStage(opts.Context, StageValidation, ErrMissingEncoder)
+	}
+	return g.resolveTiles(opts)
+}
+
+// fillDefaults fills the defaults of the generator in the given options.
+func (g *Generator) fillDefaults(opts *GenSpriteOptions) {
 	g.initGenerator()
+	applyDefaults(opts, g.DefaultOptions)
 	if opts.Context == nil {
 		opts.Context = context.Background()
 	}
-	if opts.Columns == 0 {
-		opts.Columns = 1
+	if opts.JPEGQuality == 0 {
+		opts.JPEGQuality = g.JPEGQuality
+	}
+}
+
+// resolveTiles resolves the scaling mode, the keyframes, the prefix and the
+// access token used for fetching the thumbnails.
+func (g *Generator) resolveTiles(opts *GenSpriteOptions) error {
+	mode, err := resolveScalingMode(opts.ScalingMode, opts.Width, opts.Height, opts.KeepAspectRatio)
+	if err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
 	}
-	prefix, err := g.Translator(opts.VideoURL)
+	opts.mode = mode
+	if err := opts.checkDimensions(); err != nil {
+		return wrapStage(opts.Context, StageValidation, err)
+	}
+	opts.keyframes, err = g.resolveKeyframes(opts)
 	if err != nil {
-		return nil, err
+		return wrapStage(opts.Context, StageResolve, err)
+	}
+	opts.prefix, err = g.translate(opts.Context, opts.VideoURL)
+	if err != nil {
+		return wrapStage(opts.Context, StageResolve, err)
+	}
+	opts.token, err = g.newAccessToken(opts.Context, opts.VideoURL)
+	return wrapStage(opts.Context, StageResolve, err)
+}
+
+// columnsForRows returns the number of columns needed for fitting all
+// thumbnails in Rows rows.
+func (o *GenSpriteOptions) columnsForRows() uint {
+	n := uint(o.N())
+	return (n + o.Rows - 1) / o.Rows
+}
+
+// checkTileCount ensures that the sprite doesn't exceed the maximum number
+// of tiles allowed, before any requests are sent.
+func (g *Generator) checkTileCount(opts *GenSpriteOptions) error {
+	max := opts.MaxAllowedTiles
+	if max == 0 {
+		max = g.MaxAllowedTiles
+	}
+	if max == 0 {
+		max = DefaultMaxAllowedTiles
+	}
+	if max < 0 {
+		return nil
+	}
+	if n := opts.N(); n > max {
+		return &TooManyTilesError{Tiles: n, Max: max}
+	}
+	return nil
+}
+
+// checkGranularity ensures that the distance between adjacent thumbnails
+// isn't smaller than the granularity of the video-packager.
+func (g *Generator) checkGranularity(opts *GenSpriteOptions) error {
+	if g.Granularity <= 0 {
+		return nil
+	}
+	timecodes := opts.timecodes()
+	for i := 1; i < len(timecodes); i++ {
+		if timecodes[i]-timecodes[i-1] < g.Granularity {
+			return ErrIntervalTooFine
+		}
+	}
+	return nil
+}
+
+// N returns the number of thumbnails in the sprite generated with the given
+// options, consistent with RangeEnd. It returns 0 for invalid options.
+func (o *GenSpriteOptions) N() int {
+	if o.validate() != nil {
+		return 0
+	}
+	if o.End == o.Start {
+		return 1
+	}
+	if len(o.Intervals) > 0 {
+		return o.countIntervals()
+	}
+	if o.RangeEnd == EndExclusive {
+		return int((o.End-o.Start-1)/o.Interval) + 1
+	}
+	return int((o.End-o.Start)/o.Interval) + 1
+}
+
+// countIntervals returns the number of items in a sprite sampled with
+// Intervals, counting the timecodes in each step at once, so the count is
+// cheap even when the sprite is too large to be generated.
+func (o *GenSpriteOptions) countIntervals() int {
+	// timecodes in the sprite are before limit.
+	limit := o.End + 1
+	if o.RangeEnd == EndExclusive {
+		limit = o.End
+	}
+	var n int
+	timecode := o.Start
+	count := func(until, interval time.Duration) {
+		if until > limit {
+			until = limit
+		}
+		if timecode >= until {
+			return
+		}
+		k := (until-timecode-1)/interval + 1
+		n += int(k)
+		timecode += k * interval
+	}
+	for _, step := range o.Intervals {
+		count(step.Until, step.Interval)
+	}
+	if timecode < limit {
+		count(limit, o.Interval)
+	}
+	return n
+}
+
+// intervalAt returns the sampling interval to be used after the given
+// timecode.
+func (o *GenSpriteOptions) intervalAt(timecode time.Duration) time.Duration {
+	for _, step := range o.Intervals {
+		if timecode < step.Until {
+			return step.Interval
+		}
+	}
+	return o.Interval
+}
+
+// timecodes returns the timecodes of each item in the sprite, in order.
+func (o *GenSpriteOptions) timecodes() []time.Duration {
+	if o.End == o.Start {
+		if o.RangeEnd == EndExclusive {
+			return nil
+		}
+		return []time.Duration{o.Start}
 	}
-	opts.prefix = prefix
-	var wg sync.WaitGroup
-	inputs, workersAbort, imgs, workersErrs := g.startWorkers(opts, &wg)
-	inputAbort, inputErrs := g.startSendingInputs(opts, inputs, workersErrs)
-	sprite, err := g.drawSprite(opts, imgs, workersErrs, inputErrs)
+	var timecodes []time.Duration
+	for timecode := o.Start; o.includes(timecode); timecode += o.intervalAt(timecode) {
+		timecodes = append(timecodes, timecode)
+	}
+	return timecodes
+}
+
+// includes reports whether the given timecode is within the range of the
+// sprite, according to RangeEnd.
+func (o *GenSpriteOptions) includes(timecode time.Duration) bool {
+	if o.RangeEnd == EndExclusive {
+		return timecode < o.End
+	}
+	return timecode <= o.End
+}
+
+// inputs returns the worker inputs for each of the given timecodes.
+func (o *GenSpriteOptions) inputs(timecodes []time.Duration) []workerInput {
+	inputs := make([]workerInput, len(timecodes))
+	fallback := o.fallbackPolicy()
+	for i, timecode := range timecodes {
+		inputs[i] = workerInput{
+			index:           i,
+			prefix:          o.prefix,
+			width:           o.Width,
+			height:          o.Height,
+			timecode:        o.captureTimecode(timecode),
+			mode:            o.mode,
+			timecodeMapper:  o.TimecodeMapper,
+			selectors:       o.Selectors,
+			tileHook:        o.TileHook,
+			timestamps:      o.Timestamps,
+			continueOnError: o.ContinueOnError,
+			softFail:        o.TrimMissingTail,
+			stats:           o.stats,
+			crop:            o.CropRect,
+			score:           o.QualityScores,
+			nudge:           o.BlackFrameNudge,
+			nudgeAttempts:   o.blackFrameAttempts(),
+			fallback:        fallback,
+			token:           o.token,
+			shared:          o.shared,
+			keepCompressed:  o.lossless.enabled(),
+		}
+	}
+	return inputs
+}
+
+// GenSprite generates the sprite for the given video, using the specified
+// options.
+func (g *Generator) GenSprite(opts GenSpriteOptions) ([]byte, error) {
+	result, err := g.GenSpriteWithMetadata(opts)
 	if err != nil {
-		close(workersAbort)
-		close(inputAbort)
-		wg.Wait()
 		return nil, err
 	}
+	return result.Sprite, nil
+}
+
+// GenSpriteWithMetadata generates the sprite for the given video, using the
+// specified options, and returns it along with the metadata describing the
+// position of each thumbnail in the sprite.
+func (g *Generator) GenSpriteWithMetadata(opts GenSpriteOptions) (*GenSpriteResult, error) {
+	if opts.JobKey != "" {
+		ctx := opts.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return g.jobs.do(ctx, opts.JobKey, func() (*GenSpriteResult, error) {
+			return g.genSprite(opts, nil)
+		})
+	}
+	return g.genSprite(opts, nil)
+}
+
+// genSprite generates the sprite, writing it to the given writer, or
+// buffering it in the result when the writer is nil.
+func (g *Generator) genSprite(opts GenSpriteOptions, w io.Writer) (_ *GenSpriteResult, err error) {
+	startedAt := time.Now()
+	if err := g.prepare(&opts); err != nil {
+		return nil, err
+	}
+	if w != nil && opts.sheeted() {
+		return nil, wrapStage(opts.Context, StageValidation, ErrStreamingSheets)
+	}
+	opts.stats = &fetchStats{}
+	if opts.Report {
+		opts.report = newReport(&opts, startedAt)
+	}
+	if opts.LosslessJPEG {
+		opts.lossless = &losslessSprite{err: opts.checkLossless(), maxPixels: g.MaxThumbPixels}
+	}
+	if g.UsageHook != nil {
+		defer func() {
+			g.UsageHook(opts.stats.usage(opts.Labels, opts.N(), err))
+		}()
+	}
+	sprite, result, err := g.drawSprite(opts)
+	if err != nil {
+		return nil, wrapStage(opts.Context, StageDraw, err)
+	}
+	if opts.lossless != nil {
+		opts.lossless.tiles = result.Tiles
+	}
+	opts.progress.encoding()
+	fetched := time.Now()
+	sheets := []*image.RGBA{sprite}
+	var ranges []Sheet
+	if rows := opts.sheetRows(result.TileHeight); rows > 0 {
+		sheets, ranges = splitSheets(sprite, result, rows, opts.gaps())
+	}
+	var tileSize Tile
+	var spriteSum []byte
+	var sheetSums [][]byte
+	for i, sheet := range sheets {
+		sheet, tileSize = opts.orientSheet(sheet, i, result)
+		if opts.PostProcess != nil {
+			if err := opts.PostProcess(sheet); err != nil {
+				return nil, wrapStage(opts.Context, StageEncode, err)
+			}
+		}
+		data, sum, err := g.encodeSheet(&opts, sheet, w, opts.report != nil)
+		if err != nil {
+			return nil, wrapStage(opts.Context, StageEncode, err)
+		}
+		if ranges != nil {
+			sheetSums = append(sheetSums, sum)
+			result.Sheets = append(result.Sheets, Sheet{
+				Sprite: data,
+				Width:  sheet.Bounds().Dx(),
+				Height: sheet.Bounds().Dy(),
+				Start:  ranges[i].Start,
+				End:    ranges[i].End,
+			})
+		}
+		if i == 0 {
+			sprite = sheet
+			result.Sprite = data
+			spriteSum = sum
+		}
+	}
+	opts.stats.addProcessing(time.Since(fetched))
+	result.TileWidth, result.TileHeight = tileSize.Width, tileSize.Height
+	result.Format = opts.OutputFormat
+	result.EndClamped = opts.endClamped
+	if opts.lossless != nil && opts.lossless.err != nil {
+		result.Warnings = append(result.Warnings, warnf(SeverityInfo, "the sprite was encoded from its pixels instead of assembled from the thumbnails: %v", opts.lossless.err))
+	}
+	if opts.endClamped {
+		result.Warnings = append(result.Warnings, warnf(SeverityInfo, "End was clamped to the duration of the video (%v)", opts.End))
+	}
+	result.Width = sprite.Bounds().Dx()
+	result.Height = sprite.Bounds().Dy()
+	result.BytesDownloaded = atomic.LoadInt64(&opts.stats.bytes)
+	if opts.report != nil {
+		opts.report.finish(opts.stats, spriteSum, sheetSums, fetched, time.Now())
+		result.Report = opts.report
+	}
+	return result, nil
+}
+
+// orientSheet returns the given sheet of the sprite in the orientation of the
+// options, adjusting the tiles it contains, along with the size of the tiles
+// in that orientation.
+func (o *GenSpriteOptions) orientSheet(sheet *image.RGBA, index int, result *GenSpriteResult) (*image.RGBA, Tile) {
+	width, height := sheet.Bounds().Dx(), sheet.Bounds().Dy()
+	for i, tile := range result.Tiles {
+		if tile.Sheet == index {
+			result.Tiles[i] = orientTile(tile, width, height, o.Orientation)
+		}
+	}
+	tileSize := orientTile(Tile{Width: result.TileWidth, Height: result.TileHeight}, width, height, o.Orientation)
+	return orient(sheet, o.Orientation), tileSize
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
 	var buf bytes.Buffer
-	err = jpeg.Encode(&buf, sprite, &jpeg.Options{Quality: opts.JPEGQuality})
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
 	return buf.Bytes(), err
 }
 
+func (g *Generator) translate(ctx context.Context, videoURL string) (string, error) {
+	if g.ContextTranslator != nil {
+		return g.ContextTranslator(ctx, videoURL)
+	}
+	return g.Translator(videoURL)
+}
+
 func (g *Generator) initGenerator() {
-	g.o.Do(func() { g.client = cleanhttp.DefaultPooledClient() })
+	g.o.Do(func() {
+		g.client = cleanhttp.DefaultPooledClient()
+		// keep one idle connection per worker, so connections are
+		// reused across sprite generations.
+		if t, ok := g.client.Transport.(*http.Transport); ok {
+			if int(g.MaxWorkers) > t.MaxIdleConnsPerHost {
+				t.MaxIdleConnsPerHost = int(g.MaxWorkers)
+			}
+			g.configureDialer(t)
+		}
+	})
 }
 
-func (g *Generator) startWorkers(opts GenSpriteOptions, wg *sync.WaitGroup) (chan<- workerInput, chan<- struct{}, <-chan workerOutput, <-chan error) {
-	nworkers := opts.n()/2 + 1
-	if nworkers > int(g.MaxWorkers) {
-		nworkers = int(g.MaxWorkers)
+func (g *Generator) newWorker() worker {
+	maxDecoders := int(g.MaxDecoders)
+	if maxDecoders == 0 {
+		maxDecoders = runtime.GOMAXPROCS(0)
 	}
-	inputs := make(chan workerInput, nworkers)
-	imgs := make(chan workerOutput, nworkers*2)
-	errs := make(chan error, nworkers+1)
-	abort := make(chan struct{})
-	for i := 0; i < nworkers; i++ {
-		wg.Add(1)
-		w := worker{client: g.client, group: wg}
-		go w.Run(opts.Context, inputs, abort, imgs, errs)
+	return worker{
+		client:         g.client,
+		captureHeaders: g.CaptureHeaders,
+		logger:         g.Logger,
+		requestBuilder: g.RequestBuilder,
+		checksumHeader: g.ChecksumHeader,
+		clock:          g.Clock,
+		maxThumbBytes:  g.MaxThumbBytes,
+		maxThumbPixels: g.MaxThumbPixels,
+		decoders:       make(chan struct{}, maxDecoders),
 	}
-	go func() {
-		wg.Wait()
-		close(imgs)
-	}()
-	return inputs, abort, imgs, errs
 }
 
-// startSendingInputs sends the images into the inputs channel.
+// fetch downloads the thumbnails described by the given inputs using a pool
+// of workers, invoking handle for each downloaded thumbnail. Duplicate
+// thumbnails are fetched once (see coalesce). Thumbnails may arrive in any
+// order, and handle is always invoked from the calling goroutine. When prime
+// is set, the first thumbnail is fetched before the others (see
+// GenSpriteOptions.Prime).
 //
-// It starts a goroutine in background that. Any error that happens in the
-// process is reported through the errors channel.
-//
-// The method also returns an abort channel that can be used to abort the process.
-func (g *Generator) startSendingInputs(opts GenSpriteOptions, inputs chan<- workerInput, workerErrs <-chan error) (chan<- struct{}, <-chan error) {
-	errs := make(chan error, 1)
-	abort := make(chan struct{})
-	go func() {
-		defer close(inputs)
-		blackBars := opts.KeepAspectRatio && opts.Width != 0 && opts.Height != 0
-		for timecode := opts.Start; timecode <= opts.End; timecode += opts.Interval {
-			input := workerInput{
-				prefix:          opts.prefix,
-				width:           opts.Width,
-				height:          opts.Height,
-				timecode:        timecode,
-				letterbox:       blackBars,
-				continueOnError: opts.ContinueOnError,
-			}
-
-			select {
-			case inputs <- input:
-			case <-abort:
-				return
-			case <-opts.Context.Done():
-				errs <- opts.Context.Err()
-				return
-			case err := <-workerErrs:
-				errs <- err
-				return
-			}
+// fetch returns the first error that happens in the process, aborting any
+// pending work.
+func (g *Generator) fetch(ctx context.Context, inputs []workerInput, prime bool, handle func(workerOutput)) error {
+	inputs, handle = coalesce(inputs, handle)
+	w := g.newWorker()
+	if prime && len(inputs) > 0 {
+		output, err := w.process(ctx, inputs[0])
+		if err != nil {
+			return fetchError(inputs[0], err)
 		}
-	}()
-	return abort, errs
+		handle(output)
+		inputs = inputs[1:]
+	}
+	config := pool.Config{
+		Workers: g.nworkers(len(inputs)),
+		Buffer:  int(g.QueueSize),
+	}
+	// all inputs share the stats of the generation.
+	if len(inputs) > 0 && inputs[0].stats != nil {
+		config.QueueDepth = inputs[0].stats.observeQueueDepth
+	}
+	return pool.RunConfig(ctx, len(inputs), config, func(ctx context.Context, i int) (interface{}, error) {
+		output, err := w.process(ctx, inputs[i])
+		if err != nil {
+			return nil, fetchError(inputs[i], err)
+		}
+		return output, nil
+	}, func(_ int, result interface{}) error {
+		handle(result.(workerOutput))
+		return nil
+	})
+}
+
+// autoWorkersPerCPU is the number of workers per CPU used when MaxWorkers
+// is zero.
+const autoWorkersPerCPU = 4
+
+// nworkers returns the number of workers used for fetching n thumbnails.
+func (g *Generator) nworkers(n int) int {
+	maxWorkers := int(g.MaxWorkers)
+	if maxWorkers == 0 {
+		// requests are I/O bound and decoding is limited separately
+		// (see MaxDecoders), but we still don't want to flood the
+		// video-packager.
+		maxWorkers = autoWorkersPerCPU * runtime.GOMAXPROCS(0)
+	}
+	nworkers := n/2 + 1
+	if nworkers > maxWorkers {
+		nworkers = maxWorkers
+	}
+	return nworkers
 }
@@ -7,13 +7,22 @@ package sprite
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"io/ioutil"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -57,6 +66,48 @@ func TestGenSprite(t *testing.T) {
 			},
 			expectedFile: "sprite-full-blackbars.jpg",
 		},
+		{
+			name: "full sprite - vertical with explicit letterbox scaling mode",
+			input: GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:       0,
+				End:         18 * time.Second,
+				Interval:    2 * time.Second,
+				Width:       200,
+				Height:      72,
+				JPEGQuality: testJPEGQuality,
+				ScalingMode: ScaleLetterbox,
+			},
+			expectedFile: "sprite-full-blackbars.jpg",
+		},
+		{
+			name: "full sprite - vertical - shuffled fetch order",
+			input: GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:       0,
+				End:         18 * time.Second,
+				Interval:    2 * time.Second,
+				Height:      72,
+				JPEGQuality: testJPEGQuality,
+				FetchOrder:  FetchShuffled,
+				ShuffleSeed: 42,
+			},
+			expectedFile: "sprite-full.jpg",
+		},
+		{
+			name: "full sprite - 2 columns - strided fetch order",
+			input: GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Columns:     2,
+				Start:       0,
+				End:         18 * time.Second,
+				Interval:    2 * time.Second,
+				Height:      72,
+				JPEGQuality: testJPEGQuality,
+				FetchOrder:  FetchStrided,
+			},
+			expectedFile: "sprite-full-2-columns.jpg",
+		},
 		{
 			name: "full sprite - horizontal",
 			input: GenSpriteOptions{
@@ -147,6 +198,18 @@ func TestGenSprite(t *testing.T) {
 			},
 			expectedFile: "sprite-4000-14000-horizontal.jpg",
 		},
+		{
+			name: "single frame - Start equals End",
+			input: GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:       0,
+				End:         0,
+				Height:      72,
+				Columns:     10,
+				JPEGQuality: testJPEGQuality,
+			},
+			expectedFile: "img01.jpg",
+		},
 		{
 			name: "full sprite - vertical - ContinueOnError",
 			input: GenSpriteOptions{
@@ -246,6 +309,50 @@ func TestGenSpriteErrors(t *testing.T) {
 			},
 			httpErr: true,
 		},
+		{
+			name: "End before Start",
+			input: GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:    14 * time.Second,
+				End:      4 * time.Second,
+				Interval: 2 * time.Second,
+				Height:   72,
+			},
+		},
+		{
+			name: "no interval",
+			input: GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:    4 * time.Second,
+				End:      14 * time.Second,
+				Height:   72,
+			},
+		},
+		{
+			name: "scaling mode missing dimensions",
+			input: GenSpriteOptions{
+				VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:       4 * time.Second,
+				End:         14 * time.Second,
+				Interval:    2 * time.Second,
+				Height:      72,
+				ScalingMode: ScaleExact,
+			},
+		},
+		{
+			name: "unsorted interval steps",
+			input: GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				Start:    4 * time.Second,
+				End:      14 * time.Second,
+				Intervals: []IntervalStep{
+					{Until: 10 * time.Second, Interval: time.Second},
+					{Until: 8 * time.Second, Interval: 2 * time.Second},
+				},
+				Interval: 2 * time.Second,
+				Height:   72,
+			},
+		},
 		{
 			name: "context cancelation",
 			input: GenSpriteOptions{
@@ -284,6 +391,747 @@ func TestGenSpriteErrors(t *testing.T) {
 	}
 }
 
+func TestGenSpriteContextTranslator(t *testing.T) {
+	t.Parallel()
+	type ctxKey struct{}
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	var got interface{}
+	generator := Generator{
+		ContextTranslator: func(ctx context.Context, videoURL string) (string, error) {
+			got = ctx.Value(ctxKey{})
+			return packager.translate(videoURL)
+		},
+		MaxWorkers: 4,
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		Context:  context.WithValue(context.Background(), ctxKey{}, "trace-123"),
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "trace-123" {
+		t.Errorf("context value not propagated to the translator\nwant %q\ngot  %v", "trace-123", got)
+	}
+}
+
+func TestGenSpriteAbortsInFlightRequests(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{0}
+	packager.delay = time.Minute
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := generator.GenSprite(GenSpriteOptions{
+			VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+			End:      18 * time.Second,
+			Interval: 2 * time.Second,
+			Height:   72,
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var verr *VideoPackagerError
+		if !errors.As(err, &verr) {
+			t.Errorf("expected %#v to be VideoPackagerError, but it wasn't", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GenSprite didn't abort in-flight requests")
+	}
+}
+
+func TestGenSpriteCaptureHeaders(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator:     packager.translate,
+		MaxWorkers:     4,
+		CaptureHeaders: []string{"x-served-by", "X-Cache"},
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Start:    30 * time.Second,
+		End:      34 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	var verr *VideoPackagerError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected %#v to be VideoPackagerError, but it wasn't", err)
+	}
+	expectedHeader := http.Header{"X-Served-By": []string{"fake-packager"}}
+	if !reflect.DeepEqual(verr.Header, expectedHeader) {
+		t.Errorf("wrong headers captured\nwant %#v\ngot  %#v", expectedHeader, verr.Header)
+	}
+}
+
+func TestGenSpriteDownscalesIgnoredDimensions(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	var logger fakeLogger
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4, Logger: &logger}
+
+	// the fake packager always returns 127x72 thumbnails, ignoring the
+	// requested height.
+	data, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   36,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("GenSprite didn't generate a valid jpeg: %v", err)
+	}
+	if expected := image.Rect(0, 0, 64, 360); sprite.Bounds() != expected {
+		t.Errorf("image bounds don't match\nwant %v\ngot  %v", expected, sprite.Bounds())
+	}
+	if n := len(logger.messages()); n != 10 {
+		t.Errorf("wrong number of log messages\nwant 10\ngot  %d", n)
+	}
+}
+
+func TestGenSpriteOptionsTimecodes(t *testing.T) {
+	t.Parallel()
+	opts := GenSpriteOptions{
+		Start: time.Second,
+		Intervals: []IntervalStep{
+			{Until: 4 * time.Second, Interval: time.Second},
+			{Until: 10 * time.Second, Interval: 3 * time.Second},
+		},
+		Interval: 5 * time.Second,
+		End:      20 * time.Second,
+	}
+	expected := []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		3 * time.Second,
+		4 * time.Second,
+		7 * time.Second,
+		10 * time.Second,
+		15 * time.Second,
+		20 * time.Second,
+	}
+	timecodes := opts.timecodes()
+	if !reflect.DeepEqual(timecodes, expected) {
+		t.Errorf("wrong timecodes\nwant %v\ngot  %v", expected, timecodes)
+	}
+}
+
+func TestGenSpriteWithMetadata(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Columns:   2,
+		Intervals: []IntervalStep{{Until: 4 * time.Second, Interval: 2 * time.Second}},
+		Interval:  6 * time.Second,
+		End:       18 * time.Second,
+		Height:    72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatalf("GenSpriteWithMetadata didn't generate a valid jpeg: %v", err)
+	}
+	if result.Width != sprite.Bounds().Dx() || result.Height != sprite.Bounds().Dy() {
+		t.Errorf("wrong dimensions in the result\nwant %dx%d\ngot  %dx%d", sprite.Bounds().Dx(), sprite.Bounds().Dy(), result.Width, result.Height)
+	}
+	expectedTiles := []Tile{
+		{Start: 0, End: 2 * time.Second, CapturedAt: 0, X: 0, Y: 0, Width: 127, Height: 72},
+		{Start: 2 * time.Second, End: 4 * time.Second, CapturedAt: 2 * time.Second, X: 127, Y: 0, Width: 127, Height: 72},
+		{Start: 4 * time.Second, End: 10 * time.Second, CapturedAt: 4 * time.Second, X: 0, Y: 72, Width: 127, Height: 72},
+		{Start: 10 * time.Second, End: 16 * time.Second, CapturedAt: 10 * time.Second, X: 127, Y: 72, Width: 127, Height: 72},
+		{Start: 16 * time.Second, End: 22 * time.Second, CapturedAt: 16 * time.Second, X: 0, Y: 144, Width: 127, Height: 72},
+	}
+	if !reflect.DeepEqual(result.Tiles, expectedTiles) {
+		t.Errorf("wrong tiles\nwant %#v\ngot  %#v", expectedTiles, result.Tiles)
+	}
+	if result.Width != 254 || result.Height != 216 {
+		t.Errorf("wrong sprite dimensions\nwant 254x216\ngot  %dx%d", result.Width, result.Height)
+	}
+}
+
+func TestGenSpriteWithMetadataEndExclusive(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Columns:  3,
+		Interval: 4 * time.Second,
+		End:      10 * time.Second,
+		RangeEnd: EndExclusive,
+		Height:   72,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTiles := []Tile{
+		{Start: 0, End: 4 * time.Second, CapturedAt: 0, X: 0, Y: 0, Width: 127, Height: 72},
+		{Start: 4 * time.Second, End: 8 * time.Second, CapturedAt: 4 * time.Second, X: 127, Y: 0, Width: 127, Height: 72},
+		{Start: 8 * time.Second, End: 10 * time.Second, CapturedAt: 8 * time.Second, X: 254, Y: 0, Width: 127, Height: 72},
+	}
+	if !reflect.DeepEqual(result.Tiles, expectedTiles) {
+		t.Errorf("wrong tiles\nwant %#v\ngot  %#v", expectedTiles, result.Tiles)
+	}
+}
+
+func TestGenSpriteWithMetadataExpires(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.cacheControl = map[int64]string{
+		0:    "max-age=3600",
+		2000: "public, max-age=60",
+		4000: "max-age=600",
+	}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	}
+
+	before := time.Now()
+	result, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Expires == nil {
+		t.Fatal("unexpected nil Expires")
+	}
+	if min, max := before.Add(time.Minute), time.Now().Add(time.Minute); result.Expires.Before(min) || result.Expires.After(max) {
+		t.Errorf("wrong Expires\nwant between %v and %v\ngot  %v", min, max, *result.Expires)
+	}
+
+	opts.Start = 6 * time.Second
+	opts.End = 8 * time.Second
+	result, err = generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Expires != nil {
+		t.Errorf("unexpected Expires: %v", *result.Expires)
+	}
+}
+
+func TestGenSpritePrime(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.delay = 50 * time.Millisecond
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+		Prime:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrency := packager.requestConcurrency()
+	if len(concurrency) != 10 {
+		t.Fatalf("wrong number of requests\nwant 10\ngot  %d", len(concurrency))
+	}
+	if concurrency[0] != 1 || concurrency[1] != 1 {
+		t.Errorf("the first thumbnail wasn't requested alone: %v", concurrency)
+	}
+}
+
+func TestGenSpriteWithMetadataFailedTiles(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{2000, 8000}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             18 * time.Second,
+		Interval:        2 * time.Second,
+		Height:          72,
+		ContinueOnError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tile := range result.Tiles {
+		expected := TileOK
+		if tile.Start == 2*time.Second || tile.Start == 8*time.Second {
+			expected = TileFailed
+		}
+		if tile.Status != expected {
+			t.Errorf("wrong status for tile at %v\nwant %v\ngot  %v", tile.Start, expected, tile.Status)
+		}
+	}
+}
+
+func TestGenSpritePlaceholder(t *testing.T) {
+	t.Parallel()
+	placeholder := image.NewRGBA(image.Rect(0, 0, 200, 72))
+	draw.Draw(placeholder, placeholder.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	tests := []struct {
+		name             string
+		failAtTimecode   []int64
+		omitFailedTiles  bool
+		expectedStatuses map[time.Duration]TileStatus
+		expectedBounds   image.Rectangle
+	}{
+		{
+			name:           "some failures",
+			failAtTimecode: []int64{2000, 8000},
+			expectedStatuses: map[time.Duration]TileStatus{
+				0:               TileOK,
+				2 * time.Second: TilePlaceholder,
+				4 * time.Second: TileOK,
+				6 * time.Second: TileOK,
+				8 * time.Second: TilePlaceholder,
+			},
+			expectedBounds: image.Rect(0, 0, 127, 360),
+		},
+		{
+			name:            "some failures - omitting failed tiles",
+			failAtTimecode:  []int64{2000, 8000},
+			omitFailedTiles: true,
+			expectedStatuses: map[time.Duration]TileStatus{
+				0:               TileOK,
+				4 * time.Second: TileOK,
+				6 * time.Second: TileOK,
+			},
+			expectedBounds: image.Rect(0, 0, 127, 360),
+		},
+		{
+			name:           "all failures",
+			failAtTimecode: []int64{0, 2000, 4000, 6000, 8000},
+			expectedStatuses: map[time.Duration]TileStatus{
+				0:               TilePlaceholder,
+				2 * time.Second: TilePlaceholder,
+				4 * time.Second: TilePlaceholder,
+				6 * time.Second: TilePlaceholder,
+				8 * time.Second: TilePlaceholder,
+			},
+			expectedBounds: image.Rect(0, 0, 200, 360),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.failAtTimecode = test.failAtTimecode
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:             8 * time.Second,
+				Interval:        2 * time.Second,
+				Width:           200,
+				Height:          72,
+				ScalingMode:     ScaleFitHeight,
+				JPEGQuality:     100,
+				ContinueOnError: true,
+				Placeholder:     placeholder,
+				OmitFailedTiles: test.omitFailedTiles,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+			if err != nil {
+				t.Fatalf("GenSpriteWithMetadata didn't generate a valid jpeg: %v", err)
+			}
+			if sprite.Bounds() != test.expectedBounds {
+				t.Errorf("image bounds don't match\nwant %v\ngot  %v", test.expectedBounds, sprite.Bounds())
+			}
+			if len(result.Tiles) != len(test.expectedStatuses) {
+				t.Fatalf("wrong number of tiles\nwant %d\ngot  %d", len(test.expectedStatuses), len(result.Tiles))
+			}
+			for _, tile := range result.Tiles {
+				if expected := test.expectedStatuses[tile.Start]; tile.Status != expected {
+					t.Errorf("wrong status for tile at %v\nwant %v\ngot  %v", tile.Start, expected, tile.Status)
+				}
+				if tile.Status == TilePlaceholder {
+					r, g, b, _ := sprite.At(tile.X+tile.Width/2, tile.Y+tile.Height/2).RGBA()
+					if r < 0xf000 || g > 0x1000 || b > 0x1000 {
+						t.Errorf("placeholder wasn't drawn in tile at %v", tile.Start)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenSpriteNoThumbnails(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{0, 2000}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             2 * time.Second,
+		Interval:        2 * time.Second,
+		Height:          72,
+		ContinueOnError: true,
+	})
+	if !errors.Is(err, ErrNoThumbnails) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrNoThumbnails, err)
+	}
+}
+
+func TestGenSpriteGranularity(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4, Granularity: 2 * time.Second}
+	tests := []struct {
+		name     string
+		opts     GenSpriteOptions
+		expected error
+	}{
+		{
+			"interval matching the granularity",
+			GenSpriteOptions{End: 4 * time.Second, Interval: 2 * time.Second},
+			nil,
+		},
+		{
+			"interval finer than the granularity",
+			GenSpriteOptions{End: 4 * time.Second, Interval: time.Second},
+			ErrIntervalTooFine,
+		},
+		{
+			"finer interval step",
+			GenSpriteOptions{
+				End:       8 * time.Second,
+				Intervals: []IntervalStep{{Until: 2 * time.Second, Interval: time.Second}},
+				Interval:  2 * time.Second,
+			},
+			ErrIntervalTooFine,
+		},
+		{
+			"single thumbnail",
+			GenSpriteOptions{Start: 2 * time.Second, End: 2 * time.Second},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.opts
+			opts.VideoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+			opts.Height = 72
+			_, err := generator.GenSprite(opts)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("wrong error returned\nwant %v\ngot  %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestGenSpriteTooManyTilesIntervalsIsFast(t *testing.T) {
+	t.Parallel()
+	var generator Generator
+	start := time.Now()
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:  "/video.mp4",
+		End:       2 * time.Hour,
+		Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+		Interval:  time.Microsecond,
+		Height:    72,
+	})
+	if !errors.Is(err, ErrTooManyTiles) {
+		t.Fatalf("wrong error returned\nwant %v\ngot  %v", ErrTooManyTiles, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejecting the sprite took too long: %v", elapsed)
+	}
+}
+
+func TestGenSpriteTooManyTiles(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	tests := []struct {
+		name          string
+		generatorMax  int
+		opts          GenSpriteOptions
+		expectedTiles int
+		expectedMax   int
+	}{
+		{
+			"default limit",
+			0,
+			GenSpriteOptions{End: 2 * time.Hour, Interval: time.Millisecond},
+			7200001,
+			DefaultMaxAllowedTiles,
+		},
+		{
+			"non-uniform intervals",
+			0,
+			GenSpriteOptions{
+				End:       2 * time.Hour,
+				Intervals: []IntervalStep{{Until: time.Minute, Interval: time.Second}},
+				Interval:  time.Microsecond,
+			},
+			7140000061,
+			DefaultMaxAllowedTiles,
+		},
+		{
+			"generator limit",
+			5,
+			GenSpriteOptions{End: 18 * time.Second, Interval: 2 * time.Second},
+			10,
+			5,
+		},
+		{
+			"per call limit",
+			100,
+			GenSpriteOptions{End: 18 * time.Second, Interval: 2 * time.Second, MaxAllowedTiles: 3},
+			10,
+			3,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4, MaxAllowedTiles: test.generatorMax}
+			opts := test.opts
+			opts.VideoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+			opts.Height = 72
+			_, err := generator.GenSprite(opts)
+			if !errors.Is(err, ErrTooManyTiles) {
+				t.Fatalf("wrong error returned\nwant %v\ngot  %v", ErrTooManyTiles, err)
+			}
+			var terr *TooManyTilesError
+			if !errors.As(err, &terr) {
+				t.Fatalf("expected %#v to be TooManyTilesError, but it wasn't", err)
+			}
+			if terr.Tiles != test.expectedTiles || terr.Max != test.expectedMax {
+				t.Errorf("wrong error details\nwant %d/%d\ngot  %d/%d", test.expectedTiles, test.expectedMax, terr.Tiles, terr.Max)
+			}
+		})
+	}
+	if n := atomic.LoadInt64(&packager.requests); n != 0 {
+		t.Errorf("unexpected requests to the packager: %d", n)
+	}
+
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4, MaxAllowedTiles: 5}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:             18 * time.Second,
+		Interval:        2 * time.Second,
+		Height:          72,
+		MaxAllowedTiles: -1,
+	})
+	if err != nil {
+		t.Errorf("unexpected error with the limit disabled: %v", err)
+	}
+}
+
+func TestGenSpriteMaxDecoders(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.delay = 20 * time.Millisecond
+	generator := Generator{Translator: packager.translate, MaxWorkers: 8, MaxDecoders: 1}
+	var inFlight, maxInFlight int64
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      18 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+		TileHook: func(_ time.Duration, img image.Image) (image.Image, error) {
+			if n := atomic.AddInt64(&inFlight, 1); n > atomic.LoadInt64(&maxInFlight) {
+				atomic.StoreInt64(&maxInFlight, n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+			return img, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("wrong number of concurrent decoders\nwant 1\ngot  %d", maxInFlight)
+	}
+	var maxRequests int64
+	for _, n := range packager.requestConcurrency() {
+		if n > maxRequests {
+			maxRequests = n
+		}
+	}
+	if maxRequests < 2 {
+		t.Errorf("requests weren't sent concurrently: %v", packager.requestConcurrency())
+	}
+}
+
+func TestGenSpritePostProcess(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         4 * time.Second,
+		Interval:    2 * time.Second,
+		Height:      72,
+		JPEGQuality: 100,
+		PostProcess: func(sprite draw.Image) error {
+			redacted := image.Rect(0, 0, 20, 20)
+			draw.Draw(sprite, redacted, image.NewUniform(color.Black), image.Point{}, draw.Src)
+			return nil
+		},
+	}
+	data, err := generator.GenSprite(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("GenSprite didn't generate a valid jpeg: %v", err)
+	}
+	if r, g, b, _ := sprite.At(10, 10).RGBA(); r > 0x1000 || g > 0x1000 || b > 0x1000 {
+		t.Errorf("PostProcess changes not present in the sprite: got color %v", sprite.At(10, 10))
+	}
+
+	postProcessErr := errors.New("something went wrong")
+	opts.PostProcess = func(draw.Image) error { return postProcessErr }
+	data, err = generator.GenSprite(opts)
+	if !errors.Is(err, postProcessErr) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", postProcessErr, err)
+	}
+	if data != nil {
+		t.Error("got unexpected non-nil data")
+	}
+}
+
+func TestGenSpriteTileHook(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+	opts := GenSpriteOptions{
+		VideoURL:    "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:         4 * time.Second,
+		Interval:    2 * time.Second,
+		Height:      72,
+		JPEGQuality: 100,
+		TileHook: func(timecode time.Duration, img image.Image) (image.Image, error) {
+			if timecode != 2*time.Second {
+				return img, nil
+			}
+			marked := image.NewRGBA(img.Bounds())
+			draw.Draw(marked, marked.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+			return marked, nil
+		},
+	}
+	result, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sprite, err := jpeg.Decode(bytes.NewReader(result.Sprite))
+	if err != nil {
+		t.Fatalf("GenSprite didn't generate a valid jpeg: %v", err)
+	}
+	for _, tile := range result.Tiles {
+		r, g, b, _ := sprite.At(tile.X+tile.Width/2, tile.Y+tile.Height/2).RGBA()
+		black := r < 0x1000 && g < 0x1000 && b < 0x1000
+		if expected := tile.Start == 2*time.Second; black != expected {
+			t.Errorf("wrong TileHook result for tile at %v\nwant black=%t\ngot  black=%t", tile.Start, expected, black)
+		}
+	}
+
+	hookErr := errors.New("something went wrong")
+	opts.TileHook = func(time.Duration, image.Image) (image.Image, error) { return nil, hookErr }
+	_, err = generator.GenSprite(opts)
+	if !errors.Is(err, hookErr) {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", hookErr, err)
+	}
+}
+
+func TestGenSpriteCaptureHeadersTrace(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	generator := Generator{
+		Translator:     packager.translate,
+		MaxWorkers:     4,
+		CaptureHeaders: []string{"x-served-by", "X-Cache"},
+	}
+	opts := GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	}
+	result, err := generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedHeader := http.Header{"X-Served-By": []string{"fake-packager"}}
+	for i, tile := range result.Tiles {
+		if tile.Trace == nil {
+			t.Errorf("missing trace for tile %d", i)
+			continue
+		}
+		if !reflect.DeepEqual(tile.Trace.Header, expectedHeader) {
+			t.Errorf("wrong headers for tile %d\nwant %#v\ngot  %#v", i, expectedHeader, tile.Trace.Header)
+		}
+		if tile.Trace.Duration <= 0 {
+			t.Errorf("wrong duration for tile %d: %v", i, tile.Trace.Duration)
+		}
+	}
+	data, err := json.Marshal(result.Tiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tile
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Trace == nil || !reflect.DeepEqual(decoded.Trace.Header, expectedHeader) || decoded.Trace.Duration.Round(time.Microsecond) != result.Tiles[0].Trace.Duration.Round(time.Microsecond) {
+		t.Errorf("wrong trace after decoding\nwant %#v\ngot  %#v", result.Tiles[0].Trace, decoded.Trace)
+	}
+
+	generator.CaptureHeaders = nil
+	result, err = generator.GenSpriteWithMetadata(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tile := range result.Tiles {
+		if tile.Trace != nil {
+			t.Errorf("unexpected trace for tile %d: %#v", i, tile.Trace)
+		}
+	}
+}
+
 func TestGenSpriteOptionsN(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -316,12 +1164,93 @@ func TestGenSpriteOptionsN(t *testing.T) {
 			},
 			9,
 		},
+		{
+			"0 to 18, every 2 seconds, end exclusive",
+			GenSpriteOptions{
+				Interval: 2 * time.Second,
+				End:      18 * time.Second,
+				RangeEnd: EndExclusive,
+			},
+			9,
+		},
+		{
+			"0 to 19, every 2 seconds, end exclusive",
+			GenSpriteOptions{
+				Interval: 2 * time.Second,
+				End:      19 * time.Second,
+				RangeEnd: EndExclusive,
+			},
+			10,
+		},
+		{
+			"start equals end, no interval",
+			GenSpriteOptions{
+				Start: 4 * time.Second,
+				End:   4 * time.Second,
+			},
+			1,
+		},
+		{
+			"start equals end, end exclusive",
+			GenSpriteOptions{
+				Start:    4 * time.Second,
+				End:      4 * time.Second,
+				RangeEnd: EndExclusive,
+			},
+			0,
+		},
+		{
+			"invalid range",
+			GenSpriteOptions{
+				Start:    4 * time.Second,
+				End:      2 * time.Second,
+				Interval: time.Second,
+			},
+			0,
+		},
+		{
+			"non-uniform intervals",
+			GenSpriteOptions{
+				Intervals: []IntervalStep{
+					{Until: 4 * time.Second, Interval: time.Second},
+					{Until: 10 * time.Second, Interval: 2 * time.Second},
+				},
+				Interval: 4 * time.Second,
+				End:      18 * time.Second,
+			},
+			10,
+		},
+		{
+			"non-uniform intervals, exclusive end",
+			GenSpriteOptions{
+				Intervals: []IntervalStep{
+					{Until: 4 * time.Second, Interval: time.Second},
+					{Until: 10 * time.Second, Interval: 2 * time.Second},
+				},
+				Interval: 4 * time.Second,
+				End:      18 * time.Second,
+				RangeEnd: EndExclusive,
+			},
+			9,
+		},
+		{
+			"non-uniform intervals past the end",
+			GenSpriteOptions{
+				Intervals: []IntervalStep{
+					{Until: 3 * time.Second, Interval: 2 * time.Second},
+					{Until: time.Minute, Interval: 3 * time.Second},
+				},
+				Start: time.Second,
+				End:   11 * time.Second,
+			},
+			4,
+		},
 	}
 	for _, test := range tests {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
-			n := test.input.n()
+			n := test.input.N()
 			if n != test.expected {
 				t.Errorf("wrong value\nwant %d\ngot  %d", test.expected, n)
 			}
@@ -352,11 +1281,6 @@ func imageDiff(img1, img2 image.Image) int64 {
 	return int64(math.Sqrt(float64(accumError)))
 }
 
-func sqDiff(x, y uint32) int64 {
-	d := int64(x) - int64(y)
-	return d * d
-}
-
 // loadSpriteFromDisk returns the image or an error if the file doesn't exist
 // or isn't a JPEG.
 func loadSpriteFromDisk(file string) (image.Image, error) {
@@ -367,3 +1291,77 @@ func loadSpriteFromDisk(file string) (image.Image, error) {
 	defer f.Close()
 	return jpeg.Decode(f)
 }
+
+type fakeLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *fakeLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func (l *fakeLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
+
+func TestGeneratorNWorkers(t *testing.T) {
+	t.Parallel()
+	auto := autoWorkersPerCPU * runtime.GOMAXPROCS(0)
+	tests := []struct {
+		name       string
+		maxWorkers uint
+		n          int
+		expected   int
+	}{
+		{"below the limit", 8, 6, 4},
+		{"above the limit", 8, 100, 8},
+		{"auto - few thumbnails", 0, 2, 2},
+		{"auto - many thumbnails", 0, 10000, auto},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			g := Generator{MaxWorkers: test.maxWorkers}
+			if n := g.nworkers(test.n); n != test.expected {
+				t.Errorf("wrong number of workers\nwant %d\ngot  %d", test.expected, n)
+			}
+		})
+	}
+}
+
+func TestEnumStrings(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		value    fmt.Stringer
+		expected string
+	}{
+		{ScaleLetterboxWidth, "letterbox-width"},
+		{ScalingMode(42), "ScalingMode(42)"},
+		{FetchStrided, "strided"},
+		{FetchOrder(42), "FetchOrder(42)"},
+		{FillRightToLeft, "right-to-left"},
+		{RoundNearest, "nearest"},
+		{CompositeOver, "over"},
+		{OrientationRotate90, "rotate-90"},
+		{EndExclusive, "exclusive"},
+		{RangeEnd(42), "RangeEnd(42)"},
+		{PNG, "png"},
+		{AlignEnd, "end"},
+		{Alignment(42), "Alignment(42)"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.expected, func(t *testing.T) {
+			t.Parallel()
+			if got := test.value.String(); got != test.expected {
+				t.Errorf("wrong name\nwant %q\ngot  %q", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stage identifies the stage of a generation that failed.
+type Stage int
+
+const (
+	// StageValidation indicates that the options are invalid.
+	StageValidation Stage = iota
+
+	// StageResolve indicates a failure resolving the video: translating
+	// its URL, or looking up its duration or keyframes.
+	StageResolve
+
+	// StageFetch indicates a failure fetching (or processing) the
+	// thumbnail at GenerationError.Timecode.
+	StageFetch
+
+	// StageDraw indicates a failure assembling the sprite after the
+	// thumbnails were fetched, e.g. ErrNoThumbnails.
+	StageDraw
+
+	// StageEncode indicates a failure post-processing or encoding the
+	// sprite.
+	StageEncode
+
+	// StageCanceled indicates that the context of the caller was canceled
+	// (or its deadline exceeded) before the generation finished.
+	StageCanceled
+
+	// StagePanic indicates that the generation with the same
+	// GenSpriteOptions.JobKey panicked (see ErrJobPanicked).
+	StagePanic
+)
+
+var stageNames = map[Stage]string{
+	StageValidation: "validation",
+	StageResolve:    "resolve",
+	StageFetch:      "fetch",
+	StageDraw:       "draw",
+	StageEncode:     "encode",
+	StageCanceled:   "canceled",
+	StagePanic:      "panic",
+}
+
+// String returns the name of the stage.
+func (s Stage) String() string {
+	if name, ok := stageNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+// GenerationError is the error returned when a generation aborts, describing
+// the stage that failed. It wraps the underlying error, so callers can still
+// match it with errors.Is and errors.As (e.g. against ErrInvalidInterval or
+// *VideoPackagerError).
+//
+// GenSprite, GenSpriteWithMetadata, GenPoster and GenPosters return all their
+// errors as a *GenerationError. Failures fetching thumbnails are reported
+// this way by all methods of Generator.
+type GenerationError struct {
+	Stage Stage
+
+	// Timecode is the timecode of the thumbnail that failed to be
+	// fetched. It's only meaningful in StageFetch.
+	Timecode time.Duration
+
+	// URL is the URL of the image that failed to be fetched by
+	// FetchImages, which has no timecodes. It's empty otherwise.
+	URL string
+
+	Err error
+}
+
+// Error returns the string representation of GenerationError.
+func (err *GenerationError) Error() string {
+	if err.Stage == StageFetch && err.URL != "" {
+		return fmt.Sprintf("%s %s: %v", err.Stage, err.URL, err.Err)
+	}
+	if err.Stage == StageFetch {
+		return fmt.Sprintf("%s at %v: %v", err.Stage, err.Timecode, err.Err)
+	}
+	return fmt.Sprintf("%s: %v", err.Stage, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err *GenerationError) Unwrap() error {
+	return err.Err
+}
+
+// fetchError wraps an error fetching the thumbnail described by the given
+// input.
+func fetchError(input workerInput, err error) error {
+	return &GenerationError{Stage: StageFetch, Timecode: input.timecode, Err: err}
+}
+
+// wrapStage wraps the given error in a GenerationError for the given stage,
+// unless it already is one. Errors caused by the cancellation of the given
+// context are attributed to StageCanceled instead.
+func wrapStage(ctx context.Context, stage Stage, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return &GenerationError{Stage: StageCanceled, Err: ctxErr}
+	}
+	var genErr *GenerationError
+	if errors.As(err, &genErr) {
+		return err
+	}
+	return &GenerationError{Stage: stage, Err: err}
+}
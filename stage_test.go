@@ -0,0 +1,148 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteGenerationError(t *testing.T) {
+	t.Parallel()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	translatorErr := errors.New("unknown video")
+	postProcessErr := errors.New("overlay failed")
+	var tests = []struct {
+		name             string
+		translatorErr    error
+		failAtTimecode   []int64
+		opts             GenSpriteOptions
+		expectedStage    Stage
+		expectedTimecode time.Duration
+		expectedErr      error
+	}{
+		{
+			name:          "validation",
+			opts:          GenSpriteOptions{End: 4 * time.Second},
+			expectedStage: StageValidation,
+			expectedErr:   ErrInvalidInterval,
+		},
+		{
+			name:          "resolve",
+			translatorErr: translatorErr,
+			opts:          GenSpriteOptions{End: 4 * time.Second, Interval: 2 * time.Second},
+			expectedStage: StageResolve,
+			expectedErr:   translatorErr,
+		},
+		{
+			name:             "fetch",
+			failAtTimecode:   []int64{4000},
+			opts:             GenSpriteOptions{End: 8 * time.Second, Interval: 2 * time.Second},
+			expectedStage:    StageFetch,
+			expectedTimecode: 4 * time.Second,
+		},
+		{
+			name:          "canceled",
+			opts:          GenSpriteOptions{Context: canceled, End: 8 * time.Second, Interval: 2 * time.Second},
+			expectedStage: StageCanceled,
+			expectedErr:   context.Canceled,
+		},
+		{
+			name: "encode",
+			opts: GenSpriteOptions{
+				End:         8 * time.Second,
+				Interval:    2 * time.Second,
+				PostProcess: func(draw.Image) error { return postProcessErr },
+			},
+			expectedStage: StageEncode,
+			expectedErr:   postProcessErr,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.failAtTimecode = test.failAtTimecode
+			generator := Generator{
+				Translator: func(videoURL string) (string, error) {
+					if test.translatorErr != nil {
+						return "", test.translatorErr
+					}
+					return packager.translate(videoURL)
+				},
+				MaxWorkers: 1,
+			}
+			opts := test.opts
+			opts.VideoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+			opts.Height = 72
+			_, err := generator.GenSprite(opts)
+			var genErr *GenerationError
+			if !errors.As(err, &genErr) {
+				t.Fatalf("wrong error\nwant *GenerationError\ngot  %#v", err)
+			}
+			if genErr.Stage != test.expectedStage {
+				t.Errorf("wrong stage\nwant %v\ngot  %v", test.expectedStage, genErr.Stage)
+			}
+			if genErr.Timecode != test.expectedTimecode {
+				t.Errorf("wrong timecode\nwant %v\ngot  %v", test.expectedTimecode, genErr.Timecode)
+			}
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Errorf("wrong underlying error\nwant %v\ngot  %v", test.expectedErr, genErr.Err)
+			}
+		})
+	}
+}
+
+func TestGenSpriteGenerationErrorPackagerFailure(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	packager.failAtTimecode = []int64{6000}
+	generator := Generator{Translator: packager.translate, MaxWorkers: 1}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      8 * time.Second,
+		Interval: 2 * time.Second,
+		Height:   72,
+	})
+	var pkgErr *VideoPackagerError
+	if !errors.As(err, &pkgErr) {
+		t.Fatalf("wrong error\nwant *VideoPackagerError\ngot  %#v", err)
+	}
+	const expected = "fetch at 6s: invalid response from video-packager: 500 - something went wrong\n"
+	if err.Error() != expected {
+		t.Errorf("wrong message\nwant %q\ngot  %q", expected, err.Error())
+	}
+}
+
+func TestGenerationErrorMessage(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		err      *GenerationError
+		expected string
+	}{
+		{&GenerationError{Stage: StageValidation, Err: ErrInvalidInterval}, "validation: invalid interval: must be positive"},
+		{&GenerationError{Stage: StageCanceled, Err: context.DeadlineExceeded}, "canceled: context deadline exceeded"},
+		{&GenerationError{Stage: StageFetch, Timecode: 1500 * time.Millisecond, Err: errors.New("boom")}, "fetch at 1.5s: boom"},
+		{&GenerationError{Stage: StageFetch, URL: "http://cdn/img.jpg", Err: errors.New("boom")}, "fetch http://cdn/img.jpg: boom"},
+		{&GenerationError{Stage: StagePanic, Err: ErrJobPanicked}, "panic: the generation with the same job key panicked"},
+		{&GenerationError{Stage: Stage(42), Err: errors.New("boom")}, "Stage(42): boom"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.expected, func(t *testing.T) {
+			t.Parallel()
+			if msg := test.err.Error(); msg != test.expected {
+				t.Errorf("wrong message\nwant %q\ngot  %q", test.expected, msg)
+			}
+		})
+	}
+}
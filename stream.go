@@ -0,0 +1,57 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"image"
+	"io"
+)
+
+// ErrStreamingSheets is returned by GenSpriteTo when SheetRows or
+// MaxSheetHeight is set, as a sprite split into multiple sheets can't be
+// written to a single writer.
+var ErrStreamingSheets = errors.New("sprites split into sheets can't be streamed")
+
+// GenSpriteTo generates the sprite for the given video, using the specified
+// options, and writes it to the given writer as it's encoded, instead of
+// buffering it in memory, returning the metadata describing it. Sprite is nil
+// in the returned result.
+//
+// The sprite may be partially written when encoding fails. JobKey is ignored,
+// as the sprite can't be shared with other calls.
+func (g *Generator) GenSpriteTo(opts GenSpriteOptions, w io.Writer) (*GenSpriteResult, error) {
+	return g.genSprite(opts, w)
+}
+
+// encodeSheet encodes the given sheet to the given writer or, when it's nil,
+// to a buffer whose contents are returned. When checksum is set, it also
+// returns the SHA-256 of the encoded sheet.
+func (g *Generator) encodeSheet(opts *GenSpriteOptions, sheet image.Image, w io.Writer, checksum bool) (data, sum []byte, err error) {
+	var buf bytes.Buffer
+	dst := w
+	if dst == nil {
+		dst = &buf
+	}
+	var h hash.Hash
+	if checksum {
+		h = sha256.New()
+		dst = io.MultiWriter(dst, h)
+	}
+	if data, ok := opts.lossless.assemble(sheet.Bounds().Size()); ok {
+		if _, err := dst.Write(data); err != nil {
+			return nil, nil, err
+		}
+	} else if err := opts.OutputFormat.encode(dst, sheet, opts.JPEGQuality, g.AVIFEncoder); err != nil {
+		return nil, nil, err
+	}
+	if h != nil {
+		sum = h.Sum(nil)
+	}
+	return buf.Bytes(), sum, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteTo(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name   string
+		format OutputFormat
+	}{
+		{"jpeg", JPEG},
+		{"png", PNG},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := startSourcePackager(image.Pt(160, 90))
+			defer server.Close()
+			generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+			opts := GenSpriteOptions{
+				VideoURL:     "/video.mp4",
+				End:          6 * time.Second,
+				Interval:     2 * time.Second,
+				Width:        160,
+				Height:       90,
+				OutputFormat: test.format,
+			}
+			expected, err := generator.GenSpriteWithMetadata(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			result, err := generator.GenSpriteTo(opts, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), expected.Sprite) {
+				t.Error("streamed sprite doesn't match the buffered one")
+			}
+			if result.Sprite != nil {
+				t.Errorf("unexpected sprite in the result: %d bytes", len(result.Sprite))
+			}
+			if result.Width != expected.Width || result.Height != expected.Height || len(result.Tiles) != len(expected.Tiles) {
+				t.Errorf("wrong metadata\nwant %dx%d (%d tiles)\ngot  %dx%d (%d tiles)",
+					expected.Width, expected.Height, len(expected.Tiles),
+					result.Width, result.Height, len(result.Tiles))
+			}
+		})
+	}
+}
+
+func TestGenSpriteToSheets(t *testing.T) {
+	t.Parallel()
+	server := startSourcePackager(image.Pt(160, 90))
+	defer server.Close()
+	generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+	var buf bytes.Buffer
+	_, err := generator.GenSpriteTo(GenSpriteOptions{
+		VideoURL:  "/video.mp4",
+		End:       6 * time.Second,
+		Interval:  2 * time.Second,
+		Width:     160,
+		Height:    90,
+		Columns:   1,
+		SheetRows: 2,
+	}, &buf)
+	if !errors.Is(err, ErrStreamingSheets) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrStreamingSheets, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected data written: %d bytes", buf.Len())
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrThumbTooLarge is returned (wrapped in a ThumbTooLargeError) when a
+// thumbnail exceeds Generator.MaxThumbBytes.
+var ErrThumbTooLarge = errors.New("thumbnail too large")
+
+// ThumbTooLargeError is returned when the response of the video-packager for
+// a thumbnail exceeds Generator.MaxThumbBytes. The download is aborted as
+// soon as the size is known to exceed the limit.
+type ThumbTooLargeError struct {
+	URL string
+
+	// Size is the Content-Length of the response or, when it isn't
+	// declared, the number of bytes read before the download was
+	// aborted.
+	Size int64
+	Max  int64
+}
+
+// Error returns the string representation of ThumbTooLargeError.
+func (err *ThumbTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %s has %d bytes, at most %d allowed", ErrThumbTooLarge, err.URL, err.Size, err.Max)
+}
+
+// Is reports whether target is ErrThumbTooLarge.
+func (err *ThumbTooLargeError) Is(target error) bool {
+	return target == ErrThumbTooLarge
+}
+
+// readBody reads the body of the given response, aborting the download as
+// soon as it exceeds the maximum size of thumbnails. Responses declaring a
+// larger Content-Length aren't read at all.
+func (w *worker) readBody(resp *http.Response) ([]byte, error) {
+	if w.maxThumbBytes <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	tooLarge := func(size int64) error {
+		return &ThumbTooLargeError{URL: resp.Request.URL.String(), Size: size, Max: w.maxThumbBytes}
+	}
+	if resp.ContentLength > w.maxThumbBytes {
+		return nil, tooLarge(resp.ContentLength)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, w.maxThumbBytes+1))
+	if int64(len(data)) > w.maxThumbBytes {
+		return nil, tooLarge(int64(len(data)))
+	}
+	return data, err
+}
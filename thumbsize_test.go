@@ -0,0 +1,80 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteMaxThumbBytes(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 160, 90)), nil)
+	thumb := buf.Bytes()
+	size := int64(len(thumb))
+	var tests = []struct {
+		name          string
+		max           int64
+		contentLength bool
+		expected      *ThumbTooLargeError
+	}{
+		{"no limit", 0, true, nil},
+		{"within the limit", size, true, nil},
+		{"declared size over the limit", size - 1, true, &ThumbTooLargeError{Size: size, Max: size - 1}},
+		{"undeclared size over the limit", size / 2, false, &ThumbTooLargeError{Size: size/2 + 1, Max: size / 2}},
+		{"undeclared size within the limit", size, false, nil},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(thumb)))
+				} else {
+					// flushing before writing the body makes the
+					// response chunked, without Content-Length.
+					w.WriteHeader(http.StatusOK)
+					w.(http.Flusher).Flush()
+				}
+				w.Write(thumb)
+			}))
+			defer server.Close()
+			generator := Generator{
+				Translator:    func(string) (string, error) { return server.URL, nil },
+				MaxThumbBytes: test.max,
+			}
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL: "/video.mp4",
+				End:      2 * time.Second,
+				Interval: 2 * time.Second,
+			})
+			if test.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var tooLarge *ThumbTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("wrong error\nwant %v\ngot  %v", test.expected, err)
+			}
+			if tooLarge.Size != test.expected.Size || tooLarge.Max != test.expected.Max {
+				t.Errorf("wrong sizes\nwant %d (max %d)\ngot  %d (max %d)", test.expected.Size, test.expected.Max, tooLarge.Size, tooLarge.Max)
+			}
+			if !errors.Is(err, ErrThumbTooLarge) {
+				t.Errorf("error %v should match ErrThumbTooLarge", err)
+			}
+		})
+	}
+}
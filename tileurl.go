@@ -0,0 +1,57 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import "net/url"
+
+// redactedValue replaces the values redacted by RedactQuery.
+const redactedValue = "REDACTED"
+
+// RedactQuery returns a function, suitable for GenSpriteOptions.RedactURL,
+// that replaces the values of the given query string parameters (or of all
+// parameters, when none is given) and the password of the URL with
+// "REDACTED", so signed URLs can be logged or shared without leaking
+// credentials.
+func RedactQuery(params ...string) func(string) string {
+	return func(rawURL string) string {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return redactedValue
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		}
+		query := u.Query()
+		if len(query) == 0 {
+			return u.String()
+		}
+		if len(params) == 0 {
+			for name := range query {
+				query.Set(name, redactedValue)
+			}
+		}
+		for _, name := range params {
+			if _, ok := query[name]; ok {
+				query.Set(name, redactedValue)
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+}
+
+// tileURL returns the URL of the request sent for the thumbnail in the given
+// output, as recorded in the metadata when TileURLs is set. When no request
+// was sent, it's the video-packager URL of the thumbnail.
+func (o *GenSpriteOptions) tileURL(output workerOutput) string {
+	u := output.url
+	if u == "" {
+		u = output.input.url()
+	}
+	if o.RedactURL != nil {
+		u = o.RedactURL(u)
+	}
+	return u
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+// Corner identifies the corner of each thumbnail where its timestamp is
+// rendered.
+type Corner int
+
+const (
+	// CornerBottomRight is the default corner.
+	CornerBottomRight Corner = iota
+	CornerBottomLeft
+	CornerTopLeft
+	CornerTopRight
+)
+
+var cornerNames = map[Corner]string{
+	CornerBottomRight: "bottom-right",
+	CornerBottomLeft:  "bottom-left",
+	CornerTopLeft:     "top-left",
+	CornerTopRight:    "top-right",
+}
+
+// String returns the name of the corner.
+func (c Corner) String() string {
+	if name, ok := cornerNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Corner(%d)", int(c))
+}
+
+// valid reports whether the corner is known.
+func (c Corner) valid() bool {
+	_, ok := cornerNames[c]
+	return ok
+}
+
+// ErrInvalidTimestampOverlay is returned when the position of the timestamp
+// overlay is unknown or its scale is negative.
+var ErrInvalidTimestampOverlay = errors.New("invalid timestamp overlay: unknown position or negative scale")
+
+// TimestampOverlay configures the timecode (e.g. "01:23:45") rendered onto
+// each thumbnail, so sprites can be spot-checked without a separate pass.
+// Timecodes with a fraction of a second are rendered with milliseconds
+// (e.g. "01:23:45.500").
+type TimestampOverlay struct {
+	// Position is the corner of the thumbnail where the timestamp is
+	// rendered. The default is CornerBottomRight.
+	Position Corner
+
+	// Scale is the size, in pixels, of each dot of the built-in 5x7
+	// font, so characters are 7*Scale pixels tall. The default is 2.
+	Scale int
+
+	// Color is the color of the text. The default is white.
+	Color color.Color
+
+	// Background is the color of the box behind the text. The default is
+	// translucent black.
+	Background color.Color
+}
+
+const defaultTimestampScale = 2
+
+var (
+	defaultTimestampColor      = color.White
+	defaultTimestampBackground = color.NRGBA{A: 160}
+)
+
+func (o *TimestampOverlay) validate() error {
+	if !o.Position.valid() || o.Scale < 0 {
+		return ErrInvalidTimestampOverlay
+	}
+	return nil
+}
+
+// render returns a copy of the given thumbnail with the given timecode
+// rendered onto it.
+func (o *TimestampOverlay) render(img image.Image, timecode time.Duration) *image.RGBA {
+	scale := o.Scale
+	if scale == 0 {
+		scale = defaultTimestampScale
+	}
+	fg, bg := o.Color, o.Background
+	if fg == nil {
+		fg = defaultTimestampColor
+	}
+	if bg == nil {
+		bg = defaultTimestampBackground
+	}
+
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	text := timestampText(timecode)
+	// the box has a margin of one dot around the text, and is placed one
+	// dot away from the edges of the thumbnail.
+	box := image.Rect(0, 0, (len(text)*(glyphWidth+1)+1)*scale, (glyphHeight+2)*scale)
+	switch o.Position {
+	case CornerBottomRight:
+		box = box.Add(image.Pt(dst.Rect.Dx()-box.Dx()-scale, dst.Rect.Dy()-box.Dy()-scale))
+	case CornerBottomLeft:
+		box = box.Add(image.Pt(scale, dst.Rect.Dy()-box.Dy()-scale))
+	case CornerTopLeft:
+		box = box.Add(image.Pt(scale, scale))
+	case CornerTopRight:
+		box = box.Add(image.Pt(dst.Rect.Dx()-box.Dx()-scale, scale))
+	}
+	draw.Draw(dst, box, image.NewUniform(bg), image.Point{}, draw.Over)
+
+	src := image.NewUniform(fg)
+	origin := box.Min.Add(image.Pt(scale, scale))
+	for i, r := range text {
+		glyph := glyphs[r]
+		for y, row := range glyph {
+			for x := 0; x < glyphWidth; x++ {
+				if row&(1<<uint(glyphWidth-1-x)) == 0 {
+					continue
+				}
+				dot := image.Rect(0, 0, scale, scale).Add(origin).Add(image.Pt((i*(glyphWidth+1)+x)*scale, y*scale))
+				draw.Draw(dst, dot, src, image.Point{}, draw.Over)
+			}
+		}
+	}
+	return dst
+}
+
+// timestampText formats the given timecode as HH:MM:SS, adding milliseconds
+// when it isn't a whole second.
+func timestampText(d time.Duration) string {
+	millis := int64(d / time.Millisecond)
+	text := fmt.Sprintf("%02d:%02d:%02d", millis/3600000, millis/60000%60, millis/1000%60)
+	if millis%1000 != 0 {
+		text += fmt.Sprintf(".%03d", millis%1000)
+	}
+	return text
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs is a 5x7 bitmap font with the characters used in timestamps. Each
+// row is a bit mask, with the most significant of the 5 bits on the left.
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestTimestampText(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		timecode time.Duration
+		expected string
+	}{
+		{0, "00:00:00"},
+		{time.Hour + 23*time.Minute + 45*time.Second, "01:23:45"},
+		{2500 * time.Millisecond, "00:00:02.500"},
+		{26 * time.Hour, "26:00:00"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.expected, func(t *testing.T) {
+			t.Parallel()
+			if got := timestampText(test.timecode); got != test.expected {
+				t.Errorf("wrong timestamp\nwant %q\ngot  %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestTimestampOverlayRender(t *testing.T) {
+	t.Parallel()
+	// "00:00:02" is 8 characters, so the box is 8*6+1 dots wide and 9 dots
+	// tall, one dot away from the edges of the 100x50 thumbnail.
+	var tests = []struct {
+		position Corner
+		box      image.Point
+	}{
+		{CornerBottomRight, image.Pt(50, 40)},
+		{CornerBottomLeft, image.Pt(1, 40)},
+		{CornerTopLeft, image.Pt(1, 1)},
+		{CornerTopRight, image.Pt(50, 1)},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.position.String(), func(t *testing.T) {
+			t.Parallel()
+			src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+			fill(src, color.Gray{Y: 128})
+			overlay := TimestampOverlay{Position: test.position, Scale: 1, Background: color.Black}
+			img := overlay.render(src, 2*time.Second)
+			if img.Bounds() != src.Bounds() {
+				t.Fatalf("wrong bounds\nwant %v\ngot  %v", src.Bounds(), img.Bounds())
+			}
+			if c := img.RGBAAt(test.box.X, test.box.Y); c != (color.RGBA{A: 255}) {
+				t.Errorf("expected the background of the box at %v, got %v", test.box, c)
+			}
+			// the top row of "0" has a dot right after its first column.
+			dot := test.box.Add(image.Pt(2, 1))
+			if c := img.RGBAAt(dot.X, dot.Y); c != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+				t.Errorf("expected text at %v, got %v", dot, c)
+			}
+			outside := test.box.Add(image.Pt(-1, -1))
+			if c := img.RGBAAt(outside.X, outside.Y); c != (color.RGBA{R: 128, G: 128, B: 128, A: 255}) {
+				t.Errorf("expected the thumbnail at %v, got %v", outside, c)
+			}
+			if c := src.RGBAAt(test.box.X, test.box.Y); c != (color.RGBA{R: 128, G: 128, B: 128, A: 255}) {
+				t.Errorf("the source thumbnail was modified: %v", c)
+			}
+		})
+	}
+}
+
+func TestGenSpriteTimestamps(t *testing.T) {
+	t.Parallel()
+	server := startSourcePackager(image.Pt(160, 90))
+	defer server.Close()
+	generator := Generator{
+		Translator: func(string) (string, error) { return server.URL, nil },
+	}
+	data, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL:     "/video.mp4",
+		Start:        2 * time.Second,
+		End:          2 * time.Second,
+		Height:       90,
+		OutputFormat: PNG,
+		Timestamps:   &TimestampOverlay{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with the default scale, the box is 98x18 pixels, two pixels away
+	// from the bottom right corner, and the top row of the last "2" has a
+	// dot after its first column.
+	var tests = []struct {
+		name     string
+		point    image.Point
+		expected func(uint8) bool
+	}{
+		{"thumbnail", image.Pt(2, 2), func(y uint8) bool { return y > 100 }},
+		{"box", image.Pt(61, 71), func(y uint8) bool { return y < 100 }},
+		{"text", image.Pt(148, 72), func(y uint8) bool { return y > 200 }},
+	}
+	for _, test := range tests {
+		if y := luminance(img, test.point); !test.expected(y) {
+			t.Errorf("wrong luminance for the %s at %v: %d", test.name, test.point, y)
+		}
+	}
+}
+
+func TestGenSpriteInvalidTimestamps(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name    string
+		overlay TimestampOverlay
+	}{
+		{"unknown position", TimestampOverlay{Position: Corner(42)}},
+		{"negative scale", TimestampOverlay{Scale: -1}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var generator Generator
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL:   "/video.mp4",
+				Height:     90,
+				Timestamps: &test.overlay,
+			})
+			if !errors.Is(err, ErrInvalidTimestampOverlay) {
+				t.Errorf("wrong error\nwant %v\ngot  %v", ErrInvalidTimestampOverlay, err)
+			}
+		})
+	}
+}
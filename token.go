@@ -0,0 +1,113 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// AccessTokenFunc returns the access token required by the video-packager
+// for fetching the thumbnails of the given video (e.g. a short-lived
+// playback token of a DRM or clear-key protected asset). refresh is true
+// when the video-packager rejected the previous token with 401 or 403 (e.g.
+// because it expired in the middle of a long job), in which case a new
+// token must be issued, instead of a cached one.
+type AccessTokenFunc func(ctx context.Context, videoURL string, refresh bool) (string, error)
+
+// accessToken holds the access token of a single generation, shared by all
+// workers.
+type accessToken struct {
+	fn       AccessTokenFunc
+	videoURL string
+	header   string
+
+	mu    sync.Mutex
+	token string
+}
+
+// newAccessToken fetches the initial access token for the given video, or
+// returns nil when the Generator doesn't require tokens.
+func (g *Generator) newAccessToken(ctx context.Context, videoURL string) (*accessToken, error) {
+	if g.AccessToken == nil {
+		return nil, nil
+	}
+	token, err := g.AccessToken(ctx, videoURL, false)
+	if err != nil {
+		return nil, err
+	}
+	header := g.AccessTokenHeader
+	if header == "" {
+		header = "Authorization"
+	}
+	return &accessToken{fn: g.AccessToken, videoURL: videoURL, header: header, token: token}, nil
+}
+
+// apply attaches the current token to the given request, returning it.
+func (t *accessToken) apply(req *http.Request) string {
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+	value := token
+	if http.CanonicalHeaderKey(t.header) == "Authorization" {
+		value = "Bearer " + token
+	}
+	req.Header.Set(t.header, value)
+	return token
+}
+
+// refresh replaces the given token, rejected by the video-packager, with a
+// new one. Workers rejected with the same token share a single refresh.
+func (t *accessToken) refresh(ctx context.Context, rejected string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != rejected {
+		return nil
+	}
+	token, err := t.fn(ctx, t.videoURL, true)
+	if err != nil {
+		return err
+	}
+	t.token = token
+	return nil
+}
+
+// getWithAccessToken sends the request returned by newRequest, like
+// getWithRefetch, attaching the access token of the input to it. When the
+// video-packager rejects the token, it's refreshed and the request is sent
+// again, once.
+func (w *worker) getWithAccessToken(ctx context.Context, newRequest func() (*http.Request, error), input workerInput) (workerOutput, error) {
+	if input.token == nil {
+		return w.getWithRefetch(newRequest, input)
+	}
+	for refreshed := false; ; refreshed = true {
+		var token string
+		output, err := w.getWithRefetch(func() (*http.Request, error) {
+			req, err := newRequest()
+			if err == nil {
+				token = input.token.apply(req)
+			}
+			return req, err
+		}, input)
+		if refreshed || !unauthorized(output, err) {
+			return output, err
+		}
+		if err := input.token.refresh(ctx, token); err != nil {
+			return output, err
+		}
+	}
+}
+
+// unauthorized reports whether the video-packager rejected the access
+// token of a request.
+func unauthorized(output workerOutput, err error) bool {
+	pkgErr := output.failure
+	if pkgErr == nil && !errors.As(err, &pkgErr) {
+		return false
+	}
+	return pkgErr.StatusCode == http.StatusUnauthorized || pkgErr.StatusCode == http.StatusForbidden
+}
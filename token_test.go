@@ -0,0 +1,210 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteAccessToken(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name              string
+		header            string
+		expectedHeader    string
+		expectedValue     string
+		initialToken      string
+		expectedRefreshes int32
+	}{
+		{
+			"valid token",
+			"",
+			"Authorization",
+			"Bearer fresh",
+			"fresh",
+			0,
+		},
+		{
+			"expired token",
+			"",
+			"Authorization",
+			"Bearer fresh",
+			"expired",
+			1,
+		},
+		{
+			"custom header",
+			"X-Playback-Token",
+			"X-Playback-Token",
+			"fresh",
+			"expired",
+			1,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			source := startSourcePackager(image.Pt(160, 90))
+			defer source.Close()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(test.expectedHeader) != test.expectedValue {
+					http.Error(w, "invalid token", http.StatusUnauthorized)
+					return
+				}
+				source.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			var refreshes int32
+			generator := Generator{
+				Translator: func(string) (string, error) { return server.URL, nil },
+				MaxWorkers: 4,
+				AccessToken: func(ctx context.Context, videoURL string, refresh bool) (string, error) {
+					if videoURL != "/video.mp4" {
+						t.Errorf("wrong video url\nwant %q\ngot  %q", "/video.mp4", videoURL)
+					}
+					if refresh {
+						atomic.AddInt32(&refreshes, 1)
+						return "fresh", nil
+					}
+					return test.initialToken, nil
+				},
+				AccessTokenHeader: test.header,
+			}
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL: "/video.mp4",
+				End:      18 * time.Second,
+				Interval: 2 * time.Second,
+				Width:    160,
+				Height:   90,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshes != test.expectedRefreshes {
+				t.Errorf("wrong number of refreshes\nwant %d\ngot  %d", test.expectedRefreshes, refreshes)
+			}
+		})
+	}
+}
+
+func TestGenSpriteAccessTokenRejected(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	var calls int32
+	generator := Generator{
+		Translator: func(string) (string, error) { return server.URL, nil },
+		MaxWorkers: 1,
+		AccessToken: func(context.Context, string, bool) (string, error) {
+			return "token-" + strconv.Itoa(int(atomic.AddInt32(&calls, 1))), nil
+		},
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      2 * time.Second,
+		Interval: 2 * time.Second,
+	})
+	var pkgErr *VideoPackagerError
+	if !errors.As(err, &pkgErr) || pkgErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong error\nwant VideoPackagerError with status 401\ngot  %v", err)
+	}
+	// the initial token and a single refresh.
+	if calls != 2 {
+		t.Errorf("wrong number of calls to AccessToken\nwant 2\ngot  %d", calls)
+	}
+}
+
+func TestGenSpriteAccessTokenError(t *testing.T) {
+	t.Parallel()
+	errToken := errors.New("token service unavailable")
+	generator := Generator{
+		Translator: func(string) (string, error) { return "http://packager", nil },
+		AccessToken: func(context.Context, string, bool) (string, error) {
+			return "", errToken
+		},
+	}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video.mp4",
+		End:      2 * time.Second,
+		Interval: 2 * time.Second,
+	})
+	if !errors.Is(err, errToken) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", errToken, err)
+	}
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) || genErr.Stage != StageResolve {
+		t.Errorf("wrong stage\nwant %v\ngot  %v", StageResolve, err)
+	}
+}
+
+func TestGenSpriteAccessTokenExpiresMidJob(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name   string
+		status int
+	}{
+		{"unauthorized", http.StatusUnauthorized},
+		{"forbidden", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			source := startSourcePackager(image.Pt(160, 90))
+			defer source.Close()
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the first token expires after three requests.
+				valid := "Bearer token-2"
+				if atomic.AddInt32(&requests, 1) <= 3 {
+					valid = "Bearer token-1"
+				}
+				if r.Header.Get("Authorization") != valid {
+					http.Error(w, "token expired", test.status)
+					return
+				}
+				source.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			var calls int32
+			generator := Generator{
+				Translator: func(string) (string, error) { return server.URL, nil },
+				MaxWorkers: 4,
+				AccessToken: func(context.Context, string, bool) (string, error) {
+					return "token-" + strconv.Itoa(int(atomic.AddInt32(&calls, 1))), nil
+				},
+			}
+			result, err := generator.GenSpriteWithMetadata(GenSpriteOptions{
+				VideoURL: "/video.mp4",
+				End:      18 * time.Second,
+				Interval: 2 * time.Second,
+				Width:    160,
+				Height:   90,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.FailedTimecodes) > 0 {
+				t.Errorf("unexpected failed timecodes: %v", result.FailedTimecodes)
+			}
+			// the initial token and a single refresh, shared by all
+			// rejected requests.
+			if calls != 2 {
+				t.Errorf("wrong number of calls to AccessToken\nwant 2\ngot  %d", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoTracks is returned by GenSpriteTracks when no intervals are given.
+var ErrNoTracks = errors.New("no tracks requested: at least one interval is required")
+
+// GenSpriteTracks generates one sprite per given interval for the same video
+// (e.g. a coarse track every 10 seconds for fast scrubbing and a fine track
+// every second for slow scrubbing), using the given options for all of them.
+// It returns the result of each track in the order of the intervals, each
+// with its own sheets and metadata.
+//
+// Tracks are generated one after the other, sharing the thumbnails whose
+// timecodes coincide, which are downloaded only once. Decoded thumbnails are
+// kept in memory until all tracks are generated. Interval and Intervals in
+// the options are ignored, as is JobKey.
+func (g *Generator) GenSpriteTracks(opts GenSpriteOptions, intervals ...time.Duration) ([]*GenSpriteResult, error) {
+	if len(intervals) == 0 {
+		return nil, &GenerationError{Stage: StageValidation, Err: ErrNoTracks}
+	}
+	opts.shared = &sharedThumbnails{outputs: make(map[string]workerOutput)}
+	opts.Intervals = nil
+	results := make([]*GenSpriteResult, len(intervals))
+	for i, interval := range intervals {
+		opts.Interval = interval
+		result, err := g.genSprite(opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// sharedThumbnails holds the thumbnails fetched by the tracks of a single
+// call to GenSpriteTracks, keyed by URL.
+type sharedThumbnails struct {
+	mu      sync.Mutex
+	outputs map[string]workerOutput
+}
+
+// get returns the thumbnail previously fetched from the given URL, adjusted
+// to the given input.
+func (s *sharedThumbnails) get(url string, input workerInput) (workerOutput, bool) {
+	if s == nil {
+		return workerOutput{}, false
+	}
+	s.mu.Lock()
+	output, ok := s.outputs[url]
+	s.mu.Unlock()
+	output.input = input
+	return output, ok
+}
+
+func (s *sharedThumbnails) put(url string, output workerOutput) {
+	if s == nil || (output.img == nil && output.raw == nil) {
+		return
+	}
+	s.mu.Lock()
+	s.outputs[url] = output
+	s.mu.Unlock()
+}
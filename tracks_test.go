@@ -0,0 +1,103 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteTracks(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name             string
+		intervals        []time.Duration
+		expectedTiles    []int
+		expectedRequests int32
+	}{
+		{
+			"coarse and fine",
+			[]time.Duration{4 * time.Second, 2 * time.Second},
+			[]int{5, 9},
+			9,
+		},
+		{
+			"fine and coarse",
+			[]time.Duration{2 * time.Second, 4 * time.Second},
+			[]int{9, 5},
+			9,
+		},
+		{
+			"not coinciding",
+			[]time.Duration{4 * time.Second, 3 * time.Second},
+			[]int{5, 6},
+			9,
+		},
+		{
+			"single track",
+			[]time.Duration{8 * time.Second},
+			[]int{3},
+			3,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			source := startSourcePackager(image.Pt(160, 90))
+			defer source.Close()
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				source.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			generator := Generator{Translator: func(string) (string, error) { return server.URL, nil }}
+			results, err := generator.GenSpriteTracks(GenSpriteOptions{
+				VideoURL: "/video.mp4",
+				End:      16 * time.Second,
+				Width:    160,
+				Height:   90,
+				Columns:  3,
+			}, test.intervals...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(test.intervals) {
+				t.Fatalf("wrong number of tracks\nwant %d\ngot  %d", len(test.intervals), len(results))
+			}
+			for i, result := range results {
+				if len(result.Tiles) != test.expectedTiles[i] {
+					t.Errorf("wrong number of tiles in track %d\nwant %d\ngot  %d", i, test.expectedTiles[i], len(result.Tiles))
+				}
+				for j, tile := range result.Tiles {
+					if expected := time.Duration(j) * test.intervals[i]; tile.Start != expected {
+						t.Errorf("wrong start for tile %d of track %d\nwant %v\ngot  %v", j, i, expected, tile.Start)
+					}
+				}
+				if len(result.Sprite) == 0 {
+					t.Errorf("missing sprite for track %d", i)
+				}
+			}
+			if requests != test.expectedRequests {
+				t.Errorf("wrong number of requests\nwant %d\ngot  %d", test.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestGenSpriteTracksNoIntervals(t *testing.T) {
+	t.Parallel()
+	var generator Generator
+	_, err := generator.GenSpriteTracks(GenSpriteOptions{VideoURL: "/video.mp4"})
+	if !errors.Is(err, ErrNoTracks) {
+		t.Errorf("wrong error\nwant %v\ngot  %v", ErrNoTracks, err)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrUntranslatableURL is returned by the translators in this package when
+// the given URL can't be translated.
+var ErrUntranslatableURL = errors.New("untranslatable video url")
+
+// PathRewrite describes the rewrite of the path of a video URL into the path
+// of a thumb prefix URL. Pattern is matched against the path of the video
+// URL, and Replacement follows the rules of regexp.Regexp.ReplaceAllString,
+// so it can reference capture groups (e.g. `/thumb/$1`).
+type PathRewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// PathRewriteTranslator returns a VideoURLTranslator that rewrites the path
+// of video URLs using the first of the given rules whose pattern matches it,
+// prefixing the result with the given video-packager endpoint. URLs that
+// don't match any of the rules fail with ErrUntranslatableURL.
+//
+// For example, the following translator maps /videos/{path} into
+// http://packager/thumb/{path}:
+//
+//	PathRewriteTranslator("http://packager", PathRewrite{
+//		Pattern:     regexp.MustCompile(`^/videos/(.*)$`),
+//		Replacement: "/thumb/$1",
+//	})
+func PathRewriteTranslator(endpoint string, rules ...PathRewrite) VideoURLTranslator {
+	endpoint = strings.TrimRight(endpoint, "/")
+	return func(videoURL string) (string, error) {
+		vurl, err := url.Parse(videoURL)
+		if err != nil {
+			return "", err
+		}
+		for _, rule := range rules {
+			if rule.Pattern.MatchString(vurl.Path) {
+				return endpoint + rule.Pattern.ReplaceAllString(vurl.Path, rule.Replacement), nil
+			}
+		}
+		return "", ErrUntranslatableURL
+	}
+}
+
+// ChainTranslators returns a VideoURLTranslator that invokes the given
+// translators in order, passing the output of each of them as the input of
+// the next one. It can be used for composing a translator with additional
+// steps, such as host selection or URL signing:
+//
+//	ChainTranslators(
+//		PathRewriteTranslator("http://packager", rules...),
+//		RoundRobinHosts("packager1:8080", "packager2:8080"),
+//		signURL,
+//	)
+func ChainTranslators(translators ...VideoURLTranslator) VideoURLTranslator {
+	return func(videoURL string) (string, error) {
+		var err error
+		for _, translate := range translators {
+			videoURL, err = translate(videoURL)
+			if err != nil {
+				return "", err
+			}
+		}
+		return videoURL, nil
+	}
+}
+
+// FirstTranslator returns a VideoURLTranslator that tries each of the given
+// translators in order, returning the result of the first one that succeeds,
+// or the error of the last one when all of them fail.
+func FirstTranslator(translators ...VideoURLTranslator) VideoURLTranslator {
+	return func(videoURL string) (string, error) {
+		err := ErrUntranslatableURL
+		for _, translate := range translators {
+			var prefix string
+			if prefix, err = translate(videoURL); err == nil {
+				return prefix, nil
+			}
+		}
+		return "", err
+	}
+}
+
+// WithContext adapts the translator into a ContextVideoURLTranslator that
+// ignores the context, so it can be combined with context-aware translators
+// (e.g. MappingTranslator.Translate) by ChainContextTranslators and
+// FirstContextTranslator.
+func (t VideoURLTranslator) WithContext() ContextVideoURLTranslator {
+	return func(_ context.Context, videoURL string) (string, error) {
+		return t(videoURL)
+	}
+}
+
+// ChainContextTranslators is like ChainTranslators, but combines
+// ContextVideoURLTranslators, passing the context of the sprite generation to
+// each of them:
+//
+//	generator.ContextTranslator = ChainContextTranslators(
+//		mapping.Translate,
+//		RoundRobinHosts("packager1:8080", "packager2:8080").WithContext(),
+//	)
+func ChainContextTranslators(translators ...ContextVideoURLTranslator) ContextVideoURLTranslator {
+	return func(ctx context.Context, videoURL string) (string, error) {
+		var err error
+		for _, translate := range translators {
+			videoURL, err = translate(ctx, videoURL)
+			if err != nil {
+				return "", err
+			}
+		}
+		return videoURL, nil
+	}
+}
+
+// FirstContextTranslator is like FirstTranslator, but combines
+// ContextVideoURLTranslators, passing the context of the sprite generation to
+// each of them.
+func FirstContextTranslator(translators ...ContextVideoURLTranslator) ContextVideoURLTranslator {
+	return func(ctx context.Context, videoURL string) (string, error) {
+		err := ErrUntranslatableURL
+		for _, translate := range translators {
+			var prefix string
+			if prefix, err = translate(ctx, videoURL); err == nil {
+				return prefix, nil
+			}
+		}
+		return "", err
+	}
+}
+
+// RoundRobinHosts returns a VideoURLTranslator that replaces the host of
+// the given URL with each of the given hosts in turn, spreading sprite
+// generations over multiple video-packager instances. It's meant to be used
+// with ChainTranslators.
+func RoundRobinHosts(hosts ...string) VideoURLTranslator {
+	var next uint64
+	return func(prefix string) (string, error) {
+		if len(hosts) == 0 {
+			return "", ErrUntranslatableURL
+		}
+		purl, err := url.Parse(prefix)
+		if err != nil {
+			return "", err
+		}
+		i := atomic.AddUint64(&next, 1) - 1
+		purl.Host = hosts[i%uint64(len(hosts))]
+		return purl.String(), nil
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPathRewriteTranslator(t *testing.T) {
+	t.Parallel()
+	translate := PathRewriteTranslator("http://packager/",
+		PathRewrite{Pattern: regexp.MustCompile(`^/videos/(.*)\.mp4$`), Replacement: "/thumb/$1"},
+		PathRewrite{Pattern: regexp.MustCompile(`^/live/(.*)$`), Replacement: "/live-thumb/$1"},
+	)
+	tests := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedError error
+	}{
+		{"first rule", "https://cdn/videos/2018/video.mp4", "http://packager/thumb/2018/video", nil},
+		{"second rule", "/live/channel1", "http://packager/live-thumb/channel1", nil},
+		{"query string", "/videos/video.mp4?token=abc", "http://packager/thumb/video", nil},
+		{"no match", "/images/img.jpg", "", ErrUntranslatableURL},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			prefix, err := translate(test.input)
+			if err != test.expectedError {
+				t.Errorf("wrong error returned\nwant %v\ngot  %v", test.expectedError, err)
+			}
+			if prefix != test.expected {
+				t.Errorf("wrong prefix returned\nwant %q\ngot  %q", test.expected, prefix)
+			}
+		})
+	}
+}
+
+func TestChainTranslators(t *testing.T) {
+	t.Parallel()
+	sign := func(prefix string) (string, error) {
+		return prefix + "/sig-abc", nil
+	}
+	translate := ChainTranslators(
+		PathRewriteTranslator("http://packager", PathRewrite{Pattern: regexp.MustCompile(`^/videos/(.*)$`), Replacement: "/thumb/$1"}),
+		RoundRobinHosts("packager1:8080", "packager2:8080"),
+		sign,
+	)
+	expected := []string{
+		"http://packager1:8080/thumb/video/sig-abc",
+		"http://packager2:8080/thumb/video/sig-abc",
+		"http://packager1:8080/thumb/video/sig-abc",
+	}
+	for _, want := range expected {
+		prefix, err := translate("/videos/video")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix != want {
+			t.Errorf("wrong prefix returned\nwant %q\ngot  %q", want, prefix)
+		}
+	}
+	if _, err := translate("/images/img.jpg"); err != ErrUntranslatableURL {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrUntranslatableURL, err)
+	}
+}
+
+func TestFirstTranslator(t *testing.T) {
+	t.Parallel()
+	lastErr := errors.New("no vod")
+	translate := FirstTranslator(
+		PathRewriteTranslator("http://live", PathRewrite{Pattern: regexp.MustCompile(`^/live/(.*)$`), Replacement: "/thumb/$1"}),
+		func(videoURL string) (string, error) {
+			if strings.HasPrefix(videoURL, "/vod/") {
+				return "http://vod" + videoURL, nil
+			}
+			return "", lastErr
+		},
+	)
+	tests := []struct {
+		input         string
+		expected      string
+		expectedError error
+	}{
+		{"/live/ch1", "http://live/thumb/ch1", nil},
+		{"/vod/video", "http://vod/vod/video", nil},
+		{"/other", "", lastErr},
+	}
+	for _, test := range tests {
+		prefix, err := translate(test.input)
+		if err != test.expectedError || prefix != test.expected {
+			t.Errorf("wrong result for %q\nwant %q, %v\ngot  %q, %v", test.input, test.expected, test.expectedError, prefix, err)
+		}
+	}
+	if _, err := FirstTranslator()("/live/ch1"); err != ErrUntranslatableURL {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrUntranslatableURL, err)
+	}
+}
+
+type tenantKey struct{}
+
+func TestChainContextTranslators(t *testing.T) {
+	t.Parallel()
+	tenant := func(ctx context.Context, prefix string) (string, error) {
+		return prefix + "/" + ctx.Value(tenantKey{}).(string), nil
+	}
+	translate := ChainContextTranslators(
+		PathRewriteTranslator("http://packager", PathRewrite{Pattern: regexp.MustCompile(`^/videos/(.*)$`), Replacement: "/thumb/$1"}).WithContext(),
+		tenant,
+		RoundRobinHosts("packager1:8080").WithContext(),
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, "tenant1")
+	prefix, err := translate(ctx, "/videos/video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http://packager1:8080/thumb/video/tenant1"; prefix != expected {
+		t.Errorf("wrong prefix returned\nwant %q\ngot  %q", expected, prefix)
+	}
+	if _, err := translate(ctx, "/images/img.jpg"); err != ErrUntranslatableURL {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrUntranslatableURL, err)
+	}
+}
+
+func TestFirstContextTranslator(t *testing.T) {
+	t.Parallel()
+	translate := FirstContextTranslator(
+		PathRewriteTranslator("http://live", PathRewrite{Pattern: regexp.MustCompile(`^/live/(.*)$`), Replacement: "/thumb/$1"}).WithContext(),
+		func(ctx context.Context, videoURL string) (string, error) {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			return "http://vod" + videoURL, nil
+		},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	tests := []struct {
+		input         string
+		expected      string
+		expectedError error
+	}{
+		{"/live/ch1", "http://live/thumb/ch1", nil},
+		{"/vod/video", "http://vod/vod/video", nil},
+	}
+	for _, test := range tests {
+		prefix, err := translate(ctx, test.input)
+		if err != test.expectedError || prefix != test.expected {
+			t.Errorf("wrong result for %q\nwant %q, %v\ngot  %q, %v", test.input, test.expected, test.expectedError, prefix, err)
+		}
+	}
+	cancel()
+	if _, err := translate(ctx, "/vod/video"); err != context.Canceled {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", context.Canceled, err)
+	}
+	if _, err := FirstContextTranslator()(ctx, "/live/ch1"); err != ErrUntranslatableURL {
+		t.Errorf("wrong error returned\nwant %v\ngot  %v", ErrUntranslatableURL, err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Usage describes the resources consumed by a call to the Generator. See
+// Generator.UsageHook.
+type Usage struct {
+	// Labels are the labels provided by the caller in the options of
+	// the call.
+	Labels map[string]string
+
+	// Tiles is the number of thumbnails requested by the call.
+	Tiles int
+
+	// Requests is the number of requests sent to the video-packager, and
+	// BytesDownloaded is the size of all responses.
+	Requests        int64
+	BytesDownloaded int64
+
+	// Hosts breaks the requests down per video-packager host (as in
+	// the host of the thumbnail URLs).
+	Hosts map[string]HostStats
+
+	// HeaderChecks is the number of thumbnails whose header was checked
+	// before being decoded, and HeaderRejections is the number of them
+	// rejected by the check (e.g. because they aren't JPEGs or exceed
+	// Generator.MaxThumbPixels), which weren't decoded.
+	HeaderChecks     int64
+	HeaderRejections int64
+
+	// CPUTime is an estimate of the CPU time consumed by the call: the
+	// time spent decoding, resizing and encoding images.
+	CPUTime time.Duration
+
+	// Err is the error returned by the call, if any.
+	Err error
+}
+
+// usage returns the Usage recorded in the stats.
+func (s *fetchStats) usage(labels map[string]string, tiles int, err error) Usage {
+	return Usage{
+		Labels:           labels,
+		Tiles:            tiles,
+		Requests:         atomic.LoadInt64(&s.requests),
+		BytesDownloaded:  atomic.LoadInt64(&s.bytes),
+		Hosts:            s.hostStats(),
+		HeaderChecks:     atomic.LoadInt64(&s.headerChecks),
+		HeaderRejections: atomic.LoadInt64(&s.headerRejections),
+		CPUTime:          time.Duration(atomic.LoadInt64(&s.processing)),
+		Err:              err,
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUsageHook(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	var (
+		mu     sync.Mutex
+		usages []Usage
+	)
+	generator := Generator{
+		Translator: packager.translate,
+		MaxWorkers: 2,
+		UsageHook: func(u Usage) {
+			mu.Lock()
+			defer mu.Unlock()
+			usages = append(usages, u)
+		},
+	}
+	labels := map[string]string{"tenant": "news"}
+	_, err := generator.GenSprite(GenSpriteOptions{
+		VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		End:      4 * time.Second,
+		Interval: 2 * time.Second,
+		Columns:  3,
+		Height:   72,
+		Labels:   labels,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = generator.GenPosters(GenPostersOptions{
+		VideoURL:  "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+		Timecodes: []time.Duration{0, 20 * time.Minute},
+		Height:    72,
+		Labels:    labels,
+	})
+	if err == nil {
+		t.Fatal("unexpected <nil> error")
+	}
+	if len(usages) != 2 {
+		t.Fatalf("wrong number of usages reported\nwant 2\ngot  %d", len(usages))
+	}
+	sprite, posters := usages[0], usages[1]
+	if !reflect.DeepEqual(sprite.Labels, labels) || !reflect.DeepEqual(posters.Labels, labels) {
+		t.Errorf("wrong labels\nwant %v\ngot  %v and %v", labels, sprite.Labels, posters.Labels)
+	}
+	if sprite.Tiles != 3 || sprite.Requests != 3 {
+		t.Errorf("wrong sprite usage\nwant 3 tiles and 3 requests\ngot  %d tiles and %d requests", sprite.Tiles, sprite.Requests)
+	}
+	if sprite.BytesDownloaded == 0 || sprite.CPUTime == 0 {
+		t.Errorf("bytes and CPU time weren't accounted: %#v", sprite)
+	}
+	if sprite.Err != nil {
+		t.Errorf("unexpected error in the sprite usage: %v", sprite.Err)
+	}
+	if posters.Tiles != 2 {
+		t.Errorf("wrong number of poster tiles\nwant 2\ngot  %d", posters.Tiles)
+	}
+	if posters.Err != err {
+		t.Errorf("wrong error in the posters usage\nwant %v\ngot  %v", err, posters.Err)
+	}
+}
+
+func TestUsageHookGenPoster(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	var usages []Usage
+	generator := Generator{
+		Translator: packager.translate,
+		UsageHook:  func(u Usage) { usages = append(usages, u) },
+	}
+	const videoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+	if _, err := generator.GenPoster(context.Background(), videoURL, 4*time.Second, 0, 72, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := generator.GenPoster(context.Background(), videoURL, 40*time.Second, 0, 72, 0)
+	if err == nil {
+		t.Fatal("unexpected <nil> error")
+	}
+	if len(usages) != 2 {
+		t.Fatalf("wrong number of usages reported\nwant 2\ngot  %d", len(usages))
+	}
+	poster, failed := usages[0], usages[1]
+	if poster.Tiles != 1 || poster.Requests != 1 || poster.BytesDownloaded == 0 || poster.CPUTime == 0 {
+		t.Errorf("wrong poster usage: %#v", poster)
+	}
+	if poster.Err != nil {
+		t.Errorf("unexpected error in the poster usage: %v", poster.Err)
+	}
+	if failed.Requests != 1 || failed.Err != err {
+		t.Errorf("wrong usage for the failed poster\nwant 1 request and error %v\ngot  %d requests and error %v", err, failed.Requests, failed.Err)
+	}
+}
+
+func TestUsageHookGenMosaic(t *testing.T) {
+	t.Parallel()
+	packager := startFakePackager("testdata")
+	defer packager.stop()
+	var usages []Usage
+	generator := Generator{
+		Translator: packager.translate,
+		UsageHook:  func(u Usage) { usages = append(usages, u) },
+	}
+	const videoURL = "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4"
+	labels := map[string]string{"tenant": "acme"}
+	_, err := generator.GenMosaic(GenMosaicOptions{
+		VideoURLs: []string{videoURL},
+		Timecodes: []time.Duration{0, 2 * time.Second},
+		Height:    72,
+		Labels:    labels,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = generator.GenMosaic(GenMosaicOptions{
+		VideoURLs: []string{videoURL},
+		Timecodes: []time.Duration{40 * time.Second},
+		Height:    72,
+	})
+	if err == nil {
+		t.Fatal("unexpected <nil> error")
+	}
+	if len(usages) != 2 {
+		t.Fatalf("wrong number of usages reported\nwant 2\ngot  %d", len(usages))
+	}
+	mosaic, failed := usages[0], usages[1]
+	if mosaic.Tiles != 2 || mosaic.Requests != 2 || mosaic.BytesDownloaded == 0 || mosaic.CPUTime == 0 {
+		t.Errorf("wrong mosaic usage: %#v", mosaic)
+	}
+	if !reflect.DeepEqual(mosaic.Labels, labels) {
+		t.Errorf("wrong labels\nwant %v\ngot  %v", labels, mosaic.Labels)
+	}
+	if failed.Requests != 1 || failed.Err != err {
+		t.Errorf("wrong usage for the failed mosaic\nwant 1 request and error %v\ngot  %d requests and error %v", err, failed.Requests, failed.Err)
+	}
+}
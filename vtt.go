@@ -0,0 +1,41 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WriteVTT writes a WebVTT thumbnail track describing the sprite to the given
+// writer. Each cue points to the region of the sprite, available at
+// spriteURL, that contains the thumbnail for the time range of the cue, using
+// the media fragment syntax (`#xywh=x,y,w,h`). Sprites split into multiple
+// sheets must use WriteSheetsVTT instead.
+func (r *GenSpriteResult) WriteVTT(w io.Writer, spriteURL string) error {
+	layout := r.Layout()
+	return layout.WriteVTT(w, spriteURL)
+}
+
+func writeVTT(w io.Writer, tiles []Tile, sheetURLs []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "WEBVTT\n")
+	for _, tile := range tiles {
+		if tile.Sheet >= len(sheetURLs) {
+			return ErrMissingSheetURL
+		}
+		fmt.Fprintf(bw, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(tile.Start), vttTimestamp(tile.End),
+			sheetURLs[tile.Sheet], tile.X, tile.Y, tile.Width, tile.Height)
+	}
+	return bw.Flush()
+}
+
+func vttTimestamp(d time.Duration) string {
+	millis := int64(d / time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteVTT(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Tiles: []Tile{
+			{Start: 0, End: time.Second, X: 0, Y: 0, Width: 128, Height: 72},
+			{Start: time.Second, End: 61*time.Minute + 1500*time.Millisecond, X: 128, Y: 0, Width: 128, Height: 72},
+		},
+	}
+	var buf bytes.Buffer
+	err := result.WriteVTT(&buf, "https://cdn.example.com/sprite.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `WEBVTT
+
+00:00:00.000 --> 00:00:01.000
+https://cdn.example.com/sprite.jpg#xywh=0,0,128,72
+
+00:00:01.000 --> 01:01:01.500
+https://cdn.example.com/sprite.jpg#xywh=128,0,128,72
+`
+	if buf.String() != expected {
+		t.Errorf("wrong VTT\nwant:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
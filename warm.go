@@ -0,0 +1,60 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Warm establishes the given number of connections to the video-packager at
+// the given endpoint (e.g. "https://packager.example.com"), keeping them in
+// the connection pool of the Generator, so the first sprite generation
+// doesn't pay the cost of connecting (and handshaking TLS) from all workers
+// at once. Connections are established by sending concurrent HEAD requests
+// to the endpoint, regardless of the response status.
+//
+// At most max(MaxWorkers, GOMAXPROCS+1) idle connections are kept per host,
+// so there's no point in warming more connections than that.
+func (g *Generator) Warm(ctx context.Context, endpoint string, conns int) error {
+	g.initGenerator()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, conns)
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- g.warmConn(ctx, endpoint)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Generator) warmConn(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// the body must be consumed for the connection to be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	t.Parallel()
+	var newConns, requests int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		// keeps the requests in-flight long enough for all of them
+		// to need their own connection.
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&newConns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	generator := Generator{MaxWorkers: 16}
+	if err := generator.Warm(context.Background(), server.URL, 16); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&newConns); n != 16 {
+		t.Errorf("wrong number of connections established\nwant 16\ngot  %d", n)
+	}
+
+	// all connections are idle in the pool, so warming again doesn't
+	// establish new connections.
+	if err := generator.Warm(context.Background(), server.URL, 16); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&newConns); n != 16 {
+		t.Errorf("connections weren't reused\nwant 16\ngot  %d", n)
+	}
+	if n := atomic.LoadInt64(&requests); n != 32 {
+		t.Errorf("wrong number of requests\nwant 32\ngot  %d", n)
+	}
+}
+
+func TestWarmError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	var generator Generator
+	if err := generator.Warm(context.Background(), server.URL, 2); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
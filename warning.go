@@ -0,0 +1,66 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import "fmt"
+
+// Warning describes a non-fatal condition that happened during the
+// generation of a sprite, so degraded sprites can be detected without
+// failing the generation.
+type Warning struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Severity indicates how a Warning affects the sprite.
+type Severity int
+
+const (
+	// SeverityInfo indicates conditions that don't affect the content of
+	// the sprite, such as End being clamped to the duration of the video
+	// or thumbnails being scaled locally.
+	SeverityInfo Severity = iota
+
+	// SeverityDegraded indicates that the sprite is missing content,
+	// such as tiles that failed to be fetched, were filled with the
+	// placeholder or were trimmed from the end of the range.
+	SeverityDegraded
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityDegraded: "degraded",
+}
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	if _, ok := severityNames[s]; !ok {
+		return nil, fmt.Errorf("invalid severity %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity from its name.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for severity, name := range severityNames {
+		if name == string(text) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid severity %q", text)
+}
+
+func warnf(severity Severity, format string, v ...interface{}) Warning {
+	return Warning{Severity: severity, Message: fmt.Sprintf(format, v...)}
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Francisco Souza. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenSpriteWarnings(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name           string
+		end            time.Duration
+		failAtTimecode []int64
+		duration       time.Duration
+		placeholder    bool
+		trim           bool
+		expected       []Warning
+	}{
+		{
+			name: "no warnings",
+			end:  4 * time.Second,
+		},
+		{
+			name:           "failed tiles",
+			end:            4 * time.Second,
+			failAtTimecode: []int64{2000, 4000},
+			expected: []Warning{
+				{Severity: SeverityDegraded, Message: "2 tiles failed to be fetched and were left blank"},
+			},
+		},
+		{
+			name:           "placeholder tiles",
+			end:            4 * time.Second,
+			failAtTimecode: []int64{2000},
+			placeholder:    true,
+			expected: []Warning{
+				{Severity: SeverityDegraded, Message: "1 tiles failed to be fetched and were filled with the placeholder"},
+			},
+		},
+		{
+			name:     "clamped end",
+			end:      30 * time.Second,
+			duration: 4 * time.Second,
+			expected: []Warning{
+				{Severity: SeverityInfo, Message: "End was clamped to the duration of the video (4s)"},
+			},
+		},
+		{
+			name: "trimmed tail",
+			end:  22 * time.Second,
+			trim: true,
+			expected: []Warning{
+				{Severity: SeverityDegraded, Message: "2 tiles missing at the end of the range were trimmed, the sprite ends at 20s"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.failAtTimecode = test.failAtTimecode
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+			if test.duration > 0 {
+				generator.DurationProvider = func(context.Context, string) (time.Duration, error) {
+					return test.duration, nil
+				}
+			}
+			opts := GenSpriteOptions{
+				VideoURL:        "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:             test.end,
+				Interval:        2 * time.Second,
+				Columns:         4,
+				Height:          72,
+				ContinueOnError: true,
+				TrimMissingTail: test.trim,
+			}
+			if test.placeholder {
+				opts.Placeholder = image.NewRGBA(image.Rect(0, 0, 127, 72))
+			}
+			result, err := generator.GenSpriteWithMetadata(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Warnings, test.expected) {
+				t.Errorf("wrong warnings\nwant %#v\ngot  %#v", test.expected, result.Warnings)
+			}
+		})
+	}
+}
+
+func TestWarningJSON(t *testing.T) {
+	t.Parallel()
+	data, err := json.Marshal(Warning{Severity: SeverityDegraded, Message: "something went wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"severity":"degraded","message":"something went wrong"}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON\nwant %s\ngot  %s", expected, data)
+	}
+	if _, err := Severity(42).MarshalText(); err == nil {
+		t.Error("got unexpected <nil> error when marshaling invalid severity")
+	}
+}
+
+func TestGenSpriteResultWarningsJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+	result := GenSpriteResult{
+		Tiles: []Tile{{Start: 0, End: 2 * time.Second, Width: 128, Height: 72}},
+		Warnings: []Warning{
+			{Severity: SeverityInfo, Message: "End was clamped to the duration of the video (4s)"},
+			{Severity: SeverityDegraded, Message: "1 tiles failed to be fetched and were left blank"},
+		},
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GenSpriteResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Warnings, result.Warnings) {
+		t.Errorf("wrong warnings\nwant %#v\ngot  %#v", result.Warnings, decoded.Warnings)
+	}
+
+	var warning Warning
+	err = json.Unmarshal([]byte(`{"severity":"catastrophic","message":"oops"}`), &warning)
+	if err == nil {
+		t.Error("got unexpected <nil> error when unmarshaling invalid severity")
+	}
+}
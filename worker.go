@@ -5,15 +5,18 @@
 package sprite
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -21,99 +24,397 @@ import (
 type VideoPackagerError struct {
 	StatusCode   int
 	ResponseBody []byte
+
+	// Header contains the response headers listed in
+	// Generator.CaptureHeaders, when present in the response.
+	Header http.Header
 }
 
 // Error returns the string representation of VideoPackagerError.
 func (err *VideoPackagerError) Error() string {
-	return fmt.Sprintf("invalid response from video-packager: %d - %s", err.StatusCode, err.ResponseBody)
+	msg := fmt.Sprintf("invalid response from video-packager: %d - %s", err.StatusCode, err.ResponseBody)
+	if len(err.Header) == 0 {
+		return msg
+	}
+	names := make([]string, 0, len(err.Header))
+	for name := range err.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := make([]string, len(names))
+	for i, name := range names {
+		headers[i] = name + ": " + strings.Join(err.Header[name], ", ")
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(headers, "; "))
+}
+
+// TruncatedThumbnailError is returned when the video-packager keeps sending
+// truncated thumbnails, even after the thumbnail is fetched again.
+type TruncatedThumbnailError struct {
+	URL string
+}
+
+// Error returns the string representation of TruncatedThumbnailError.
+func (err *TruncatedThumbnailError) Error() string {
+	return "truncated thumbnail received from video-packager: " + err.URL
+}
+
+// errTruncated is returned by the worker when a thumbnail is truncated, so it
+// can be fetched again.
+var errTruncated = errors.New("truncated thumbnail")
+
+// hasEndOfImage reports whether the given JPEG ends with the End Of Image
+// marker, ignoring trailing padding. Truncated JPEGs may still be decoded,
+// with the missing part of the image filled with gray.
+func hasEndOfImage(data []byte) bool {
+	data = bytes.TrimRight(data, "\x00\r\n")
+	return bytes.HasSuffix(data, []byte{0xff, 0xd9})
 }
 
 type workerInput struct {
+	index           int
 	prefix          string
 	timecode        time.Duration
 	width           uint
 	height          uint
-	letterbox       bool
+	mode            ScalingMode
+	timecodeMapper  TimecodeMapper
+	selectors       []string
+	tileHook        func(time.Duration, image.Image) (image.Image, error)
+	timestamps      *TimestampOverlay
 	continueOnError bool
+	softFail        bool
+	passthrough     bool
+	discard         bool
+	stats           *fetchStats
+	crop            *NormalizedRect
+	score           bool
+	nudge           time.Duration
+	nudgeAttempts   int
+	fallback        *fallbackPolicy
+	token           *accessToken
+	shared          *sharedThumbnails
+	keepCompressed  bool
+
+	// degraded indicates that the input is being fetched at the
+	// fallback size (see fetchSize), and must be scaled back up after
+	// decoding. width and height are still the requested dimensions,
+	// which determine the layout of the sprite.
+	degraded bool
 }
 
 func (i *workerInput) url() string {
-	milli := i.timecode.Truncate(time.Millisecond)
-	suffixParts := []string{"thumb", strconv.FormatInt(int64(milli/time.Millisecond), 10)}
-	if i.width > 0 && !i.letterbox {
-		suffixParts = append(suffixParts, fmt.Sprintf("w%d", i.width))
+	suffixParts := []string{"thumb", i.offset()}
+	width, height := i.requestSize()
+	if width > 0 {
+		suffixParts = append(suffixParts, fmt.Sprintf("w%d", width))
 	}
-	if i.height > 0 {
-		suffixParts = append(suffixParts, fmt.Sprintf("h%d", i.height))
+	if height > 0 {
+		suffixParts = append(suffixParts, fmt.Sprintf("h%d", height))
 	}
+	suffixParts = append(suffixParts, i.selectors...)
 	return fmt.Sprintf("%s/%s.jpg", strings.TrimRight(i.prefix, "/"), strings.Join(suffixParts, "-"))
 }
 
+// requestSize returns the dimensions sent when requesting the thumbnail,
+// given the scaling mode: a dimension that's derived from the source is zero.
+func (i *workerInput) requestSize() (width, height uint) {
+	mode := i.scalingMode()
+	w, h := i.fetchSize()
+	if mode == ScaleFitWidth || mode == ScaleExact || mode == ScaleLetterboxWidth {
+		width = w
+	}
+	if mode == ScaleFitHeight || mode == ScaleExact || mode == ScaleLetterbox {
+		height = h
+	}
+	return width, height
+}
+
+func (i *workerInput) offset() string {
+	if i.timecodeMapper != nil {
+		return i.timecodeMapper(i.timecode)
+	}
+	milli := i.timecode.Truncate(time.Millisecond)
+	return strconv.FormatInt(int64(milli/time.Millisecond), 10)
+}
+
 type workerOutput struct {
-	img   image.Image
-	input workerInput
+	img    image.Image
+	header http.Header
+	input  workerInput
+
+	// url is the URL of the request sent for the thumbnail, after
+	// Generator.RequestBuilder. It's empty when no request was sent.
+	url string
+
+	// latency is how long the video-packager took to respond.
+	latency time.Duration
+
+	// expires is the time when the thumbnail is no longer fresh, according
+	// to the video-packager. It's zero when unknown.
+	expires time.Time
+
+	// raw contains the JPEG returned by the video-packager, when the
+	// input is in passthrough mode and the thumbnail can be used as is.
+	// img is nil in that case.
+	raw []byte
+
+	// compressed contains the JPEG returned by the video-packager when
+	// the input keeps it (see GenSpriteOptions.LosslessJPEG) and img is
+	// that JPEG, decoded without further changes.
+	compressed []byte
+
+	// failure is the error returned by the video-packager for inputs in
+	// soft-fail mode, which don't abort the generation. img is nil in
+	// that case.
+	failure *VideoPackagerError
+
+	// scaled indicates whether the thumbnail was scaled locally because
+	// the video-packager ignored the requested dimensions.
+	scaled bool
+
+	// score is the quality of the thumbnail, when requested by the
+	// input.
+	score *tileScore
+
+	// black indicates whether the thumbnail is essentially black. It's
+	// only checked for inputs that avoid black frames.
+	black bool
 }
 
 type worker struct {
-	client *http.Client
-	group  *sync.WaitGroup
-}
-
-func (w *worker) Run(ctx context.Context, inputs <-chan workerInput, abort <-chan struct{}, imgs chan<- workerOutput, errs chan<- error) {
-	defer w.group.Done()
-	for {
-		select {
-		case input, ok := <-inputs:
-			if !ok {
-				return
-			}
-
-			img, err := w.process(ctx, input)
-			if err != nil {
-				errs <- err
-				return
-			}
-
-			select {
-			case imgs <- workerOutput{img: img, input: input}:
-			case <-ctx.Done():
-				errs <- ctx.Err()
-				return
-			case <-abort:
-				return
-			}
-		case <-ctx.Done():
-			errs <- ctx.Err()
-			return
-		case <-abort:
-			return
-		}
+	client         *http.Client
+	captureHeaders []string
+	logger         Logger
+	requestBuilder RequestBuilder
+	checksumHeader string
+	clock          Clock
+	maxThumbBytes  int64
+	maxThumbPixels int
+
+	// decoders limits the number of thumbnails decoded concurrently,
+	// shared by all workers.
+	decoders chan struct{}
+}
+
+func (w *worker) process(ctx context.Context, input workerInput) (workerOutput, error) {
+	if input.fallback != nil && !input.degraded {
+		return w.processWithFallback(ctx, input)
 	}
+	return w.processRequested(ctx, input)
 }
 
-func (w *worker) process(ctx context.Context, input workerInput) (image.Image, error) {
-	thumbURL := input.url()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, thumbURL, nil)
-	if err != nil {
-		return nil, err
+// processRequested processes the given input at its dimensions.
+func (w *worker) processRequested(ctx context.Context, input workerInput) (workerOutput, error) {
+	if input.nudge > 0 {
+		return w.processAvoidingBlack(ctx, input)
+	}
+	return w.fetchThumbnail(ctx, input)
+}
+
+// fetchThumbnail fetches the thumbnail described by the given input.
+func (w *worker) fetchThumbnail(ctx context.Context, input workerInput) (workerOutput, error) {
+	builder := w.requestBuilder
+	if builder == nil {
+		builder = defaultRequestBuilder
+	}
+	width, height := input.requestSize()
+	thumb := ThumbnailRequest{
+		URL:      input.url(),
+		Prefix:   input.prefix,
+		Timecode: input.timecode,
+		Width:    width,
+		Height:   height,
 	}
+	if output, ok := input.shared.get(thumb.URL, input); ok {
+		return output, nil
+	}
+	output, err := w.getWithAccessToken(ctx, func() (*http.Request, error) {
+		return builder.BuildRequest(ctx, thumb)
+	}, input)
+	if err == nil {
+		input.shared.put(thumb.URL, output)
+	}
+	return output, err
+}
+
+// getWithRefetch sends the request returned by newRequest, sending it again
+// when the thumbnail in the response is truncated. If the second response is
+// truncated too, getWithRefetch returns a TruncatedThumbnailError.
+func (w *worker) getWithRefetch(newRequest func() (*http.Request, error), input workerInput) (workerOutput, error) {
+	var thumbURL string
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return workerOutput{input: input}, err
+		}
+		thumbURL = req.URL.String()
+		if attempt > 0 {
+			input.stats.addRefetch()
+		}
+		output, err := w.get(req, input)
+		if err != errTruncated {
+			return output, err
+		}
+	}
+	return workerOutput{input: input}, &TruncatedThumbnailError{URL: thumbURL}
+}
+
+// get sends the given request, then decodes the thumbnail in the response,
+// adjusting it to the given input.
+func (w *worker) get(req *http.Request, input workerInput) (workerOutput, error) {
+	ctx := req.Context()
+	thumbURL := req.URL.String()
+	output := workerOutput{input: input, url: thumbURL}
+	input.stats.addRequest()
+	start := time.Now()
 	resp, err := w.client.Do(req)
+	output.latency = time.Since(start)
+	input.stats.observeResponse(req.URL.Host, output.latency, resp, err)
 	if err != nil {
-		return nil, err
+		return output, err
 	}
 	defer resp.Body.Close()
+	output.header = w.capturedHeaders(resp.Header)
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode >= http.StatusInternalServerError && input.continueOnError {
-			return nil, nil
+		if resp.StatusCode == http.StatusServiceUnavailable && input.fallback != nil && !input.degraded {
+			return output, errOriginPressure
+		}
+		if resp.StatusCode >= http.StatusInternalServerError && input.continueOnError && !input.softFail {
+			return output, nil
 		}
 		data, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return nil, err
+			return output, err
 		}
-		return nil, &VideoPackagerError{
+		pkgErr := &VideoPackagerError{
 			StatusCode:   resp.StatusCode,
 			ResponseBody: data,
+			Header:       output.header,
+		}
+		if input.softFail {
+			output.failure = pkgErr
+			return output, nil
+		}
+		return output, pkgErr
+	}
+	output.expires, _ = expiresAt(resp.Header, now(w.clock))
+	if input.discard {
+		n, err := io.Copy(ioutil.Discard, resp.Body)
+		input.stats.addBytes(n)
+		return output, err
+	}
+	data, err := w.readBody(resp)
+	input.stats.addBytes(int64(len(data)))
+	if err == io.ErrUnexpectedEOF {
+		// the body is shorter than the declared Content-Length.
+		return output, errTruncated
+	}
+	if err != nil {
+		return output, err
+	}
+	if !hasEndOfImage(data) {
+		return output, errTruncated
+	}
+	if w.checksumHeader != "" {
+		if err := verifyChecksum(resp.Header, w.checksumHeader, data); err != nil {
+			return output, fmt.Errorf("%s: %w", thumbURL, err)
+		}
+	}
+	if input.passthrough && input.canPassthrough(data) {
+		output.raw = data
+		return output, nil
+	}
+	if err := w.checkHeader(data, thumbURL, input.stats); err != nil {
+		return output, err
+	}
+	select {
+	case w.decoders <- struct{}{}:
+		defer func() { <-w.decoders }()
+	case <-ctx.Done():
+		return output, ctx.Err()
+	}
+	defer func(start time.Time) {
+		input.stats.addProcessing(time.Since(start))
+	}(time.Now())
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err == io.ErrUnexpectedEOF {
+		return output, errTruncated
+	}
+	if err != nil {
+		return output, err
+	}
+	decoded := img
+	img, output.scaled = w.fitToRequestedSize(thumbURL, img, input)
+	if input.degraded {
+		img = input.fallback.restore(img, input)
+	}
+	img = input.fitToBox(img)
+	if input.crop != nil {
+		img = crop(img, input.crop)
+	}
+	if input.score || input.nudge > 0 {
+		output.score = scoreTile(img)
+		output.black = output.score.quality.Black()
+		if !input.score {
+			output.score = nil
+		}
+	}
+	if input.tileHook != nil {
+		img, err = input.tileHook(input.timecode, img)
+		if err != nil {
+			return output, err
+		}
+	}
+	if input.timestamps != nil {
+		img = input.timestamps.render(img, input.timecode)
+	}
+	output.img = img
+	if input.keepCompressed && img == decoded {
+		output.compressed = data
+	}
+	return output, nil
+}
+
+// canPassthrough reports whether the given thumbnail is a JPEG with the
+// expected dimensions, checking only its header, so it can be used without
+// being decoded and re-encoded.
+func (i *workerInput) canPassthrough(data []byte) bool {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	bounds := image.Rect(0, 0, config.Width, config.Height)
+	width, height := i.expectedSize(bounds)
+	return config.Width <= width && config.Height <= height
+}
+
+// fitToRequestedSize handles packagers that ignore the requested dimensions
+// and return thumbnails in the resolution of the source, scaling them down to
+// the requested size. It reports whether the thumbnail had to be scaled.
+func (w *worker) fitToRequestedSize(thumbURL string, img image.Image, input workerInput) (image.Image, bool) {
+	bounds := img.Bounds()
+	width, height := input.expectedSize(bounds)
+	if bounds.Dx() <= width && bounds.Dy() <= height {
+		return img, false
+	}
+	if w.logger != nil {
+		w.logger.Printf("video-packager ignored the requested dimensions for %s: got %dx%d, scaling down to %dx%d", thumbURL, bounds.Dx(), bounds.Dy(), width, height)
+	}
+	return resize(img, width, height), true
+}
+
+// capturedHeaders returns the subset of the given headers that should be
+// captured, as configured in the generator.
+func (w *worker) capturedHeaders(header http.Header) http.Header {
+	if len(w.captureHeaders) == 0 {
+		return nil
+	}
+	captured := make(http.Header)
+	for _, name := range w.captureHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			captured[http.CanonicalHeaderKey(name)] = values
 		}
 	}
-	return jpeg.Decode(resp.Body)
+	return captured
 }
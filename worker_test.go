@@ -5,6 +5,11 @@
 package sprite
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -29,11 +34,11 @@ func TestWorkerInputURL(t *testing.T) {
 		{
 			"duration, width and height + black bars",
 			workerInput{
-				prefix:    "https://video-packager.example.com/video/t/something/",
-				width:     128,
-				height:    72,
-				timecode:  2 * time.Second,
-				letterbox: true,
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				width:    128,
+				height:   72,
+				timecode: 2 * time.Second,
+				mode:     ScaleLetterbox,
 			},
 			"https://video-packager.example.com/video/t/something/thumb-2000-h72.jpg",
 		},
@@ -73,6 +78,73 @@ func TestWorkerInputURL(t *testing.T) {
 			},
 			"https://video-packager.example.com/video/t/something/thumb-2000.jpg",
 		},
+		{
+			"source scaling mode",
+			workerInput{
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				width:    128,
+				height:   72,
+				timecode: 2 * time.Second,
+				mode:     ScaleSource,
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000.jpg",
+		},
+		{
+			"fit-width scaling mode",
+			workerInput{
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				width:    128,
+				height:   72,
+				timecode: 2 * time.Second,
+				mode:     ScaleFitWidth,
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000-w128.jpg",
+		},
+		{
+			"fit-height scaling mode",
+			workerInput{
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				width:    128,
+				height:   72,
+				timecode: 2 * time.Second,
+				mode:     ScaleFitHeight,
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000-h72.jpg",
+		},
+		{
+			"exact scaling mode",
+			workerInput{
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				width:    128,
+				height:   72,
+				timecode: 2 * time.Second,
+				mode:     ScaleExact,
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000-w128-h72.jpg",
+		},
+		{
+			"custom timecode mapper",
+			workerInput{
+				prefix:   "https://video-packager.example.com/video/t/something/",
+				height:   72,
+				timecode: 12 * time.Second,
+				timecodeMapper: func(abs time.Duration) string {
+					return strconv.FormatInt(int64((abs-10*time.Second)/time.Millisecond), 10)
+				},
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000-h72.jpg",
+		},
+		{
+			"track selectors",
+			workerInput{
+				prefix:    "https://video-packager.example.com/video/t/something/",
+				width:     128,
+				height:    72,
+				timecode:  2 * time.Second,
+				selectors: []string{"v2", "a1"},
+			},
+			"https://video-packager.example.com/video/t/something/thumb-2000-w128-h72-v2-a1.jpg",
+		},
 	}
 
 	for _, test := range tests {
@@ -99,3 +171,62 @@ func TestVideoPackagerError(t *testing.T) {
 		t.Errorf("invalid error message generated by VideoPackagerError\nwant %q\ngot  %q", expectedMsg, errMsg)
 	}
 }
+
+func TestVideoPackagerErrorWithHeaders(t *testing.T) {
+	t.Parallel()
+	var err error = &VideoPackagerError{
+		StatusCode:   500,
+		ResponseBody: []byte("nope"),
+		Header: http.Header{
+			"X-Served-By": []string{"cache-1"},
+			"X-Cache":     []string{"MISS", "MISS"},
+		},
+	}
+	const expectedMsg = "invalid response from video-packager: 500 - nope (X-Cache: MISS, MISS; X-Served-By: cache-1)"
+	errMsg := err.Error()
+	if errMsg != expectedMsg {
+		t.Errorf("invalid error message generated by VideoPackagerError\nwant %q\ngot  %q", expectedMsg, errMsg)
+	}
+}
+
+func TestGenSpriteRefetchesTruncatedThumbnails(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		truncations    int
+		truncateLength bool
+		expectedError  bool
+	}{
+		{"short read, fixed by re-fetching", 1, true, false},
+		{"missing end of image, fixed by re-fetching", 1, false, false},
+		{"short read, not fixed", 2, true, true},
+		{"missing end of image, not fixed", 2, false, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			packager := startFakePackager("testdata")
+			defer packager.stop()
+			packager.truncate = map[int64]int{2000: test.truncations}
+			packager.truncateLength = test.truncateLength
+			generator := Generator{Translator: packager.translate, MaxWorkers: 4}
+			_, err := generator.GenSprite(GenSpriteOptions{
+				VideoURL: "/video/2017/05/26/000000_1_CREDIT-SUISSE--O-_wg_360p.mp4",
+				End:      4 * time.Second,
+				Interval: 2 * time.Second,
+				Height:   72,
+			})
+			var terr *TruncatedThumbnailError
+			if isTruncated := errors.As(err, &terr); isTruncated != test.expectedError {
+				t.Fatalf("unexpected error returned: %v", err)
+			}
+			if test.expectedError && !strings.Contains(terr.URL, "thumb-2000-h72.jpg") {
+				t.Errorf("wrong URL in the error: %q", terr.URL)
+			}
+			if n := atomic.LoadInt64(&packager.requests); n != 4 {
+				t.Errorf("wrong number of requests\nwant 4\ngot  %d", n)
+			}
+		})
+	}
+}